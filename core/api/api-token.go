@@ -0,0 +1,206 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+	"strings"
+)
+
+type publicAPITokenS struct {
+	db.APITokenS
+	Active      bool
+	Permissions perms.FrontPerm
+}
+
+type publicServiceAccountS struct {
+	ID                 string
+	Email              string
+	Name               string
+	CreatedTimeStamp   int64
+	CreatedByUserEmail string
+	Teams              []string
+	Tokens             int
+}
+
+func apiTokenToFront(t *db.APITokenS) publicAPITokenS {
+	front := t.Front()
+	return publicAPITokenS{
+		APITokenS:   front,
+		Active:      front.Active(),
+		Permissions: front.Permissions.ToFrontPerm(),
+	}
+}
+
+// apiTokenOwner returns user whose tokens are managed, users manage own
+// tokens, tokens of service accounts are managed by members managers
+func apiTokenOwner(userID string, user *db.UserS) (*db.UserS, *tlog.RecordS) {
+
+	if user.Token != nil {
+		return nil, tlog.Error("API tokens can't be managed with API token")
+	}
+	if userID == "" || userID == user.ID {
+		if user.ServiceAccount {
+			return nil, tlog.Error("permission denied")
+		}
+		return user, nil
+	}
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return nil, tlog.Error("permission denied")
+	}
+	owner := db.GetUserByID(userID)
+	if owner == nil {
+		return nil, tlog.Error("user not found")
+	}
+	return owner, nil
+}
+
+func apiUserTokenList(r *http.Request, user *db.UserS) interface{} {
+
+	owner, err := apiTokenOwner(r.FormValue("UserID"), user)
+	if err != nil {
+		return err
+	}
+
+	res := []publicAPITokenS{}
+	for _, t := range db.APITokenListByUser(owner.ID) {
+		res = append(res, apiTokenToFront(t))
+	}
+	return res
+}
+
+func apiUserTokenCreate(r *http.Request, user *db.UserS) interface{} {
+
+	var data struct {
+		UserID  string
+		Name    string
+		Days    int
+		Global  map[uint8]bool
+		Env     map[string]map[uint8]bool
+		GitRepo map[string]map[uint8]bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+
+	owner, err := apiTokenOwner(data.UserID, user)
+	if err != nil {
+		return err
+	}
+	if owner.ID != user.ID && !owner.ServiceAccount {
+		return tlog.Error("tokens can be created only for yourself or service accounts")
+	}
+
+	permissions := perms.PermGroup{
+		Global:   perms.FromMap(data.Global),
+		Envs:     map[string]perms.Mask{},
+		GitRepos: map[string]perms.Mask{},
+	}
+	for k, v := range data.Env {
+		if k = strings.TrimSpace(k); k != "" {
+			permissions.Envs[k] = perms.FromMap(v)
+		}
+	}
+	for k, v := range data.GitRepo {
+		if k = strings.TrimSpace(k); k != "" {
+			permissions.GitRepos[k] = perms.FromMap(v)
+		}
+	}
+
+	value, t, err := db.APITokenCreate(owner, data.Name, data.Days, permissions, user)
+	if err != nil {
+		return err
+	}
+
+	return struct {
+		Token publicAPITokenS
+		Value string // shown only once
+	}{
+		Token: apiTokenToFront(t),
+		Value: value,
+	}
+}
+
+func apiUserTokenRevoke(r *http.Request, user *db.UserS) interface{} {
+
+	t := db.APITokenMap.Get(r.FormValue("ID"))
+	if t == nil {
+		return tlog.Error("token not found")
+	}
+	if _, err := apiTokenOwner(t.UserID, user); err != nil {
+		return err
+	}
+
+	if err := t.Revoke(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// --------------------------------------------------
+
+func apiServiceAccountList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	res := []publicServiceAccountS{}
+	for _, sa := range db.ServiceAccountList() {
+		tokens := 0
+		for _, t := range db.APITokenListByUser(sa.ID) {
+			if t.Active() {
+				tokens++
+			}
+		}
+		res = append(res, publicServiceAccountS{
+			ID:                 sa.ID,
+			Email:              sa.Email,
+			Name:               sa.Name,
+			CreatedTimeStamp:   sa.CreatedTimeStamp,
+			CreatedByUserEmail: sa.CreatedByUserEmail,
+			Teams:              sa.Teams.List(),
+			Tokens:             tokens,
+		})
+	}
+	return res
+}
+
+func apiServiceAccountCreate(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) || user.Token != nil {
+		return tlog.Error("permission denied")
+	}
+
+	sa, err := db.ServiceAccountCreate(r.FormValue("Name"), user)
+	if err != nil {
+		return err
+	}
+	return publicServiceAccountS{
+		ID:                 sa.ID,
+		Email:              sa.Email,
+		Name:               sa.Name,
+		CreatedTimeStamp:   sa.CreatedTimeStamp,
+		CreatedByUserEmail: sa.CreatedByUserEmail,
+		Teams:              []string{},
+	}
+}
+
+func apiServiceAccountDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) || user.Token != nil {
+		return tlog.Error("permission denied")
+	}
+
+	sa := db.GetUserByID(r.FormValue("ID"))
+	if sa == nil {
+		return tlog.Error("service account not found")
+	}
+	if err := db.ServiceAccountDelete(sa, user); err != nil {
+		return err
+	}
+	return "ok"
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"core/config"
+	"core/db2"
+	"crypto/tls"
+	"errors"
+	"lib/tlog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// apiCert keeps certificate of web UI domain, it is swapped without restart
+// when certificate in db changes (renewed by certprovider or synced from FP).
+var apiCert = &apiCertS{}
+
+type apiCertS struct {
+	mu     sync.RWMutex
+	certID string
+	cert   *tls.Certificate
+}
+
+func (c *apiCertS) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.cert == nil {
+		return nil, errors.New("certificate not loaded")
+	}
+	return c.cert, nil
+}
+
+// Reload loads current certificate of web UI domain if it has changed
+func (c *apiCertS) Reload() {
+	cert := db2.DomainGetByID(db2.TheDomain.ID()).Cert()
+	if cert.NotValid() {
+		cert = db2.TheDomain.Cert()
+	}
+
+	c.mu.RLock()
+	same := c.cert != nil && c.certID == cert.ID()
+	c.mu.RUnlock()
+	if same {
+		return
+	}
+
+	if time.Now().Unix() > cert.ExpirationTime() {
+		tlog.Error("certificate of {{domain}} has expired", tlog.Vars{
+			"domain": db2.TheDomain.Name(),
+			"certID": cert.ID(),
+		})
+	}
+
+	keyPair, err := tls.X509KeyPair([]byte(cert.Pem()), []byte(cert.Key()))
+	if err != nil {
+		tlog.Error(err, tlog.Vars{
+			"domain": db2.TheDomain.Name(),
+			"certID": cert.ID(),
+		})
+		return
+	}
+
+	c.mu.Lock()
+	c.certID = cert.ID()
+	c.cert = &keyPair
+	c.mu.Unlock()
+
+	// used by other tools
+	os.WriteFile(filepath.Join(config.DataPath(), "cert.key"), []byte(cert.Key()), 0644)
+	os.WriteFile(filepath.Join(config.DataPath(), "cert.pem"), []byte(cert.Pem()), 0644)
+
+	tlog.Info("api certificate loaded", tlog.Vars{
+		"domain":     db2.TheDomain.Name(),
+		"certID":     cert.ID(),
+		"expiration": cert.ExpirationTime(),
+	})
+}
+
+func (c *apiCertS) ReloadLoop() {
+	for {
+		time.Sleep(time.Minute)
+		c.Reload()
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"core/kube"
+	"lib/tlog"
+	"net/http"
+	"strings"
+)
+
+// apiSystemClusterList returns clusters on which envs can be placed, health
+// of clusters is visible in admin zone only
+func apiSystemClusterList(r *http.Request, user *db.UserS) interface{} {
+
+	list := kube.ClusterList()
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		for i := range list {
+			list[i].Health = kube.ClusterHealthS{}
+		}
+	}
+	return list
+}
+
+func apiSystemClusterSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return tlog.Error("Param `name` is required")
+	}
+	enabled := r.FormValue("enabled") != "false"
+	if !enabled && len(db.EnvironmentsOnCluster(name)) > 0 {
+		return tlog.Error("cluster has environments, move them to other cluster first")
+	}
+
+	// empty config keeps current one
+	if err := kube.ClusterSave(name, r.FormValue("config"), enabled); err != nil {
+		return tlog.Error(err.Error())
+	}
+
+	tlog.Info("cluster saved", tlog.Vars{
+		"cluster": name,
+		"enabled": enabled,
+		"user":    user.Email,
+		"event":   true,
+	})
+	return "ok"
+}
+
+func apiSystemClusterDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		return tlog.Error("Param `name` is required")
+	}
+	if envs := db.EnvironmentsOnCluster(name); len(envs) > 0 {
+		return tlog.Error("cluster has environments: " + strings.Join(envs, ", "))
+	}
+
+	if err := kube.ClusterDelete(name); err != nil {
+		return tlog.Error(err.Error())
+	}
+
+	tlog.Info("cluster deleted", tlog.Vars{
+		"cluster": name,
+		"user":    user.Email,
+		"event":   true,
+	})
+	return "ok"
+}
+
+// apiEnvironmentClusterSet moves env to other cluster, elements are deleted
+// from current cluster and created on the new one, `delete-volumes=true`
+// confirms that volumes of env are deleted too
+func apiEnvironmentClusterSet(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_ManageCluster) {
+		return tlog.Error("permission denied")
+	}
+
+	if err := env.ClusterMigrate(r.FormValue("cluster"), r.FormValue("delete-volumes") == "true", user); err != nil {
+		return err
+	}
+	return "ok"
+}
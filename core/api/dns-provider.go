@@ -0,0 +1,120 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"core/db2"
+	"core/dnsprovider"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+	"sort"
+)
+
+type frontDNSProvider struct {
+	ID        string
+	Name      string
+	Variant   string
+	Type      string // dnsprovider implementation, see db.DNSProviderType
+	Enabled   bool
+	Supported bool // records are managed by Timoni
+	Fields    []dnsprovider.FieldS
+	Settings  dnsprovider.Settings
+}
+
+func dnsProviderGet(r *http.Request) (db2.DNSProvider, *tlog.RecordS) {
+	id := r.FormValue("id")
+	if id == "" {
+		return nil, tlog.Error("Param `id` is required")
+	}
+	p := db2.DNSProviderGetByID(id)
+	if p.NotValid() {
+		return nil, tlog.Error("DNS provider not found: " + id)
+	}
+	return p, nil
+}
+
+func apiSystemDNSProviderList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	res := []frontDNSProvider{}
+	for _, p := range db2.DNSProviderList("", "Name", 0, 1000).Iter() {
+		x := frontDNSProvider{
+			ID:       p.ID(),
+			Name:     p.Name(),
+			Variant:  p.Variant().EN(),
+			Type:     db.DNSProviderType(p),
+			Enabled:  p.Enabled(),
+			Settings: db.DNSProviderSettingsFront(p),
+		}
+		if factory, ok := dnsprovider.Factory(x.Type); ok {
+			x.Supported = true
+			x.Fields = factory.Fields
+		}
+		res = append(res, x)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func apiSystemDNSProviderSettingsSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	p, err := dnsProviderGet(r)
+	if err != nil {
+		return err
+	}
+
+	settings := dnsprovider.Settings{}
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+
+	if err := db.DNSProviderSettingsSave(p, r.FormValue("type"), settings, user); err != nil {
+		return err
+	}
+	return db.DNSProviderSettingsFront(p)
+}
+
+func apiSystemDNSProviderRecords(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	p, err := dnsProviderGet(r)
+	if err != nil {
+		return err
+	}
+	zone := r.FormValue("zone")
+	if zone == "" {
+		return tlog.Error("Param `zone` is required")
+	}
+
+	provider, err := db.DNSProviderGet(p)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return tlog.Error("records of DNS provider are not managed by Timoni: " + p.Variant().EN())
+	}
+
+	records, e := provider.List(zone)
+	if e != nil {
+		return tlog.Error(e)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].Type < records[j].Type
+	})
+	return records
+}
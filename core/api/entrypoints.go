@@ -1,21 +1,21 @@
 package api
 
 import (
+	"core/certprovider"
 	"core/config"
 	"core/db2"
 	"core/imageregistry"
 	"core/term"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	log "lib/tlog"
 	"lib/utils"
-	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -64,6 +64,8 @@ func GetRouter() *mux.Router {
 
 	router.HandleFunc("/cli", term.Xterm)
 	router.HandleFunc("/term", term.Socket)
+	router.HandleFunc("/cli-replay", term.Replay)
+	router.HandleFunc("/term-recording", term.Recording)
 	router.PathPrefix("/term/").Handler(http.FileServer(http.Dir(config.WebPublicPath())))
 
 	imageregistry.Start(router)
@@ -80,8 +82,37 @@ func GetRouter() *mux.Router {
 	router.Handle("/api/system-resources", apiMiddleware(apiResources))
 	router.Handle("/api/system-pod-cache", apiMiddleware(apiPodCache))
 	router.Handle("/api/system-element-versions", apiMiddleware(apiAllElementVersionsMatrix))
+	router.Handle("/api/system-secrets-status", apiMiddleware(apiSystemSecretsStatus))
+	router.Handle("/api/system-secrets-reencrypt", apiMiddleware(apiSystemSecretsReEncrypt))
+	router.Handle("/api/system-secrets-rotate", apiMiddleware(apiSystemSecretsRotate))
+	router.Handle("/api/system-secret-sources", apiMiddleware(apiSystemSecretSources))
+	router.Handle("/api/system-secret-sources-refresh", apiMiddleware(apiSystemSecretSourcesRefresh))
+	router.Handle("/api/system-dns-provider-list", apiMiddleware(apiSystemDNSProviderList))
+	router.Handle("/api/system-dns-provider-settings-save", apiMiddleware(apiSystemDNSProviderSettingsSave))
+	router.Handle("/api/system-dns-provider-records", apiMiddleware(apiSystemDNSProviderRecords))
+	router.Handle("/api/system-sso-provider-list", apiMiddleware(apiSystemSSOProviderList))
+	router.Handle("/api/system-sso-provider-save", apiMiddleware(apiSystemSSOProviderSave))
+	router.Handle("/api/system-sso-provider-delete", apiMiddleware(apiSystemSSOProviderDelete))
+	router.Handle("/api/system-volume-backup-target", apiMiddleware(apiSystemVolumeBackupTarget))
+	router.Handle("/api/system-volume-backup-target-save", apiMiddleware(apiSystemVolumeBackupTargetSave))
+	router.Handle("/api/system-cluster-list", apiMiddleware(apiSystemClusterList))
+	router.Handle("/api/system-cluster-save", apiMiddleware(apiSystemClusterSave))
+	router.Handle("/api/system-cluster-delete", apiMiddleware(apiSystemClusterDelete))
+	router.Handle("/api/system-quota-list", apiMiddleware(apiSystemQuotaList))
+	router.Handle("/api/system-quota-save", apiMiddleware(apiSystemQuotaSave))
+	router.Handle("/api/system-quota-delete", apiMiddleware(apiSystemQuotaDelete))
+	router.Handle("/api/system-quota-prices-save", apiMiddleware(apiSystemQuotaPricesSave))
+	router.Handle("/api/system-schedule-calendar-list", apiMiddleware(apiSystemScheduleCalendarList))
+	router.Handle("/api/system-schedule-calendar-import", apiMiddleware(apiSystemScheduleCalendarImport))
+	router.Handle("/api/system-schedule-calendar-delete", apiMiddleware(apiSystemScheduleCalendarDelete))
 
 	router.HandleFunc("/api/user-login", apiUserLogin)
+	router.HandleFunc("/api/sso-providers", apiSSOProviders)
+	router.HandleFunc("/api/sso-login", apiSSOLogin)
+	router.HandleFunc("/api/sso-callback", apiSSOCallback)
+	router.HandleFunc("/api/sso-saml-acs", apiSSOSAMLACS)
+	router.HandleFunc("/api/sso-saml-metadata", apiSSOSAMLMetadata)
+	router.HandleFunc("/api/sso-session", apiSSOSession)
 	router.Handle("/api/user-invite", apiMiddleware(apiUserInvite))
 	router.Handle("/api/user-invite-qr", apiMiddleware(apiUserInviteQR))
 	router.Handle("/api/user-list", apiMiddleware(apiUserList))
@@ -90,6 +121,12 @@ func GetRouter() *mux.Router {
 	router.Handle("/api/user-theme", apiMiddleware(apiUserTheme))
 	router.Handle("/api/user-notification-update", apiMiddleware(userNotificationOnOff))
 	router.Handle("/api/user-auto-logout-update", apiMiddleware(apiUserAutoLogoutUpdate))
+	router.Handle("/api/user-token-list", apiMiddleware(apiUserTokenList))
+	router.Handle("/api/user-token-create", apiMiddleware(apiUserTokenCreate))
+	router.Handle("/api/user-token-revoke", apiMiddleware(apiUserTokenRevoke))
+	router.Handle("/api/service-account-list", apiMiddleware(apiServiceAccountList))
+	router.Handle("/api/service-account-create", apiMiddleware(apiServiceAccountCreate))
+	router.Handle("/api/service-account-delete", apiMiddleware(apiServiceAccountDelete))
 
 	router.Handle("/api/team-create", apiMiddleware(apiTeamCreate))
 	router.Handle("/api/team-delete", apiMiddleware(apiTeamDelete))
@@ -100,7 +137,19 @@ func GetRouter() *mux.Router {
 	router.Handle("/api/team-user-remove", apiMiddleware(apiTeamRemoveUser))
 	router.Handle("/api/team-user-add", apiMiddleware(apiTeamAddUser))
 
+	router.Handle("/api/variable-set-list", apiMiddleware(apiVariableSetList))
+	router.Handle("/api/variable-set-info", apiMiddleware(apiVariableSetInfo))
+	router.Handle("/api/variable-set-save", apiMiddleware(apiVariableSetSave))
+	router.Handle("/api/variable-set-delete", apiMiddleware(apiVariableSetDelete))
+
 	router.Handle("/api/perms-list", apiMiddleware(apiPermissionList))
+	router.Handle("/api/perms-explain", apiMiddleware(apiPermsExplain))
+	router.Handle("/api/role-list", apiMiddleware(apiRoleList))
+	router.Handle("/api/role-save", apiMiddleware(apiRoleSave))
+	router.Handle("/api/role-delete", apiMiddleware(apiRoleDelete))
+	router.Handle("/api/role-binding-list", apiMiddleware(apiRoleBindingList))
+	router.Handle("/api/role-binding-create", apiMiddleware(apiRoleBindingCreate))
+	router.Handle("/api/role-binding-delete", apiMiddleware(apiRoleBindingDelete))
 	router.Handle("/api/gitops-repo-map", apiMiddleware(apiGitOpsRepoMap))
 
 	router.Handle("/api/git-repo-create", apiMiddleware(apiGitRepoCreate))
@@ -148,11 +197,17 @@ func GetRouter() *mux.Router {
 	router.Handle("/api/env-tag-create", apiMiddleware(apiEnvironmentCreateTag))
 	router.Handle("/api/env-tag-delete", apiMiddleware(apiEnvironmentDeleteTag))
 	router.Handle("/api/env-variables", apiMiddleware(apiEnvironmentVariables))
+	router.Handle("/api/env-variable-sets", apiMiddleware(apiEnvironmentVariableSets))
 	router.Handle("/api/env-variable-get-secret", apiMiddleware(apiEnvironmentVariableGetSecret))
 	router.Handle("/api/env-pods", apiMiddleware(apiEnvironmentPods))
 	router.Handle("/api/env-rename", apiMiddleware(apiEnvironmentRename))
 	router.Handle("/api/env-schedule-set", apiMiddleware(apiEnvironmentSchedulerSet))
+	router.Handle("/api/env-schedule-rules-set", apiMiddleware(apiEnvironmentScheduleRulesSet))
 	router.Handle("/api/env-gitops-set", apiMiddleware(apiEnvironmentGitOpsSet))
+	router.Handle("/api/env-terminal-set", apiMiddleware(apiEnvironmentTerminalSet))
+	router.Handle("/api/env-cluster-set", apiMiddleware(apiEnvironmentClusterSet))
+	router.Handle("/api/env-terminal-session-list", apiMiddleware(apiEnvironmentTerminalSessionList))
+	router.Handle("/api/env-terminal-session-replay", apiMiddleware(apiEnvironmentTerminalSessionReplay))
 	router.Handle("/api/env-domain-targets", apiMiddleware(apiEnvironmentDomainTargets))
 	// router.Handle("/api/env-team-add", apiMiddleware(apiEnvironmentTeamAdd))
 	// router.Handle("/api/env-team-remove", apiMiddleware(apiEnvironmentTeamRemove))
@@ -166,18 +221,42 @@ func GetRouter() *mux.Router {
 	router.Handle("/api/env-element-map", apiMiddleware(apiEnvironmentElementMap))
 	router.Handle("/api/env-element-versions", apiMiddleware(apiEnvironmentElementVersionMap))
 	router.Handle("/api/env-element-version-change", apiMiddleware(apiEnvironmentElementVersionChange))
+	router.Handle("/api/env-element-history", apiMiddleware(apiEnvironmentElementHistory))
+	router.Handle("/api/env-element-history-diff", apiMiddleware(apiEnvironmentElementHistoryDiff))
+	router.Handle("/api/env-element-history-restore", apiMiddleware(apiEnvironmentElementHistoryRestore))
 	router.Handle("/api/env-element-commit-list", apiMiddleware(apiEnvironmentElementCommitList))
 	router.Handle("/api/env-element-docker-file", apiMiddleware(apiEnvironmentElementDockerFile))
 	router.Handle("/api/env-element-restart-pods", apiMiddleware(apiEnvironmentElementRestart))
+	router.Handle("/api/env-element-terminal", apiMiddleware(apiEnvironmentElementTerminal))
 	router.Handle("/api/env-element-delete", apiMiddleware(apiEnvironmentElementDelete))
 	router.Handle("/api/env-element-update-mode-set", apiMiddleware(apiEnvironmentElementUpdateModeSet))
 	router.Handle("/api/env-element-run-control", apiMiddleware(apiEnvironmentElementRunControl))
+	router.Handle("/api/env-element-schedule-set", apiMiddleware(apiEnvironmentElementScheduleSet))
+	router.Handle("/api/env-element-snapshot-list", apiMiddleware(apiEnvironmentElementSnapshotList))
+	router.Handle("/api/env-element-snapshot-create", apiMiddleware(apiEnvironmentElementSnapshotCreate))
+	router.Handle("/api/env-element-snapshot-delete", apiMiddleware(apiEnvironmentElementSnapshotDelete))
+	router.Handle("/api/env-element-snapshot-restore", apiMiddleware(apiEnvironmentElementSnapshotRestore))
+	router.Handle("/api/env-element-backup-list", apiMiddleware(apiEnvironmentElementBackupList))
+	router.Handle("/api/env-element-backup-create", apiMiddleware(apiEnvironmentElementBackupCreate))
+	router.Handle("/api/env-element-backup-delete", apiMiddleware(apiEnvironmentElementBackupDelete))
+	router.Handle("/api/env-element-backup-restore", apiMiddleware(apiEnvironmentElementBackupRestore))
+	router.Handle("/api/env-element-profile-list", apiMiddleware(apiEnvironmentElementProfileList))
+	router.Handle("/api/env-element-profile-download", apiMiddleware(apiEnvironmentElementProfileDownload))
+	router.Handle("/api/env-element-profile-compare", apiMiddleware(apiEnvironmentElementProfileCompare))
+	router.Handle("/api/env-drift-list", apiMiddleware(apiEnvironmentDriftList))
+	router.Handle("/api/env-quota", apiMiddleware(apiEnvironmentQuota))
+	router.Handle("/api/env-alerts", apiMiddleware(apiEnvironmentAlerts))
+	router.Handle("/api/env-alerts-set", apiMiddleware(apiEnvironmentAlertsSet))
+	router.Handle("/api/env-alert-test", apiMiddleware(apiEnvironmentAlertTest))
+	router.Handle("/api/env-alert-silence-create", apiMiddleware(apiEnvironmentAlertSilenceCreate))
+	router.Handle("/api/env-alert-silence-delete", apiMiddleware(apiEnvironmentAlertSilenceDelete))
 	router.Handle("/api/env-export-toml", apiMiddleware(apiEnvironmentExportTOML))
 
 	router.Handle("/api/env-pod-restart", apiMiddleware(apiEnvironmentPodRestart))
 
 	router.Handle("/api/env-element-actions-run", apiMiddleware(apiEnvironmentElementActionsRun))
 	router.HandleFunc("/api/entry-point-actions-status", apiActionStatus)
+	router.HandleFunc("/api/entry-point-profile-upload", apiProfileUpload)
 
 	router.Handle("/api/image-rebuild", apiMiddleware(apiImageRebuild))
 	router.Handle("/api/image-list", apiMiddleware(apiImageList))
@@ -238,30 +317,22 @@ func GetRouter() *mux.Router {
 func Loop() {
 	log.Debug("api.loop()")
 
-	domain := db2.TheDomain
-	cert := domain.Cert()
-	certLeftDays := int(math.Ceil(time.Since(time.Unix(cert.ExpirationTime(), 0)).Hours()/24)) * -1
+	apiCert.Reload()
+	go apiCert.ReloadLoop()
+	certprovider.OnRenew(func(domainName string) {
+		if domainName == db2.TheDomain.Name() {
+			apiCert.Reload()
+		}
+	})
 
-	if certLeftDays <= 0 {
-		fmt.Println("certLeftDays=", certLeftDays, cert.ID(), domain.Name())
-		os.Exit(1)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", db2.TheDomain.Port()),
+		Handler: GetRouter(),
+		TLSConfig: &tls.Config{
+			GetCertificate: apiCert.GetCertificate,
+		},
 	}
-
-	certKeyFilePath := filepath.Join(config.DataPath(), "cert.key")
-	certPemFilePath := filepath.Join(config.DataPath(), "cert.pem")
-
-	os.WriteFile(certKeyFilePath, []byte(cert.Key()), 0644)
-	os.WriteFile(certPemFilePath, []byte(cert.Pem()), 0644)
-
-	// ---
-
-	log.Fatal(http.ListenAndServeTLS(
-		fmt.Sprintf(":%d", domain.Port()),
-		certPemFilePath,
-		certKeyFilePath,
-		GetRouter(),
-	))
-
+	log.Fatal(server.ListenAndServeTLS("", ""))
 }
 
 func pemExpiry(crtData []byte) time.Time {
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+	"time"
+)
+
+// apiEnvironmentAlerts returns alert rules and routes of env with pending
+// and firing alerts and active silences
+func apiEnvironmentAlerts(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(env.ID, perms.Env_ViewMetrics) {
+		return tlog.Error("permission denied")
+	}
+
+	alerts, errors := db.EnvAlertList(env.ID)
+	return struct {
+		Config       db.EnvironmentAlertsS
+		ManagedByGit bool
+		Alerts       []db.AlertS
+		RuleErrors   map[string]string
+		Silences     []*db.AlertSilenceS
+	}{
+		Config:       env.Alerts,
+		ManagedByGit: env.GitOps.Enabled,
+		Alerts:       alerts,
+		RuleErrors:   errors,
+		Silences:     db.AlertSilenceList(env.ID),
+	}
+}
+
+// apiEnvironmentAlertsSet replaces alert rules and routes of env
+func apiEnvironmentAlertsSet(r *http.Request, user *db.UserS) interface{} {
+
+	type requestS struct {
+		EnvID  string
+		Rules  map[string]*db.AlertRuleS
+		Routes []*db.AlertRouteS
+	}
+
+	var request requestS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+
+	env := db.EnvironmentMap.Get(request.EnvID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(env.ID, perms.Env_ManageMetrics) {
+		return tlog.Error("permission denied")
+	}
+
+	err := env.SetAlerts(db.EnvironmentAlertsS{
+		Rules:  request.Rules,
+		Routes: request.Routes,
+	}, user)
+	if err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// apiEnvironmentAlertTest runs PromQL expression like alert rule of env
+func apiEnvironmentAlertTest(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if db.EnvironmentMap.Get(envID) == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_ViewMetrics) {
+		return tlog.Error("permission denied")
+	}
+	expr := r.FormValue("expr")
+	if expr == "" {
+		return tlog.Error("Param `expr` is required")
+	}
+
+	samples, err := db.AlertQuery(envID, expr)
+	if err != nil {
+		return err
+	}
+	return samples
+}
+
+func apiEnvironmentAlertSilenceCreate(r *http.Request, user *db.UserS) interface{} {
+
+	type requestS struct {
+		EnvID       string
+		Match       map[string]string
+		DurationMin int
+		Comment     string
+	}
+
+	var request requestS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+
+	env := db.EnvironmentMap.Get(request.EnvID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(env.ID, perms.Env_ManageMetrics) {
+		return tlog.Error("permission denied")
+	}
+
+	s, err := db.AlertSilenceCreate(env, request.Match, time.Duration(request.DurationMin)*time.Minute, request.Comment, user)
+	if err != nil {
+		return err
+	}
+	return s
+}
+
+func apiEnvironmentAlertSilenceDelete(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if !user.HasEnvPerm(envID, perms.Env_ManageMetrics) {
+		return tlog.Error("permission denied")
+	}
+	s := db.AlertSilenceGet(envID, r.FormValue("id"))
+	if s == nil {
+		return tlog.Error("silence not found")
+	}
+	if err := s.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"lib/tlog"
+	"net/http"
+)
+
+// apiEnvironmentDriftList returns changes of env objects made in cluster
+// outside of Timoni, which were reverted to desired state
+func apiEnvironmentDriftList(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	if db.EnvironmentMap.Get(envID) == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	return db.EnvDriftList(envID)
+}
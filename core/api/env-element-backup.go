@@ -0,0 +1,95 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"lib/tlog"
+	"net/http"
+)
+
+func apiEnvironmentElementBackupList(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	if db.EnvironmentMap.Get(envID) == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	return db.ElementBackupList(envID, r.FormValue("element"))
+}
+
+func apiEnvironmentElementBackupCreate(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return tlog.Error("Param `element` is required")
+	}
+	target := r.FormValue("target")
+	if target == "" {
+		return tlog.Error("Param `target` is required")
+	}
+
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasElementPerm(envID, elementName, perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	b, err := db.ElementBackupCreate(env, elementName, target, r.FormValue("label"), false, user)
+	if err != nil {
+		return err
+	}
+	return b
+}
+
+// elementBackupGet returns backup of env when user can manage its element
+func elementBackupGet(r *http.Request, user *db.UserS) (*db.ElementBackupS, *tlog.RecordS) {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return nil, tlog.Error("Param `env` is required")
+	}
+	b := db.ElementBackupMap.Get(r.FormValue("id"))
+	if b == nil || b.EnvID != envID {
+		return nil, tlog.Error("backup not found")
+	}
+	if !user.HasElementPerm(envID, b.ElementName, perms.Env_ElementFullManage) {
+		return nil, tlog.Error("permission denied")
+	}
+	return b, nil
+}
+
+func apiEnvironmentElementBackupDelete(r *http.Request, user *db.UserS) interface{} {
+
+	b, err := elementBackupGet(r, user)
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+func apiEnvironmentElementBackupRestore(r *http.Request, user *db.UserS) interface{} {
+
+	b, err := elementBackupGet(r, user)
+	if err != nil {
+		return err
+	}
+	if err := b.Restore(user); err != nil {
+		return err
+	}
+	return "ok"
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"core/db"
+	perms "core/db/permissions"
+	"crypto/subtle"
+	"io"
+	"lib/tlog"
+	"net/http"
+	"strconv"
+)
+
+// apiProfileUpload receives profile pulled by entry-point of pod with
+// `[profiling]`, authorized by profiling token of element
+func apiProfileUpload(w http.ResponseWriter, r *http.Request) {
+	env := db.EnvironmentMap.Get(r.FormValue("envID"))
+	if env == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("envID is invalid"))
+		return
+	}
+
+	element := env.GetElement(r.FormValue("elementName"))
+	if element == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("elementName is invalid"))
+		return
+	}
+
+	profiling := db.ElementProfilingGet(element)
+	if profiling == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("profiling of element is disabled"))
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(profiling.Token)) != 1 {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("token is invalid"))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 32<<20))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if errx := db.ElementProfileSave(env, element, r.FormValue("pod"), r.FormValue("version"), r.FormValue("type"), data); errx != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(errx.Message))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// profileElementGet returns env ID and element name of request when user
+// can view metrics of element
+func profileElementGet(r *http.Request, user *db.UserS) (string, string, *tlog.RecordS) {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return "", "", tlog.Error("Param `env` is required")
+	}
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return "", "", tlog.Error("Param `element` is required")
+	}
+	if db.EnvironmentMap.Get(envID) == nil {
+		return "", "", tlog.Error("environment not found")
+	}
+	if !user.HasElementPerm(envID, elementName, perms.Env_ViewMetrics) {
+		return "", "", tlog.Error("permission denied")
+	}
+	return envID, elementName, nil
+}
+
+func apiEnvironmentElementProfileList(r *http.Request, user *db.UserS) interface{} {
+
+	envID, elementName, err := profileElementGet(r, user)
+	if err != nil {
+		return err
+	}
+	return db.ElementProfileList(envID, elementName, r.FormValue("type"))
+}
+
+// apiEnvironmentElementProfileDownload returns single profile by `id` or
+// merged profiles of `type` and `version`, the result is readable by
+// `go tool pprof`
+func apiEnvironmentElementProfileDownload(r *http.Request, user *db.UserS) interface{} {
+
+	envID, elementName, err := profileElementGet(r, user)
+	if err != nil {
+		return err
+	}
+
+	if id := r.FormValue("id"); id != "" {
+		p := db.ElementProfileMap.Get(id)
+		if p == nil || p.EnvID != envID || p.ElementName != elementName {
+			return tlog.Error("profile not found")
+		}
+		buf, err := p.Data()
+		if err != nil {
+			return err
+		}
+		return bytes.NewReader(buf)
+	}
+
+	profileType := r.FormValue("type")
+	if profileType == "" {
+		return tlog.Error("Param `type` is required")
+	}
+	buf, err := db.ElementProfileMergeData(envID, elementName, profileType, r.FormValue("version"))
+	if err != nil {
+		return err
+	}
+	return bytes.NewReader(buf)
+}
+
+// apiEnvironmentElementProfileCompare compares profiles of `type` of `base`
+// and `target` versions of element
+func apiEnvironmentElementProfileCompare(r *http.Request, user *db.UserS) interface{} {
+
+	envID, elementName, err := profileElementGet(r, user)
+	if err != nil {
+		return err
+	}
+
+	profileType := r.FormValue("type")
+	if profileType == "" {
+		return tlog.Error("Param `type` is required")
+	}
+	base := r.FormValue("base")
+	target := r.FormValue("target")
+	if base == "" || target == "" {
+		return tlog.Error("Params `base` and `target` are required")
+	}
+	top, _ := strconv.Atoi(r.FormValue("top"))
+	if top <= 0 {
+		top = 30
+	}
+
+	res, err := db.ElementProfileCompare(envID, elementName, profileType, base, target, top)
+	if err != nil {
+		return err
+	}
+	return res
+}
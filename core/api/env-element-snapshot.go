@@ -0,0 +1,138 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+)
+
+func apiEnvironmentElementSnapshotList(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	if db.EnvironmentMap.Get(envID) == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	return db.ElementSnapshotList(envID, r.FormValue("element"))
+}
+
+func apiEnvironmentElementSnapshotCreate(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return tlog.Error("Param `element` is required")
+	}
+
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasElementPerm(envID, elementName, perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	s, err := db.ElementSnapshotCreate(env, elementName, r.FormValue("label"), r.FormValue("export") == "true", false, user)
+	if err != nil {
+		return err
+	}
+	return s
+}
+
+// elementSnapshotGet returns snapshot of env when user can manage its element
+func elementSnapshotGet(r *http.Request, user *db.UserS) (*db.ElementSnapshotS, *tlog.RecordS) {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return nil, tlog.Error("Param `env` is required")
+	}
+	s := db.ElementSnapshotMap.Get(r.FormValue("id"))
+	if s == nil || s.EnvID != envID {
+		return nil, tlog.Error("snapshot not found")
+	}
+	if !user.HasElementPerm(envID, s.ElementName, perms.Env_ElementFullManage) {
+		return nil, tlog.Error("permission denied")
+	}
+	return s, nil
+}
+
+func apiEnvironmentElementSnapshotDelete(r *http.Request, user *db.UserS) interface{} {
+
+	s, err := elementSnapshotGet(r, user)
+	if err != nil {
+		return err
+	}
+	if err := s.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// apiEnvironmentElementSnapshotRestore restores snapshot into element of the
+// same env or, with `targetEnv`, into element of other env (eg. its clone)
+func apiEnvironmentElementSnapshotRestore(r *http.Request, user *db.UserS) interface{} {
+
+	s, err := elementSnapshotGet(r, user)
+	if err != nil {
+		return err
+	}
+
+	targetID := r.FormValue("targetEnv")
+	if targetID == "" {
+		targetID = s.EnvID
+	}
+	target := db.EnvironmentMap.Get(targetID)
+	if target == nil {
+		return tlog.Error("target environment not found")
+	}
+	if !user.HasElementPerm(targetID, s.ElementName, perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	if err := s.Restore(target, user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// --------------------------------------------------
+
+func apiSystemVolumeBackupTarget(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	t := db.VolumeBackupTargetGet()
+	if t == nil {
+		return db.VolumeBackupTargetS{}
+	}
+	return t.Front()
+}
+
+func apiSystemVolumeBackupTargetSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	t := &db.VolumeBackupTargetS{}
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+	if err := db.VolumeBackupTargetSave(t, user); err != nil {
+		return err
+	}
+	return t.Front()
+}
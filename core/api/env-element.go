@@ -36,14 +36,14 @@ func apiEnvironmentElementCreateFromGitRepo(r *http.Request, user *db.UserS) int
 		return tlog.Error("envNotFound")
 	}
 
-	if !user.HasEnvPerm(data.EnvID, perms.Env_ElementFullManage) {
-		return tlog.Error("permissionDenied")
-	}
-
 	if data.Name == "" {
 		return tlog.Error("`Name` is required")
 	}
 
+	if !user.HasElementPerm(data.EnvID, data.Name, perms.Env_ElementFullManage) {
+		return tlog.Error("permissionDenied")
+	}
+
 	if data.GitID == "" {
 		return tlog.Error("`GitID` is required")
 	}
@@ -88,7 +88,7 @@ func apiEnvironmentElementCreateFromTOML(r *http.Request, user *db.UserS) interf
 		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) {
 		return tlog.Error("permission denied")
 	}
 
@@ -113,6 +113,14 @@ func apiEnvironmentElementCreateFromTOML(r *http.Request, user *db.UserS) interf
 		return err2
 	}
 
+	if errs := el.SchemaErrors(); errs.Err() != nil {
+		// returned as Details with per field errors, see apiEncodeResponse
+		return tlog.Error("wystapił problem", tlog.Vars{
+			"Message": "element variables do not match their schema",
+			"Fields":  errs,
+		})
+	}
+
 	err2 = env.ElementAdd(
 		elementName,
 		el,
@@ -145,7 +153,7 @@ func apiEnvironmentElementUpdateFromTOML(r *http.Request, user *db.UserS) interf
 		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) {
 		return tlog.Error("permission denied")
 	}
 
@@ -203,8 +211,9 @@ func apiEnvironmentElementUpdateFromTOML(r *http.Request, user *db.UserS) interf
 }
 
 type ElementMapToFrontS struct {
-	Info   interface{}
-	Status db.ElementStatusS
+	Info    interface{}
+	Status  db.ElementStatusS
+	Metrics *db.ElementPodMetricsS // I/O, network and OOM from node-agent
 }
 
 func apiEnvironmentElementMap(r *http.Request, user *db.UserS) interface{} {
@@ -229,8 +238,9 @@ func apiEnvironmentElementMap(r *http.Request, user *db.UserS) interface{} {
 	for _, elName := range env.Elements.Keys() {
 		element := env.ElementCloneWithoutSecrets(elName)
 		elements[elName] = ElementMapToFrontS{
-			Info:   element,
-			Status: *element.GetStatus(),
+			Info:    element,
+			Status:  *element.GetStatus(),
+			Metrics: db.ElementMetricsGet(env.ID, elName),
 		}
 	}
 
@@ -263,6 +273,124 @@ func apiEnvironmentElementVersionMap(r *http.Request, user *db.UserS) interface{
 	return env.ElementVersionMap(elementName)
 }
 
+func apiEnvironmentElementHistory(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		tlog.Error("środowisko nie zostało odnalezione", tlog.Vars{
+			"env": envID,
+		})
+		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
+	}
+
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return tlog.Error("Param `element` is required")
+	}
+	if !env.Elements.Exists(elementName) {
+		return tlog.Error("element does not exist")
+	}
+
+	versions, err := env.ElementHistoryList(elementName)
+	if err != nil {
+		return err
+	}
+	return versions
+}
+
+// apiEnvironmentElementHistoryDiff compares two versions of element,
+// params `from` and `to` are versions from apiEnvironmentElementHistory.
+func apiEnvironmentElementHistoryDiff(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		tlog.Error("środowisko nie zostało odnalezione", tlog.Vars{
+			"env": envID,
+		})
+		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
+	}
+
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return tlog.Error("Param `element` is required")
+	}
+	if !env.Elements.Exists(elementName) {
+		return tlog.Error("element does not exist")
+	}
+
+	from := r.FormValue("from")
+	if from == "" {
+		return tlog.Error("Param `from` is required")
+	}
+	to := r.FormValue("to")
+	if to == "" {
+		to = db.ElementHistoryCurrent
+	}
+
+	diff, err := env.ElementHistoryDiff(elementName, from, to)
+	if err != nil {
+		return err
+	}
+	return diff
+}
+
+func apiEnvironmentElementHistoryRestore(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		tlog.Error("środowisko nie zostało odnalezione", tlog.Vars{
+			"env": envID,
+		})
+		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
+	}
+
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	if env.GitOps.Enabled {
+		return tlog.Error("GitOps is enabled")
+	}
+
+	elementName := r.FormValue("element")
+	if elementName == "" {
+		return tlog.Error("Param `element` is required")
+	}
+	if !env.Elements.Exists(elementName) {
+		return tlog.Error("element does not exist")
+	}
+
+	version := r.FormValue("version")
+	if version == "" {
+		return tlog.Error("Param `version` is required")
+	}
+
+	if err := env.ElementHistoryRestore(elementName, version, user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
 func apiEnvironmentElementCommitList(r *http.Request, user *db.UserS) interface{} {
 
 	envID := r.FormValue("env")
@@ -354,8 +482,10 @@ func apiEnvironmentElementDockerFile(r *http.Request, user *db.UserS) interface{
 		return tlog.Error("env not found")
 	}
 
-	if !user.HasEnvPerm(env.ID, perms.Env_ElementFullManage) {
-		return tlog.Error("permission denied")
+	for _, elementName := range data.Elements {
+		if !user.HasElementPerm(env.ID, elementName, perms.Env_ElementFullManage) {
+			return tlog.Error("permission denied")
+		}
 	}
 
 	res := map[string]string{}
@@ -418,7 +548,7 @@ func apiEnvironmentElementRestart(r *http.Request, user *db.UserS) interface{} {
 	}
 
 	// XXX: ImageBuilder = temporary workaround
-	if user.ID != "ImageBuilder" && !user.HasEnvPerm(envID, perms.Env_ElementStartStopRestart) {
+	if user.ID != "ImageBuilder" && !user.HasElementPerm(envID, elementName, perms.Env_ElementStartStopRestart) {
 		return tlog.Error("permission denied")
 	}
 
@@ -449,7 +579,7 @@ func apiEnvironmentPodRestart(r *http.Request, user *db.UserS) interface{} {
 		return tlog.Error("env not found")
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementStartStopRestart) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementStartStopRestart) {
 		return tlog.Error("permission denied")
 	}
 
@@ -496,7 +626,7 @@ func apiEnvironmentElementDelete(r *http.Request, user *db.UserS) interface{} {
 		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) {
 		return tlog.Error("permission denied")
 	}
 
@@ -531,7 +661,7 @@ func apiEnvironmentElementUpdateModeSet(r *http.Request, user *db.UserS) interfa
 		return tlog.Error("env not found")
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) {
 		return tlog.Error("permission denied")
 	}
 
@@ -592,7 +722,7 @@ func apiEnvironmentElementVersionChange(r *http.Request, user *db.UserS) interfa
 		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) && !user.HasEnvPerm(envID, perms.Env_ElementVersionChangeOnly) {
+	if !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementFullManage) && !user.HasElementPerm(envID, r.FormValue("element"), perms.Env_ElementVersionChangeOnly) {
 		return tlog.Error("permission denied")
 	}
 
@@ -657,6 +787,12 @@ func apiEnvironmentElementRunControl(r *http.Request, user *db.UserS) interface{
 		elements = env.Elements.Keys()
 	}
 
+	for _, elementName := range elements {
+		if !user.HasElementPerm(env.ID, elementName, perms.Env_ElementStartStopRestart) {
+			return tlog.Error("permission denied")
+		}
+	}
+
 	for _, elementName := range elements {
 		element := env.GetElement(elementName)
 
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+)
+
+// apiEnvironmentScheduleRulesSet sets TTL, idle sleep and blackout calendars
+// of env
+func apiEnvironmentScheduleRulesSet(r *http.Request, user *db.UserS) interface{} {
+
+	type requestS struct {
+		EnvID        string
+		ExpireTime   int64 // unix, 0 = never
+		IdleSleepMin int   // 0 = disabled
+		Calendars    []string
+	}
+
+	var request requestS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+
+	env := db.EnvironmentMap.Get(request.EnvID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(env.ID, perms.Env_ManageSchedule) {
+		return tlog.Error("permission denied")
+	}
+
+	if err := env.SetScheduleRules(request.ExpireTime, request.IdleSleepMin, request.Calendars, user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// apiEnvironmentElementScheduleSet sets own schedule of element, empty
+// schedule makes element follow schedule of env
+func apiEnvironmentElementScheduleSet(r *http.Request, user *db.UserS) interface{} {
+
+	type requestS struct {
+		EnvID    string
+		Element  string
+		Schedule *db.ElementScheduleS
+	}
+
+	var request requestS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+
+	env := db.EnvironmentMap.Get(request.EnvID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasElementPerm(env.ID, request.Element, perms.Env_ManageSchedule) {
+		return tlog.Error("permission denied")
+	}
+	element := env.GetElement(request.Element)
+	if element == nil {
+		return tlog.Error("element not found")
+	}
+
+	if err := env.SetElementSchedule(element, request.Schedule, user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+func apiSystemScheduleCalendarList(r *http.Request, user *db.UserS) interface{} {
+	return db.ScheduleCalendarList()
+}
+
+// apiSystemScheduleCalendarImport imports iCal file from body or from URL
+func apiSystemScheduleCalendarImport(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	type requestS struct {
+		Name     string
+		URL      string
+		Timezone string
+		ICal     string
+	}
+
+	var request requestS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+
+	c, err := db.ScheduleCalendarImport(request.Name, request.URL, request.Timezone, []byte(request.ICal), user)
+	if err != nil {
+		return err
+	}
+	return c
+}
+
+func apiSystemScheduleCalendarDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		return tlog.Error("Param `name` is required")
+	}
+	if err := db.ScheduleCalendarDelete(name, user); err != nil {
+		return err
+	}
+	return "ok"
+}
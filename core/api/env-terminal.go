@@ -0,0 +1,127 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"core/term"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+)
+
+// apiEnvironmentElementTerminal returns one-time link to terminal of element
+func apiEnvironmentElementTerminal(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+
+	ticket, err := term.TicketCreate(user, env, r.FormValue("element"), r.FormValue("pod"), r.FormValue("debug") == "true")
+	if err != nil {
+		return err
+	}
+	return struct {
+		URL string
+	}{
+		URL: "/cli?ticket=" + ticket,
+	}
+}
+
+func apiEnvironmentTerminalSet(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+
+	var request db.EnvironmentTerminalS
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return tlog.Error("Bad request", tlog.Vars{
+			"error": err.Error(),
+		})
+	}
+	if request.IdleTimeoutMin < 0 || request.IdleTimeoutMin > 24*60 {
+		return tlog.Error("idle timeout must be from 0 to 1440 minutes")
+	}
+
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+
+	// same managers who see terminal sessions of env
+	if !user.HasEnvPerm(envID, perms.Env_ManageMembers) && !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	env.Terminal = request
+	if err := env.Save(user); err != nil {
+		return err
+	}
+
+	tlog.Info("env terminal policy changed", tlog.Vars{
+		"env":          env.ID,
+		"disabled":     env.Terminal.Disabled,
+		"idle-timeout": env.Terminal.IdleTimeout().String(),
+		"user":         user.Email,
+		"event":        true,
+	})
+	return "ok"
+}
+
+// terminal sessions can be seen by its user and by members managers
+func canViewTermSession(user *db.UserS, s *db.TermSessionS) bool {
+	if user.HasGlobPerm(perms.Glob_AccessToAdminZone) || user.HasEnvPerm(s.EnvID, perms.Env_ManageMembers) {
+		return true
+	}
+	return s.UserID == user.ID && user.HasElementPerm(s.EnvID, s.ElementName, perms.Env_ElementTerminal)
+}
+
+func apiEnvironmentTerminalSessionList(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+
+	res := []*db.TermSessionS{}
+	for _, s := range db.TermSessionList(envID) {
+		if canViewTermSession(user, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// apiEnvironmentTerminalSessionReplay returns one-time link to player of
+// recorded session
+func apiEnvironmentTerminalSessionReplay(r *http.Request, user *db.UserS) interface{} {
+
+	s := db.TermSessionGet(r.FormValue("id"))
+	if s == nil || !canViewTermSession(user, s) {
+		return tlog.Error("session not found")
+	}
+
+	ticket, err := term.ReplayTicketCreate(user, s)
+	if err != nil {
+		return err
+	}
+
+	tlog.Info("terminal session replayed", tlog.Vars{
+		"env":        s.EnvID,
+		"session-id": s.ID,
+		"owner":      s.UserEmail,
+		"user":       user.Email,
+		"event":      true,
+	})
+	return struct {
+		URL string
+	}{
+		URL: "/cli-replay?ticket=" + ticket,
+	}
+}
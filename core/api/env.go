@@ -5,6 +5,7 @@ import (
 	"core/db/permissions"
 	perms "core/db/permissions"
 	"core/db2"
+	"core/kube"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -38,8 +39,9 @@ func apiEnvironmentShortMap2(r *http.Request, user *db.UserS) interface{} {
 }
 
 type envPost struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"` // empty = local cluster
 	// Teams []string `json:"teams"`
 }
 
@@ -60,9 +62,14 @@ func apiEnvironmentCreate2(r *http.Request, user *db.UserS) interface{} {
 		return tlog.Error("`name` is required")
 	}
 
+	if envP.Cluster != "" && !kube.ClusterExists(envP.Cluster) {
+		return tlog.Error("cluster not found or disabled")
+	}
+
 	env := db.EnvironmentS{
-		ID:   envP.ID,
-		Name: envP.Name,
+		ID:          envP.ID,
+		Name:        envP.Name,
+		ClusterName: envP.Cluster,
 	}
 
 	err := env.Create(user)
@@ -241,6 +248,11 @@ func apiEnvironmentInfo(r *http.Request, user *db.UserS) interface{} {
 		}
 	}
 
+	dashboard, elementDashboards := "", map[string]string{}
+	if user.HasEnvPerm(env.ID, perms.Env_ViewMetrics) {
+		dashboard, elementDashboards = env.DashboardLinks()
+	}
+
 	// --------------------
 
 	return struct {
@@ -252,6 +264,12 @@ func apiEnvironmentInfo(r *http.Request, user *db.UserS) interface{} {
 		Teams               map[string]bool
 		Members             map[string]map[string]bool
 		URLs                map[string]string
+		Dependencies        db.EnvDependencyGraphS
+		ScheduleBlackout    string                           // event of blackout calendar lasting now
+		SLO                 map[string]*db.ElementSLOStatusS // key=domain element name
+		AutoUpdateBlockedBy string                           // domain element with exhausted error budget
+		Dashboard           string                           // Grafana dashboard of env
+		ElementDashboards   map[string]string                // key=element name
 	}{
 		Env:                 tmp,
 		Alerts:              alerts,
@@ -261,6 +279,12 @@ func apiEnvironmentInfo(r *http.Request, user *db.UserS) interface{} {
 		Teams:               envTeams,
 		Members:             envMembers,
 		URLs:                urls,
+		Dependencies:        env.DependencyGraph(),
+		ScheduleBlackout:    env.ScheduleBlackout(),
+		SLO:                 env.SLOStatus(),
+		AutoUpdateBlockedBy: env.SLOBlocksAutoUpdate(),
+		Dashboard:           dashboard,
+		ElementDashboards:   elementDashboards,
 	}
 }
 
@@ -289,7 +313,12 @@ func apiEnvironmentClone(r *http.Request, user *db.UserS) interface{} {
 		return tlog.Error("Param `targetName` is required")
 	}
 
-	clonedEnv, err := env.Clone(user, id, name)
+	withData := r.FormValue("withData") == "true"
+	if withData && !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	clonedEnv, err := env.Clone(user, id, name, withData)
 	if err != nil {
 		return err
 	}
@@ -300,9 +329,11 @@ func apiEnvironmentClone(r *http.Request, user *db.UserS) interface{} {
 	}
 
 	tlog.Info("env cloned", tlog.Vars{
-		"env":   env.ID,
-		"event": true,
-		"user":  user.Email,
+		"env":       env.ID,
+		"target":    clonedEnv.ID,
+		"with-data": withData,
+		"event":     true,
+		"user":      user.Email,
 	})
 
 	return clonedEnv.ID
@@ -417,7 +448,7 @@ func apiEnvironmentVariableGetSecret(r *http.Request, user *db.UserS) interface{
 	elementName := r.FormValue("element")
 	variableName := r.FormValue("variable")
 
-	if !user.HasEnvPerm(envID, perms.Env_CopyAndViewSecrets) {
+	if !user.HasElementPerm(envID, elementName, perms.Env_CopyAndViewSecrets) {
 		return tlog.Error("permission denied")
 	}
 
@@ -638,7 +669,7 @@ func apiEnvironmentElementScale(r *http.Request, user *db.UserS) interface{} {
 		return tlog.Error("element is a debug element")
 	}
 
-	if !user.HasEnvPerm(data.EnvID, perms.Env_ElementFullManage) {
+	if !user.HasElementPerm(data.EnvID, data.Element, perms.Env_ElementFullManage) {
 		return tlog.Error("permission denied")
 	}
 
@@ -703,16 +734,18 @@ func apiEnvironmentElementStaticScaling(r *http.Request, user *db.UserS) interfa
 		return tlog.Error("env not found")
 	}
 
-	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
-		return tlog.Error("permission denied")
-	}
-
 	elements := map[string]int{}
 	err := json.NewDecoder(r.Body).Decode(&elements)
 	if err != nil {
 		return tlog.Error("Bad request")
 	}
 
+	for elementName := range elements {
+		if !user.HasElementPerm(envID, elementName, perms.Env_ElementFullManage) {
+			return tlog.Error("permission denied")
+		}
+	}
+
 	for elementName, scale := range elements {
 		element := env.GetElement(elementName)
 		if element == nil {
@@ -810,5 +843,9 @@ func apiEnvironmentExportTOML(r *http.Request, user *db.UserS) interface{} {
 		out = append(out, "")
 	}
 
+	if alerts := env.Alerts.TOML(); alerts != "" {
+		out = append(out, alerts)
+	}
+
 	return base64.StdEncoding.EncodeToString([]byte(strings.Join(out, "\n")))
 }
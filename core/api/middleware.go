@@ -107,7 +107,11 @@ func apiMiddleware(fn func(r *http.Request, user *db.UserS) interface{}) http.Ha
 		sessionID := r.Header.Get("Session")
 		var user *db.UserS
 
-		if sessionID == db2.TheImageBuilder.Timoni_Token() {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			// API token (CI, automation)
+			user = getTokenUser(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), r, w)
+
+		} else if sessionID == db2.TheImageBuilder.Timoni_Token() {
 			// Image Builder
 			user = &db.UserS{
 				ID:       "ImageBuilder",
@@ -223,6 +227,44 @@ func getUser(sessionID string, r *http.Request, w http.ResponseWriter) *db.UserS
 	return user
 }
 
+func getTokenUser(token string, r *http.Request, w http.ResponseWriter) *db.UserS {
+
+	userIP := net.RequestIP(r)
+
+	user, err := db.APITokenAuth(token, userIP)
+	if err != nil {
+		tlog.Warning("API token refused", tlog.Vars{
+			"logger":  "apiMiddleware",
+			"url":     r.URL,
+			"user-ip": userIP,
+			"error":   err.Message,
+		})
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(apiEncodeResponse(err, r.URL.String()))
+		return nil
+	}
+
+	if user.Teams.Exists(db.BlacklistedTeamName) {
+		tlog.Warning("user is blacklisted", tlog.Vars{
+			"logger":     "apiMiddleware",
+			"url":        r.URL,
+			"user-ip":    userIP,
+			"user-email": user.Email,
+			"token-id":   user.Token.ID,
+		})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(apiEncodeResponse(
+			tlog.Error("user is blacklisted"),
+			r.URL.String(),
+		))
+		return nil
+	}
+
+	cloudHttpRequests.WithLabelValues(r.URL.Path, user.Email).Inc()
+
+	return user
+}
+
 func apiGitOnBoard(w http.ResponseWriter, r *http.Request) {
 	token := r.FormValue("token")
 	userObj := db.GetUserByID(token)
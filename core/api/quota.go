@@ -0,0 +1,108 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+)
+
+// apiSystemQuotaList returns quotas of envs and tags with unit prices of
+// cost estimates
+func apiSystemQuotaList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	return struct {
+		Quotas []*db.EnvQuotaS
+		Prices *db.EnvQuotaPricesS
+	}{
+		Quotas: db.QuotaList(),
+		Prices: db.QuotaPricesGet(),
+	}
+}
+
+func apiSystemQuotaSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	q := &db.EnvQuotaS{}
+	if err := json.NewDecoder(r.Body).Decode(q); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+	if err := db.QuotaSave(q, user); err != nil {
+		return err
+	}
+	return q
+}
+
+func apiSystemQuotaDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	key := r.FormValue("key")
+	if key == "" {
+		return tlog.Error("Param `key` is required")
+	}
+	if err := db.QuotaDelete(key, user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+func apiSystemQuotaPricesSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	p := &db.EnvQuotaPricesS{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+	if err := db.QuotaPricesSave(p, user); err != nil {
+		return err
+	}
+	return p
+}
+
+// apiEnvironmentQuota returns limits of env with usage declared by its
+// elements and cost in current month
+func apiEnvironmentQuota(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		return tlog.Error("environment not found")
+	}
+	if !user.HasEnvPerm(envID, perms.Env_View) {
+		return tlog.Error("permission denied")
+	}
+
+	quota := env.Quota()
+	if quota != nil && !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		quota.AlertEmails = nil
+	}
+
+	return struct {
+		Quota    *db.EnvQuotaS
+		Usage    db.EnvQuotaUsageS
+		Cost     *db.EnvCostS
+		Currency string
+	}{
+		Quota:    quota,
+		Usage:    env.QuotaUsage(nil),
+		Cost:     db.EnvCostGet(envID),
+		Currency: db.QuotaPricesGet().Currency,
+	}
+}
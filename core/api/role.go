@@ -0,0 +1,227 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+	"time"
+)
+
+type frontRoleS struct {
+	ID             string
+	Name           string
+	Description    string
+	Global         map[string]perms.PermExplained
+	Env            map[string]perms.PermExplained
+	Repo           map[string]perms.PermExplained
+	UpdateTime     int64
+	UpdatedByEmail string
+}
+
+type frontRoleBindingS struct {
+	db.RoleBindingS
+	RoleName string
+	Subject  string
+	Active   bool
+}
+
+func roleToFront(r *db.RoleS) frontRoleS {
+	return frontRoleS{
+		ID:             r.ID,
+		Name:           r.Name,
+		Description:    r.Description,
+		Global:         perms.GlobMaskToFront(r.Global),
+		Env:            perms.EnvMaskToFront(r.Env),
+		Repo:           perms.RepoMaskToFront(r.Repo),
+		UpdateTime:     r.UpdateTime,
+		UpdatedByEmail: r.UpdatedByEmail,
+	}
+}
+
+func apiRoleList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	res := []frontRoleS{}
+	for _, role := range db.RoleList() {
+		res = append(res, roleToFront(role))
+	}
+	return res
+}
+
+func apiRoleSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	var data struct {
+		ID          string
+		Name        string
+		Description string
+		Global      map[uint8]bool
+		Env         map[uint8]bool
+		Repo        map[uint8]bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+
+	role := &db.RoleS{
+		ID:          data.ID,
+		Name:        data.Name,
+		Description: data.Description,
+		Global:      perms.FromMap(data.Global),
+		Env:         perms.FromMap(data.Env),
+		Repo:        perms.FromMap(data.Repo),
+	}
+	if err := role.Save(user); err != nil {
+		return err
+	}
+	return roleToFront(role)
+}
+
+func apiRoleDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	role := db.RoleMap.Get(r.FormValue("ID"))
+	if role == nil {
+		return tlog.Error("role not found")
+	}
+	if err := role.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// --------------------------------------------------
+
+func apiRoleBindingList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	teamID := r.FormValue("TeamID")
+	userID := r.FormValue("UserID")
+
+	res := []frontRoleBindingS{}
+	for _, b := range db.RoleBindingMap.Values() {
+		if teamID != "" && b.TeamID != teamID || userID != "" && b.UserID != userID {
+			continue
+		}
+		front := frontRoleBindingS{
+			RoleBindingS: *b,
+			Subject:      b.Subject(),
+			Active:       b.Active(),
+		}
+		if role := db.RoleMap.Get(b.RoleID); role != nil {
+			front.RoleName = role.Name
+		}
+		res = append(res, front)
+	}
+	return res
+}
+
+func apiRoleBindingCreate(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	var data struct {
+		RoleID      string
+		TeamID      string
+		UserID      string
+		Scope       string
+		Element     string
+		Deny        bool
+		ExpiresTime int64
+		Hours       int // break-glass: expires after hours, instead of ExpiresTime
+		Reason      string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+	if data.Hours < 0 {
+		return tlog.Error("invalid number of hours")
+	}
+	if data.Hours > 0 {
+		data.ExpiresTime = time.Now().Add(time.Duration(data.Hours) * time.Hour).Unix()
+	}
+	if data.ExpiresTime != 0 && data.Reason == "" && !data.Deny {
+		return tlog.Error("reason is required for time-bound grant")
+	}
+
+	b := &db.RoleBindingS{
+		RoleID:      data.RoleID,
+		TeamID:      data.TeamID,
+		UserID:      data.UserID,
+		Scope:       data.Scope,
+		Element:     data.Element,
+		Deny:        data.Deny,
+		ExpiresTime: data.ExpiresTime,
+		Reason:      data.Reason,
+	}
+	if err := b.Create(user); err != nil {
+		return err
+	}
+	return b
+}
+
+func apiRoleBindingDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	b := db.RoleBindingMap.Get(r.FormValue("ID"))
+	if b == nil {
+		return tlog.Error("role binding not found")
+	}
+	if err := b.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// --------------------------------------------------
+
+// apiPermsExplain says why user has or lacks permission, eg.
+// /api/perms-explain?perm=Env_ElementStartStopRestart&env=env-xxx&element=postgres
+func apiPermsExplain(r *http.Request, user *db.UserS) interface{} {
+
+	subject := user
+	if email := r.FormValue("user"); email != "" && email != user.Email {
+		if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+			return tlog.Error("permission denied")
+		}
+		subject = db.GetUserByEmail(email)
+		if subject == nil {
+			return tlog.Error("user not found")
+		}
+	}
+
+	perm := r.FormValue("perm")
+	if perm == "" {
+		return tlog.Error("Param `perm` is required")
+	}
+
+	target := r.FormValue("env")
+	if target == "" {
+		target = r.FormValue("repo")
+	}
+
+	res, err := subject.ExplainPerm(perm, target, r.FormValue("element"))
+	if err != nil {
+		return err
+	}
+	return res
+}
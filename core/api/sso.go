@@ -0,0 +1,260 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"core/db2"
+	"core/sso"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"lib/tlog"
+	"lib/utils/maps"
+	"lib/utils/net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type ssoLoginS struct {
+	ProviderID string
+	Login      sso.LoginS
+}
+
+// ssoCodeS is one-time code passed to webui after login, exchanged for
+// session by /api/sso-session (session ID never appears in URL)
+type ssoCodeS struct {
+	UserID  string
+	Expires time.Time // session
+	Created time.Time
+}
+
+var (
+	ssoLogins = maps.NewSafe[string, ssoLoginS](nil) // key=state
+	ssoCodes  = maps.NewSafe[string, ssoCodeS](nil)  // key=code
+)
+
+type publicSSOProviderS struct {
+	ID   string
+	Name string
+}
+
+func ssoCleanup() {
+	for _, k := range ssoLogins.Keys() {
+		if l, ok := ssoLogins.GetFull(k); ok && l.Login.Expired() {
+			ssoLogins.Delete(k)
+		}
+	}
+	for _, k := range ssoCodes.Keys() {
+		if c, ok := ssoCodes.GetFull(k); ok && time.Since(c.Created) > time.Minute {
+			ssoCodes.Delete(k)
+		}
+	}
+}
+
+// ssoRedirectError returns user to login page with error message
+func ssoRedirectError(w http.ResponseWriter, r *http.Request, msg string) {
+	http.Redirect(w, r, "/login?sso-error="+url.QueryEscape(msg), http.StatusFound)
+}
+
+// apiSSOProviders returns enabled SSO providers shown on login page
+func apiSSOProviders(w http.ResponseWriter, r *http.Request) {
+	res := []publicSSOProviderS{}
+	for _, p := range db.SSOProviderList(db2.TheOrganization.ID()) {
+		if p.Enabled {
+			res = append(res, publicSSOProviderS{ID: p.ID, Name: p.Name})
+		}
+	}
+	buf, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(buf)
+}
+
+// apiSSOLogin redirects user to identity provider
+func apiSSOLogin(w http.ResponseWriter, r *http.Request) {
+	p := db.SSOProviderGet(r.FormValue("id"))
+	if p == nil || !p.Enabled || p.OrganizationID != db2.TheOrganization.ID() {
+		ssoRedirectError(w, r, "SSO provider not found")
+		return
+	}
+	provider, err := p.Provider()
+	if err != nil {
+		ssoRedirectError(w, r, err.Message)
+		return
+	}
+
+	authURL, login, e := provider.AuthURL(r.Context())
+	if e != nil {
+		tlog.Error(e, tlog.Vars{
+			"provider": p.Name,
+		})
+		ssoRedirectError(w, r, "identity provider is not available")
+		return
+	}
+
+	ssoCleanup()
+	ssoLogins.Set(login.State, ssoLoginS{ProviderID: p.ID, Login: login})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// apiSSOCallback is OIDC redirect URI
+func apiSSOCallback(w http.ResponseWriter, r *http.Request) {
+	ssoFinish(w, r, r.FormValue("state"))
+}
+
+// apiSSOSAMLACS is SAML assertion consumer service (HTTP-POST binding)
+func apiSSOSAMLACS(w http.ResponseWriter, r *http.Request) {
+	ssoFinish(w, r, r.FormValue("RelayState"))
+}
+
+func ssoFinish(w http.ResponseWriter, r *http.Request, state string) {
+	l, ok := ssoLogins.GetFull(state)
+	if !ok {
+		ssoRedirectError(w, r, "login expired, try again")
+		return
+	}
+	ssoLogins.Delete(state)
+
+	p := db.SSOProviderGet(l.ProviderID)
+	if p == nil || !p.Enabled {
+		ssoRedirectError(w, r, "SSO provider not found")
+		return
+	}
+	provider, err := p.Provider()
+	if err != nil {
+		ssoRedirectError(w, r, err.Message)
+		return
+	}
+
+	identity, e := provider.Callback(r.Context(), r, l.Login)
+	if e != nil {
+		tlog.Warning("SSO login failed", tlog.Vars{
+			"provider": p.Name,
+			"error":    e.Error(),
+			"user-ip":  net.RequestIP(r),
+		})
+		ssoRedirectError(w, r, e.Error())
+		return
+	}
+
+	user, err := p.Login(identity)
+	if err != nil {
+		tlog.Warning("SSO login refused", tlog.Vars{
+			"provider": p.Name,
+			"email":    identity.Email,
+			"error":    err.Message,
+			"user-ip":  net.RequestIP(r),
+		})
+		ssoRedirectError(w, r, err.Message)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		ssoRedirectError(w, r, err.Error())
+		return
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+	ssoCodes.Set(code, ssoCodeS{
+		UserID:  user.ID,
+		Expires: p.SessionExpires(identity),
+		Created: time.Now(),
+	})
+	http.Redirect(w, r, "/login?sso="+code, http.StatusFound)
+}
+
+// apiSSOSession exchanges one-time code for session, response is the same
+// as /api/user-login
+func apiSSOSession(w http.ResponseWriter, r *http.Request) {
+	res := struct {
+		Error   string `json:"error"`
+		Session string `json:"session,omitempty"`
+	}{}
+
+	code := r.FormValue("code")
+	c, ok := ssoCodes.GetFull(code)
+	ssoCodes.Delete(code)
+
+	if !ok || time.Since(c.Created) > time.Minute {
+		res.Error = "login expired, try again"
+	} else if db.GetUserByID(c.UserID) == nil {
+		res.Error = "user not found"
+	} else {
+		sess := db.SessionCreate(c.UserID, r)
+		if c.Expires.Before(sess.Expires) {
+			sess.Expires = c.Expires
+			sess.Update()
+		}
+		res.Session = sess.ID
+	}
+
+	buf, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-control", "no-store")
+	w.Write(buf)
+}
+
+// apiSSOSAMLMetadata returns metadata of Timoni as SAML service provider
+func apiSSOSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	p := db.SSOProviderGet(r.FormValue("id"))
+	if p == nil {
+		http.Error(w, "SSO provider not found", http.StatusNotFound)
+		return
+	}
+	buf, err := p.SAMLMetadata()
+	if err != nil {
+		http.Error(w, err.Message, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(buf)
+}
+
+// --------------------------------------------------
+
+func apiSystemSSOProviderList(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	res := []db.SSOProviderS{}
+	for _, p := range db.SSOProviderList(db2.TheOrganization.ID()) {
+		res = append(res, p.Front())
+	}
+	return res
+}
+
+func apiSystemSSOProviderSave(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	p := &db.SSOProviderS{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+	p.OrganizationID = db2.TheOrganization.ID()
+
+	if err := p.Save(user); err != nil {
+		return err
+	}
+	return p.Front()
+}
+
+func apiSystemSSOProviderDelete(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return tlog.Error("permission denied")
+	}
+
+	p := db.SSOProviderGet(r.FormValue("id"))
+	if p == nil || p.OrganizationID != db2.TheOrganization.ID() {
+		return tlog.Error("SSO provider not found")
+	}
+	if err := p.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"core/db"
+	"core/db/envelope"
 	perms "core/db/permissions"
+	"core/db/secretsource"
 	"core/imagebuilder"
 	"core/kube"
 	"encoding/json"
@@ -10,6 +12,7 @@ import (
 	"lib/utils/conv"
 	"lib/utils/maps"
 	"math"
+	"net"
 	"net/http"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -202,6 +205,17 @@ func apiResources(r *http.Request, user *db.UserS) interface{} {
 type metrics struct {
 	CPU float64
 	RSS float64
+
+	// from cgroup v2, see node-agent/cgroup.go
+	CPUThrottled float64 // % of time
+	WorkingSet   float64 // KiB
+	MemLimit     float64 // KiB
+	DiskRead     float64 // KiB/s
+	DiskWrite    float64
+	NetRx        float64
+	NetTx        float64
+	OOMKills     float64
+	Restarts     float64
 }
 
 func apiPodCache(r *http.Request, user *db.UserS) interface{} {
@@ -212,6 +226,7 @@ func apiPodCache(r *http.Request, user *db.UserS) interface{} {
 	}
 
 	defer r.Body.Close()
+	source, _, _ := net.SplitHostPort(r.RemoteAddr)
 	go func() {
 		for envID, elements := range metrics {
 			// var cpu, mem float64
@@ -225,6 +240,17 @@ func apiPodCache(r *http.Request, user *db.UserS) interface{} {
 					continue
 				}
 				env.GetElement(elementName).SetMetrics(elementMetrics.CPU, math.Floor(elementMetrics.RSS)/1024)
+				db.ElementMetricsSet(source, envID, elementName, db.ElementPodMetricsS{
+					CPUThrottledPC: elementMetrics.CPUThrottled,
+					WorkingSetMB:   math.Floor(elementMetrics.WorkingSet) / 1024,
+					MemLimitMB:     math.Floor(elementMetrics.MemLimit) / 1024,
+					DiskReadKBs:    elementMetrics.DiskRead,
+					DiskWriteKBs:   elementMetrics.DiskWrite,
+					NetRxKBs:       elementMetrics.NetRx,
+					NetTxKBs:       elementMetrics.NetTx,
+					OOMKills:       int(elementMetrics.OOMKills),
+					Restarts:       int(elementMetrics.Restarts),
+				})
 			}
 		}
 	}()
@@ -319,3 +345,60 @@ func apiAllElementVersionsMatrix(r *http.Request, user *db.UserS) interface{} {
 		Data:    data,
 	}
 }
+
+func apiSystemSecretsStatus(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	return envelope.Status()
+}
+
+func apiSystemSecretsReEncrypt(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	return db.SecretsReEncrypt(user)
+}
+
+func apiSystemSecretsRotate(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_ManageSystem) {
+		return tlog.Error("permission denied")
+	}
+
+	res, err := db.SecretsRotateMasterKey(user)
+	if err != nil {
+		return err
+	}
+	return res
+}
+
+func apiSystemSecretSources(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	return map[string]interface{}{
+		"Providers": secretsource.Providers(),
+		"Sources":   secretsource.Status(),
+	}
+}
+
+func apiSystemSecretSourcesRefresh(r *http.Request, user *db.UserS) interface{} {
+
+	if !user.HasGlobPerm(perms.Glob_AccessToAdminZone) {
+		return tlog.Error("permission denied")
+	}
+
+	tlog.Info("external secrets refresh", tlog.Vars{
+		"user":  user.Email,
+		"event": true,
+	})
+	secretsource.RefreshNow(true, db.ExternalSecretChanged)
+	return secretsource.Status()
+}
@@ -30,6 +30,7 @@ type publicUserS struct {
 	CreatedTimeStamp    int64
 	Logout              int8
 	LastActionTimeStamp int64
+	ServiceAccount      bool
 
 	CanCreate         bool
 	HideGitRepoLocal  bool
@@ -55,6 +56,7 @@ func apiUserList(r *http.Request, user *db.UserS) interface{} {
 			AutoLogout:          u.Value.Logout,
 			CreatedTimeStamp:    u.Value.CreatedTimeStamp,
 			LastActionTimeStamp: u.Value.LastActionTimeStamp,
+			ServiceAccount:      u.Value.ServiceAccount,
 			Teams:               u.Value.Teams.List(),
 		}
 
@@ -84,6 +86,18 @@ func apiUserLogin(w http.ResponseWriter, r *http.Request) {
 	token := r.FormValue("token")
 	user := db.GetUserByEmail(email)
 	isAdmin := false
+
+	// organization admins can always log in with token (SSO misconfiguration)
+	if !organizationAdmin(email) {
+		if p := db.SSOProviderForEmail(email); p != nil || user != nil && db.SSOUserManaged(user) {
+			fmt.Fprint(w, `{"error": "use SSO login"}`)
+			return
+		}
+	}
+	if user != nil && user.ServiceAccount {
+		fmt.Fprint(w, `{"error": "service account can not log in"}`)
+		return
+	}
 	if user == nil {
 		// registration
 
@@ -153,6 +167,19 @@ func apiUserLogin(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, `{"error": "","session": "`+sess.ID+`"}`)
 }
 
+func organizationAdmin(email string) bool {
+	org := fp.OrganizationGetByID(db2.TheOrganization.ID())
+	if org.NotValid() {
+		return false
+	}
+	for _, admin := range org.Admins().Iter() {
+		if email == admin.Email() {
+			return true
+		}
+	}
+	return false
+}
+
 func apiUserInvite(r *http.Request, user *db.UserS) interface{} {
 
 	if !user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
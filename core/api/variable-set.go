@@ -0,0 +1,164 @@
+package api
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type frontVariableSet struct {
+	db.VariableSetS
+	TeamName string
+	CanEdit  bool
+	Affected []db.VariableSetUsageS
+}
+
+func frontVariableSetGet(set *db.VariableSetS, user *db.UserS, withAffected bool) frontVariableSet {
+	res := frontVariableSet{
+		VariableSetS: set.Front(),
+		CanEdit:      user.CanManageVariableSet(set),
+	}
+	if team := db.TeamMap.Get(set.TeamID); team != nil {
+		res.TeamName = team.Name
+	}
+	if withAffected {
+		res.Affected = db.VariableSetAffected(set.Name)
+	}
+	return res
+}
+
+func apiVariableSetList(r *http.Request, user *db.UserS) interface{} {
+
+	res := []frontVariableSet{}
+	for _, set := range db.VariableSetMap.Values() {
+		if !user.CanUseVariableSet(set) {
+			continue
+		}
+		res = append(res, frontVariableSetGet(set, user, false))
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func apiVariableSetInfo(r *http.Request, user *db.UserS) interface{} {
+
+	name := r.FormValue("name")
+	if name == "" {
+		return tlog.Error("Param `name` is required")
+	}
+
+	set := db.VariableSetMap.Get(name)
+	if set == nil {
+		return tlog.Error("variable set not found: " + name)
+	}
+	if !user.CanUseVariableSet(set) {
+		return tlog.Error("permission denied")
+	}
+
+	return frontVariableSetGet(set, user, true)
+}
+
+func apiVariableSetSave(r *http.Request, user *db.UserS) interface{} {
+
+	set := &db.VariableSetS{}
+	if err := json.NewDecoder(r.Body).Decode(set); err != nil {
+		return tlog.Error("Invalid JSON")
+	}
+
+	old := db.VariableSetMap.Get(set.Name)
+	if old != nil && !user.CanManageVariableSet(old) {
+		return tlog.Error("permission denied")
+	}
+	if !user.CanManageVariableSet(set) {
+		// team members can create sets of their team only,
+		// organization sets require Glob_ManageGlobalMemebers
+		return tlog.Error("permission denied")
+	}
+
+	affected, err := set.Save(user)
+	if err != nil {
+		return err
+	}
+	return affected
+}
+
+func apiVariableSetDelete(r *http.Request, user *db.UserS) interface{} {
+
+	name := r.FormValue("name")
+	if name == "" {
+		return tlog.Error("Param `name` is required")
+	}
+
+	set := db.VariableSetMap.Get(name)
+	if set == nil {
+		return tlog.Error("variable set not found: " + name)
+	}
+	if !user.CanManageVariableSet(set) {
+		return tlog.Error("permission denied")
+	}
+
+	if err := set.Delete(user); err != nil {
+		return err
+	}
+	return "ok"
+}
+
+// apiEnvironmentVariableSets sets variable sets imported by all elements of environment
+func apiEnvironmentVariableSets(r *http.Request, user *db.UserS) interface{} {
+
+	envID := r.FormValue("env")
+	if envID == "" {
+		return tlog.Error("Param `env` is required")
+	}
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		tlog.Error("środowisko nie zostało odnalezione", tlog.Vars{
+			"env": envID,
+		})
+		return tlog.Error("środowisko nie zostało odnalezione: " + envID)
+	}
+
+	if !user.HasEnvPerm(envID, perms.Env_ElementFullManage) {
+		return tlog.Error("permission denied")
+	}
+
+	if env.GitOps.Enabled {
+		return tlog.Error("GitOps is enabled")
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(r.FormValue("sets"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		set := db.VariableSetMap.Get(name)
+		if set == nil {
+			return tlog.Error("variable set not found: " + name)
+		}
+		if !user.CanUseVariableSet(set) {
+			return tlog.Error("permission denied to variable set: " + name)
+		}
+		names = append(names, name)
+	}
+
+	env.VariableSets = names
+	if err := env.Save(user); err != nil {
+		return err
+	}
+	env.ReRender("")
+
+	tlog.Info("env variable sets changed", tlog.Vars{
+		"env":   env.ID,
+		"sets":  names,
+		"event": true,
+		"user":  user.Email,
+	})
+
+	return "ok"
+}
@@ -0,0 +1,97 @@
+package certprovider
+
+import (
+	"core/config"
+	"core/db"
+	"core/db2"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+)
+
+// newClient returns ACME client with registered account of cert provider.
+// Empty LetsEncrypt_URL means Let's Encrypt production directory.
+func newClient(provider db2.CertProvider) (*lego.Client, error) {
+
+	email := provider.LetsEncrypt_Email()
+	if email == "" {
+		return nil, errors.New("cert provider " + provider.Name() + ": LetsEncrypt_Email is required")
+	}
+
+	caDirURL := provider.LetsEncrypt_URL()
+	if caDirURL == "" {
+		caDirURL = lego.LEDirectoryProduction
+	}
+
+	user, err := db.GetAcmeUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.CADirURL != caDirURL {
+		// registration from other CA is not valid
+		user.Registration = nil
+		user.CADirURL = caDirURL
+	}
+
+	conf := lego.NewConfig(user)
+	conf.CADirURL = caDirURL
+	conf.Certificate.KeyType = certcrypto.EC256
+	conf.UserAgent = "timoni/" + config.GitTag
+
+	client, err := lego.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Registration == nil {
+		reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+		if err != nil {
+			return nil, fmt.Errorf("account registration: %w", err)
+		}
+		user.Registration = reg
+		if err := user.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// obtain requests new certificate for domain, DNS-01 challenge is used when
+// domain has DNS provider which supports it, otherwise HTTP-01 through traefik.
+func obtain(domain db2.Domain) (*certificate.Resource, error) {
+
+	client, err := newClient(domain.CertProvider())
+	if err != nil {
+		return nil, err
+	}
+
+	if dns := newDNSChallenge(domain.DNSProvider()); dns != nil {
+		err = client.Challenge.SetDNS01Provider(dns)
+	} else {
+		err = client.Challenge.SetHTTP01Provider(httpChallenge)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{domain.Name()},
+		Bundle:  true,
+	})
+}
+
+// renewBefore returns how long before expiration cert of domain should be renewed
+func renewBefore(domain db2.Domain) time.Duration {
+	days := domain.CertRenewBeforeDays()
+	if days <= 0 {
+		days, _ = strconv.ParseInt(config.AcmeDefaultRenewDays(), 10, 64)
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,86 @@
+package certprovider
+
+import (
+	"core/db2"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRenewPebble renews certificate of domain in Pebble through HTTP-01
+// challenge served by httpChallenge. Test is skipped without Pebble, run it with:
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//	PEBBLE_URL=https://localhost:14000/dir LEGO_CA_CERTIFICATES=test/certs/pebble.minica.pem go test ./certprovider/
+func TestRenewPebble(t *testing.T) {
+	dirURL := os.Getenv("PEBBLE_URL")
+	if dirURL == "" {
+		t.Skip("PEBBLE_URL is not set")
+	}
+	domain := testDomain(t, "pebble.timoni.test", dirURL)
+
+	// Pebble validates HTTP-01 on httpPort of its config directly
+	t.Setenv("AcmeChallengeIngress", "false")
+	srv := &http.Server{Addr: ":5002", Handler: httpChallenge}
+	go srv.ListenAndServe()
+	defer srv.Close()
+
+	if err := Renew(domain, false); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+
+	if httpChallenge.tokens.Len() != 0 {
+		t.Errorf("challenge tokens left after renew: %d", httpChallenge.tokens.Len())
+	}
+
+	saved := db2.DomainGetByID(domain.ID())
+	if saved.CertRenewError() != "" {
+		t.Errorf("CertRenewError() = %q", saved.CertRenewError())
+	}
+	pemData := []byte(saved.Cert().Pem())
+	if expiry := PemExpiry(pemData); !expiry.After(time.Now()) {
+		t.Fatalf("PemExpiry() = %v, want time in future", expiry)
+	}
+	block, _ := pem.Decode(pemData)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname(domain.Name()); err != nil {
+		t.Error(err)
+	}
+
+	// registered account is reused
+	if err := Renew(domain, true); err != nil {
+		t.Fatalf("Renew() with registered account error = %v", err)
+	}
+}
+
+func TestDomainLock(t *testing.T) {
+	lock := domainLock("a.timoni.test")
+	lock.Lock()
+	defer lock.Unlock()
+
+	if domainLock("a.timoni.test") != lock {
+		t.Fatal("domainLock() returned other lock for same domain")
+	}
+	if domainLock("a.timoni.test").TryLock() {
+		t.Error("renew of domain is not locked")
+	}
+
+	other := domainLock("b.timoni.test")
+	if !other.TryLock() {
+		t.Fatal("renew of other domain is blocked")
+	}
+	other.Unlock()
+}
+
+func TestPemExpiry(t *testing.T) {
+	if !PemExpiry([]byte("not a pem")).IsZero() {
+		t.Error("PemExpiry() of invalid data is not zero")
+	}
+}
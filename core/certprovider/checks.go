@@ -0,0 +1,17 @@
+package certprovider
+
+import (
+	"core/db2"
+	"strings"
+)
+
+func Check() (db2.StateT, string) {
+	errs := []string{}
+	for _, domain := range db2.DomainList("Enabled = true AND CertRenewError != ''", "", 0, 1000).Iter() {
+		errs = append(errs, domain.Name()+": "+domain.CertRenewError())
+	}
+	if len(errs) > 0 {
+		return db2.State_error, strings.Join(errs, "; ")
+	}
+	return db2.State_ready, ""
+}
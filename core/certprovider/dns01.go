@@ -0,0 +1,65 @@
+package certprovider
+
+import (
+	"core/config"
+	"core/db"
+	"core/db2"
+	"core/dnsprovider"
+	"strconv"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// dnsChallengeS creates TXT records of DNS-01 challenge using domain DNS provider
+type dnsChallengeS struct {
+	provider dnsprovider.Provider
+}
+
+// newDNSChallenge returns nil when DNS provider can't be used for DNS-01,
+// records of `Timoni` provider are managed by Focal Point.
+func newDNSChallenge(provider db2.DNSProvider) *dnsChallengeS {
+	p, _ := db.DNSProviderGet(provider)
+	if p == nil {
+		return nil
+	}
+	return &dnsChallengeS{provider: p}
+}
+
+func (c *dnsChallengeS) record(domain, keyAuth string) (string, dnsprovider.RecordS, error) {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	zone, err := dns01.FindZoneByFqdn(fqdn)
+	if err != nil {
+		return "", dnsprovider.RecordS{}, err
+	}
+	return dns01.UnFqdn(zone), dnsprovider.RecordS{
+		Type:  dnsprovider.TypeTXT,
+		Name:  dns01.UnFqdn(fqdn),
+		Value: value,
+		TTL:   60,
+	}, nil
+}
+
+func (c *dnsChallengeS) Present(domain, token, keyAuth string) error {
+	zone, record, err := c.record(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	return c.provider.Upsert(zone, record)
+}
+
+func (c *dnsChallengeS) CleanUp(domain, token, keyAuth string) error {
+	zone, record, err := c.record(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	return c.provider.Delete(zone, record)
+}
+
+func (c *dnsChallengeS) Timeout() (timeout, interval time.Duration) {
+	sec, _ := strconv.Atoi(config.AcmeDNSPropagationSec())
+	if sec <= 0 {
+		sec = 120
+	}
+	return time.Duration(sec) * time.Second, 5 * time.Second
+}
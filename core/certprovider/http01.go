@@ -0,0 +1,149 @@
+package certprovider
+
+import (
+	"core/config"
+	"core/kube"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+)
+
+const (
+	challengeNamespace   = "timoni"
+	challengeServiceName = "core-acme"
+)
+
+// httpChallenge serves HTTP-01 tokens on AcmeHTTPPort, traefik routes
+// `/.well-known/acme-challenge/` of domain to it while challenge is pending.
+var httpChallenge = &httpChallengeS{
+	tokens: maps.NewSafe[string, string](nil),
+}
+
+type httpChallengeS struct {
+	tokens *maps.SafeMap[string, string] // key=token, value=keyAuth
+}
+
+func (c *httpChallengeS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, http01.ChallengePath(""))
+	if token == r.URL.Path || token == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	keyAuth, ok := c.tokens.GetFull(token)
+	if !ok {
+		tlog.Warning("unknown ACME challenge token", tlog.Vars{
+			"host":  r.Host,
+			"token": token,
+		})
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+func (c *httpChallengeS) Present(domain, token, keyAuth string) error {
+	c.tokens.Set(token, keyAuth)
+	if config.AcmeChallengeIngress() != "true" {
+		// CA connects to AcmeHTTPPort directly, eg. Pebble with -httpPort
+		return nil
+	}
+
+	port, _ := strconv.Atoi(config.AcmeHTTPPort())
+	ingress := kube.Ingress2S{
+		KubeClient: kube.GetKube(),
+		Namespace:  challengeNamespace,
+		Name:       challengeIngressName(domain),
+		Domain:     domain,
+		Labels: map[string]string{
+			"manager": "timoni",
+			"element": challengeServiceName,
+		},
+		Paths: map[string]*kube.DomainPathS{
+			http01.ChallengePath(""): {
+				ElementName: challengeServiceName,
+				Port:        int32(port),
+			},
+		},
+	}
+	if _, err := ingress.CreateOrUpdate(); err != nil {
+		return fmt.Errorf("challenge ingress: %s", err.Message)
+	}
+
+	c.waitForRoute(domain, token)
+	return nil
+}
+
+func (c *httpChallengeS) CleanUp(domain, token, keyAuth string) error {
+	c.tokens.Delete(token)
+	if config.AcmeChallengeIngress() != "true" {
+		return nil
+	}
+
+	ingress := kube.Ingress2S{
+		KubeClient: kube.GetKube(),
+		Namespace:  challengeNamespace,
+		Name:       challengeIngressName(domain),
+	}
+	return ingress.Delete()
+}
+
+// waitForRoute gives traefik time to load new ingress, CA validates token only once
+func (c *httpChallengeS) waitForRoute(domain, token string) {
+	client := http.Client{Timeout: 3 * time.Second}
+	url := "http://" + domain + http01.ChallengePath(token)
+
+	for i := 0; i < 20; i++ {
+		res, err := client.Get(url)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(time.Second)
+	}
+
+	tlog.Warning("ACME challenge is not reachable, asking CA anyway", tlog.Vars{
+		"url": url,
+	})
+}
+
+func challengeIngressName(domain string) string {
+	return "acme-" + conv.KeyString(domain)
+}
+
+// challengeServiceCreate creates service used by challenge ingresses
+func challengeServiceCreate() {
+	port, _ := strconv.Atoi(config.AcmeHTTPPort())
+
+	svc := kube.ServiceS{
+		KubeClient: kube.GetKube(),
+		Namespace:  challengeNamespace,
+		Name:       challengeServiceName,
+		Ports:      map[int32]int32{int32(port): int32(port)},
+		TargetSelector: map[string]string{
+			"element": "core",
+		},
+		Labels: map[string]string{
+			"element": challengeServiceName,
+		},
+	}
+	for {
+		_, err := svc.CreateOrUpdate()
+		if tlog.Error(err) == nil {
+			return
+		}
+		tlog.Warning("Waiting for core-acme service ...")
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,151 @@
+package certprovider
+
+import (
+	"core/db2"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"lib/tlog"
+	"sync"
+	"time"
+)
+
+var (
+	// renew of domain holds its lock while waiting for CA, other domains
+	// are renewed in parallel
+	domainLocksLock = &sync.Mutex{}
+	domainLocks     = map[string]*sync.Mutex{}
+
+	listenersLock = &sync.Mutex{}
+	listeners     = []func(domainName string){}
+)
+
+// OnRenew registers callback called after new certificate of domain is saved
+func OnRenew(fn func(domainName string)) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// domainLock returns lock of renew of domain
+func domainLock(domainName string) *sync.Mutex {
+	domainLocksLock.Lock()
+	defer domainLocksLock.Unlock()
+
+	lock := domainLocks[domainName]
+	if lock == nil {
+		lock = &sync.Mutex{}
+		domainLocks[domainName] = lock
+	}
+	return lock
+}
+
+func Loop() {
+	for {
+		RenewAll()
+		time.Sleep(time.Hour)
+	}
+}
+
+// RenewAll checks certificates of all domains using Let's Encrypt cert provider
+func RenewAll() {
+	for _, domain := range db2.DomainList("Enabled = true", "", 0, 1000).Iter() {
+		provider := domain.CertProvider()
+		if provider.NotValid() || provider.Variant() != db2.CertProviderVariant_LetsEncrypt {
+			continue
+		}
+		Renew(domain, false)
+	}
+}
+
+// Renew obtains new certificate when current one is missing or expires
+// in less than CertRenewBeforeDays, force=true skips expiration check.
+func Renew(domain db2.Domain, force bool) error {
+	lock := domainLock(domain.Name())
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Focal Point sync can reset cert of domain, latest cert issued locally is used again
+	cert := latestCert(domain.Name())
+	if !cert.NotValid() && domain.Cert().ID() != cert.ID() {
+		domain.SetCert(cert)
+	}
+
+	if !force && !cert.NotValid() && time.Until(time.Unix(cert.ExpirationTime(), 0)) > renewBefore(domain) {
+		return nil
+	}
+
+	tlog.Info("requesting certificate for {{domain}}", tlog.Vars{
+		"domain": domain.Name(),
+	})
+
+	res, err := obtain(domain)
+	if err == nil {
+		err = save(domain, res.Certificate, res.PrivateKey)
+	}
+	if err != nil {
+		domain.SetCertRenewError(err.Error())
+		tlog.Error("certificate renewal failed for {{domain}}", tlog.Vars{
+			"domain": domain.Name(),
+			"error":  err.Error(),
+			"event":  true,
+		})
+		return err
+	}
+
+	domain.SetCertRenewError("")
+	tlog.Info("certificate renewed for {{domain}}", tlog.Vars{
+		"domain": domain.Name(),
+		"event":  true,
+	})
+
+	listenersLock.Lock()
+	fns := append([]func(string){}, listeners...)
+	listenersLock.Unlock()
+	for _, fn := range fns {
+		fn(domain.Name())
+	}
+	return nil
+}
+
+func latestCert(domainName string) db2.Cert {
+	return db2.CertList("DomainName = '"+domainName+"'", "ExpirationTime DESC", 0, 1).First()
+}
+
+func save(domain db2.Domain, pemData, key []byte) error {
+	expiration := PemExpiry(pemData)
+	if expiration.IsZero() {
+		return errors.New("certificate from CA is not valid")
+	}
+
+	cert := db2.CertCreate(
+		domain.Name(),
+		expiration.Unix(),
+		string(key),
+		domain.Organization(),
+		string(pemData),
+	)
+	if cert.NotValid() {
+		return errors.New("cert save failed: " + cert.InfoLastTrace().Message)
+	}
+
+	if res := domain.SetCert(cert); res.NotValid() {
+		return errors.New("domain cert update failed: " + res.InfoLastTrace().Message)
+	}
+	return nil
+}
+
+// PemExpiry returns expiration time of the first certificate in PEM data
+func PemExpiry(pemData []byte) time.Time {
+	for block, rest := pem.Decode(pemData); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		return cert.NotAfter
+	}
+	return time.Time{}
+}
@@ -0,0 +1,318 @@
+package certprovider
+
+import (
+	"core/db"
+	"core/db2"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCAS is minimal ACME server, authorizations are valid without challenge
+// and CSR of finalize is signed by its own CA key
+type fakeCAS struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fail     bool // new order is rejected
+	accounts int
+	orders   int
+	domains  []string
+	pem      []byte
+
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newFakeCA(t *testing.T) *fakeCAS {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &fakeCAS{key: key, cert: cert}
+	ca.Server = httptest.NewServer(http.HandlerFunc(ca.serveHTTP))
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+func (ca *fakeCAS) dirURL() string {
+	return ca.URL + "/dir"
+}
+
+func (ca *fakeCAS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", base64.RawURLEncoding.EncodeToString([]byte(time.Now().String())))
+	if r.Method == http.MethodHead || r.URL.Path == "/nonce" {
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	// payload of JWS is not verified
+	jws := struct{ Payload string }{}
+	json.NewDecoder(r.Body).Decode(&jws)
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	order := func(status string) map[string]any {
+		identifiers := []map[string]string{}
+		for _, domain := range ca.domains {
+			identifiers = append(identifiers, map[string]string{"type": "dns", "value": domain})
+		}
+		return map[string]any{
+			"status":         status,
+			"identifiers":    identifiers,
+			"authorizations": []string{ca.URL + "/authz"},
+			"finalize":       ca.URL + "/finalize",
+			"certificate":    ca.URL + "/cert",
+		}
+	}
+
+	switch r.URL.Path {
+	case "/dir":
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   ca.URL + "/nonce",
+			"newAccount": ca.URL + "/account",
+			"newOrder":   ca.URL + "/order",
+			"revokeCert": ca.URL + "/revoke",
+			"keyChange":  ca.URL + "/key-change",
+		})
+
+	case "/account":
+		ca.accounts++
+		w.Header().Set("Location", ca.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "valid"})
+
+	case "/order":
+		if ca.fail {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{
+				"type":   "urn:ietf:params:acme:error:rateLimited",
+				"detail": "too many certificates",
+				"status": http.StatusForbidden,
+			})
+			return
+		}
+		ca.orders++
+		req := struct{ Identifiers []struct{ Value string } }{}
+		json.Unmarshal(payload, &req)
+		ca.domains = nil
+		for _, id := range req.Identifiers {
+			ca.domains = append(ca.domains, id.Value)
+		}
+		w.Header().Set("Location", ca.URL+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(order("ready"))
+
+	case "/authz":
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":     "valid",
+			"identifier": map[string]string{"type": "dns", "value": ca.domains[0]},
+			"challenges": []any{},
+		})
+
+	case "/finalize":
+		req := struct{ CSR string }{}
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(ca.orders + 1)),
+			Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		cert, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ca.pem = append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...,
+		)
+		json.NewEncoder(w).Encode(order("valid"))
+
+	case "/order/1":
+		json.NewEncoder(w).Encode(order("valid"))
+
+	case "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.pem)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *fakeCAS) setFail(fail bool) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.fail = fail
+}
+
+func (ca *fakeCAS) counts() (accounts, orders int) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.accounts, ca.orders
+}
+
+// testDomain creates domain with Let's Encrypt cert provider using CA of dirURL
+func testDomain(t *testing.T, name, dirURL string) db2.Domain {
+	db.OpenStorage()
+
+	org := db2.OrganizationCreate("test")
+	provider := db2.CertProviderCreate("test", org, db2.CertProviderVariant_LetsEncrypt)
+	provider.SetLetsEncrypt_Email("acme-" + provider.ID() + "@timoni.test")
+	provider.SetLetsEncrypt_URL(dirURL)
+
+	domain := db2.DomainCreate(db2.CertGetByID(""), provider, db2.DNSProviderGetByID(""), "", name, org, "")
+	if domain.NotValid() {
+		t.Fatal("domain create failed: " + domain.InfoLastTrace().Message)
+	}
+	t.Cleanup(func() { domain.SetEnabled(false) })
+	return domain
+}
+
+func TestRenew(t *testing.T) {
+	ca := newFakeCA(t)
+	domain := testDomain(t, "renew.timoni.test", ca.dirURL())
+
+	renewed := 0
+	OnRenew(func(domainName string) {
+		if domainName == domain.Name() {
+			renewed++
+		}
+	})
+
+	// domain without cert
+	if err := Renew(domain, false); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	first := db2.DomainGetByID(domain.ID()).Cert()
+	if first.NotValid() || first.DomainName() != domain.Name() {
+		t.Fatal("Renew() did not save cert of domain")
+	}
+	if expiry := time.Unix(first.ExpirationTime(), 0); time.Until(expiry) < 89*24*time.Hour {
+		t.Errorf("cert expires at %v, want in 90 days", expiry)
+	}
+	if accounts, orders := ca.counts(); accounts != 1 || orders != 1 || renewed != 1 {
+		t.Fatalf("accounts = %d, orders = %d, renewed = %d, want 1", accounts, orders, renewed)
+	}
+
+	// cert is far from expiration, CA is not called
+	if err := Renew(domain, false); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if accounts, orders := ca.counts(); accounts != 1 || orders != 1 {
+		t.Errorf("Renew() before renew window: accounts = %d, orders = %d, want 1", accounts, orders)
+	}
+
+	// cert in renew window, registered account is reused
+	domain.SetCertRenewBeforeDays(100)
+	if err := Renew(domain, false); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, orders := ca.counts(); accounts != 1 || orders != 2 || renewed != 2 {
+		t.Errorf("Renew() in renew window: accounts = %d, orders = %d, renewed = %d, want 1, 2, 2", accounts, orders, renewed)
+	}
+	if cert := db2.DomainGetByID(domain.ID()).Cert(); cert.ID() == first.ID() {
+		t.Error("renewed cert is not set to domain")
+	}
+}
+
+func TestRenewError(t *testing.T) {
+	ca := newFakeCA(t)
+	domain := testDomain(t, "renew-error.timoni.test", ca.dirURL())
+
+	if err := Renew(domain, false); err != nil {
+		t.Fatal(err)
+	}
+	cert := db2.DomainGetByID(domain.ID()).Cert()
+
+	ca.setFail(true)
+	if err := Renew(domain, true); err == nil || !strings.Contains(err.Error(), "too many certificates") {
+		t.Fatalf("Renew() error = %v, want error of CA", err)
+	}
+	saved := db2.DomainGetByID(domain.ID())
+	if !strings.Contains(saved.CertRenewError(), "too many certificates") {
+		t.Errorf("CertRenewError() = %q", saved.CertRenewError())
+	}
+	if saved.Cert().ID() != cert.ID() {
+		t.Error("cert of domain changed after failed renewal")
+	}
+	if state, msg := Check(); state != db2.State_error || !strings.Contains(msg, domain.Name()) {
+		t.Errorf("Check() = %v, %q, want error of %s", state, msg, domain.Name())
+	}
+
+	ca.setFail(false)
+	if err := Renew(domain, true); err != nil {
+		t.Fatal(err)
+	}
+	if msg := db2.DomainGetByID(domain.ID()).CertRenewError(); msg != "" {
+		t.Errorf("CertRenewError() after renewal = %q", msg)
+	}
+	if state, msg := Check(); state != db2.State_ready {
+		t.Errorf("Check() = %v, %q, want ready", state, msg)
+	}
+}
+
+func TestRenewOtherCA(t *testing.T) {
+	ca := newFakeCA(t)
+	domain := testDomain(t, "other-ca.timoni.test", ca.dirURL())
+
+	if err := Renew(domain, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// account of cert provider is registered again in new CA
+	other := newFakeCA(t)
+	domain.CertProvider().SetLetsEncrypt_URL(other.dirURL())
+	if err := Renew(domain, true); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, orders := other.counts(); accounts != 1 || orders != 1 {
+		t.Errorf("other CA: accounts = %d, orders = %d, want 1", accounts, orders)
+	}
+	if accounts, orders := ca.counts(); accounts != 1 || orders != 1 {
+		t.Errorf("first CA: accounts = %d, orders = %d, want 1", accounts, orders)
+	}
+
+	user, err := db.GetAcmeUser(domain.CertProvider().LetsEncrypt_Email())
+	if err != nil || user.CADirURL != other.dirURL() || user.Registration == nil {
+		t.Errorf("GetAcmeUser() = %+v, %v, want account of %s", user, err, other.dirURL())
+	}
+}
@@ -0,0 +1,30 @@
+package certprovider
+
+import (
+	"core/config"
+	"core/modulestate"
+	"lib/tlog"
+	"net/http"
+	"time"
+)
+
+func Setup() {
+	modulestate.StatusByModulesAdd("cert-provider", Check)
+
+	go func() {
+		// port can be busy for a while, eg. during rolling update of core
+		for {
+			err := http.ListenAndServe(":"+config.AcmeHTTPPort(), httpChallenge)
+			tlog.Error("ACME challenge server failed, retrying", tlog.Vars{
+				"port":  config.AcmeHTTPPort(),
+				"error": err.Error(),
+			})
+			time.Sleep(10 * time.Second)
+		}
+	}()
+
+	go func() {
+		challengeServiceCreate()
+		Loop()
+	}()
+}
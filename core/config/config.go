@@ -16,6 +16,42 @@ var (
 	ModulesPath    = lwhelper.GetEnv("ModulesPath", "/modules")
 	WebPublicPath  = lwhelper.GetEnv("WebPublicPath", "/public")
 
+	// master key for secrets encryption at rest, see db/envelope
+	MasterKey         = lwhelper.GetEnv("MasterKey", "") // base64, comma separated, first is primary
+	MasterKeyFile     = lwhelper.GetEnv("MasterKeyFile", "/keys/master.key")
+	MasterKeyKMSAddr  = lwhelper.GetEnv("MasterKeyKMSAddr", "")
+	MasterKeyKMSKeyID = lwhelper.GetEnv("MasterKeyKMSKeyID", "timoni")
+	MasterKeyKMSToken = lwhelper.GetEnv("MasterKeyKMSToken", "")
+
+	// external secret sources, see db/secretsource
+	SecretVaultAddr  = lwhelper.GetEnv("SecretVaultAddr", "")
+	SecretVaultToken = lwhelper.GetEnv("SecretVaultToken", "")
+	SecretFileDirs   = lwhelper.GetEnv("SecretFileDirs", "/run/secrets/{env}") // comma separated, {env} = env ID
+	SecretVaultPaths = lwhelper.GetEnv("SecretVaultPaths", "")                 // comma separated prefixes, {env} = env ID, empty = no path allowed
+
+	// local ACME for Let's Encrypt cert providers, see certprovider
+	// for Pebble set LEGO_CA_CERTIFICATES to its CA and LetsEncrypt_URL of provider to its directory
+	AcmeHTTPPort          = lwhelper.GetEnv("AcmeHTTPPort", "8089") // HTTP-01 challenges, routed by traefik
+	AcmeChallengeIngress  = lwhelper.GetEnv("AcmeChallengeIngress", "true")
+	AcmeDefaultRenewDays  = lwhelper.GetEnv("AcmeDefaultRenewDays", "30")
+	AcmeDNSPropagationSec = lwhelper.GetEnv("AcmeDNSPropagationSec", "120")
+
+	// web terminal, see term
+	TermIdleTimeoutMin = lwhelper.GetEnv("TermIdleTimeoutMin", "15") // default, environment can set own
+	TermRecordingDays  = lwhelper.GetEnv("TermRecordingDays", "90")  // retention of session recordings
+
+	// wake endpoint of envs with idle sleep, called by traefik forwardAuth, see db/env-schedule.go
+	WakeHTTPPort = lwhelper.GetEnv("WakeHTTPPort", "8090")
+	WakeAddr     = lwhelper.GetEnv("WakeAddr", "")      // default service of core, set for envs on other clusters
+	WakeWaitSec  = lwhelper.GetEnv("WakeWaitSec", "25") // request is held, then page asks browser to retry
+
+	// alert rules of envs, see db/env-alert.go
+	MetricsQueryURL = lwhelper.GetEnv("MetricsQueryURL", "http://metrics.timoni-metrics.svc:8481/select/0/prometheus")
+	AlertEvalSec    = lwhelper.GetEnv("AlertEvalSec", "30")
+
+	// dashboards of envs, see db/env-dashboard.go
+	GrafanaURL = lwhelper.GetEnv("GrafanaURL", "http://metrics-grafana.timoni:3000/grafana")
+
 	KubeConfigFilePath = filepath.Join(DataPath(), "kubeconfig.yaml")
 	GitStatsPath       = filepath.Join(DataPath(), "git-stats")
 	GitRemotePath      = filepath.Join(DataPath(), "git-remote")
@@ -0,0 +1,249 @@
+package db
+
+import (
+	perms "core/db/permissions"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APITokenS is personal token of user or service account, used by
+// automation as `Authorization: Bearer tmn_...`. Token can only narrow
+// permissions of its user: effective permission = teams of user AND
+// Permissions of token. Only sha256 of secret part is stored.
+type APITokenS struct {
+	ID          string
+	UserID      string
+	Name        string
+	Hash        string // sha256 of secret, hex
+	Permissions perms.PermGroup
+
+	CreatedTime    int64
+	CreatedByEmail string
+	ExpiresTime    int64
+	LastUsedTime   int64
+	LastUsedIP     string
+	RevokedTime    int64
+	RevokedByEmail string
+}
+
+const (
+	apiTokenPrefix = "tmn_"
+
+	APITokenMaxDays     = 365
+	APITokenDefaultDays = 90
+
+	apiTokenSaveInterval = 60 // s, last-used time is saved at most once per interval
+)
+
+var (
+	APITokenMap   = maps.NewSafe[string, *APITokenS](nil) // key=ID
+	apiTokenMu    sync.Mutex                              // LastUsed* fields
+	apiTokenSaved = maps.NewSafe[string, int64](nil)      // key=ID, value=last save time
+)
+
+func LoadAPITokens() {
+	APITokenMap = maps.NewSafe[string, *APITokenS](nil)
+	list, err := driver.ReadAll("api-token")
+	if err != nil {
+		tlog.Error(err)
+		return
+	}
+	for _, buf := range list {
+		t := &APITokenS{}
+		if err := json.Unmarshal(buf, t); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		APITokenMap.Set(t.ID, t)
+	}
+}
+
+func (t *APITokenS) save() *tlog.RecordS {
+	apiTokenMu.Lock()
+	defer apiTokenMu.Unlock()
+	if err := driver.Write("api-token", t.ID, t); err != nil {
+		return tlog.Error(err)
+	}
+	apiTokenSaved.Set(t.ID, time.Now().Unix())
+	return nil
+}
+
+func (t *APITokenS) Expired() bool {
+	return t.ExpiresTime <= time.Now().Unix()
+}
+
+func (t *APITokenS) Revoked() bool {
+	return t.RevokedTime > 0
+}
+
+func (t *APITokenS) Active() bool {
+	return !t.Expired() && !t.Revoked()
+}
+
+// Front returns copy of token safe to show, without hash
+func (t *APITokenS) Front() APITokenS {
+	apiTokenMu.Lock()
+	defer apiTokenMu.Unlock()
+	res := *t
+	res.Hash = ""
+	return res
+}
+
+func apiTokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiTokenRandom(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// APITokenCreate creates token of owner (user or service account), returns
+// token value which is shown only once.
+func APITokenCreate(owner *UserS, name string, days int, permissions perms.PermGroup, user *UserS) (string, *APITokenS, *tlog.RecordS) {
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, tlog.Error("token name is required")
+	}
+	if days == 0 {
+		days = APITokenDefaultDays
+	}
+	if days < 0 || days > APITokenMaxDays {
+		return "", nil, tlog.Error("token can be valid from 1 to 365 days")
+	}
+	if permissions.Envs == nil {
+		permissions.Envs = map[string]perms.Mask{}
+	}
+	if permissions.GitRepos == nil {
+		permissions.GitRepos = map[string]perms.Mask{}
+	}
+
+	idBuf := make([]byte, 8)
+	if _, err := rand.Read(idBuf); err != nil {
+		return "", nil, tlog.Error(err)
+	}
+	secret, err := apiTokenRandom(32)
+	if err != nil {
+		return "", nil, tlog.Error(err)
+	}
+
+	t := &APITokenS{
+		ID:             hex.EncodeToString(idBuf),
+		UserID:         owner.ID,
+		Name:           name,
+		Hash:           apiTokenHash(secret),
+		Permissions:    permissions,
+		CreatedTime:    time.Now().Unix(),
+		CreatedByEmail: user.Email,
+		ExpiresTime:    time.Now().AddDate(0, 0, days).Unix(),
+	}
+	if err := t.save(); err != nil {
+		return "", nil, err
+	}
+	APITokenMap.Set(t.ID, t)
+
+	tlog.Info("API token created", tlog.Vars{
+		"token-id": t.ID,
+		"name":     t.Name,
+		"owner":    owner.Email,
+		"expires":  time.Unix(t.ExpiresTime, 0).UTC().Format(time.RFC3339),
+		"user":     user.Email,
+		"event":    true,
+	})
+	return apiTokenPrefix + t.ID + "_" + secret, t, nil
+}
+
+// APITokenAuth returns copy of token owner with permissions limited by token
+func APITokenAuth(value, ip string) (*UserS, *tlog.RecordS) {
+
+	if !strings.HasPrefix(value, apiTokenPrefix) {
+		return nil, tlog.Error("invalid API token")
+	}
+	id, secret, ok := strings.Cut(strings.TrimPrefix(value, apiTokenPrefix), "_")
+	if !ok {
+		return nil, tlog.Error("invalid API token")
+	}
+
+	t := APITokenMap.Get(id)
+	if t == nil || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(apiTokenHash(secret))) != 1 {
+		return nil, tlog.Error("invalid API token")
+	}
+	if t.Revoked() {
+		return nil, tlog.Error("API token is revoked")
+	}
+	if t.Expired() {
+		return nil, tlog.Error("API token is expired")
+	}
+
+	owner := GetUserByID(t.UserID)
+	if owner == nil {
+		return nil, tlog.Error("owner of API token not found")
+	}
+
+	now := time.Now().Unix()
+	apiTokenMu.Lock()
+	t.LastUsedTime = now
+	t.LastUsedIP = ip
+	apiTokenMu.Unlock()
+	if now-apiTokenSaved.Get(t.ID) >= apiTokenSaveInterval {
+		tlog.Error(t.save())
+	}
+
+	user := *owner
+	user.Token = t
+	return &user, nil
+}
+
+// APITokenListByUser returns tokens of user sorted by creation time, newest first
+func APITokenListByUser(userID string) []*APITokenS {
+	res := []*APITokenS{}
+	for _, t := range APITokenMap.Values() {
+		if t.UserID == userID {
+			res = append(res, t)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedTime > res[j].CreatedTime })
+	return res
+}
+
+// Revoke disables token, it's kept for audit
+func (t *APITokenS) Revoke(user *UserS) *tlog.RecordS {
+	if t.Revoked() {
+		return nil
+	}
+	t.RevokedTime = time.Now().Unix()
+	t.RevokedByEmail = user.Email
+	if err := t.save(); err != nil {
+		return err
+	}
+
+	tlog.Info("API token revoked", tlog.Vars{
+		"token-id": t.ID,
+		"name":     t.Name,
+		"user":     user.Email,
+		"event":    true,
+	})
+	return nil
+}
+
+// APITokensRevokeByUser revokes all tokens of user
+func APITokensRevokeByUser(userID string, user *UserS) {
+	for _, t := range APITokenListByUser(userID) {
+		tlog.Error(t.Revoke(user))
+	}
+}
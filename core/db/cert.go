@@ -51,6 +51,7 @@ func (e *ECPrivateKey) UnmarshalJSON(data []byte) error {
 
 type AcmeUser struct {
 	Email        string
+	CADirURL     string // account is registered only in this CA
 	Registration *registration.Resource
 	PrivateKey   *ECPrivateKey
 }
@@ -72,10 +73,11 @@ func (u *AcmeUser) Save() error {
 }
 
 func GetAcmeUser(email string) (*AcmeUser, error) {
-	var acmeUser *AcmeUser
+	acmeUser := &AcmeUser{}
 	err := driver.Read("cert", email, acmeUser)
-	if err != nil {
-		return nil, err
+	if err != nil || acmeUser.Email == "" {
+		// new account
+		acmeUser = &AcmeUser{Email: email}
 	}
 
 	if acmeUser.PrivateKey == nil {
@@ -84,7 +86,9 @@ func GetAcmeUser(email string) (*AcmeUser, error) {
 			return nil, err
 		}
 		acmeUser.PrivateKey = &ECPrivateKey{PrivateKey: privatekey}
-		acmeUser.Save()
+		if err := acmeUser.Save(); err != nil {
+			return nil, err
+		}
 	}
 
 	return acmeUser, nil
@@ -2,8 +2,12 @@ package db
 
 import (
 	"core/config"
+	"core/db/envelope"
 	"core/db/scribble"
+	"core/db/secretsource"
+	"core/kube"
 	"encoding/json"
+	"fmt"
 	"lib/tlog"
 	"lib/utils/bitmap"
 	"lib/utils/maps"
@@ -22,6 +26,7 @@ var (
 	reSimpleName1 = regexp.MustCompile(`^[a-z0-9\-]+$`)
 	reSimpleName2 = regexp.MustCompile(`^[a-z0-9\-\.]+$`)
 	reSimpleName3 = regexp.MustCompile(`^[a-z]+$`)
+	reEmail       = regexp.MustCompile(`^(?:[A-Z0-9a-z._%+-]{2,64}@[A-Za-z0-9.-]{2,64}\.[A-Za-z]{2,16})$`)
 
 	// JournalReader *journal.ReaderS
 	// JournalWriter *journal.WriterS
@@ -45,24 +50,62 @@ const (
 	error_ElementNotFound      errorMessageT = 10
 	error_VariableNotFound     errorMessageT = 11
 	error_InvalidReference     errorMessageT = 12 // self or cycle reference
+	error_ExternalSecretFailed errorMessageT = 13 // vault, k8s-secret, file...
+	error_SecretOpenFailed     errorMessageT = 14 // master key missing or wrong
 	error_EmptyValue           errorMessageT = 20
 	error_InvalidValidator     errorMessageT = 30
 	error_InvalidValidatorArgs errorMessageT = 31
+	error_InvalidSchema        errorMessageT = 32 // type, min, max, default...
 	error_InvalidName          errorMessageT = 40
 	error_ValidationFailed     errorMessageT = 41
+	error_SchemaFailed         errorMessageT = 42
+	error_ConstraintFailed     errorMessageT = 43 // variables-constraints
 )
 
-func Open() {
+var errorMessages = map[errorMessageT]string{
+	error_ElementNotFound:      "referenced element not found",
+	error_VariableNotFound:     "referenced variable not found",
+	error_InvalidReference:     "self or cyclic reference",
+	error_ExternalSecretFailed: "external secret could not be read",
+	error_SecretOpenFailed:     "secret value could not be decrypted, check master key",
+	error_EmptyValue:           "value is empty",
+	error_InvalidValidator:     "unknown validator",
+	error_InvalidValidatorArgs: "invalid validator arguments",
+	error_InvalidSchema:        "invalid variable schema",
+	error_InvalidName:          "invalid variable name",
+	error_ValidationFailed:     "value does not pass validation",
+	error_SchemaFailed:         "value does not match variable schema",
+	error_ConstraintFailed:     "variables constraint failed",
+}
+
+// Message returns human readable description of error
+func (e errorMessageT) Message() string {
+	if msg, ok := errorMessages[e]; ok {
+		return msg
+	}
+	return fmt.Sprintf("error %d", int(e))
+}
 
+// OpenStorage opens file storage in DataPath, without loading of its data
+func OpenStorage() {
 	for {
 		var err error
 		driver, err = scribble.New(config.DataPath(), nil)
 		if err == nil {
-			break
+			return
 		}
 		tlog.Error(err)
 		time.Sleep(10 * time.Second)
 	}
+}
+
+func Open() {
+
+	if err := envelope.Setup(); err != nil {
+		tlog.Fatal(err)
+	}
+	secretsource.Setup(kubeSecretGet)
+	OpenStorage()
 
 	// ----------------------------------------------------------
 
@@ -73,6 +116,25 @@ func Open() {
 	os.Mkdir(filepath.Join(config.DataPath(), "git-repo"), 0755)
 	os.Mkdir(filepath.Join(config.DataPath(), "git-stats"), 0755)
 	os.Mkdir(filepath.Join(config.DataPath(), "team"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "variable-set"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "dns-provider"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "sso-provider"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "sso-user"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "api-token"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "term-session"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "role"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "role-binding"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "element-snapshot"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "element-backup"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "volume-backup-target"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "quota"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "quota-prices"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "env-cost"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "schedule-calendar"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "element-profile"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "element-profile-data"), 0755)
+	os.Mkdir(filepath.Join(config.DataPath(), "alert-silence"), 0755)
+	os.Mkdir(termRecordingDir(), 0755)
 
 	// ----------------------------------------------------------
 	// applyFixtures
@@ -84,6 +146,15 @@ func Open() {
 
 	// ----------------------------------------------------------
 	LoadTeams()
+	LoadVariableSets()
+	LoadAPITokens()
+	LoadRoles()
+	LoadElementSnapshots()
+	LoadElementBackups()
+	LoadQuotas()
+	LoadScheduleCalendars()
+	LoadElementProfiles()
+	LoadAlertSilences()
 
 	// Create Admin team
 	if GetTeamByName(AdminTeamName) == nil {
@@ -124,6 +195,21 @@ func Open() {
 	// ----------------------------------------------------------
 
 	go SyncWithDiskLoop()
+	kube.DriftHook = envDriftAdd
+
+	go secretsource.Loop(ExternalSecretChanged)
+	go SSOSyncLoop()
+	go RoleBindingCleanupLoop()
+	go ElementSnapshotLoop()
+	go ElementBackupLoop()
+	go EnvCostLoop()
+	go EnvScheduleLoop()
+	go EnvAlertLoop()
+	go EnvSLOLoop()
+	go EnvDashboardLoop()
+
+	TermSessionsCloseOrphaned()
+	go TermSessionCleanupLoop()
 
 	// ----------------------------------------------------------
 
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"core/db/envelope"
+	"core/db2"
+	"core/dnsprovider"
+	"lib/tlog"
+	"time"
+)
+
+// DNSProviderSettingsS keeps settings of DNS provider which are not part of
+// Focal Point row (Route53, Google, Hetzner, RFC2136 credentials...).
+// Secret fields are sealed with envelope encryption.
+type DNSProviderSettingsS struct {
+	ID         string // db2.DNSProvider ID
+	Type       string // name of dnsprovider implementation, for types Focal Point doesn't know
+	Settings   dnsprovider.Settings
+	UpdateTime int64
+	UserEmail  string
+}
+
+// variants of Focal Point with dnsprovider implementation, other types are
+// set only locally in DNSProviderSettingsS.Type
+var dnsProviderVariants = map[db2.DNSProviderVariantT]string{
+	db2.DNSProviderVariant_Azure:      "azure",
+	db2.DNSProviderVariant_Cloudflare: "cloudflare",
+}
+
+// DNSProviderType returns name of dnsprovider implementation, empty when
+// records of provider are not managed by Timoni (eg. `Timoni` variant
+// without local type).
+func DNSProviderType(p db2.DNSProvider) string {
+	if name := dnsProviderVariants[p.Variant()]; name != "" {
+		return name
+	}
+	if local := dnsProviderSettingsLoad(p.ID()); local != nil {
+		return local.Type
+	}
+	return ""
+}
+
+func dnsProviderSettingsLoad(id string) *DNSProviderSettingsS {
+	res := &DNSProviderSettingsS{}
+	if err := driver.Read("dns-provider", id, res); err != nil {
+		return nil
+	}
+	return res
+}
+
+// DNSProviderSettings returns settings of provider with plain values,
+// columns of Focal Point row are used as defaults.
+func DNSProviderSettings(p db2.DNSProvider) dnsprovider.Settings {
+	res := dnsprovider.Settings{}
+
+	switch p.Variant() {
+	case db2.DNSProviderVariant_Cloudflare:
+		res["email"] = p.Cloudflare_Email()
+		res["key"] = p.Cloudflare_Key()
+	case db2.DNSProviderVariant_Azure:
+		res["tenant_id"] = p.Azure_TenantID()
+		res["client_id"] = p.Azure_ClientID()
+		res["client_secret"] = p.Azure_Key()
+		res["subscription_id"] = p.Azure_SUBSCRIPTION_ID()
+		res["resource_group"] = p.Azure_RESOURCE_GROUP_NAME()
+		res["zone"] = p.Azure_HOSTED_ZONE_NAME()
+	}
+
+	if local := dnsProviderSettingsLoad(p.ID()); local != nil {
+		for k, v := range local.Settings {
+			if v != "" {
+				res[k] = envelope.MustOpen(v)
+			}
+		}
+	}
+	return res
+}
+
+// DNSProviderSettingsFront returns settings with hidden secret values
+func DNSProviderSettingsFront(p db2.DNSProvider) dnsprovider.Settings {
+	factory, ok := dnsprovider.Factory(DNSProviderType(p))
+	if !ok {
+		return dnsprovider.Settings{}
+	}
+
+	settings := DNSProviderSettings(p)
+	res := dnsprovider.Settings{}
+	for _, field := range factory.Fields {
+		res[field.Name] = settings[field.Name]
+		if field.Secret && res[field.Name] != "" {
+			res[field.Name] = "{{ secret }}"
+		}
+	}
+	return res
+}
+
+// DNSProviderSettingsSave stores settings of provider, secret values equal
+// to `{{ secret }}` are kept from previously saved settings. Type can be set
+// only for variants without own implementation, empty type keeps current one.
+func DNSProviderSettingsSave(p db2.DNSProvider, typ string, settings dnsprovider.Settings, user *UserS) *tlog.RecordS {
+
+	if variantType := dnsProviderVariants[p.Variant()]; variantType != "" {
+		if typ != "" && typ != variantType {
+			return tlog.Error("type of DNS provider is set by its variant: " + p.Variant().EN())
+		}
+		typ = variantType
+	} else if typ == "" {
+		typ = DNSProviderType(p)
+	}
+
+	factory, ok := dnsprovider.Factory(typ)
+	if !ok {
+		return tlog.Error("DNS provider type not supported: " + typ)
+	}
+
+	current := dnsprovider.Settings{}
+	if typ == DNSProviderType(p) {
+		// secrets of other type are not reused
+		current = DNSProviderSettings(p)
+	}
+	res := &DNSProviderSettingsS{
+		ID:         p.ID(),
+		Type:       typ,
+		Settings:   dnsprovider.Settings{},
+		UpdateTime: time.Now().UTC().Unix(),
+		UserEmail:  user.Email,
+	}
+	plain := dnsprovider.Settings{}
+
+	for _, field := range factory.Fields {
+		v := settings[field.Name]
+		if field.Secret && v == "{{ secret }}" {
+			v = current[field.Name]
+		}
+		plain[field.Name] = v
+		if field.Secret && v != "" {
+			v = envelope.MustSeal(v)
+		}
+		res.Settings[field.Name] = v
+	}
+
+	if _, err := dnsprovider.New(factory.Name, plain); err != nil {
+		return tlog.Error(err)
+	}
+	if err := driver.Write("dns-provider", p.ID(), res); err != nil {
+		return tlog.Error(err)
+	}
+
+	tlog.Info("DNS provider settings saved", tlog.Vars{
+		"provider": p.Name(),
+		"variant":  factory.Name,
+		"user":     user.Email,
+		"event":    true,
+	})
+	return nil
+}
+
+// DNSProviderGet returns client of DNS provider, nil without error when
+// records of provider are not managed by Timoni.
+func DNSProviderGet(p db2.DNSProvider) (dnsprovider.Provider, *tlog.RecordS) {
+	if p == nil || p.NotValid() || !p.Enabled() {
+		return nil, nil
+	}
+	name := DNSProviderType(p)
+	if name == "" {
+		return nil, nil
+	}
+
+	provider, err := dnsprovider.New(name, DNSProviderSettings(p))
+	if err != nil {
+		return nil, tlog.Error(err, tlog.Vars{
+			"provider": p.Name(),
+		})
+	}
+	return provider, nil
+}
@@ -0,0 +1,556 @@
+package db
+
+import (
+	"bytes"
+	"core/config"
+	"core/db2"
+	"core/db2/fp"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"lib/tlog"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const alertTemplatePrefix = "{{$labels := .Labels}}{{$value := .Value}}"
+
+// AlertS is pending or firing alert of env
+type AlertS struct {
+	Rule       string
+	Labels     map[string]string
+	Value      float64
+	Summary    string
+	State      string // pending, firing
+	ActiveTime int64  // condition is true since
+	FiredTime  int64
+	Silenced   bool
+}
+
+const (
+	AlertStatePending = "pending"
+	AlertStateFiring  = "firing"
+)
+
+// alertGroupS collects alerts of route with the same values of group-by
+// labels, they are sent in one notification
+type alertGroupS struct {
+	route       *AlertRouteS
+	labels      map[string]string
+	firing      map[string]*AlertS // key=alert key
+	resolved    []*AlertS
+	changedTime time.Time // zero = nothing new to send
+	sentTime    time.Time
+}
+
+type envAlertStateS struct {
+	alerts map[string]*AlertS // key=alert key
+	groups map[string]*alertGroupS
+	errors map[string]string // key=rule name, last error of query
+}
+
+type AlertSampleS struct {
+	Labels map[string]string
+	Value  float64
+}
+
+var (
+	alertStates = map[string]*envAlertStateS{} // key=envID
+	alertLock   sync.Mutex
+)
+
+func alertStateReset(envID string) {
+	alertLock.Lock()
+	defer alertLock.Unlock()
+	delete(alertStates, envID)
+}
+
+// EnvAlertList returns pending and firing alerts of env and last errors of
+// rules
+func EnvAlertList(envID string) ([]AlertS, map[string]string) {
+	alertLock.Lock()
+	defer alertLock.Unlock()
+
+	res := []AlertS{}
+	errs := map[string]string{}
+	state := alertStates[envID]
+	if state == nil {
+		return res, errs
+	}
+	now := time.Now()
+	for _, a := range state.alerts {
+		tmp := *a
+		tmp.Silenced = alertSilenced(envID, a.Labels, now)
+		res = append(res, tmp)
+	}
+	for k, v := range state.errors {
+		errs[k] = v
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rule != res[j].Rule {
+			return res[i].Rule < res[j].Rule
+		}
+		return res[i].ActiveTime < res[j].ActiveTime
+	})
+	return res, errs
+}
+
+// AlertQuery runs PromQL instant query limited to series of env
+func AlertQuery(envID, expr string) ([]AlertSampleS, *tlog.RecordS) {
+	return metricsQuery(expr,
+		fmt.Sprintf(`{env_id=%q}`, envID),
+		fmt.Sprintf(`{namespace=%q}`, envID),
+	)
+}
+
+// metricsQuery runs PromQL instant query, series have to match any of
+// filters, no filters = all series
+func metricsQuery(expr string, filters ...string) ([]AlertSampleS, *tlog.RecordS) {
+
+	query := url.Values{}
+	query.Set("query", expr)
+	for _, f := range filters {
+		query.Add("extra_filters[]", f)
+	}
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	response, err := client.Get(strings.TrimSuffix(config.MetricsQueryURL(), "/") + "/api/v1/query?" + query.Encode())
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+
+	res := struct {
+		Status string
+		Error  string
+		Data   struct {
+			ResultType string
+			Result     json.RawMessage
+		}
+	}{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, tlog.Error(fmt.Sprintf("%s: %s", response.Status, strings.TrimSpace(string(body))))
+	}
+	if res.Status != "success" {
+		return nil, tlog.Error(res.Error)
+	}
+
+	parseValue := func(v []interface{}) float64 {
+		if len(v) != 2 {
+			return 0
+		}
+		s, _ := v[1].(string)
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+
+	samples := []AlertSampleS{}
+	switch res.Data.ResultType {
+	case "vector":
+		vector := []struct {
+			Metric map[string]string
+			Value  []interface{}
+		}{}
+		if err := json.Unmarshal(res.Data.Result, &vector); err != nil {
+			return nil, tlog.Error(err)
+		}
+		for _, v := range vector {
+			delete(v.Metric, "__name__")
+			samples = append(samples, AlertSampleS{Labels: v.Metric, Value: parseValue(v.Value)})
+		}
+	case "scalar":
+		scalar := []interface{}{}
+		if err := json.Unmarshal(res.Data.Result, &scalar); err != nil {
+			return nil, tlog.Error(err)
+		}
+		samples = append(samples, AlertSampleS{Labels: map[string]string{}, Value: parseValue(scalar)})
+	default:
+		return nil, tlog.Error("expr has to return instant vector, got {{type}}", tlog.Vars{
+			"type": res.Data.ResultType,
+		})
+	}
+	return samples, nil
+}
+
+// alertKey identifies alert by rule name and labels
+func alertKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := strings.Builder{}
+	for _, k := range keys {
+		buf.WriteString(k + "=" + strconv.Quote(labels[k]) + ",")
+	}
+	return buf.String()
+}
+
+func alertSummary(name, summary string, labels map[string]string, value float64) string {
+	if summary == "" {
+		return ""
+	}
+	t, err := template.New(name).Parse(alertTemplatePrefix + summary)
+	if err != nil {
+		return summary
+	}
+	buf := &bytes.Buffer{}
+	data := struct {
+		Labels map[string]string
+		Value  float64
+	}{labels, value}
+	if err := t.Execute(buf, data); err != nil {
+		return summary
+	}
+	return buf.String()
+}
+
+// alertEvaluate runs rules of env and updates its alerts, changes are
+// passed to groups of routes
+func (env *EnvironmentS) alertEvaluate(now time.Time) {
+
+	type resultS struct {
+		samples []AlertSampleS
+		err     *tlog.RecordS
+	}
+	results := map[string]resultS{}
+	for name, rule := range env.Alerts.Rules {
+		if rule.Disabled {
+			continue
+		}
+		samples, err := AlertQuery(env.ID, rule.Expr)
+		results[name] = resultS{samples, err}
+	}
+
+	alertLock.Lock()
+	defer alertLock.Unlock()
+
+	state := alertStates[env.ID]
+	if state == nil {
+		state = &envAlertStateS{
+			alerts: map[string]*AlertS{},
+			groups: map[string]*alertGroupS{},
+		}
+		alertStates[env.ID] = state
+	}
+	state.errors = map[string]string{}
+
+	active := map[string]bool{}
+	for name, result := range results {
+		rule := env.Alerts.Rules[name]
+		if result.err != nil {
+			state.errors[name] = result.err.Message
+			// keep alerts of rule until query works again
+			for key, a := range state.alerts {
+				if a.Rule == name {
+					active[key] = true
+				}
+			}
+			continue
+		}
+
+		for _, sample := range result.samples {
+			labels := map[string]string{}
+			for k, v := range sample.Labels {
+				labels[k] = v
+			}
+			for k, v := range rule.Labels {
+				labels[k] = v
+			}
+			labels["alertname"] = name
+			labels["severity"] = rule.Severity
+			labels["env"] = env.ID
+
+			key := alertKey(labels)
+			active[key] = true
+			a := state.alerts[key]
+			if a == nil {
+				a = &AlertS{
+					Rule:       name,
+					Labels:     labels,
+					State:      AlertStatePending,
+					ActiveTime: now.Unix(),
+				}
+				state.alerts[key] = a
+			}
+			a.Value = sample.Value
+			a.Summary = alertSummary(name, rule.Summary, sample.Labels, sample.Value)
+
+			if a.State == AlertStatePending && now.Sub(time.Unix(a.ActiveTime, 0)) >= alertDuration(rule.For, 0) {
+				a.State = AlertStateFiring
+				a.FiredTime = now.Unix()
+				env.alertEvent(a, true)
+				state.alertRoute(env, key, a, now)
+			}
+		}
+	}
+
+	for key, a := range state.alerts {
+		if active[key] {
+			continue
+		}
+		delete(state.alerts, key)
+		if a.State == AlertStateFiring {
+			env.alertEvent(a, false)
+			state.alertRoute(env, key, a, now)
+		}
+	}
+
+	state.alertNotify(env, now)
+}
+
+func (env *EnvironmentS) alertEvent(a *AlertS, firing bool) {
+	msg := "alert {{alert}} resolved"
+	if firing {
+		msg = "alert {{alert}} firing"
+	}
+	vars := tlog.Vars{
+		"alert":    a.Rule,
+		"severity": a.Labels["severity"],
+		"value":    a.Value,
+		"env":      env.ID,
+		"event":    true,
+	}
+	if a.Summary != "" {
+		vars["summary"] = a.Summary
+	}
+	if firing && a.Labels["severity"] == AlertSeverityCritical {
+		tlog.Warning(msg, vars)
+		return
+	}
+	tlog.Info(msg, vars)
+}
+
+// alertRoute passes fired or resolved alert to groups of matching routes
+func (state *envAlertStateS) alertRoute(env *EnvironmentS, key string, a *AlertS, now time.Time) {
+
+	for i, route := range env.Alerts.Routes {
+		if !route.matches(a.Labels) {
+			continue
+		}
+
+		groupBy := route.GroupBy
+		if len(groupBy) == 0 {
+			groupBy = []string{"alertname"}
+		}
+		labels := map[string]string{}
+		for _, l := range groupBy {
+			labels[l] = a.Labels[l]
+		}
+		groupKey := fmt.Sprintf("%d/%s", i, alertKey(labels))
+
+		g := state.groups[groupKey]
+		if g == nil {
+			g = &alertGroupS{
+				route:  route,
+				labels: labels,
+				firing: map[string]*AlertS{},
+			}
+			state.groups[groupKey] = g
+		}
+
+		if a.State == AlertStateFiring && state.alerts[key] != nil {
+			g.firing[key] = a
+		} else {
+			delete(g.firing, key)
+			g.resolved = append(g.resolved, a)
+		}
+		if g.changedTime.IsZero() {
+			g.changedTime = now
+		}
+
+		if !route.Continue {
+			return
+		}
+	}
+}
+
+// alertNotify sends groups with changes after group-wait and firing groups
+// after repeat-interval, silenced alerts are not sent
+func (state *envAlertStateS) alertNotify(env *EnvironmentS, now time.Time) {
+
+	for groupKey, g := range state.groups {
+
+		firing := []*AlertS{}
+		for _, a := range g.firing {
+			if !alertSilenced(env.ID, a.Labels, now) {
+				firing = append(firing, a)
+			}
+		}
+
+		send := false
+		if !g.changedTime.IsZero() && now.Sub(g.changedTime) >= alertDuration(g.route.GroupWait, 30*time.Second) {
+			send = true
+		}
+		if len(firing) > 0 && !g.sentTime.IsZero() && now.Sub(g.sentTime) >= alertDuration(g.route.RepeatInterval, 4*time.Hour) {
+			send = true
+		}
+		if !send {
+			continue
+		}
+
+		resolved := []*AlertS{}
+		for _, a := range g.resolved {
+			if !alertSilenced(env.ID, a.Labels, now) {
+				resolved = append(resolved, a)
+			}
+		}
+		if len(firing) > 0 || len(resolved) > 0 {
+			go env.alertDeliver(g.route, g.labels, firing, resolved)
+			g.sentTime = now
+		}
+		g.changedTime = time.Time{}
+		g.resolved = nil
+
+		if len(g.firing) == 0 {
+			delete(state.groups, groupKey)
+		}
+	}
+}
+
+// alertProviderGet returns enabled NotificationProvider by name, empty name
+// returns first enabled SMTP provider
+func alertProviderGet(name string) db2.NotificationProvider {
+	for _, p := range db2.NotificationProviderList("", "", 0, 1000).Iter() {
+		if !p.Enabled() {
+			continue
+		}
+		if name == "" && p.Variant() == db2.NotificationProviderVariant_SMTP {
+			return p
+		}
+		if name != "" && p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (env *EnvironmentS) alertDeliver(route *AlertRouteS, groupLabels map[string]string, firing, resolved []*AlertS) {
+
+	subject := fmt.Sprintf("[FIRING:%d] %s", len(firing), env.Name)
+	if len(firing) == 0 {
+		subject = fmt.Sprintf("[RESOLVED] %s", env.Name)
+	}
+	groupBy := []string{}
+	for k, v := range groupLabels {
+		groupBy = append(groupBy, k+"="+v)
+	}
+	sort.Strings(groupBy)
+	subject += " " + strings.Join(groupBy, " ")
+
+	msg := &strings.Builder{}
+	writeList := func(title string, list []*AlertS) {
+		if len(list) == 0 {
+			return
+		}
+		fmt.Fprintf(msg, "<h3>%s</h3><ul>", title)
+		for _, a := range list {
+			labels := []string{}
+			for k, v := range a.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			sort.Strings(labels)
+			fmt.Fprintf(msg, "<li><b>%s</b> value %s since %s",
+				html.EscapeString(a.Rule),
+				strconv.FormatFloat(a.Value, 'g', 6, 64),
+				time.Unix(a.ActiveTime, 0).UTC().Format("2006-01-02 15:04 MST"),
+			)
+			if a.Summary != "" {
+				fmt.Fprintf(msg, "<br>%s", html.EscapeString(a.Summary))
+			}
+			fmt.Fprintf(msg, "<br><small>%s</small></li>", html.EscapeString(strings.Join(labels, ", ")))
+		}
+		msg.WriteString("</ul>")
+	}
+	writeList("Firing", firing)
+	writeList("Resolved", resolved)
+	fmt.Fprintf(msg, `<p><a href="%s">%s</a></p>`, db2.TheDomain.URL("/env/"+env.ID), html.EscapeString(env.Name))
+
+	if err := alertSend(route, subject, msg.String()); err != nil {
+		tlog.Error("alert notification failed: {{error}}", tlog.Vars{
+			"error": err.Error(),
+			"env":   env.ID,
+			"event": true,
+		})
+	}
+}
+
+// alertSend delivers message to emails of route by its NotificationProvider,
+// platform email is used when no provider is configured
+func alertSend(route *AlertRouteS, subject, htmlMessage string) error {
+
+	provider := alertProviderGet(route.Provider)
+	if provider == nil {
+		if route.Provider != "" {
+			return fmt.Errorf("notification provider %s not found", route.Provider)
+		}
+		for _, email := range route.Emails {
+			fp.SendEmail(email, subject, htmlMessage)
+		}
+		return nil
+	}
+
+	if provider.Variant() != db2.NotificationProviderVariant_SMTP {
+		return fmt.Errorf("notification provider %s: %s is not supported for alerts", provider.Name(), provider.Variant().EN())
+	}
+
+	from := provider.SMTP_SenderEmail()
+	header := "From: " + from + "\r\n"
+	if provider.SMTP_SenderName() != "" {
+		header = fmt.Sprintf("From: %q <%s>\r\n", provider.SMTP_SenderName(), from)
+	}
+	header += "To: " + strings.Join(route.Emails, ", ") + "\r\n" +
+		"Subject: " + strings.NewReplacer("\r", "", "\n", "").Replace(subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n\r\n"
+
+	var auth smtp.Auth
+	if provider.SMTP_Login() != "" {
+		auth = smtp.PlainAuth("", provider.SMTP_Login(), provider.SMTP_Password(), provider.SMTP_Host())
+	}
+	return SendMailRaw(
+		fmt.Sprintf("%s:%d", provider.SMTP_Host(), provider.SMTP_Port()),
+		auth,
+		from,
+		route.Emails,
+		[]byte(header+htmlMessage),
+	)
+}
+
+// EnvAlertLoop evaluates alert rules of envs
+func EnvAlertLoop() {
+	sec, _ := strconv.Atoi(config.AlertEvalSec())
+	if sec <= 0 {
+		sec = 30
+	}
+
+	for {
+		time.Sleep(time.Duration(sec) * time.Second)
+
+		if db2.TheMetrics == nil || !db2.TheMetrics.Enabled() {
+			continue
+		}
+
+		now := time.Now()
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete || len(env.Alerts.Rules) == 0 {
+				alertStateReset(env.ID)
+				continue
+			}
+			env.alertEvaluate(now)
+		}
+		alertSilencesCleanup()
+	}
+}
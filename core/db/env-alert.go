@@ -0,0 +1,382 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/maps"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Alert rules of env are PromQL expressions evaluated by core against
+// VictoriaMetrics, queries are limited to series of env (env_id or namespace
+// label). Firing alerts are grouped by routes and delivered by
+// NotificationProvider, see env-alert-eval.go. Rules and routes are part of
+// env TOML in git, `[alert.<name>]` and `[[alert-route]]`.
+
+// AlertRuleS is `[alert.<name>]` of env
+type AlertRuleS struct {
+	Expr     string            `toml:"expr"`               // PromQL, every returned series is an alert
+	For      string            `toml:"for,omitempty"`      // condition has to be true for duration before firing, eg. 5m
+	Severity string            `toml:"severity,omitempty"` // critical, warning (default) or info
+	Labels   map[string]string `toml:"labels,omitempty"`   // added to labels of series
+	Summary  string            `toml:"summary,omitempty"`  // template, eg. `{{ $labels.pod }} uses {{ $value }} MB`
+	Disabled bool              `toml:"disabled,omitempty"`
+}
+
+// AlertRouteS is `[[alert-route]]` of env, alerts go to first route they
+// match, unless route has `continue`
+type AlertRouteS struct {
+	Match          map[string]string `toml:"match,omitempty"`    // label=value, empty matches all alerts
+	MatchRe        map[string]string `toml:"match-re,omitempty"` // label=regexp
+	Emails         []string          `toml:"emails"`
+	Provider       string            `toml:"provider,omitempty"`        // name of NotificationProvider, default first enabled SMTP provider
+	GroupBy        []string          `toml:"group-by,omitempty"`        // labels, default alertname
+	GroupWait      string            `toml:"group-wait,omitempty"`      // wait for more alerts of group before sending, default 30s
+	RepeatInterval string            `toml:"repeat-interval,omitempty"` // resend firing group, default 4h
+	Continue       bool              `toml:"continue,omitempty"`
+}
+
+// EnvironmentAlertsS are alert rules and routes of env
+type EnvironmentAlertsS struct {
+	Rules  map[string]*AlertRuleS // key=alert name
+	Routes []*AlertRouteS
+}
+
+// AlertSilenceS mutes alerts of env matching all labels until EndTime
+type AlertSilenceS struct {
+	ID        string
+	EnvID     string
+	Match     map[string]string
+	Comment   string
+	StartTime int64
+	EndTime   int64
+	UserEmail string
+}
+
+const (
+	AlertSeverityCritical = "critical"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityInfo     = "info"
+)
+
+var (
+	alertSilenceMap = maps.NewSafe[string, *AlertSilenceS](nil) // key=ID
+	reAlertLabel    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func LoadAlertSilences() {
+	alertSilenceMap = maps.NewSafe[string, *AlertSilenceS](nil)
+	list, err := driver.ReadAll("alert-silence")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		s := &AlertSilenceS{}
+		if err := json.Unmarshal(buf, s); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		alertSilenceMap.Set(s.ID, s)
+	}
+}
+
+// alertDuration returns parsed duration, def for empty value
+func alertDuration(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+func alertLabelsCheck(labels map[string]string) *tlog.RecordS {
+	for k := range labels {
+		if !reAlertLabel.MatchString(k) {
+			return tlog.Error("invalid label name {{label}}", tlog.Vars{
+				"label": k,
+			})
+		}
+	}
+	return nil
+}
+
+func (rule *AlertRuleS) check(name string) *tlog.RecordS {
+	if !reSimpleName2.MatchString(name) {
+		return tlog.Error("invalid alert name {{name}}, use a-z, 0-9, - and .", tlog.Vars{
+			"name": name,
+		})
+	}
+	if rule == nil || strings.TrimSpace(rule.Expr) == "" {
+		return tlog.Error("alert {{name}}: expr is empty", tlog.Vars{
+			"name": name,
+		})
+	}
+	if rule.For != "" {
+		if d, err := time.ParseDuration(rule.For); err != nil || d < 0 {
+			return tlog.Error("alert {{name}}: invalid for {{for}}", tlog.Vars{
+				"name": name,
+				"for":  rule.For,
+			})
+		}
+	}
+	switch rule.Severity {
+	case "":
+		rule.Severity = AlertSeverityWarning
+	case AlertSeverityCritical, AlertSeverityWarning, AlertSeverityInfo:
+	default:
+		return tlog.Error("alert {{name}}: severity has to be critical, warning or info", tlog.Vars{
+			"name": name,
+		})
+	}
+	if err := alertLabelsCheck(rule.Labels); err != nil {
+		return err
+	}
+	if rule.Summary != "" {
+		if _, err := template.New(name).Parse(alertTemplatePrefix + rule.Summary); err != nil {
+			return tlog.Error(fmt.Sprintf("alert %s: invalid summary: %v", name, err))
+		}
+	}
+	return nil
+}
+
+func (route *AlertRouteS) check() *tlog.RecordS {
+	if route == nil {
+		return tlog.Error("alert route is empty")
+	}
+	if len(route.Emails) == 0 {
+		return tlog.Error("alert route needs at least one email")
+	}
+	if err := alertLabelsCheck(route.Match); err != nil {
+		return err
+	}
+	if err := alertLabelsCheck(route.MatchRe); err != nil {
+		return err
+	}
+	for _, re := range route.MatchRe {
+		if _, err := regexp.Compile("^(?:" + re + ")$"); err != nil {
+			return tlog.Error(fmt.Sprintf("invalid alert route match-re: %v", err))
+		}
+	}
+	for _, value := range []string{route.GroupWait, route.RepeatInterval} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return tlog.Error("invalid alert route duration {{value}}", tlog.Vars{
+				"value": value,
+			})
+		}
+	}
+	if route.Provider != "" && alertProviderGet(route.Provider) == nil {
+		return tlog.Error("notification provider {{provider}} not found", tlog.Vars{
+			"provider": route.Provider,
+		})
+	}
+	return nil
+}
+
+func (alerts *EnvironmentAlertsS) check() *tlog.RecordS {
+	for name, rule := range alerts.Rules {
+		if err := rule.check(name); err != nil {
+			return err
+		}
+	}
+	for _, route := range alerts.Routes {
+		if err := route.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches returns true when labels of alert match route
+func (route *AlertRouteS) matches(labels map[string]string) bool {
+	for k, v := range route.Match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for k, re := range route.MatchRe {
+		if ok, _ := regexp.MatchString("^(?:"+re+")$", labels[k]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// SetAlerts sets alert rules and routes of env, envs managed by GitOps take
+// them from env TOML in git
+func (env *EnvironmentS) SetAlerts(alerts EnvironmentAlertsS, user *UserS) *tlog.RecordS {
+
+	if env.GitOps.Enabled {
+		return tlog.Error("alerts of environment are managed by git, edit env TOML in {{repo}}", tlog.Vars{
+			"repo": env.GitOps.GitRepoName,
+		})
+	}
+	if err := alerts.check(); err != nil {
+		return err
+	}
+
+	env.Alerts = alerts
+	alertStateReset(env.ID)
+
+	tlog.Info("env alerts set", tlog.Vars{
+		"env":    env.ID,
+		"rules":  len(alerts.Rules),
+		"routes": len(alerts.Routes),
+		"event":  true,
+		"user":   user.Email,
+	})
+	return env.Save(user)
+}
+
+// alertsFromGit applies alerts of env TOML in git
+func (env *EnvironmentS) alertsFromGit(alerts EnvironmentAlertsS) {
+	if reflect.DeepEqual(env.Alerts, alerts) {
+		return
+	}
+	env.Alerts = alerts
+	alertStateReset(env.ID)
+
+	tlog.Info("env alerts updated from git", tlog.Vars{
+		"env":    env.ID,
+		"rules":  len(alerts.Rules),
+		"routes": len(alerts.Routes),
+		"event":  true,
+	})
+	tlog.Error(env.Save(nil))
+}
+
+// TOML returns alerts as part of env TOML
+func (alerts EnvironmentAlertsS) TOML() string {
+	if len(alerts.Rules) == 0 && len(alerts.Routes) == 0 {
+		return ""
+	}
+	buf, err := toml.Marshal(struct {
+		Alert      map[string]*AlertRuleS `toml:"alert,omitempty"`
+		AlertRoute []*AlertRouteS         `toml:"alert-route,omitempty"`
+	}{alerts.Rules, alerts.Routes})
+	if err != nil {
+		tlog.Error(err)
+		return ""
+	}
+	return string(buf)
+}
+
+// AlertSilenceList returns silences of env which did not end, newest first
+func AlertSilenceList(envID string) []*AlertSilenceS {
+	now := time.Now().Unix()
+	res := []*AlertSilenceS{}
+	for _, s := range alertSilenceMap.Values() {
+		if s.EnvID == envID && s.EndTime > now {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartTime > res[j].StartTime })
+	return res
+}
+
+// AlertSilenceCreate mutes alerts of env matching labels for duration
+func AlertSilenceCreate(env *EnvironmentS, match map[string]string, duration time.Duration, comment string, user *UserS) (*AlertSilenceS, *tlog.RecordS) {
+
+	if len(match) == 0 {
+		return nil, tlog.Error("silence needs at least one label")
+	}
+	if err := alertLabelsCheck(match); err != nil {
+		return nil, err
+	}
+	if duration <= 0 || duration > 90*24*time.Hour {
+		return nil, tlog.Error("silence duration has to be between 1 minute and 90 days")
+	}
+
+	now := time.Now()
+	s := &AlertSilenceS{
+		ID:        newRBACID()[:16],
+		EnvID:     env.ID,
+		Match:     match,
+		Comment:   strings.TrimSpace(comment),
+		StartTime: now.Unix(),
+		EndTime:   now.Add(duration).Unix(),
+		UserEmail: user.Email,
+	}
+	if err := driver.Write("alert-silence", s.ID, s); err != nil {
+		return nil, tlog.Error(err)
+	}
+	alertSilenceMap.Set(s.ID, s)
+
+	tlog.Info("alert silence created", tlog.Vars{
+		"env":     env.ID,
+		"match":   match,
+		"endTime": s.EndTime,
+		"event":   true,
+		"user":    user.Email,
+	})
+	return s, nil
+}
+
+func (s *AlertSilenceS) Delete(user *UserS) *tlog.RecordS {
+	if err := driver.Delete("alert-silence", s.ID); err != nil {
+		return tlog.Error(err)
+	}
+	alertSilenceMap.Delete(s.ID)
+
+	if user != nil {
+		tlog.Info("alert silence deleted", tlog.Vars{
+			"env":   s.EnvID,
+			"match": s.Match,
+			"event": true,
+			"user":  user.Email,
+		})
+	}
+	return nil
+}
+
+// AlertSilenceGet returns silence of env
+func AlertSilenceGet(envID, id string) *AlertSilenceS {
+	s := alertSilenceMap.Get(id)
+	if s == nil || s.EnvID != envID {
+		return nil
+	}
+	return s
+}
+
+// alertSilenced returns true when active silence of env matches labels
+func alertSilenced(envID string, labels map[string]string, now time.Time) bool {
+	for _, s := range alertSilenceMap.Values() {
+		if s.EnvID != envID || s.StartTime > now.Unix() || s.EndTime <= now.Unix() {
+			continue
+		}
+		match := true
+		for k, v := range s.Match {
+			if labels[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// alertSilencesCleanup removes ended silences, all silences of deleted env
+func alertSilencesCleanup() {
+	now := time.Now().Unix()
+	for _, s := range alertSilenceMap.Values() {
+		if s.EndTime <= now || EnvironmentMap.Get(s.EnvID) == nil {
+			tlog.Error(s.Delete(nil))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"core/kube"
+	"lib/tlog"
+	"lib/utils/maps"
+	"time"
+)
+
+// EnvClusterMigrationS is move of env to other cluster in progress: env is
+// drained from old cluster (its namespace is deleted) and then kubesync
+// recreates its elements on new one. Data of volumes is not moved, it has to
+// be restored from backups of elements, so user has to confirm deletion of
+// volumes when migration is started.
+type EnvClusterMigrationS struct {
+	From      string
+	To        string
+	State     string
+	Error     string
+	StartTime int64
+	UserEmail string
+}
+
+const (
+	EnvClusterMigrationDraining = "draining"
+)
+
+var envClusterMigrating = maps.NewSafe[string, bool](nil) // key=env-id
+
+// envKube returns client of cluster of env
+func envKube(envID string) *kube.ClientS {
+	env := EnvironmentMap.Get(envID)
+	if env == nil {
+		return kube.GetKube()
+	}
+	return env.KubeClient()
+}
+
+// KubeClient returns client of cluster on which env runs, nil when cluster
+// is not reachable
+func (env *EnvironmentS) KubeClient() *kube.ClientS {
+	return kube.GetKubeCluster(env.ClusterName)
+}
+
+// SameCluster returns true when both envs run on the same cluster
+func (env *EnvironmentS) SameCluster(other *EnvironmentS) bool {
+	return env.clusterName() == other.clusterName()
+}
+
+// clusterName returns name of cluster of env, local cluster is empty
+func (env *EnvironmentS) clusterName() string {
+	if env.ClusterName == kube.LocalClusterName() {
+		return ""
+	}
+	return env.ClusterName
+}
+
+func (element *elementS) kubeClient() *kube.ClientS {
+	return envKube(element.EnvironmentID)
+}
+
+// EnvironmentsOnCluster returns IDs of envs placed on cluster
+func EnvironmentsOnCluster(name string) []string {
+	res := []string{}
+	for _, env := range EnvironmentMap.Values() {
+		if env.ClusterName == name || (env.ClusterMigration != nil && env.ClusterMigration.To == name) {
+			res = append(res, env.ID)
+		}
+	}
+	return res
+}
+
+// ClusterMigrate moves env to cluster, empty name is local cluster.
+// deleteVolumes confirms that volumes of env on current cluster are deleted
+// with its namespace.
+func (env *EnvironmentS) ClusterMigrate(cluster string, deleteVolumes bool, user *UserS) *tlog.RecordS {
+
+	if cluster == kube.LocalClusterName() {
+		cluster = ""
+	}
+	if cluster == env.clusterName() {
+		return tlog.Error("environment is already on this cluster")
+	}
+	if env.ToDelete {
+		return tlog.Error("environment is deleted")
+	}
+	if env.ClusterMigration != nil {
+		return tlog.Error("migration of environment is in progress")
+	}
+	if !kube.ClusterExists(cluster) {
+		return tlog.Error("cluster not found or disabled")
+	}
+	if kube.GetKubeCluster(cluster) == nil {
+		return tlog.Error("unable to connect to cluster")
+	}
+	if !deleteVolumes {
+		return tlog.Error("volumes of environment are deleted with its namespace on current cluster, back up elements and confirm deletion of volumes")
+	}
+
+	env.ClusterMigration = &EnvClusterMigrationS{
+		From:      env.clusterName(),
+		To:        cluster,
+		State:     EnvClusterMigrationDraining,
+		StartTime: time.Now().Unix(),
+		UserEmail: user.Email,
+	}
+	if err := env.Save(user); err != nil {
+		env.ClusterMigration = nil
+		return err
+	}
+
+	tlog.Info("env cluster migration started, volumes on old cluster are deleted", tlog.Vars{
+		"env":   env.ID,
+		"from":  env.ClusterMigration.From,
+		"to":    cluster,
+		"user":  user.Email,
+		"event": true,
+	})
+
+	go env.clusterMigrate()
+	return nil
+}
+
+// ClusterMigrationResume continues migration interrupted by restart, env is
+// not applied to any cluster until migration is finished
+func (env *EnvironmentS) ClusterMigrationResume() bool {
+	if env.ClusterMigration == nil {
+		return false
+	}
+	if !envClusterMigrating.Exists(env.ID) {
+		go env.clusterMigrate()
+	}
+	return true
+}
+
+func (env *EnvironmentS) clusterMigrate() {
+	defer PanicHandler()
+
+	if envClusterMigrating.Exists(env.ID) {
+		return
+	}
+	envClusterMigrating.Set(env.ID, true)
+	defer envClusterMigrating.Delete(env.ID)
+
+	m := env.ClusterMigration
+	vars := tlog.Vars{
+		"env":   env.ID,
+		"from":  m.From,
+		"to":    m.To,
+		"user":  m.UserEmail,
+		"event": true,
+	}
+
+	// drain
+	if old := kube.GetKubeCluster(m.From); old != nil {
+		env.SetStatusForAllElements(ElementStatusTerminating, nil)
+		if old.NamespaceGet(env.ID) != nil {
+			tlog.Error(old.NamespaceDelete(env.ID))
+		}
+		drained := waitFor(30*time.Minute, func() bool {
+			return old.NamespaceGet(env.ID) == nil
+		})
+		if !drained {
+			m.Error = "namespace on old cluster is still terminating"
+			tlog.Warning("env cluster migration: "+m.Error, vars)
+		}
+	} else {
+		m.Error = "old cluster is not reachable, namespace was not deleted"
+		tlog.Warning("env cluster migration: "+m.Error, vars)
+	}
+
+	// recreate, kubesync applies elements on new cluster
+	env.ClusterName = m.To
+	env.ClusterMigration = nil
+	env.SetStatusForAllElements(ElementStatusDeploying, nil)
+	if err := env.Save(nil); err != nil {
+		vars["error"] = err.Message
+		tlog.Error("env cluster migration failed", vars)
+		return
+	}
+	tlog.Info("env cluster migration finished", vars)
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"bytes"
+	"core/config"
+	"core/db2"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lib/tlog"
+	"lib/utils/maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dashboards of envs and elements are provisioned by core through HTTP API of
+// Grafana into folder `Environments`, one per env and one per element.
+// EnvDashboardLoop regenerates them, uploads the changed ones and deletes
+// dashboards of removed envs and elements (tagged `timoni`).
+
+const (
+	dashboardLoopInterval = time.Minute
+	dashboardFolderUID    = "timoni-envs"
+	dashboardTag          = "timoni"
+	grafanaDatasourceUID  = "0FPyLuV4k" // metrics-grafana/provisioning/datasources
+	grafanaUser           = "admin"
+)
+
+var (
+	dashboardHashMap = maps.NewSafe[string, string](nil) // key=dashboard uid, hash of uploaded model
+	dashboardURLMap  = maps.NewSafe[string, string](nil) // key=dashboard uid, path under /grafana/
+	dashboardFolder  bool
+)
+
+// envDashboardUID returns uid of dashboard of env, or of element when
+// elementName is not empty, uid of Grafana has at most 40 chars
+func envDashboardUID(envID, elementName string) string {
+	if elementName == "" {
+		sum := sha1.Sum([]byte(envID))
+		return "timoni-env-" + hex.EncodeToString(sum[:])[:16]
+	}
+	sum := sha1.Sum([]byte(envID + "/" + elementName))
+	return "timoni-el-" + hex.EncodeToString(sum[:])[:20]
+}
+
+// DashboardLinks returns paths of dashboards of env and its elements
+// (key=element name), empty until they are uploaded to Grafana
+func (env *EnvironmentS) DashboardLinks() (string, map[string]string) {
+	elements := map[string]string{}
+	for _, elName := range env.Elements.Keys() {
+		if link := dashboardURLMap.Get(envDashboardUID(env.ID, elName)); link != "" {
+			elements[elName] = link
+		}
+	}
+	return dashboardURLMap.Get(envDashboardUID(env.ID, "")), elements
+}
+
+func grafanaRequest(method, path string, body interface{}) ([]byte, *tlog.RecordS) {
+
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, tlog.Error(err)
+		}
+		reader = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(config.GrafanaURL(), "/")+path, reader)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	req.SetBasicAuth(grafanaUser, db2.TheMetrics.GrafanaAdminPassword())
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	defer response.Body.Close()
+	buf, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	if response.StatusCode >= 300 {
+		return buf, tlog.Error(fmt.Sprintf("grafana %s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(buf))))
+	}
+	return buf, nil
+}
+
+// dashboardTarget is PromQL of panel
+type dashboardTarget struct {
+	Expr   string
+	Legend string
+}
+
+// dashboardPanel returns time series panel, panels are laid out by two in row
+func dashboardPanel(index int, title, unit string, targets ...dashboardTarget) map[string]interface{} {
+	datasource := map[string]string{"type": "prometheus", "uid": grafanaDatasourceUID}
+
+	list := []map[string]interface{}{}
+	for i, t := range targets {
+		list = append(list, map[string]interface{}{
+			"datasource":   datasource,
+			"expr":         t.Expr,
+			"legendFormat": t.Legend,
+			"refId":        string(rune('A' + i%26)),
+		})
+	}
+
+	return map[string]interface{}{
+		"id":         index + 1,
+		"type":       "timeseries",
+		"title":      title,
+		"datasource": datasource,
+		"gridPos":    map[string]int{"h": 8, "w": 12, "x": index % 2 * 12, "y": index / 2 * 8},
+		"fieldConfig": map[string]interface{}{
+			"defaults": map[string]interface{}{"unit": unit},
+		},
+		"targets": list,
+	}
+}
+
+func dashboardModel(uid, title string, tags []string, links []map[string]interface{}, panels []map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"uid":           uid,
+		"title":         title,
+		"tags":          tags,
+		"links":         links,
+		"panels":        panels,
+		"editable":      false,
+		"refresh":       "1m",
+		"schemaVersion": 38,
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+	}
+}
+
+// dashboardOfEnv returns model of dashboard of env with series per element
+func (env *EnvironmentS) dashboardOfEnv() map[string]interface{} {
+
+	envLabel := fmt.Sprintf(`env_id=%q`, env.ID)
+	ns := fmt.Sprintf(`namespace=%q`, env.ID)
+
+	panels := []map[string]interface{}{
+		dashboardPanel(0, "CPU by element", "percent", dashboardTarget{
+			Expr:   fmt.Sprintf(`sum by (element) (timoni_process_cpu_utilization{%s})`, envLabel),
+			Legend: "{{element}}",
+		}),
+		dashboardPanel(1, "RAM by element", "kbytes", dashboardTarget{
+			Expr:   fmt.Sprintf(`sum by (element) (timoni_process_rss_utilization{%s})`, envLabel),
+			Legend: "{{element}}",
+		}),
+		dashboardPanel(2, "Pod restarts (1h)", "short", dashboardTarget{
+			Expr:   fmt.Sprintf(`sum by (label_element) (increase(kube_pod_container_status_restarts_total{%s}[1h]) * on (namespace, pod) group_left (label_element) kube_pod_labels{%s})`, ns, ns),
+			Legend: "{{label_element}}",
+		}),
+		dashboardPanel(3, "Log errors (5m)", "short", dashboardTarget{
+			Expr:   fmt.Sprintf(`sum by (element) (increase(timoni_journal_entries_total{%s,level=~"ERROR|FATAL"}[5m]))`, envLabel),
+			Legend: "{{element}}",
+		}),
+	}
+
+	requests := []dashboardTarget{}
+	for _, elName := range env.Elements.Keys() {
+		if domain, ok := GetElementDomain(env.GetElement(elName)); ok {
+			requests = append(requests, dashboardTarget{
+				Expr:   fmt.Sprintf(`sum(rate(traefik_router_requests_total{router=~%q}[5m]))`, domain.routerRegex()),
+				Legend: elName,
+			})
+		}
+	}
+	if len(requests) > 0 {
+		panels = append(panels, dashboardPanel(len(panels), "Requests by domain", "reqps", requests...))
+	}
+
+	links := []map[string]interface{}{{
+		"title":      "Elements",
+		"type":       "dashboards",
+		"tags":       []string{"env:" + env.ID},
+		"asDropdown": true,
+	}}
+	return dashboardModel(envDashboardUID(env.ID, ""), "Env "+env.Name, []string{dashboardTag, "env:" + env.ID}, links, panels)
+}
+
+// dashboardOfElement returns model of dashboard of element, traffic of domain
+// elements, resources, restarts and logs of others
+func (env *EnvironmentS) dashboardOfElement(elName string, element EnvElementS) map[string]interface{} {
+
+	panels := []map[string]interface{}{}
+
+	if domain, ok := GetElementDomain(element); ok {
+		router := fmt.Sprintf(`router=~%q`, domain.routerRegex())
+		panels = append(panels,
+			dashboardPanel(0, "Requests by code", "reqps", dashboardTarget{
+				Expr:   fmt.Sprintf(`sum by (code) (rate(traefik_router_requests_total{%s}[5m]))`, router),
+				Legend: "{{code}}",
+			}),
+			dashboardPanel(1, "Latency", "s",
+				dashboardTarget{
+					Expr:   fmt.Sprintf(`histogram_quantile(0.5, sum by (le) (rate(traefik_router_request_duration_seconds_bucket{%s}[5m])))`, router),
+					Legend: "p50",
+				},
+				dashboardTarget{
+					Expr:   fmt.Sprintf(`histogram_quantile(0.95, sum by (le) (rate(traefik_router_request_duration_seconds_bucket{%s}[5m])))`, router),
+					Legend: "p95",
+				},
+			),
+		)
+	} else {
+		labels := fmt.Sprintf(`env_id=%q,element=%q`, env.ID, elName)
+		ns := fmt.Sprintf(`namespace=%q`, env.ID)
+		panels = append(panels,
+			dashboardPanel(0, "CPU by process", "percent", dashboardTarget{
+				Expr:   fmt.Sprintf(`sum by (name) (timoni_process_cpu_utilization{%s})`, labels),
+				Legend: "{{name}}",
+			}),
+			dashboardPanel(1, "RAM by process", "kbytes", dashboardTarget{
+				Expr:   fmt.Sprintf(`sum by (name) (timoni_process_rss_utilization{%s})`, labels),
+				Legend: "{{name}}",
+			}),
+			dashboardPanel(2, "Pod restarts (1h)", "short", dashboardTarget{
+				Expr:   fmt.Sprintf(`sum by (pod) (increase(kube_pod_container_status_restarts_total{%s}[1h]) * on (namespace, pod) group_left () kube_pod_labels{%s,label_element=%q})`, ns, ns, elName),
+				Legend: "{{pod}}",
+			}),
+			dashboardPanel(3, "Log entries by level (5m)", "short", dashboardTarget{
+				Expr:   fmt.Sprintf(`sum by (level) (increase(timoni_journal_entries_total{%s}[5m]))`, labels),
+				Legend: "{{level}}",
+			}),
+		)
+	}
+
+	links := []map[string]interface{}{{
+		"title": "Env " + env.Name,
+		"type":  "link",
+		"url":   dashboardURLMap.Get(envDashboardUID(env.ID, "")),
+	}}
+	tags := []string{dashboardTag, "env:" + env.ID, "element:" + elName}
+	return dashboardModel(envDashboardUID(env.ID, elName), env.Name+" / "+elName, tags, links, panels)
+}
+
+// dashboardUpload creates or overwrites dashboard when model changed
+func dashboardUpload(model map[string]interface{}) *tlog.RecordS {
+
+	uid := model["uid"].(string)
+	buf, err := json.Marshal(model)
+	if err != nil {
+		return tlog.Error(err)
+	}
+	sum := sha1.Sum(buf)
+	hash := hex.EncodeToString(sum[:])
+	if dashboardHashMap.Get(uid) == hash {
+		return nil
+	}
+
+	res, errx := grafanaRequest(http.MethodPost, "/api/dashboards/db", map[string]interface{}{
+		"dashboard": model,
+		"folderUid": dashboardFolderUID,
+		"overwrite": true,
+		"message":   "provisioned by timoni",
+	})
+	if errx != nil {
+		return errx
+	}
+
+	out := struct {
+		URL string `json:"url"`
+	}{}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return tlog.Error(err)
+	}
+	dashboardHashMap.Set(uid, hash)
+	dashboardURLMap.Set(uid, out.URL)
+	return nil
+}
+
+// dashboardFolderCreate creates folder of env dashboards if missing
+func dashboardFolderCreate() *tlog.RecordS {
+	if dashboardFolder {
+		return nil
+	}
+	if _, err := grafanaRequest(http.MethodGet, "/api/folders/"+dashboardFolderUID, nil); err != nil {
+		_, err = grafanaRequest(http.MethodPost, "/api/folders", map[string]string{
+			"uid":   dashboardFolderUID,
+			"title": "Environments",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	dashboardFolder = true
+	return nil
+}
+
+// dashboardsSync uploads dashboards of all envs and deletes the ones of
+// removed envs and elements
+func dashboardsSync() *tlog.RecordS {
+
+	if err := dashboardFolderCreate(); err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, env := range EnvironmentMap.Values() {
+		if env.ToDelete {
+			continue
+		}
+
+		model := env.dashboardOfEnv()
+		wanted[model["uid"].(string)] = true
+		if err := dashboardUpload(model); err != nil {
+			return err
+		}
+
+		for _, elName := range env.Elements.Keys() {
+			element := env.GetElement(elName)
+			if element == nil {
+				continue
+			}
+			model := env.dashboardOfElement(elName, element)
+			wanted[model["uid"].(string)] = true
+			if err := dashboardUpload(model); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := url.Values{}
+	query.Set("tag", dashboardTag)
+	query.Set("type", "dash-db")
+	query.Set("limit", "5000")
+	res, err := grafanaRequest(http.MethodGet, "/api/search?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	found := []struct {
+		UID string `json:"uid"`
+	}{}
+	if err := json.Unmarshal(res, &found); err != nil {
+		return tlog.Error(err)
+	}
+	exists := map[string]bool{}
+	for _, d := range found {
+		exists[d.UID] = true
+		if wanted[d.UID] {
+			continue
+		}
+		if _, err := grafanaRequest(http.MethodDelete, "/api/dashboards/uid/"+d.UID, nil); err != nil {
+			return err
+		}
+		dashboardHashMap.Delete(d.UID)
+		dashboardURLMap.Delete(d.UID)
+	}
+
+	// dashboards removed in Grafana are uploaded again
+	for _, uid := range dashboardHashMap.Keys() {
+		if !exists[uid] {
+			dashboardHashMap.Delete(uid)
+		}
+	}
+	return nil
+}
+
+// EnvDashboardLoop keeps Grafana dashboards of envs and elements up to date
+func EnvDashboardLoop() {
+	for {
+		time.Sleep(dashboardLoopInterval)
+
+		if db2.TheMetrics == nil || !db2.TheMetrics.Enabled() || !db2.TheMetrics.Grafana() {
+			continue
+		}
+		if err := dashboardsSync(); err != nil {
+			// folder could be removed in Grafana, check it again
+			dashboardFolder = false
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"core/kube"
+	"lib/tlog"
+	"sync"
+)
+
+// EnvDriftS is change of env object made in cluster outside of Timoni, found
+// by kube before the object was patched back to desired state
+type EnvDriftS struct {
+	kube.DriftS
+	EnvID       string
+	ElementName string
+}
+
+const envDriftMax = 100 // per env
+
+var (
+	envDriftLock = &sync.Mutex{}
+	envDriftMap  = map[string][]EnvDriftS{} // key=env-id, newest first
+)
+
+// envDriftAdd is kube.DriftHook, drifts of objects out of envs are ignored
+func envDriftAdd(d kube.DriftS) {
+
+	env := EnvironmentMap.Get(d.Namespace)
+	if env == nil {
+		return
+	}
+
+	drift := EnvDriftS{
+		DriftS: d,
+		EnvID:  env.ID,
+	}
+	if env.Elements.Exists(d.Name) {
+		drift.ElementName = d.Name
+	}
+
+	envDriftLock.Lock()
+	list := append([]EnvDriftS{drift}, envDriftMap[env.ID]...)
+	if len(list) > envDriftMax {
+		list = list[:envDriftMax]
+	}
+	envDriftMap[env.ID] = list
+	envDriftLock.Unlock()
+
+	tlog.Warning("element drift detected", tlog.Vars{
+		"env":     env.ID,
+		"element": drift.ElementName,
+		"kind":    d.Kind,
+		"name":    d.Name,
+		"live":    d.Live,
+		"desired": d.Desired,
+		"event":   true,
+	})
+}
+
+// EnvDriftList returns drifts found in env, newest first
+func EnvDriftList(envID string) []EnvDriftS {
+	envDriftLock.Lock()
+	defer envDriftLock.Unlock()
+	return append([]EnvDriftS{}, envDriftMap[envID]...)
+}
+
+// envDriftDelete drops drifts of deleted env
+func envDriftDelete(envID string) {
+	envDriftLock.Lock()
+	delete(envDriftMap, envID)
+	envDriftLock.Unlock()
+}
@@ -64,7 +64,7 @@ func (element *elementActionS) KubeApply() {
 
 func (element *elementActionS) DeleteFromKube() *tlog.RecordS {
 	tlog.Info("DeleteFromKube")
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
@@ -104,7 +104,7 @@ func elementActionCheckKubeDeploy(element *elementActionS) error {
 }
 
 func elementActionCreateOrUpdate(element *elementActionS) (anyChange bool, err error) {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return false, fmt.Errorf("kube.Client not ready")
@@ -119,6 +119,10 @@ func elementActionCreateOrUpdate(element *elementActionS) (anyChange bool, err e
 	// 	imageURL = strings.TrimPrefix(extIRurl, "https://") + "/" + element.ImageID
 	// }
 
+	if err := element.secretsCheck(); err != nil {
+		return false, fmt.Errorf("%s", err.Message)
+	}
+
 	// action variable
 	variables := element.VariablesGet(true)
 	variables["EP_ACTION_TOKEN"] = element.ActionToken
@@ -300,7 +304,7 @@ func elementActionCheckRunningContainers(element *elementActionS) CheckStepResul
 }
 
 func elementActionPods(element *elementActionS, onlyReady bool) (podList []*kube.PodS) {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return
@@ -318,7 +322,7 @@ func elementActionPods(element *elementActionS, onlyReady bool) (podList []*kube
 }
 
 func elementActionCleanupPods(element *elementActionS) {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return
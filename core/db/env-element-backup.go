@@ -0,0 +1,619 @@
+package db
+
+import (
+	"core/db/envelope"
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// elementBackupS is backup target of database element (`[backup.<name>]`),
+// dumps of mongodb are copied to it by rclone, elasticsearch uses it as
+// snapshot repository
+type elementBackupS struct {
+	Type     string `toml:"type"`      // s3, gcs, azure, filesystem (nfs)
+	ReadOnly bool   `toml:"read-only"` // only restore, eg. backups of other env
+	Path     string `toml:"path"`      // prefix in bucket, container or share
+
+	Schedule string `toml:"schedule"`  // cron schedule format, in timezone of env schedule
+	Keep     int    `toml:"keep"`      // number of scheduled backups kept, default 7
+	KeepDays int    `toml:"keep-days"` // scheduled backups older than days are deleted, 0 = no limit
+
+	// s3, AWS or compatible storage, eg. MinIO
+	S3Bucket    string `toml:"s3-bucket"`
+	S3Endpoint  string `toml:"s3-endpoint"`
+	S3Region    string `toml:"s3-region"`
+	S3AccessKey string `toml:"s3-access-key"`
+	S3SecretKey string `toml:"s3-secret-key"` // sealed on save
+
+	// gcs
+	GCSBucket      string `toml:"gcs-bucket"`
+	GCSCredentials string `toml:"gcs-credentials"` // JSON key of service account, sealed on save
+
+	// azure
+	AzureStorageAccountName      string `toml:"azure-storage-account-name"`
+	AzureStorageAccountKey       string `toml:"azure-storage-account-key"` // sealed on save
+	AzureStorageAccountContainer string `toml:"azure-storage-account-container"`
+
+	// filesystem, NFS share
+	RemoteServer string `toml:"remote-server"`
+	RemotePath   string `toml:"remote-path"`
+}
+
+const (
+	BackupTypeS3         = "s3"
+	BackupTypeGCS        = "gcs"
+	BackupTypeAzure      = "azure"
+	BackupTypeFilesystem = "filesystem"
+)
+
+// check validates target and sets defaults
+func (t *elementBackupS) check(name string) *tlog.RecordS {
+
+	if t.Type == "nfs" {
+		t.Type = BackupTypeFilesystem
+	}
+	missing := ""
+	switch t.Type {
+	case BackupTypeS3:
+		if t.S3Bucket == "" || t.S3AccessKey == "" || t.S3SecretKey == "" {
+			missing = "s3-bucket, s3-access-key and s3-secret-key"
+		}
+	case BackupTypeGCS:
+		if t.GCSBucket == "" || t.GCSCredentials == "" {
+			missing = "gcs-bucket and gcs-credentials"
+		}
+	case BackupTypeAzure:
+		if t.AzureStorageAccountName == "" || t.AzureStorageAccountKey == "" || t.AzureStorageAccountContainer == "" {
+			missing = "azure-storage-account-name, azure-storage-account-key and azure-storage-account-container"
+		}
+	case BackupTypeFilesystem:
+		if t.RemoteServer == "" || t.RemotePath == "" {
+			missing = "remote-server and remote-path"
+		}
+	default:
+		return tlog.Error("backup." + name + ": invalid type, use s3, gcs, azure or filesystem")
+	}
+	if missing != "" {
+		return tlog.Error("backup." + name + ": " + missing + " are required")
+	}
+
+	t.Path = strings.Trim(t.Path, "/")
+	if t.Schedule != "" {
+		if t.ReadOnly {
+			return tlog.Error("backup." + name + ": read-only target can't have schedule")
+		}
+		if _, err := cron.ParseStandard(t.Schedule); err != nil {
+			return tlog.Error(fmt.Sprintf("backup.%s: invalid schedule: %v", name, err))
+		}
+	}
+	if t.Keep <= 0 {
+		t.Keep = 7
+	}
+	if t.KeepDays < 0 {
+		return tlog.Error("backup." + name + ": keep-days can't be negative")
+	}
+	return nil
+}
+
+// secrets returns credentials of target, they are sealed with envelope
+// encryption on save like secret variables
+func (t *elementBackupS) secrets() []*string {
+	return []*string{&t.S3SecretKey, &t.GCSCredentials, &t.AzureStorageAccountKey}
+}
+
+// seal seals plain credentials, ciphertext of unchanged ones is kept from
+// stored target
+func (t *elementBackupS) seal(stored elementBackupS) {
+	prev := stored.secrets()
+	for i, v := range t.secrets() {
+		*v = resealPlain(*prev[i], *v)
+	}
+}
+
+// open returns copy of target with plain credentials
+func (t *elementBackupS) open() (*elementBackupS, *tlog.RecordS) {
+	res := *t
+	for _, v := range res.secrets() {
+		plain, err := envelope.Open(*v)
+		if err != nil {
+			return nil, tlog.Error("credentials of backup target could not be decrypted, check master key: {{error}}", tlog.Vars{
+				"error": err.Error(),
+			})
+		}
+		*v = plain
+	}
+	return &res, nil
+}
+
+// rcloneEnv returns configuration of rclone remote `target`
+func (t *elementBackupS) rcloneEnv() map[string][]byte {
+	env := map[string]string{}
+	switch t.Type {
+	case BackupTypeS3:
+		env["TYPE"] = "s3"
+		env["PROVIDER"] = "AWS"
+		if t.S3Endpoint != "" {
+			env["PROVIDER"] = "Other"
+			env["ENDPOINT"] = t.S3Endpoint
+		}
+		env["REGION"] = t.S3Region
+		env["ACCESS_KEY_ID"] = t.S3AccessKey
+		env["SECRET_ACCESS_KEY"] = t.S3SecretKey
+	case BackupTypeGCS:
+		env["TYPE"] = "google cloud storage"
+		env["SERVICE_ACCOUNT_CREDENTIALS"] = t.GCSCredentials
+		env["BUCKET_POLICY_ONLY"] = "true"
+	case BackupTypeAzure:
+		env["TYPE"] = "azureblob"
+		env["ACCOUNT"] = t.AzureStorageAccountName
+		env["KEY"] = t.AzureStorageAccountKey
+	case BackupTypeFilesystem:
+		env["TYPE"] = "local"
+	}
+
+	res := map[string][]byte{}
+	for k, v := range env {
+		if v != "" {
+			res["RCLONE_CONFIG_TARGET_"+k] = []byte(v)
+		}
+	}
+	return res
+}
+
+// rcloneRemote returns rclone path of file, filesystem target is mounted
+// in /backup
+func (t *elementBackupS) rcloneRemote(file string) string {
+	path := file
+	if t.Path != "" {
+		path = t.Path + "/" + file
+	}
+	switch t.Type {
+	case BackupTypeS3:
+		return "target:" + t.S3Bucket + "/" + path
+	case BackupTypeGCS:
+		return "target:" + t.GCSBucket + "/" + path
+	case BackupTypeAzure:
+		return "target:" + t.AzureStorageAccountContainer + "/" + path
+	}
+	return "target:/backup/" + path
+}
+
+// --------------------------------------------------
+
+// elementBackuperI is element with backup targets (mongodb, elasticsearch)
+type elementBackuperI interface {
+	EnvElementS
+	backupTargets() map[string]elementBackupS
+	backupRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS
+	backupPoll(b *ElementBackupS, t *elementBackupS) (done bool, err *tlog.RecordS)
+	backupRemove(b *ElementBackupS, t *elementBackupS) *tlog.RecordS
+	restoreRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS
+	restorePoll(b *ElementBackupS, t *elementBackupS) (done bool, err *tlog.RecordS)
+}
+
+// ElementBackupS is backup of database element kept in backup target
+type ElementBackupS struct {
+	ID          string
+	EnvID       string
+	ElementName string
+	Target      string // name of `[backup.<name>]` of element
+	Name        string // file (mongodb) or snapshot (elasticsearch) in target
+	Label       string // point-in-time label, eg. `before-migration`
+	Scheduled   bool   // subject of retention
+	State       string
+	Error       string
+	SizeBytes   int64
+	StartTime   int64
+	EndTime     int64
+
+	CreatedByEmail string
+
+	RestoreState    string // empty = never restored
+	RestoreError    string
+	RestoreTime     int64
+	RestoredByEmail string
+}
+
+const (
+	ElementBackupRunning = "running"
+	ElementBackupReady   = "ready"
+	ElementBackupFailed  = "failed"
+)
+
+// ElementBackupStatusS is part of ElementStatusS of elements with backups
+type ElementBackupStatusS struct {
+	Running         bool
+	Restoring       bool
+	Count           int
+	LastTime        int64
+	LastState       string
+	LastError       string
+	LastSuccessTime int64
+	NextTime        int64
+}
+
+var ElementBackupMap = maps.NewSafe[string, *ElementBackupS](nil) // key=ID
+
+func LoadElementBackups() {
+	ElementBackupMap = maps.NewSafe[string, *ElementBackupS](nil)
+	list, err := driver.ReadAll("element-backup")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		b := &ElementBackupS{}
+		if err := json.Unmarshal(buf, b); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		ElementBackupMap.Set(b.ID, b)
+	}
+}
+
+// ElementBackupList returns backups of element, newest first, empty
+// elementName returns backups of all elements of env
+func ElementBackupList(envID, elementName string) []*ElementBackupS {
+	res := []*ElementBackupS{}
+	for _, b := range ElementBackupMap.Values() {
+		if b.EnvID == envID && (elementName == "" || b.ElementName == elementName) {
+			res = append(res, b)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartTime > res[j].StartTime })
+	return res
+}
+
+func (b *ElementBackupS) save() *tlog.RecordS {
+	if err := driver.Write("element-backup", b.ID, b); err != nil {
+		return tlog.Error(err)
+	}
+	ElementBackupMap.Set(b.ID, b)
+	return nil
+}
+
+func (b *ElementBackupS) vars(user *UserS) tlog.Vars {
+	email := "Timoni"
+	if user != nil {
+		email = user.Email
+	}
+	return tlog.Vars{
+		"env":     b.EnvID,
+		"element": b.ElementName,
+		"target":  b.Target,
+		"backup":  b.Name,
+		"user":    email,
+		"event":   true,
+	}
+}
+
+// element returns element of backup with its target
+func (b *ElementBackupS) element() (elementBackuperI, *elementBackupS, *tlog.RecordS) {
+	env := EnvironmentMap.Get(b.EnvID)
+	if env == nil {
+		return nil, nil, tlog.Error("environment not found")
+	}
+	return backupElementTarget(env, b.ElementName, b.Target)
+}
+
+func backupElementTarget(env *EnvironmentS, elementName, target string) (elementBackuperI, *elementBackupS, *tlog.RecordS) {
+	element, ok := env.GetElement(elementName).(elementBackuperI)
+	if !ok || element == nil {
+		return nil, nil, tlog.Error("element not found or it has no backups")
+	}
+	t, ok := element.backupTargets()[target]
+	if !ok {
+		return nil, nil, tlog.Error("backup target not found: " + target)
+	}
+	plain, err := t.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return element, plain, nil
+}
+
+// elementBackupBusy returns true when backup or restore of element is running
+func elementBackupBusy(envID, elementName string) bool {
+	for _, b := range ElementBackupList(envID, elementName) {
+		if b.State == ElementBackupRunning || b.RestoreState == ElementBackupRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// ElementBackupCreate starts backup of element to target
+func ElementBackupCreate(env *EnvironmentS, elementName, target, label string, scheduled bool, user *UserS) (*ElementBackupS, *tlog.RecordS) {
+
+	element, t, err := backupElementTarget(env, elementName, target)
+	if err != nil {
+		return nil, err
+	}
+	if t.ReadOnly {
+		return nil, tlog.Error("backup target is read-only")
+	}
+	if elementBackupBusy(env.ID, elementName) {
+		return nil, tlog.Error("backup or restore of element is in progress")
+	}
+
+	now := time.Now().UTC()
+	b := &ElementBackupS{
+		ID:          newRBACID()[:16],
+		EnvID:       env.ID,
+		ElementName: elementName,
+		Target:      target,
+		Label:       strings.TrimSpace(label),
+		Scheduled:   scheduled,
+		State:       ElementBackupRunning,
+		StartTime:   now.Unix(),
+	}
+	b.Name = fmt.Sprintf("%s-%s-%s", elementName, now.Format("20060102-150405"), b.ID[:6])
+	b.CreatedByEmail = "Timoni"
+	if user != nil {
+		b.CreatedByEmail = user.Email
+	}
+
+	if err := element.backupRun(b, t); err != nil {
+		return nil, err
+	}
+	if err := b.save(); err != nil {
+		return nil, err
+	}
+
+	vars := b.vars(user)
+	vars["label"] = b.Label
+	vars["scheduled"] = scheduled
+	tlog.Info("element backup started", vars)
+	return b, nil
+}
+
+// refresh updates state of running backup and restore
+func (b *ElementBackupS) refresh() {
+
+	if b.State != ElementBackupRunning && b.RestoreState != ElementBackupRunning {
+		return
+	}
+
+	element, t, err := b.element()
+	if b.State == ElementBackupRunning {
+		done := false
+		if err == nil {
+			done, err = element.backupPoll(b, t)
+		}
+		if err != nil {
+			b.State = ElementBackupFailed
+			b.Error = err.Message
+			b.EndTime = time.Now().Unix()
+			tlog.Error(b.save())
+
+			vars := b.vars(nil)
+			vars["error"] = b.Error
+			tlog.Error("element backup failed", vars)
+			return
+		}
+		if done {
+			b.State = ElementBackupReady
+			b.EndTime = time.Now().Unix()
+			tlog.Error(b.save())
+			tlog.Info("element backup finished", b.vars(nil))
+		}
+		return
+	}
+
+	done := false
+	if err == nil {
+		done, err = element.restorePoll(b, t)
+	}
+	if err != nil {
+		b.RestoreState = ElementBackupFailed
+		b.RestoreError = err.Message
+		tlog.Error(b.save())
+
+		vars := b.vars(nil)
+		vars["error"] = b.RestoreError
+		tlog.Error("element restore failed", vars)
+		return
+	}
+	if done {
+		b.RestoreState = ElementBackupReady
+		tlog.Error(b.save())
+		tlog.Info("element restore finished", b.vars(nil))
+	}
+}
+
+// Restore starts restore of element from backup
+func (b *ElementBackupS) Restore(user *UserS) *tlog.RecordS {
+
+	if b.State != ElementBackupReady {
+		return tlog.Error("backup is not ready")
+	}
+	element, t, err := b.element()
+	if err != nil {
+		return err
+	}
+	if elementBackupBusy(b.EnvID, b.ElementName) {
+		return tlog.Error("backup or restore of element is in progress")
+	}
+
+	if err := element.restoreRun(b, t); err != nil {
+		return err
+	}
+
+	b.RestoreState = ElementBackupRunning
+	b.RestoreError = ""
+	b.RestoreTime = time.Now().Unix()
+	b.RestoredByEmail = user.Email
+	if err := b.save(); err != nil {
+		return err
+	}
+
+	tlog.Info("element restore started", b.vars(user))
+	return nil
+}
+
+// Delete removes backup from target and its record
+func (b *ElementBackupS) Delete(user *UserS) *tlog.RecordS {
+
+	if b.State == ElementBackupRunning || b.RestoreState == ElementBackupRunning {
+		return tlog.Error("backup or restore is in progress")
+	}
+
+	if element, t, err := b.element(); err == nil && !t.ReadOnly && b.State == ElementBackupReady {
+		if err := element.backupRemove(b, t); err != nil {
+			return err
+		}
+	}
+	return b.deleteRecord(user)
+}
+
+func (b *ElementBackupS) deleteRecord(user *UserS) *tlog.RecordS {
+	if err := driver.Delete("element-backup", b.ID); err != nil {
+		return tlog.Error(err)
+	}
+	ElementBackupMap.Delete(b.ID)
+	tlog.Info("element backup deleted", b.vars(user))
+	return nil
+}
+
+// --------------------------------------------------
+
+// ElementBackupLoop runs scheduled backups of database elements, applies
+// retention, tracks running backups and updates status of elements
+func ElementBackupLoop() {
+	loopStart := time.Now()
+	for {
+		time.Sleep(time.Minute)
+
+		for _, b := range ElementBackupMap.Values() {
+			if EnvironmentMap.Get(b.EnvID) == nil {
+				// data stays in target, only record of deleted env is removed
+				tlog.Error(b.deleteRecord(nil))
+				continue
+			}
+			b.refresh()
+		}
+
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete {
+				continue
+			}
+			for _, elementName := range env.Elements.Keys() {
+				element, ok := env.GetElement(elementName).(elementBackuperI)
+				if !ok || element == nil || element.GetToDelete() {
+					continue
+				}
+				elementBackupSchedule(env, element, loopStart)
+			}
+		}
+	}
+}
+
+func elementBackupSchedule(env *EnvironmentS, element elementBackuperI, loopStart time.Time) {
+
+	loc := env.Schedule.Timezone
+	if loc == nil {
+		loc = time.UTC
+	}
+	status := &ElementBackupStatusS{}
+	backups := ElementBackupList(env.ID, element.GetName())
+
+	for name, t := range element.backupTargets() {
+		if t.Schedule == "" || t.ReadOnly {
+			continue
+		}
+		schedule, err := cron.ParseStandard(t.Schedule)
+		if err != nil {
+			continue
+		}
+
+		last := loopStart
+		for _, b := range backups {
+			if b.Scheduled && b.Target == name {
+				last = time.Unix(b.StartTime, 0)
+				break
+			}
+		}
+		next := schedule.Next(last.In(loc))
+		if !next.After(time.Now()) && !element.GetStopped() {
+			label := "scheduled " + time.Now().In(loc).Format("2006-01-02 15:04")
+			if b, err := ElementBackupCreate(env, element.GetName(), name, label, true, nil); err != nil {
+				tlog.Error("scheduled element backup failed", tlog.Vars{
+					"env":     env.ID,
+					"element": element.GetName(),
+					"target":  name,
+					"error":   err.Message,
+					"event":   true,
+				})
+			} else {
+				backups = append([]*ElementBackupS{b}, backups...)
+				next = schedule.Next(time.Now().In(loc))
+			}
+		}
+		if status.NextTime == 0 || next.Unix() < status.NextTime {
+			status.NextTime = next.Unix()
+		}
+
+		elementBackupTargetRetention(element, name, &t, backups)
+	}
+
+	for _, b := range ElementBackupList(env.ID, element.GetName()) {
+		status.Count++
+		status.Running = status.Running || b.State == ElementBackupRunning
+		status.Restoring = status.Restoring || b.RestoreState == ElementBackupRunning
+		if status.LastTime == 0 {
+			status.LastTime = b.StartTime
+			status.LastState = b.State
+			status.LastError = b.Error
+		}
+		if status.LastSuccessTime == 0 && b.State == ElementBackupReady {
+			status.LastSuccessTime = b.EndTime
+		}
+	}
+	element.GetStatus().Backup = status
+}
+
+func elementBackupTargetRetention(element elementBackuperI, target string, t *elementBackupS, backups []*ElementBackupS) {
+
+	minTime := int64(0)
+	if t.KeepDays > 0 {
+		minTime = time.Now().AddDate(0, 0, -t.KeepDays).Unix()
+	}
+
+	nr := 0
+	for _, b := range backups {
+		if !b.Scheduled || b.Target != target || b.State == ElementBackupRunning || b.RestoreState == ElementBackupRunning {
+			continue
+		}
+		nr++
+		if nr > t.Keep || b.StartTime < minTime {
+			tlog.Error(b.Delete(nil))
+		}
+	}
+}
+
+// backupTargetsCheck validates backup targets of element and seals their
+// credentials, stored are targets of saved element
+func backupTargetsCheck(targets, stored map[string]elementBackupS) *tlog.RecordS {
+	for name, t := range targets {
+		if err := t.check(name); err != nil {
+			return err
+		}
+		t.seal(stored[name])
+		targets[name] = t
+	}
+	return nil
+}
+
+// backupTargetsStored returns backup targets of saved element
+func backupTargetsStored(envID, elementName string) map[string]elementBackupS {
+	if old, ok := ElementMap.Get(envID + "/" + elementName).(elementBackuperI); ok {
+		return old.backupTargets()
+	}
+	return nil
+}
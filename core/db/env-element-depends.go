@@ -0,0 +1,325 @@
+package db
+
+import (
+	"lib/tlog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Elements can depend on other elements of env, eg.
+// `depends-on = ["postgres", "migrate:succeeded"]`. Element is applied when
+// each dependency is ready, dependency with `:succeeded` waits for action
+// element (or for the last run of action with this name) to succeed.
+// Dependencies make DAG, cycles and unknown names are rejected on save,
+// element whose dependency disappeared gets alert.
+
+const (
+	DependsOnReady     = "ready"
+	DependsOnSucceeded = "succeeded"
+)
+
+type ElementDependencyS struct {
+	Name  string
+	State string // ready, succeeded
+}
+
+type EnvDependencyGraphS struct {
+	Nodes  []EnvDependencyNodeS
+	Levels [][]string // elements in order of start, each level depends only on previous ones
+}
+
+type EnvDependencyNodeS struct {
+	Name      string
+	DependsOn []string
+	Waiting   []string // dependencies which are not satisfied yet
+}
+
+func parseDependsOn(dep string) (ElementDependencyS, *tlog.RecordS) {
+	name, state, ok := strings.Cut(strings.TrimSpace(dep), ":")
+	if !ok {
+		state = DependsOnReady
+	}
+	d := ElementDependencyS{Name: name, State: strings.ToLower(state)}
+	if d.State != DependsOnReady && d.State != DependsOnSucceeded {
+		return d, tlog.Error("depends-on `{{dep}}`: state has to be `ready` or `succeeded`", tlog.Vars{
+			"dep": dep,
+		})
+	}
+	if err := ElementNameCheck(d.Name); err != nil {
+		return d, tlog.Error("depends-on `{{dep}}`: "+err.Message, tlog.Vars{
+			"dep": dep,
+		})
+	}
+	return d, nil
+}
+
+func (element *elementS) GetDependsOn() []ElementDependencyS {
+	res := []ElementDependencyS{}
+	for _, dep := range element.DependsOn {
+		if d, err := parseDependsOn(dep); err == nil {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// checkDependsOn validates dependencies of element and rejects cycles made
+// with other elements of env. Added dependencies have to exist, except in
+// saves from git where elements are added in any order.
+func (element *elementS) checkDependsOn() *tlog.RecordS {
+
+	deps := map[string][]string{} // key=element-name
+	for _, dep := range element.DependsOn {
+		d, err := parseDependsOn(dep)
+		if err != nil {
+			return err
+		}
+		if d.Name == element.Name {
+			return tlog.Error("element can't depend on itself")
+		}
+		deps[element.Name] = append(deps[element.Name], d.Name)
+	}
+
+	env := EnvironmentMap.Get(element.EnvironmentID)
+	if env == nil || len(deps) == 0 {
+		return nil
+	}
+
+	if element.UserEmail != "Timoni" {
+		stored := map[string]bool{}
+		if old := ElementMap.Get(element.EnvironmentID + "/" + element.Name); old != nil {
+			for _, d := range old.GetDependsOn() {
+				stored[d.Name+":"+d.State] = true
+			}
+		}
+		for _, d := range element.GetDependsOn() {
+			if !stored[d.Name+":"+d.State] && !env.dependencyExists(d) {
+				return tlog.Error("depends-on `{{dep}}`: element not found", tlog.Vars{
+					"dep": d.Name,
+				})
+			}
+		}
+	}
+	for _, elName := range env.Elements.Keys() {
+		if elName == element.Name {
+			continue
+		}
+		if el := env.GetElement(elName); el != nil {
+			for _, d := range el.GetDependsOn() {
+				deps[elName] = append(deps[elName], d.Name)
+			}
+		}
+	}
+
+	// DFS from element, any path back to it is cycle
+	visited := map[string]bool{}
+	var walk func(name string, path []string) []string
+	walk = func(name string, path []string) []string {
+		for _, next := range deps[name] {
+			if next == element.Name {
+				return append(path, next)
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if cycle := walk(next, append(path, next)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	if cycle := walk(element.Name, []string{element.Name}); cycle != nil {
+		return tlog.Error("depends-on makes cycle: " + strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// dependencyExists returns true when dependency is element of env or name
+// of action (`:succeeded`)
+func (env *EnvironmentS) dependencyExists(d ElementDependencyS) bool {
+	if env.Elements.Exists(d.Name) {
+		el := env.GetElement(d.Name)
+		return el != nil && !el.GetToDelete()
+	}
+	if d.State == DependsOnReady {
+		return false
+	}
+	for _, elName := range env.Elements.Keys() {
+		if el, ok := env.GetElement(elName).(*elementActionS); ok && el.ActionName == d.Name && !el.GetToDelete() {
+			return true
+		}
+	}
+	return false
+}
+
+// ElementDependenciesMissing returns dependencies of element which are not in
+// env (deleted or never added), element can't be applied until they are back
+func (env *EnvironmentS) ElementDependenciesMissing(element EnvElementS) []string {
+	res := []string{}
+	for _, d := range element.GetDependsOn() {
+		if !env.dependencyExists(d) {
+			res = append(res, d.Name)
+		}
+	}
+	return res
+}
+
+// dependencySatisfied returns true when dependency is ready or its action
+// succeeded
+func (env *EnvironmentS) dependencySatisfied(d ElementDependencyS) bool {
+
+	if env.Elements.Exists(d.Name) {
+		el := env.GetElement(d.Name)
+		if action, ok := el.(*elementActionS); ok && d.State == DependsOnSucceeded {
+			return action.Status == ElementActionStatusSucceeded
+		}
+		return el != nil && !el.GetToDelete() && el.GetStatus().State == ElementStatusReady
+	}
+	if d.State == DependsOnReady {
+		return false
+	}
+
+	// last run of action with this name
+	var last *elementActionS
+	for _, elName := range env.Elements.Keys() {
+		el, ok := env.GetElement(elName).(*elementActionS)
+		if !ok || el.ActionName != d.Name {
+			continue
+		}
+		if last == nil || el.TimeBegin > last.TimeBegin {
+			last = el
+		}
+	}
+	return last != nil && last.Status == ElementActionStatusSucceeded
+}
+
+// ElementDependenciesWaiting returns dependencies of element which are not
+// satisfied, element should not be applied until list is empty
+func (env *EnvironmentS) ElementDependenciesWaiting(element EnvElementS) []string {
+	res := []string{}
+	for _, d := range element.GetDependsOn() {
+		if !env.dependencySatisfied(d) {
+			res = append(res, d.Name+":"+d.State)
+		}
+	}
+	return res
+}
+
+// ElementLevels returns elements ordered by dependencies, elements of the
+// same level can be started at once. Dependencies on actions which are not
+// elements do not change order.
+func (env *EnvironmentS) ElementLevels() [][]string {
+
+	deps := map[string]map[string]bool{}
+	for _, elName := range env.Elements.Keys() {
+		deps[elName] = map[string]bool{}
+	}
+	for elName := range deps {
+		el := env.GetElement(elName)
+		if el == nil {
+			continue
+		}
+		for _, d := range el.GetDependsOn() {
+			if _, ok := deps[d.Name]; ok {
+				deps[elName][d.Name] = true
+			}
+		}
+	}
+
+	res := [][]string{}
+	for len(deps) > 0 {
+		level := []string{}
+		for elName, waiting := range deps {
+			if len(waiting) == 0 {
+				level = append(level, elName)
+			}
+		}
+		if len(level) == 0 {
+			// cycle made outside of check, eg. by edited files, rest is started at once
+			for elName := range deps {
+				level = append(level, elName)
+			}
+		}
+		sort.Strings(level)
+		for _, elName := range level {
+			delete(deps, elName)
+		}
+		for _, waiting := range deps {
+			for _, elName := range level {
+				delete(waiting, elName)
+			}
+		}
+		res = append(res, level)
+	}
+	return res
+}
+
+// DependencyGraph returns dependencies of elements with their state
+func (env *EnvironmentS) DependencyGraph() EnvDependencyGraphS {
+
+	graph := EnvDependencyGraphS{
+		Nodes:  []EnvDependencyNodeS{},
+		Levels: env.ElementLevels(),
+	}
+	for _, level := range graph.Levels {
+		for _, elName := range level {
+			el := env.GetElement(elName)
+			if el == nil {
+				continue
+			}
+			node := EnvDependencyNodeS{
+				Name:      elName,
+				DependsOn: []string{},
+				Waiting:   env.ElementDependenciesWaiting(el),
+			}
+			for _, d := range el.GetDependsOn() {
+				node.DependsOn = append(node.DependsOn, d.Name+":"+d.State)
+			}
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+	return graph
+}
+
+// elementsStopped returns true when elements have no pods in kube
+func (env *EnvironmentS) elementsStopped(elNames []string) bool {
+	kClient := env.KubeClient()
+	if kClient == nil {
+		return true
+	}
+	names := map[string]bool{}
+	for _, elName := range elNames {
+		names[elName] = true
+	}
+	for _, pod := range kClient.PodListAll(env.ID) {
+		if names[pod.Obj.Labels["element"]] {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduleStopLevels stops elements in reverse order of dependencies, next
+// level is stopped when pods of elements depending on it are gone
+func (env *EnvironmentS) scheduleStopLevels() {
+	levels := env.ElementLevels()
+	for i := len(levels) - 1; i >= 0; i-- {
+		stopped := []string{}
+		for _, elementName := range levels[i] {
+			element := env.GetElement(elementName)
+			if element == nil || element.GetUnschedulable() {
+				continue
+			}
+			element.SetStopped(true)
+			element.Save(nil)
+			stopped = append(stopped, elementName)
+		}
+		if len(stopped) > 0 && i > 0 {
+			waitFor(2*time.Minute, func() bool {
+				return env.elementsStopped(stopped)
+			})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"core/db2"
+	"core/dnsprovider"
+	"core/kube"
+	"lib/tlog"
+	"lib/utils/maps"
+	"lib/utils/slice"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// last record applied to DNS provider, so provider API is not called on every KubeApply
+var domainDNSAppliedMap = maps.NewSafe[string, dnsprovider.RecordS](nil) // key=domain
+
+// ingressService returns service of traefik in cluster of env, domains of
+// http elements point to it
+func ingressService(kClient *kube.ClientS) *corev1.Service {
+	svc := kube.ServiceS{
+		KubeClient: kClient,
+		Namespace:  "timoni",
+		Name:       "ingress-traefik",
+	}
+	return svc.GetObj()
+}
+
+// dnsRecordForService returns A record for IP of load balancer, or CNAME for its hostname
+func dnsRecordForService(name string, svc *corev1.Service) (dnsprovider.RecordS, bool) {
+	if svc == nil || len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return dnsprovider.RecordS{}, false
+	}
+	lb := svc.Status.LoadBalancer.Ingress[0]
+	switch {
+	case lb.IP != "":
+		return dnsprovider.RecordS{Type: dnsprovider.TypeA, Name: name, Value: lb.IP}, true
+	case lb.Hostname != "" && lb.Hostname != "localhost":
+		return dnsprovider.RecordS{Type: dnsprovider.TypeCNAME, Name: name, Value: lb.Hostname}, true
+	}
+	return dnsprovider.RecordS{}, false
+}
+
+// dnsApply points domain of element to load balancer, when DNS provider of
+// domain is managed by Timoni. Errors are added to element alerts.
+func (element *elementDomainS) dnsApply(svc *corev1.Service) {
+
+	domain := db2.DomainList("Name = '"+element.Domain+"'", "", 0, 1).First()
+	if domain.NotValid() {
+		return
+	}
+
+	provider, err := DNSProviderGet(domain.DNSProvider())
+	if provider == nil {
+		element.dnsAlert(err)
+		return
+	}
+
+	record, ok := dnsRecordForService(element.Domain, svc)
+	if !ok {
+		return
+	}
+	if domain.IP() != "" {
+		record = dnsprovider.RecordS{Type: dnsprovider.TypeA, Name: element.Domain, Value: domain.IP()}
+	}
+	if domainDNSAppliedMap.Get(element.Domain) == record {
+		return
+	}
+
+	zone := domain.TLD()
+	if zone == "" {
+		z, e := dns01.FindZoneByFqdn(dns01.ToFqdn(element.Domain))
+		if e != nil {
+			element.dnsAlert(tlog.Error(e))
+			return
+		}
+		zone = dns01.UnFqdn(z)
+	}
+
+	// A and CNAME can't exist together
+	other := dnsprovider.RecordS{Type: dnsprovider.TypeCNAME, Name: element.Domain}
+	if record.Type == dnsprovider.TypeCNAME {
+		other.Type = dnsprovider.TypeA
+	}
+	if e := provider.Delete(zone, other); e != nil {
+		element.dnsAlert(tlog.Error(e))
+		return
+	}
+	if e := provider.Upsert(zone, record); e != nil {
+		element.dnsAlert(tlog.Error(e))
+		return
+	}
+
+	domainDNSAppliedMap.Set(element.Domain, record)
+	tlog.Info("DNS record of domain updated", tlog.Vars{
+		"envID":   element.EnvironmentID,
+		"element": element.Name,
+		"domain":  element.Domain,
+		"type":    record.Type,
+		"value":   record.Value,
+		"event":   true,
+	})
+}
+
+func (element *elementDomainS) dnsAlert(err *tlog.RecordS) {
+	if err == nil {
+		return
+	}
+	es := element.GetStatus()
+	msg := "DNS: " + err.Message
+	if !slice.Contains(es.Alerts, msg) {
+		es.Alerts = append(es.Alerts, msg)
+	}
+}
@@ -19,7 +19,7 @@ import (
 func (element *elementDomainS) KubeApply() {
 	defer PanicHandler()
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	es := element.GetStatus()
 
 	ingName := conv.KeyString(element.Name + "-" + element.Domain)
@@ -76,10 +76,17 @@ func (element *elementDomainS) KubeApply() {
 	}
 
 	switch element.ExternalProtocol {
-	case "tcp", "udp", "lb":
+	case "tcp", "udp":
+		element.KubeApplyRoute()
+		return
+	case "lb":
 		element.KubeApplyLoadalancer()
 		return
-
+	}
+	if key := element.EnvironmentID + "/" + element.Name; !domainRoutesDeletedMap.Exists(key) {
+		if tlog.Error(element.deleteRoutes()) == nil {
+			domainRoutesDeletedMap.Set(key, true)
+		}
 	}
 
 	https := false
@@ -121,23 +128,7 @@ func (element *elementDomainS) KubeApply() {
 		}
 
 		if https {
-			secret := kube.SecretS{
-				KubeClient: kClient,
-				Namespace:  element.EnvironmentID,
-				Name:       element.Domain + "-tls",
-				Type:       corev1.SecretTypeTLS,
-				Data: map[string][]byte{
-					"tls.crt": []byte(cert.Pem()),
-					"tls.key": []byte(cert.Key()),
-				},
-				Labels: map[string]string{
-					"manager":    "timoni",
-					"cert-id":    cert.ID()[:30],
-					"expiration": fmt.Sprint(cert.ExpirationTime()),
-				},
-			}
-			_, err := secret.CreateOrUpdate()
-			tlog.Error(err)
+			element.tlsSecretApply()
 		}
 	}
 
@@ -161,6 +152,10 @@ func (element *elementDomainS) KubeApply() {
 		Timeout:       element.Timeout,
 		HTTPS:         https,
 		Auth:          element.Auth,
+		HTTP:          element.HTTPOptionsS,
+	}
+	if env := element.GetEnvironment(); env != nil {
+		ingress.HTTP.Wake = env.WakeAddress()
 	}
 
 	es.Alerts = []string{}
@@ -175,16 +170,16 @@ func (element *elementDomainS) KubeApply() {
 
 	// }
 
+	element.dnsApply(ingressService(kClient))
 	es.State = ElementStatusReady
 }
 
 func (element *elementDomainS) KubeApplyLoadalancer() {
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	es := element.GetStatus()
 
-	switch element.ExternalPort {
-	case 22, 80, 443, int(db2.TheDomain.Port()):
+	if domainPortReserved(element.ExternalPort) {
 		es.Alerts = append(es.Alerts, fmt.Sprintf("Port %d not allowed", element.ExternalPort))
 		es.State = ElementStatusFailed
 		return
@@ -222,5 +217,33 @@ func (element *elementDomainS) KubeApplyLoadalancer() {
 		return
 	}
 
+	element.dnsApply(is)
 	es.State = ElementStatusReady
 }
+
+// tlsSecretApply creates secret `{domain}-tls` with certificate of domain,
+// returns false when domain has no certificate
+func (element *elementDomainS) tlsSecretApply() bool {
+	cert := db2.DomainList("Name = '"+element.Domain+"' AND Cert != ''", "", 0, 1).First().Cert()
+	if cert.NotValid() || cert.ID() == "" {
+		return false
+	}
+
+	secret := kube.SecretS{
+		KubeClient: element.kubeClient(),
+		Namespace:  element.EnvironmentID,
+		Name:       element.Domain + "-tls",
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": []byte(cert.Pem()),
+			"tls.key": []byte(cert.Key()),
+		},
+		Labels: map[string]string{
+			"manager":    "timoni",
+			"cert-id":    cert.ID()[:30],
+			"expiration": fmt.Sprint(cert.ExpirationTime()),
+		},
+	}
+	_, err := secret.CreateOrUpdate()
+	return tlog.Error(err) == nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"core/db2"
+	"core/kube"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"lib/utils/slice"
+	"sort"
+)
+
+// elements of http domains without IngressRouteTCP/UDP, key='env_id/el_name'
+var domainRoutesDeletedMap = maps.NewSafe[string, bool](nil)
+
+// domainPortReserved returns true for external ports used by ssh, traefik
+// (web, websecure, dashboard) and Timoni domain
+func domainPortReserved(port int) bool {
+	switch port {
+	case 22, 80, 443, 9000, int(db2.TheDomain.Port()):
+		return true
+	}
+	return false
+}
+
+// entryPoint returns traefik entrypoint of tcp and udp domain element, false
+// without external port or with reserved one
+func (element *elementDomainS) entryPoint() (kube.TraefikEntryPointS, bool) {
+	switch element.ExternalProtocol {
+	case "tcp", "udp":
+		if element.ExternalPort <= 0 || domainPortReserved(element.ExternalPort) {
+			return kube.TraefikEntryPointS{}, false
+		}
+		return kube.TraefikEntryPointGet(element.ExternalProtocol, int32(element.ExternalPort)), true
+	}
+	return kube.TraefikEntryPointS{}, false
+}
+
+// tcpSNI returns domain used by HostSNI rule, empty for plain TCP (http-only = true)
+func (element *elementDomainS) tcpSNI() string {
+	if element.HttpOnly && !element.TLSPassthrough {
+		return ""
+	}
+	return element.Domain
+}
+
+// domainElementsWithEntryPoints returns running tcp and udp domain elements of all environments
+func domainElementsWithEntryPoints() []*elementDomainS {
+	res := []*elementDomainS{}
+	for _, env := range EnvironmentMap.Values() {
+		if env.ToDelete {
+			continue
+		}
+		for el := range env.Elements.Iter() {
+			if el.Value != ElementSourceTypeDomain {
+				continue
+			}
+			element, ok := env.GetElement(el.Key).(*elementDomainS)
+			if !ok || element.GetToDelete() || element.GetStopped() {
+				continue
+			}
+			if _, ok := element.entryPoint(); ok {
+				res = append(res, element)
+			}
+		}
+	}
+	return res
+}
+
+// TraefikEntryPointsRequired returns entrypoints which must be configured in
+// ingress-traefik for tcp and udp domain elements
+func TraefikEntryPointsRequired() []kube.TraefikEntryPointS {
+	m := map[string]kube.TraefikEntryPointS{}
+	for _, element := range domainElementsWithEntryPoints() {
+		ep, _ := element.entryPoint()
+		m[ep.Name] = ep
+	}
+
+	res := []kube.TraefikEntryPointS{}
+	for _, ep := range m {
+		res = append(res, ep)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// entryPointConflict returns description of other element which can't share
+// entrypoint with this one, UDP and plain TCP entrypoints have single route.
+func (element *elementDomainS) entryPointConflict() string {
+	ep, _ := element.entryPoint()
+	for _, other := range domainElementsWithEntryPoints() {
+		if other.EnvironmentID == element.EnvironmentID && other.Name == element.Name {
+			continue
+		}
+		if otherEP, _ := other.entryPoint(); otherEP.Name != ep.Name {
+			continue
+		}
+		if ep.Protocol == "udp" || element.tcpSNI() == "" || other.tcpSNI() == "" || other.tcpSNI() == element.tcpSNI() {
+			return fmt.Sprintf("port %s/%d is already used by element %s in environment %s",
+				ep.Protocol, ep.Port, other.Name, other.EnvironmentID,
+			)
+		}
+	}
+	return ""
+}
+
+// KubeApplyRoute exposes tcp or udp port of element by traefik entrypoint
+func (element *elementDomainS) KubeApplyRoute() {
+
+	kClient := element.kubeClient()
+	es := element.GetStatus()
+	es.Alerts = []string{}
+	domainRoutesDeletedMap.Delete(element.EnvironmentID + "/" + element.Name)
+
+	fail := func(msg string) {
+		if !slice.Contains(es.Alerts, msg) {
+			es.Alerts = append(es.Alerts, msg)
+		}
+		es.State = ElementStatusFailed
+	}
+
+	if domainPortReserved(element.ExternalPort) {
+		fail(fmt.Sprintf("Port %d not allowed", element.ExternalPort))
+		return
+	}
+	ep, ok := element.entryPoint()
+	if !ok {
+		fail("external-port is required for protocol " + element.ExternalProtocol)
+		return
+	}
+	target := element.Paths["/"]
+	if target == nil {
+		fail("path `/` is required for protocol " + element.ExternalProtocol)
+		return
+	}
+	if msg := element.entryPointConflict(); msg != "" {
+		fail(msg)
+		return
+	}
+
+	// load balancer created by previous versions
+	lb := kube.ServiceS{
+		KubeClient: kClient,
+		Namespace:  element.EnvironmentID,
+		Name:       conv.KeyString(element.Name),
+	}
+	if obj := lb.GetObj(); obj != nil && obj.Labels["element"] == element.Name {
+		tlog.Error(lb.Delete())
+	}
+
+	name := conv.KeyString(element.Name + "-" + ep.Name)
+	labels := map[string]string{
+		"timoni-env": element.EnvironmentID,
+		"element":    element.Name,
+	}
+
+	if ep.Protocol == "udp" {
+		route := kube.IngressRouteUDPS{
+			KubeClient:  kClient,
+			Namespace:   element.EnvironmentID,
+			Name:        name,
+			Labels:      labels,
+			EntryPoint:  ep.Name,
+			ServiceName: target.ElementName,
+			ServicePort: target.Port,
+		}
+		if err := route.CreateOrUpdate(); err != nil {
+			fail(err.Message)
+			return
+		}
+		tlog.Error(kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteUDP, element.EnvironmentID, labels, name))
+		tlog.Error(kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteTCP, element.EnvironmentID, labels, ""))
+
+	} else {
+		route := kube.IngressRouteTCPS{
+			KubeClient:     kClient,
+			Namespace:      element.EnvironmentID,
+			Name:           name,
+			Labels:         labels,
+			EntryPoint:     ep.Name,
+			Domain:         element.tcpSNI(),
+			TLSPassthrough: element.TLSPassthrough,
+			ServiceName:    target.ElementName,
+			ServicePort:    target.Port,
+		}
+		if route.Domain != "" && !route.TLSPassthrough {
+			if !element.tlsSecretApply() {
+				es.Alerts = append(es.Alerts, "waiting for certificate of domain "+element.Domain)
+				es.State = ElementStatusDeploying
+				return
+			}
+			route.TLSSecretName = element.Domain + "-tls"
+		}
+		if err := route.CreateOrUpdate(); err != nil {
+			fail(err.Message)
+			return
+		}
+		tlog.Error(kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteTCP, element.EnvironmentID, labels, name))
+		tlog.Error(kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteUDP, element.EnvironmentID, labels, ""))
+	}
+
+	if !kube.TraefikEntryPointsActive.Exists(ep.Name) {
+		es.Alerts = append(es.Alerts, "waiting for ingress-traefik entrypoint "+ep.Name)
+		es.State = ElementStatusDeploying
+		return
+	}
+
+	element.dnsApply(ingressService(kClient))
+	es.State = ElementStatusReady
+}
+
+// deleteRoutes removes IngressRouteTCP and IngressRouteUDP of element
+func (element *elementDomainS) deleteRoutes() *tlog.RecordS {
+	kClient := element.kubeClient()
+	if kClient == nil {
+		return tlog.Error("kube.Client not ready")
+	}
+	labels := map[string]string{
+		"timoni-env": element.EnvironmentID,
+		"element":    element.Name,
+	}
+	if err := kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteTCP, element.EnvironmentID, labels, ""); err != nil {
+		return err
+	}
+	return kube.TraefikCRDCleanup(kClient, kube.TraefikKindIngressRouteUDP, element.EnvironmentID, labels, "")
+}
@@ -0,0 +1,341 @@
+package db
+
+import (
+	"core/db2"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLOs of domain element are computed from metrics of Traefik routers of
+// domain (Ingress and IngressRoute of element), Traefik needs
+// `--metrics.prometheus.addRoutersLabels` in CMD of ingress-traefik image,
+// core only appends entrypoints to it. Availability counts requests
+// without 5xx, latency counts requests faster than `latency-ms`. Status is
+// refreshed by EnvSLOLoop and kept in memory.
+
+// elementDomainSLOS is `[slo]` of domain element
+type elementDomainSLOS struct {
+	WindowDays        int     `toml:"window-days"`        // default 30
+	Availability      float64 `toml:"availability"`       // % of requests without 5xx, eg. 99.9, 0 = not tracked
+	LatencyMs         int     `toml:"latency-ms"`         // has to be bucket of Traefik histogram, 0 = not tracked
+	LatencyPercentile float64 `toml:"latency-percentile"` // % of requests faster than latency-ms, default 95
+	BlockAutoUpdate   bool    `toml:"block-auto-update"`  // no AutoUpdate deploys to env while error budget is exhausted
+}
+
+// SLOObjectiveS is status of single objective in window of SLO
+type SLOObjectiveS struct {
+	Target          float64 // % of good requests
+	SLI             float64 // % of good requests, 100 without requests
+	BudgetRemaining float64 // % of error budget left, negative when overspent
+	BurnRate1h      float64 // 1 = budget lasts exactly till the end of window
+	BurnRate6h      float64
+}
+
+// ElementSLOStatusS is status of SLO of domain element
+type ElementSLOStatusS struct {
+	WindowDays      int
+	Requests        float64 // in window
+	Availability    *SLOObjectiveS
+	Latency         *SLOObjectiveS
+	LatencyMs       int
+	PercentileMs    float64 // latency percentile of last hour
+	Exhausted       bool    // budget of any objective is spent
+	BlockAutoUpdate bool
+	Error           string
+	UpdateTime      int64
+}
+
+const (
+	sloLoopInterval = 5 * time.Minute
+)
+
+var (
+	sloStatusMap = maps.NewSafe[string, *ElementSLOStatusS](nil) // key=env-id/element-name
+
+	// buckets of `--metrics.prometheus.buckets` in CMD of ingress-traefik image
+	sloLatencyBuckets = []int{50, 100, 200, 300, 500, 1000, 2000, 5000}
+	reRouterName      = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+func (slo *elementDomainSLOS) check() *tlog.RecordS {
+	if slo == nil {
+		return nil
+	}
+	if slo.WindowDays == 0 {
+		slo.WindowDays = 30
+	}
+	if slo.WindowDays < 1 || slo.WindowDays > 90 {
+		return tlog.Error("slo: window-days has to be between 1 and 90")
+	}
+	if slo.Availability == 0 && slo.LatencyMs == 0 {
+		return tlog.Error("slo: set availability or latency-ms")
+	}
+	if slo.Availability < 0 || slo.Availability >= 100 {
+		return tlog.Error("slo: availability has to be between 0 and 100")
+	}
+	if slo.LatencyMs != 0 {
+		ok := false
+		for _, b := range sloLatencyBuckets {
+			ok = ok || b == slo.LatencyMs
+		}
+		if !ok {
+			return tlog.Error("slo: latency-ms has to be one of {{buckets}}", tlog.Vars{
+				"buckets": sloLatencyBuckets,
+			})
+		}
+		if slo.LatencyPercentile == 0 {
+			slo.LatencyPercentile = 95
+		}
+		if slo.LatencyPercentile < 0 || slo.LatencyPercentile >= 100 {
+			return tlog.Error("slo: latency-percentile has to be between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// routerRegex returns PromQL regexp of Traefik routers of domain, names of
+// routers are `<namespace>-<ingress>-...@provider`
+func (element *elementDomainS) routerRegex() string {
+	ingName := conv.KeyString(element.Name + "-" + element.Domain)
+	return reRouterName.ReplaceAllString(element.EnvironmentID+"-"+ingName, "-") + "-.*"
+}
+
+// metricsValue returns value of first series of PromQL instant query, 0
+// without series
+func metricsValue(expr string) (float64, *tlog.RecordS) {
+	samples, err := metricsQuery(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(samples) == 0 || math.IsNaN(samples[0].Value) {
+		return 0, nil
+	}
+	return samples[0].Value, nil
+}
+
+// sloObjective computes objective from PromQL of all and bad requests in range
+func sloObjective(target float64, window string, total, bad func(rng string) string) (*SLOObjectiveS, *tlog.RecordS) {
+
+	ratio := func(rng string) (float64, *tlog.RecordS) {
+		t, err := metricsValue(total(rng))
+		if err != nil || t <= 0 {
+			return 0, err
+		}
+		b, err := metricsValue(bad(rng))
+		if err != nil {
+			return 0, err
+		}
+		return math.Max(0, math.Min(b/t, 1)), nil
+	}
+
+	budget := 1 - target/100
+	res := &SLOObjectiveS{Target: target, SLI: 100, BudgetRemaining: 100}
+
+	badRatio, err := ratio(window)
+	if err != nil {
+		return nil, err
+	}
+	res.SLI = 100 * (1 - badRatio)
+	res.BudgetRemaining = 100 * (1 - badRatio/budget)
+
+	badRatio, err = ratio("1h")
+	if err != nil {
+		return nil, err
+	}
+	res.BurnRate1h = badRatio / budget
+
+	badRatio, err = ratio("6h")
+	if err != nil {
+		return nil, err
+	}
+	res.BurnRate6h = badRatio / budget
+
+	return res, nil
+}
+
+// sloCompute queries metrics of domain and returns status of its SLO
+func (element *elementDomainS) sloCompute() *ElementSLOStatusS {
+
+	slo := element.SLO
+	status := &ElementSLOStatusS{
+		WindowDays:      slo.WindowDays,
+		LatencyMs:       slo.LatencyMs,
+		BlockAutoUpdate: slo.BlockAutoUpdate,
+		UpdateTime:      time.Now().Unix(),
+	}
+	router := fmt.Sprintf(`router=~%q`, element.routerRegex())
+	window := strconv.Itoa(slo.WindowDays) + "d"
+
+	requests := func(rng string) string {
+		return fmt.Sprintf(`sum(increase(traefik_router_requests_total{%s}[%s]))`, router, rng)
+	}
+
+	var err *tlog.RecordS
+	if status.Requests, err = metricsValue(requests(window)); err != nil {
+		status.Error = err.Message
+		return status
+	}
+
+	if slo.Availability > 0 {
+		status.Availability, err = sloObjective(slo.Availability, window, requests, func(rng string) string {
+			return fmt.Sprintf(`sum(increase(traefik_router_requests_total{%s,code=~"5.."}[%s]))`, router, rng)
+		})
+		if err != nil {
+			status.Error = err.Message
+			return status
+		}
+	}
+
+	if slo.LatencyMs > 0 {
+		le := strconv.FormatFloat(float64(slo.LatencyMs)/1000, 'f', -1, 64)
+		count := func(rng string) string {
+			return fmt.Sprintf(`sum(increase(traefik_router_request_duration_seconds_count{%s}[%s]))`, router, rng)
+		}
+		status.Latency, err = sloObjective(slo.LatencyPercentile, window, count, func(rng string) string {
+			return fmt.Sprintf(`%s - sum(increase(traefik_router_request_duration_seconds_bucket{%s,le=%q}[%s]))`, count(rng), router, le, rng)
+		})
+		if err != nil {
+			status.Error = err.Message
+			return status
+		}
+
+		p, err := metricsValue(fmt.Sprintf(`histogram_quantile(%g, sum by (le) (rate(traefik_router_request_duration_seconds_bucket{%s}[1h])))`, slo.LatencyPercentile/100, router))
+		if err != nil {
+			status.Error = err.Message
+			return status
+		}
+		status.PercentileMs = math.Round(p * 1000)
+	}
+
+	for _, o := range []*SLOObjectiveS{status.Availability, status.Latency} {
+		if o != nil && o.BudgetRemaining <= 0 {
+			status.Exhausted = true
+		}
+	}
+	return status
+}
+
+// SLOStatus returns status of SLOs of domain elements of env, key=element name
+func (env *EnvironmentS) SLOStatus() map[string]*ElementSLOStatusS {
+	res := map[string]*ElementSLOStatusS{}
+	for _, elName := range env.Elements.Keys() {
+		element, ok := GetElementDomain(env.GetElement(elName))
+		if !ok || element.SLO == nil {
+			continue
+		}
+		if status := sloStatusMap.Get(env.ID + "/" + elName); status != nil {
+			res[elName] = status
+		}
+	}
+	return res
+}
+
+// SLOBlocksAutoUpdate returns name of domain element with `block-auto-update`
+// whose error budget is exhausted, empty when AutoUpdate deploys are allowed
+func (env *EnvironmentS) SLOBlocksAutoUpdate() string {
+	for elName, status := range env.SLOStatus() {
+		if status.Exhausted && status.BlockAutoUpdate {
+			return elName
+		}
+	}
+	return ""
+}
+
+// autoUpdatePending deploys latest commits to AutoUpdate elements of env
+// which were held back while error budget was exhausted
+func (env *EnvironmentS) autoUpdatePending() {
+	for _, elName := range env.Elements.Keys() {
+		element := env.GetElement(elName)
+		if element == nil || !element.GetAutoUpdate() || !element.GetStatus().NewerVersion {
+			continue
+		}
+		source := element.GetSource()
+		commit := GitRepoGetByName(source.RepoName).GetLastCommit(source.BranchName)
+		if commit == "" || commit == source.CommitHash {
+			continue
+		}
+		tlog.Error(env.SetElementVersion(elName, source.BranchName, commit, nil))
+	}
+}
+
+// sloUpdate refreshes status of SLOs of env
+func (env *EnvironmentS) sloUpdate() {
+
+	blocked := env.SLOBlocksAutoUpdate() != ""
+
+	for _, elName := range env.Elements.Keys() {
+		key := env.ID + "/" + elName
+		element, ok := GetElementDomain(env.GetElement(elName))
+		if !ok || element.SLO == nil {
+			sloStatusMap.Delete(key)
+			continue
+		}
+
+		status := element.sloCompute()
+		if status.Error != "" {
+			// keep last good status
+			if old := sloStatusMap.Get(key); old != nil {
+				kept := *old
+				kept.Error = status.Error
+				sloStatusMap.Set(key, &kept)
+				continue
+			}
+		}
+
+		old := sloStatusMap.Get(key)
+		if status.Exhausted && (old == nil || !old.Exhausted) {
+			tlog.Warning("error budget of {{element}} is exhausted", tlog.Vars{
+				"env":     env.ID,
+				"element": elName,
+				"event":   true,
+			})
+		}
+		if !status.Exhausted && old != nil && old.Exhausted && status.Error == "" {
+			tlog.Info("error budget of {{element}} recovered", tlog.Vars{
+				"env":     env.ID,
+				"element": elName,
+				"event":   true,
+			})
+		}
+		sloStatusMap.Set(key, status)
+	}
+
+	if blocked && env.SLOBlocksAutoUpdate() == "" {
+		env.autoUpdatePending()
+	}
+}
+
+// sloStatusReset forgets SLO status of env
+func sloStatusReset(envID string) {
+	for _, key := range sloStatusMap.Keys() {
+		if strings.HasPrefix(key, envID+"/") {
+			sloStatusMap.Delete(key)
+		}
+	}
+}
+
+// EnvSLOLoop refreshes SLO status of domain elements
+func EnvSLOLoop() {
+	for {
+		time.Sleep(sloLoopInterval)
+
+		if db2.TheMetrics == nil || !db2.TheMetrics.Enabled() {
+			continue
+		}
+
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete {
+				sloStatusReset(env.ID)
+				continue
+			}
+			env.sloUpdate()
+		}
+	}
+}
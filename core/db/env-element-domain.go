@@ -1,6 +1,7 @@
 package db
 
 import (
+	"core/db/envelope"
 	"core/kube"
 	"fmt"
 	"lib/tlog"
@@ -14,8 +15,9 @@ type elementDomainS struct {
 	elementS
 
 	Domain           string `toml:"domain"`
-	ExternalProtocol string `toml:"external-protocol"` // default 'https', posible: http, tcp, udp, lb
+	ExternalProtocol string `toml:"external-protocol"` // default 'https', posible: http, tcp, udp (traefik entrypoint), lb (own load balancer)
 	ExternalPort     int    `toml:"external-port"`
+	TLSPassthrough   bool   `toml:"tls-passthrough"` // tcp: TLS is terminated by element, routed by SNI
 
 	// nativeLB in https://doc.traefik.io/traefik/routing/providers/kubernetes-crd/#kind-ingressrouteudp
 	// DontUseLoadBalancer bool `toml:"dont-use-load-balancer"`
@@ -23,6 +25,10 @@ type elementDomainS struct {
 	HttpOnly    bool `toml:"http-only"`
 	WWWredirect bool `toml:"www-redirect"`
 
+	// rate-limit, ip-allow, ip-deny, headers, cors, redirects, rewrites,
+	// retry, circuit-breaker, compress, forward-auth
+	kube.HTTPOptionsS
+
 	Auth        string `toml:"auth"`         // basic auth eg. 'user:password_hash' < htpasswd -nb {login} {pass}
 	UploadLimit int    `toml:"upload-limit"` // default 1 MB, proxy-body-size
 	Timeout     int    `toml:"timeout"`      // default 60 s, proxy-read-timeout, client-header-timeout, client-body-timeout
@@ -34,6 +40,8 @@ type elementDomainS struct {
 	// StartPath   string                         `toml:"start-path"`
 	Paths       map[string]*kube.DomainPathS `toml:"paths"`
 	Annotations map[string]string            `toml:"annotations"`
+
+	SLO *elementDomainSLOS `toml:"slo"` // availability and latency objectives, see env-element-domain-slo.go
 	// URL         string                         `toml:"-"`
 }
 
@@ -76,6 +84,26 @@ func (element *elementDomainS) check(user *UserS) *tlog.RecordS {
 
 	element.RenderVariables()
 
+	if err := element.HTTPOptionsS.Check(); err != nil {
+		return tlog.Error(err)
+	}
+	for path, target := range element.Paths {
+		if target == nil || target.RateLimit == nil {
+			continue
+		}
+		if err := target.RateLimit.Check(); err != nil {
+			return tlog.Error("path " + path + ": " + err.Error())
+		}
+	}
+
+	if err := element.SLO.check(); err != nil {
+		return err
+	}
+
+	if err := envQuotaCheck(element); err != nil {
+		return err
+	}
+
 	// run generic check
 	return element.elementS.check(user)
 }
@@ -99,7 +127,7 @@ func (element *elementDomainS) RenderVariables() bool {
 		System:       true,
 	}
 	element.elementS.RenderVariables()
-	element.Domain = element.Variables["DOMAIN_NAME"].ResolvedValue
+	element.Domain = envelope.MustOpen(element.Variables["DOMAIN_NAME"].ResolvedValue)
 	return true
 }
 
@@ -138,11 +166,13 @@ func (element *elementDomainS) DeleteFromKube() *tlog.RecordS {
 	}
 
 	switch element.ExternalProtocol {
-	case "tcp", "udp", "lb":
+	case "tcp", "udp":
+		return element.deleteRoutes()
+	case "lb":
 		return element.DeleteLoadBalancer()
 	}
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
@@ -166,7 +196,7 @@ func (element *elementDomainS) DeleteFromKube() *tlog.RecordS {
 }
 
 func (element *elementDomainS) DeleteLoadBalancer() *tlog.RecordS {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
@@ -0,0 +1,278 @@
+package db
+
+import (
+	"bytes"
+	"core/kube"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lib/tlog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Backups of elasticsearch are snapshots in repository registered for each
+// target, core calls snapshot API of cluster made by ECK. Credentials of
+// repositories are secure settings kept in secret
+// `<name>-backup-secure-settings`, filesystem targets have to be mounted on
+// nodes and listed in `path.repo`.
+
+func (element *elementElasticsearchS) backupTargets() map[string]elementBackupS {
+	return element.Backup
+}
+
+// esRequest calls API of elasticsearch, out is decoded from JSON response
+func (element *elementElasticsearchS) esRequest(method, path string, body interface{}, out interface{}) *tlog.RecordS {
+
+	kClient := element.kubeClient()
+	if kClient == nil {
+		return tlog.Error("kube.Client not ready")
+	}
+	if kClient.Cluster != "" {
+		// services of other clusters are not reachable by cluster DNS
+		return tlog.Error("elasticsearch backups are available only on local cluster")
+	}
+
+	scheme := "http"
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if element.XpackSecurity {
+		scheme = "https"
+		ca := &kube.SecretS{KubeClient: kClient, Namespace: element.EnvironmentID, Name: element.Name + "-es-http-certs-public"}
+		if ca.GetObj() == nil {
+			return tlog.Error("elasticsearch CA certificate not found")
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca.Obj.Data["ca.crt"])
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return tlog.Error(err)
+		}
+		reader = bytes.NewReader(buf)
+	}
+	u := fmt.Sprintf("%s://%s-es-http.%s.svc.cluster.local:9200/%s", scheme, element.Name, element.EnvironmentID, path)
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return tlog.Error(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	user := &kube.SecretS{KubeClient: kClient, Namespace: element.EnvironmentID, Name: element.Name + "-es-elastic-user"}
+	if user.GetObj() != nil {
+		req.SetBasicAuth("elastic", string(user.Obj.Data["elastic"]))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return tlog.Error(err)
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return tlog.Error(err)
+	}
+	if resp.StatusCode >= 300 {
+		return tlog.Error(fmt.Sprintf("elasticsearch %s %s: %s %s", method, path, resp.Status, buf))
+	}
+	if out != nil {
+		if err := json.Unmarshal(buf, out); err != nil {
+			return tlog.Error(err)
+		}
+	}
+	return nil
+}
+
+// repositoryEnsure stores secure settings of targets and registers
+// snapshot repository of target
+func (element *elementElasticsearchS) repositoryEnsure(repo string, t *elementBackupS) *tlog.RecordS {
+
+	settings := map[string]interface{}{
+		"client":    repo,
+		"base_path": t.Path,
+		"readonly":  t.ReadOnly,
+	}
+	secure := map[string][]byte{}
+	repoType := ""
+	switch t.Type {
+	case BackupTypeS3:
+		repoType = "s3"
+		settings["bucket"] = t.S3Bucket
+		secure["s3.client."+repo+".access_key"] = []byte(t.S3AccessKey)
+		secure["s3.client."+repo+".secret_key"] = []byte(t.S3SecretKey)
+	case BackupTypeGCS:
+		repoType = "gcs"
+		settings["bucket"] = t.GCSBucket
+		secure["gcs.client."+repo+".credentials_file"] = []byte(t.GCSCredentials)
+	case BackupTypeAzure:
+		repoType = "azure"
+		settings["container"] = t.AzureStorageAccountContainer
+		secure["azure.client."+repo+".account"] = []byte(t.AzureStorageAccountName)
+		secure["azure.client."+repo+".key"] = []byte(t.AzureStorageAccountKey)
+	case BackupTypeFilesystem:
+		repoType = "fs"
+		settings = map[string]interface{}{
+			"location": strings.TrimRight(t.RemotePath, "/") + "/" + t.Path,
+			"readonly": t.ReadOnly,
+		}
+	}
+
+	if len(secure) > 0 {
+		secret := &kube.SecretS{
+			KubeClient: element.kubeClient(),
+			Namespace:  element.EnvironmentID,
+			Name:       element.Name + "-backup-secure-settings",
+			Type:       corev1.SecretTypeOpaque,
+			Data:       secure,
+			Labels: map[string]string{
+				"timoni-env": element.EnvironmentID,
+				"element":    element.Name,
+			},
+		}
+		if secret.GetObj() != nil {
+			for k, v := range secret.Obj.Data {
+				if _, ok := secure[k]; !ok {
+					secure[k] = v
+				}
+			}
+		}
+		diff, err := secret.CreateOrUpdate()
+		if err != nil {
+			return tlog.Error(err)
+		}
+		if diff != "" {
+			// secret is mounted in keystore by ECK, nodes have to reload it
+			tlog.Error(element.esRequest("POST", "_nodes/reload_secure_settings", nil, nil))
+		}
+	}
+
+	return element.esRequest("PUT", "_snapshot/"+url.PathEscape(repo), map[string]interface{}{
+		"type":     repoType,
+		"settings": settings,
+	}, nil)
+}
+
+func (element *elementElasticsearchS) backupRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+	if err := element.repositoryEnsure(b.Target, t); err != nil {
+		return err
+	}
+	return element.esRequest("PUT", "_snapshot/"+url.PathEscape(b.Target)+"/"+url.PathEscape(b.Name)+"?wait_for_completion=false",
+		map[string]interface{}{
+			"include_global_state": false,
+			"metadata":             map[string]string{"label": b.Label, "created-by": b.CreatedByEmail},
+		}, nil)
+}
+
+type elasticsearchSnapshotsS struct {
+	Snapshots []struct {
+		Snapshot string   `json:"snapshot"`
+		State    string   `json:"state"`
+		Indices  []string `json:"indices"`
+		Failures []struct {
+			Reason string `json:"reason"`
+		} `json:"failures"`
+		Stats struct {
+			Total struct {
+				SizeInBytes int64 `json:"size_in_bytes"`
+			} `json:"total"`
+		} `json:"stats"`
+	} `json:"snapshots"`
+}
+
+func (element *elementElasticsearchS) snapshotPath(b *ElementBackupS) string {
+	return "_snapshot/" + url.PathEscape(b.Target) + "/" + url.PathEscape(b.Name)
+}
+
+func (element *elementElasticsearchS) backupPoll(b *ElementBackupS, t *elementBackupS) (bool, *tlog.RecordS) {
+
+	res := elasticsearchSnapshotsS{}
+	if err := element.esRequest("GET", element.snapshotPath(b), nil, &res); err != nil {
+		return false, err
+	}
+	if len(res.Snapshots) == 0 {
+		return false, tlog.Error("snapshot not found")
+	}
+
+	s := res.Snapshots[0]
+	switch s.State {
+	case "SUCCESS":
+		status := elasticsearchSnapshotsS{}
+		if element.esRequest("GET", element.snapshotPath(b)+"/_status", nil, &status) == nil && len(status.Snapshots) > 0 {
+			b.SizeBytes = status.Snapshots[0].Stats.Total.SizeInBytes
+		}
+		return true, nil
+	case "FAILED", "PARTIAL", "INCOMPATIBLE":
+		reason := strings.ToLower(s.State)
+		if len(s.Failures) > 0 {
+			reason += ": " + s.Failures[0].Reason
+		}
+		return false, tlog.Error("snapshot " + reason)
+	}
+	return false, nil
+}
+
+func (element *elementElasticsearchS) backupRemove(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+	if err := element.repositoryEnsure(b.Target, t); err != nil {
+		return err
+	}
+	return element.esRequest("DELETE", element.snapshotPath(b), nil, nil)
+}
+
+// restoreRun replaces indices of snapshot, system indices are not restored
+func (element *elementElasticsearchS) restoreRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+
+	if err := element.repositoryEnsure(b.Target, t); err != nil {
+		return err
+	}
+
+	res := elasticsearchSnapshotsS{}
+	if err := element.esRequest("GET", element.snapshotPath(b), nil, &res); err != nil {
+		return err
+	}
+	if len(res.Snapshots) == 0 {
+		return tlog.Error("snapshot not found")
+	}
+	indices := []string{}
+	for _, index := range res.Snapshots[0].Indices {
+		if !strings.HasPrefix(index, ".") {
+			indices = append(indices, index)
+		}
+	}
+	if len(indices) == 0 {
+		return tlog.Error("snapshot has no indices to restore")
+	}
+
+	if err := element.esRequest("DELETE", url.PathEscape(strings.Join(indices, ","))+"?ignore_unavailable=true", nil, nil); err != nil {
+		return err
+	}
+	return element.esRequest("POST", element.snapshotPath(b)+"/_restore", map[string]interface{}{
+		"indices":              strings.Join(indices, ","),
+		"include_global_state": false,
+	}, nil)
+}
+
+func (element *elementElasticsearchS) restorePoll(b *ElementBackupS, t *elementBackupS) (bool, *tlog.RecordS) {
+
+	recoveries := []struct {
+		Index string `json:"index"`
+		Type  string `json:"type"`
+	}{}
+	if err := element.esRequest("GET", "_cat/recovery?active_only=true&format=json", nil, &recoveries); err != nil {
+		return false, err
+	}
+	for _, r := range recoveries {
+		if r.Type == "snapshot" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
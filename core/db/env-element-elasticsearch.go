@@ -1,7 +1,6 @@
 package db
 
 import (
-	"core/kube"
 	"fmt"
 	"lib/tlog"
 
@@ -14,9 +13,9 @@ import (
 type elementElasticsearchS struct {
 	elementS
 
-	ExternalIP    bool                                   `toml:"external-ip"`
-	XpackSecurity bool                                   `toml:"xpack-security"`
-	Backup        map[string]elementElasticsearchBackupS `toml:"backup"`
+	ExternalIP    bool                      `toml:"external-ip"`
+	XpackSecurity bool                      `toml:"xpack-security"`
+	Backup        map[string]elementBackupS `toml:"backup"` // key=snapshot repository name
 
 	// https://www.elastic.co/guide/en/cloud-on-k8s/current/k8s-node-configuration.html
 	Version  string                         `toml:"version"`
@@ -39,20 +38,6 @@ type elementElasticSearchNodeSetS struct {
 	} `toml:"podTemplate"`
 }
 
-type elementElasticsearchBackupS struct {
-	Type     string `toml:"type"` // nfs, azure
-	ReadOnly bool   `toml:"read-only"`
-
-	// nfs
-	RemoteServer string `toml:"remote-server"`
-	RemotePath   string `toml:"remote-path"`
-
-	// azure
-	AzureStorageAccountName      string `toml:"azure-storage-account-name"`
-	AzureStorageAccountKey       string `toml:"azure-storage-account-key"`
-	AzureStorageAccountContainer string `toml:"azure-storage-account-container"`
-}
-
 func (element *elementElasticsearchS) RebuildImage(imageID string, user *UserS) *tlog.RecordS {
 	return nil
 }
@@ -69,6 +54,13 @@ func (element *elementElasticsearchS) check(user *UserS) *tlog.RecordS {
 	if element.ToDelete {
 		return nil
 	}
+	if err := backupTargetsCheck(element.Backup, backupTargetsStored(element.EnvironmentID, element.Name)); err != nil {
+		return err
+	}
+	if err := envQuotaCheck(element); err != nil {
+		return err
+	}
+
 	return element.elementS.check(user)
 }
 
@@ -106,7 +98,7 @@ func (element *elementElasticsearchS) DeleteFromKube() *tlog.RecordS {
 		return tlog.Error("element.EnvironmentID is empty")
 	}
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
@@ -131,4 +123,4 @@ func (element *elementElasticsearchS) DeleteFromKube() *tlog.RecordS {
 
 func (element *elementElasticsearchS) GetScale() *ElementScaleS {
 	return &ElementScaleS{}
-}
\ No newline at end of file
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"core/config"
+	"core/db/envelope"
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// ElementHistoryCurrent is version name of element saved in 0-current.json with 0-patch.json
+const ElementHistoryCurrent = "current"
+
+type ElementHistoryVersionS struct {
+	Version       string // file name without .json, or ElementHistoryCurrent
+	SaveTimestamp int64
+	UserEmail     string
+	UserInitials  string
+	SourceGit     SourceGitS
+	Current       bool
+}
+
+type ElementHistoryDiffS struct {
+	Field  string // eg. Variables.DB_HOST.CurrentValue
+	From   any
+	To     any
+	Secret bool // values are masked
+}
+
+// elementHistoryData returns element data of version with applied patch
+func (env *EnvironmentS) elementHistoryData(elementName, version string) ([]byte, *tlog.RecordS) {
+	path := env.getElementDBFilePath(elementName)
+
+	if version == ElementHistoryCurrent {
+		data, err := os.ReadFile(filepath.Join(path, "0-current.json"))
+		if err != nil {
+			return nil, tlog.Error(err)
+		}
+		patch, _ := os.ReadFile(filepath.Join(path, "0-patch.json"))
+		if len(patch) == 0 {
+			return data, nil
+		}
+		data, err = jsonpatch.MergePatch(data, patch)
+		if err != nil {
+			return nil, tlog.Error(err)
+		}
+		return data, nil
+	}
+
+	if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+		return nil, tlog.Error("invalid version: " + version)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(path, version+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, tlog.Error("version not found: " + version)
+		}
+		return nil, tlog.Error(err)
+	}
+
+	history := ElementHistory{}
+	if err := json.Unmarshal(buf, &history); err != nil {
+		return nil, tlog.Error(err)
+	}
+	if len(history.Patch) == 0 || string(history.Patch) == "null" {
+		return history.Data, nil
+	}
+
+	data, err := jsonpatch.MergePatch(history.Data, history.Patch)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	return data, nil
+}
+
+func (env *EnvironmentS) getElementDBFilePath(elementName string) string {
+	return filepath.Join(config.DataPath(), "env", env.ID, "element", elementName)
+}
+
+// ElementHistoryList returns saved versions of element, newest first.
+// The first one is current version.
+func (env *EnvironmentS) ElementHistoryList(elementName string) ([]ElementHistoryVersionS, *tlog.RecordS) {
+
+	files, err := os.ReadDir(env.getElementDBFilePath(elementName))
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+
+	versions := []string{ElementHistoryCurrent}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(fi.Name(), ".json")
+		if _, err := strconv.ParseInt(name, 10, 64); err != nil {
+			// 0-current, 0-patch
+			continue
+		}
+		versions = append(versions, name)
+	}
+
+	res := []ElementHistoryVersionS{}
+	for _, version := range versions {
+		data, err := env.elementHistoryData(elementName, version)
+		if err != nil {
+			continue
+		}
+
+		v := ElementHistoryVersionS{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		v.Version = version
+		v.Current = version == ElementHistoryCurrent
+		res = append(res, v)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Current != res[j].Current {
+			return res[i].Current
+		}
+		return res[i].SaveTimestamp > res[j].SaveTimestamp
+	})
+	return res, nil
+}
+
+// ElementHistoryLoad returns element in given version
+func (env *EnvironmentS) ElementHistoryLoad(elementName, version string) (EnvElementS, *tlog.RecordS) {
+	current := env.ElementLoad(elementName)
+	if current == nil {
+		return nil, tlog.Error("element does not exist")
+	}
+
+	data, err := env.elementHistoryData(elementName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	out := reflect.New(reflect.Indirect(reflect.ValueOf(current)).Type()).Interface().(EnvElementS)
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, tlog.Error(err)
+	}
+	if out.GetType() != current.GetType() {
+		return nil, tlog.Error("element type has changed, version cannot be used: " + version)
+	}
+	return out, nil
+}
+
+// ElementHistoryDiff returns fields changed between two versions of element.
+// Values of secret variables are never returned, only information that they have changed.
+func (env *EnvironmentS) ElementHistoryDiff(elementName, from, to string) ([]ElementHistoryDiffS, *tlog.RecordS) {
+
+	fromData, err := env.elementHistoryData(elementName, from)
+	if err != nil {
+		return nil, err
+	}
+	toData, err := env.elementHistoryData(elementName, to)
+	if err != nil {
+		return nil, err
+	}
+
+	a := map[string]any{}
+	if err := json.Unmarshal(fromData, &a); err != nil {
+		return nil, tlog.Error(err)
+	}
+	b := map[string]any{}
+	if err := json.Unmarshal(toData, &b); err != nil {
+		return nil, tlog.Error(err)
+	}
+
+	fieldsA := map[string]any{}
+	historyFlatten("", a, fieldsA)
+	fieldsB := map[string]any{}
+	historyFlatten("", b, fieldsB)
+
+	secrets := historySecretVariables(a)
+	for name := range historySecretVariables(b) {
+		secrets[name] = true
+	}
+
+	names := map[string]bool{}
+	for k := range fieldsA {
+		names[k] = true
+	}
+	for k := range fieldsB {
+		names[k] = true
+	}
+
+	res := []ElementHistoryDiffS{}
+	for field := range names {
+		if field == "SaveTimestamp" {
+			continue
+		}
+		x, okA := fieldsA[field]
+		y, okB := fieldsB[field]
+
+		if historySecretField(field, secrets) {
+			// sealed values differ even for the same plain value
+			sx, _ := x.(string)
+			sy, _ := y.(string)
+			if okA == okB && envelope.MustOpen(sx) == envelope.MustOpen(sy) {
+				continue
+			}
+			d := ElementHistoryDiffS{
+				Field:  field,
+				Secret: true,
+			}
+			if okA {
+				d.From = "{{ secret }}"
+			}
+			if okB {
+				d.To = "{{ secret }}"
+			}
+			res = append(res, d)
+			continue
+		}
+
+		if okA == okB && reflect.DeepEqual(x, y) {
+			continue
+		}
+		res = append(res, ElementHistoryDiffS{
+			Field: field,
+			From:  x,
+			To:    y,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Field < res[j].Field })
+	return res, nil
+}
+
+// ElementHistoryRestore sets element to given version. Restore is saved as
+// a new version, so current version stays in history.
+func (env *EnvironmentS) ElementHistoryRestore(elementName, version string, user *UserS) *tlog.RecordS {
+	if version == ElementHistoryCurrent {
+		return tlog.Error("version is already current")
+	}
+
+	orgElement := env.ElementLoad(elementName)
+	if orgElement == nil {
+		return tlog.Error("element does not exist")
+	}
+
+	restored, err := env.ElementHistoryLoad(elementName, version)
+	if err != nil {
+		return err
+	}
+	restored.setVersion(0)
+
+	if currentElement, ok := ElementMap.GetFull(fmt.Sprintf("%s/%s", env.ID, elementName)); ok {
+		if err := currentElement.CopySecrets(restored); err != nil {
+			return err
+		}
+	}
+
+	if err := ElementUpdate(orgElement, restored, user, true); err != nil {
+		return err
+	}
+
+	tlog.Info("element restored from history", tlog.Vars{
+		"env":     env.ID,
+		"element": elementName,
+		"version": version,
+		"event":   true,
+		"user":    user.Email,
+	})
+	return nil
+}
+
+func historyFlatten(prefix string, in any, out map[string]any) {
+	switch x := in.(type) {
+	case map[string]any:
+		if len(x) == 0 && prefix != "" {
+			out[prefix] = x
+		}
+		for k, v := range x {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			historyFlatten(name, v, out)
+		}
+	default:
+		out[prefix] = in
+	}
+}
+
+// historySecretVariables returns names of secret variables of element data
+func historySecretVariables(data map[string]any) map[string]bool {
+	res := map[string]bool{}
+	vars, _ := data["Variables"].(map[string]any)
+	for name, v := range vars {
+		if x, ok := v.(map[string]any); ok && x["Secret"] == true {
+			res[name] = true
+		}
+	}
+	return res
+}
+
+func historySecretField(field string, secrets map[string]bool) bool {
+	parts := strings.Split(field, ".")
+	if len(parts) != 3 || parts[0] != "Variables" || !secrets[parts[1]] {
+		return false
+	}
+	switch parts[2] {
+	case "FirstValue", "CurrentValue", "ResolvedValue":
+		return true
+	}
+	return false
+}
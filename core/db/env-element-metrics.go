@@ -0,0 +1,58 @@
+package db
+
+import (
+	"lib/tlog"
+	"lib/utils/maps"
+	"time"
+)
+
+// ElementPodMetricsS are metrics of element pods read by node-agent from
+// cgroup v2 files, averages of last 2 minutes
+type ElementPodMetricsS struct {
+	CPUThrottledPC float64 // % of time when CPU was throttled by limit
+	WorkingSetMB   float64
+	MemLimitMB     float64 // 0 = no limit
+	DiskReadKBs    float64 // KiB/s
+	DiskWriteKBs   float64
+	NetRxKBs       float64
+	NetTxKBs       float64
+	OOMKills       int // since start of pod
+	Restarts       int
+	UpdateTime     int64
+}
+
+var (
+	elementMetricsMap       = maps.NewSafe[string, ElementPodMetricsS](nil) // key=env-id/element-name
+	elementOOMKillsBySource = maps.NewSafe[string, ElementPodMetricsS](nil) // key=source/env-id/element-name
+)
+
+// ElementMetricsSet stores metrics of element sent by node-agent of source
+// node, OOM kills which did not restart container are reported as event
+func ElementMetricsSet(source, envID, elementName string, m ElementPodMetricsS) {
+	key := envID + "/" + elementName
+	m.UpdateTime = time.Now().Unix()
+
+	// pods of element on other nodes have own counters
+	prev, ok := elementOOMKillsBySource.GetFull(source + "/" + key)
+	elementOOMKillsBySource.Set(source+"/"+key, m)
+	if ok && m.OOMKills > prev.OOMKills && m.Restarts == prev.Restarts {
+		tlog.Warning("element {{element}}: process killed by OOM, memory {{memory}} MB of limit {{limit}} MB", tlog.Vars{
+			"element": elementName,
+			"memory":  int(m.WorkingSetMB),
+			"limit":   int(m.MemLimitMB),
+			"env":     envID,
+			"event":   true,
+		})
+	}
+	elementMetricsMap.Set(key, m)
+}
+
+// ElementMetricsGet returns metrics of element, nil when node-agent sent none
+// in last 5 minutes
+func ElementMetricsGet(envID, elementName string) *ElementPodMetricsS {
+	m, ok := elementMetricsMap.GetFull(envID + "/" + elementName)
+	if !ok || time.Since(time.Unix(m.UpdateTime, 0)) > 5*time.Minute {
+		return nil
+	}
+	return &m
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"core/kube"
+	"fmt"
+	"lib/tlog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Backups of mongodb are gzipped archives of mongodump, copied by rclone to
+// backup target. Jobs run in namespace of env and connect to service of
+// replica set made by MongoDB operator.
+
+const (
+	mongodbBackupRcloneImage = "rclone/rclone:1.64"
+	mongodbBackupWorkDir     = "/work"
+	mongodbBackupArchive     = mongodbBackupWorkDir + "/dump.archive.gz"
+)
+
+func (element *elementMongodbS) backupTargets() map[string]elementBackupS {
+	return element.Backup
+}
+
+func (element *elementMongodbS) mongodbImage() string {
+	if element.Version == "" {
+		return "mongo:7.0"
+	}
+	return "mongo:" + element.Version
+}
+
+// mongodbURI returns connection string of backup user
+func (element *elementMongodbS) mongodbURI() (string, *tlog.RecordS) {
+
+	login := element.BackupUser
+	if login == "" {
+		logins := []string{}
+		for l := range element.Users {
+			logins = append(logins, l)
+		}
+		sort.Strings(logins)
+	loop:
+		for _, l := range logins {
+			for _, role := range element.Users[l].Roles {
+				if strings.Contains(role, "root") || strings.Contains(role, "backup") {
+					login = l
+					break loop
+				}
+			}
+		}
+	}
+	u, ok := element.Users[login]
+	if login == "" || !ok {
+		return "", tlog.Error("mongodb has no user for backups, set backup-user")
+	}
+
+	return fmt.Sprintf("mongodb://%s:%s@%s-svc.%s.svc.cluster.local:27017/?authSource=admin",
+		url.QueryEscape(login), url.QueryEscape(u.Password), element.Name, element.EnvironmentID,
+	), nil
+}
+
+func (element *elementMongodbS) backupJobName(b *ElementBackupS, kind string) string {
+	name := element.Name
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return strings.Trim(name, "-") + "-" + kind + "-" + strings.ToLower(b.ID[:8])
+}
+
+// backupJob returns job with rclone configuration of target in secret and
+// work dir shared by containers
+func (element *elementMongodbS) backupJob(b *ElementBackupS, t *elementBackupS, kind string) (*kube.JobS, *tlog.RecordS) {
+
+	kClient := element.kubeClient()
+	if kClient == nil {
+		return nil, tlog.Error("kube.Client not ready")
+	}
+
+	secretData := t.rcloneEnv()
+	if kind != "remove" {
+		uri, err := element.mongodbURI()
+		if err != nil {
+			return nil, err
+		}
+		secretData["MONGODB_URI"] = []byte(uri)
+	}
+
+	labels := map[string]string{
+		"timoni-env":    element.EnvironmentID,
+		"element":       element.Name,
+		"timoni-backup": b.ID,
+	}
+	job := &kube.JobS{
+		KubeClient: kClient,
+		Namespace:  element.EnvironmentID,
+		Name:       element.backupJobName(b, kind),
+		Labels:     labels,
+		Volumes: []corev1.Volume{
+			{
+				Name:         "work",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		},
+	}
+
+	secret := &kube.SecretS{
+		KubeClient: kClient,
+		Namespace:  element.EnvironmentID,
+		Name:       job.Name,
+		Type:       corev1.SecretTypeOpaque,
+		Data:       secretData,
+		Labels:     labels,
+	}
+	if _, err := secret.CreateOrUpdate(); err != nil {
+		return nil, tlog.Error(err)
+	}
+
+	if t.Type == BackupTypeFilesystem {
+		job.Volumes = append(job.Volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				NFS: &corev1.NFSVolumeSource{
+					Server: t.RemoteServer,
+					Path:   t.RemotePath,
+				},
+			},
+		})
+	}
+	return job, nil
+}
+
+func (element *elementMongodbS) backupContainer(job *kube.JobS, t *elementBackupS, name, image string, cmd string) corev1.Container {
+	c := corev1.Container{
+		Name:    name,
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", cmd},
+		EnvFrom: []corev1.EnvFromSource{
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: job.Name}}},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "work", MountPath: mongodbBackupWorkDir},
+		},
+	}
+	if t.Type == BackupTypeFilesystem && image == mongodbBackupRcloneImage {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: "backup", MountPath: "/backup"})
+	}
+	return c
+}
+
+func (element *elementMongodbS) backupRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+
+	job, err := element.backupJob(b, t, "backup")
+	if err != nil {
+		return err
+	}
+	remote := t.rcloneRemote(b.Name + ".archive.gz")
+
+	job.InitContainers = []corev1.Container{
+		element.backupContainer(job, t, "dump", element.mongodbImage(),
+			`mongodump --uri="$MONGODB_URI" --gzip --archive=`+mongodbBackupArchive),
+	}
+	// size of archive is termination message of upload
+	job.Containers = []corev1.Container{
+		element.backupContainer(job, t, "upload", mongodbBackupRcloneImage,
+			fmt.Sprintf(`rclone copyto %s "%s" && stat -c %%s %s > /dev/termination-log`,
+				mongodbBackupArchive, remote, mongodbBackupArchive)),
+	}
+	return tlog.Error(job.Create())
+}
+
+func (element *elementMongodbS) backupPoll(b *ElementBackupS, t *elementBackupS) (bool, *tlog.RecordS) {
+	return element.jobPoll(b, "backup", func(msg string) {
+		b.SizeBytes, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	})
+}
+
+func (element *elementMongodbS) backupRemove(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+
+	job, err := element.backupJob(b, t, "remove")
+	if err != nil {
+		return err
+	}
+	job.Containers = []corev1.Container{
+		element.backupContainer(job, t, "remove", mongodbBackupRcloneImage,
+			fmt.Sprintf(`rclone deletefile "%s"`, t.rcloneRemote(b.Name+".archive.gz"))),
+	}
+	if err := tlog.Error(job.Create()); err != nil {
+		return err
+	}
+
+	// record of backup is deleted at once, job only cleans up target
+	go func() {
+		defer PanicHandler()
+		waitFor(10*time.Minute, func() bool {
+			done, err := element.jobPoll(b, "remove", nil)
+			if err != nil {
+				tlog.Error("removing of mongodb backup failed", tlog.Vars{
+					"env": element.EnvironmentID, "element": element.Name, "backup": b.Name, "error": err.Message,
+				})
+			}
+			return done || err != nil
+		})
+	}()
+	return nil
+}
+
+func (element *elementMongodbS) restoreRun(b *ElementBackupS, t *elementBackupS) *tlog.RecordS {
+
+	job, err := element.backupJob(b, t, "restore")
+	if err != nil {
+		return err
+	}
+	// previous restore of the same backup
+	tlog.Error(job.Delete())
+
+	job.InitContainers = []corev1.Container{
+		element.backupContainer(job, t, "download", mongodbBackupRcloneImage,
+			fmt.Sprintf(`rclone copyto "%s" %s`, t.rcloneRemote(b.Name+".archive.gz"), mongodbBackupArchive)),
+	}
+	job.Containers = []corev1.Container{
+		element.backupContainer(job, t, "restore", element.mongodbImage(),
+			`mongorestore --uri="$MONGODB_URI" --drop --gzip --archive=`+mongodbBackupArchive),
+	}
+	return tlog.Error(job.Create())
+}
+
+func (element *elementMongodbS) restorePoll(b *ElementBackupS, t *elementBackupS) (bool, *tlog.RecordS) {
+	return element.jobPoll(b, "restore", nil)
+}
+
+// jobPoll returns true when job finished, its secret with credentials is
+// removed then
+func (element *elementMongodbS) jobPoll(b *ElementBackupS, kind string, onSuccess func(msg string)) (bool, *tlog.RecordS) {
+
+	kClient := element.kubeClient()
+	job := &kube.JobS{
+		KubeClient: kClient,
+		Namespace:  element.EnvironmentID,
+		Name:       element.backupJobName(b, kind),
+	}
+	status, msg := job.Status()
+	if status == kube.JobStatusRunning {
+		return false, nil
+	}
+
+	secret := &kube.SecretS{KubeClient: kClient, Namespace: element.EnvironmentID, Name: job.Name}
+	tlog.Error(secret.Delete())
+
+	switch status {
+	case kube.JobStatusSucceeded:
+		if onSuccess != nil {
+			onSuccess(msg)
+		}
+		return true, nil
+	case kube.JobStatusNotFound:
+		return false, tlog.Error(kind + " job not found")
+	}
+	return false, tlog.Error(msg)
+}
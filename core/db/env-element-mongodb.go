@@ -1,7 +1,6 @@
 package db
 
 import (
-	"core/kube"
 	"fmt"
 	"lib/tlog"
 )
@@ -13,6 +12,9 @@ type elementMongodbS struct {
 	BackupAzureStorageAccountKey       string `toml:"backup-azure-storage-account-key"`
 	BackupAzureStorageAccountContainer string `toml:"backup-azure-storage-account-container"`
 
+	Backup     map[string]elementBackupS `toml:"backup"`      // key=target name
+	BackupUser string                    `toml:"backup-user"` // user used by mongodump, default user with root or backup role
+
 	Version       string                         `toml:"version"`
 	MembersCount  int                            `toml:"members-count"`
 	StorageSize   int                            `toml:"storage-size-gb"`
@@ -52,6 +54,39 @@ func (element *elementMongodbS) check(user *UserS) *tlog.RecordS {
 	if element.ToDelete {
 		return nil
 	}
+
+	// backup-azure-storage-account-* are older form of azure target
+	storedKey := ""
+	if old, ok := ElementMap.Get(element.EnvironmentID + "/" + element.Name).(*elementMongodbS); ok {
+		storedKey = old.BackupAzureStorageAccountKey
+	}
+	element.BackupAzureStorageAccountKey = resealPlain(storedKey, element.BackupAzureStorageAccountKey)
+	if element.BackupAzureStorageAccountName != "" {
+		if element.Backup == nil {
+			element.Backup = map[string]elementBackupS{}
+		}
+		if _, ok := element.Backup["azure"]; !ok {
+			element.Backup["azure"] = elementBackupS{
+				Type:                         BackupTypeAzure,
+				AzureStorageAccountName:      element.BackupAzureStorageAccountName,
+				AzureStorageAccountKey:       element.BackupAzureStorageAccountKey,
+				AzureStorageAccountContainer: element.BackupAzureStorageAccountContainer,
+			}
+		}
+	}
+	if err := backupTargetsCheck(element.Backup, backupTargetsStored(element.EnvironmentID, element.Name)); err != nil {
+		return err
+	}
+	if element.BackupUser != "" {
+		if _, ok := element.Users[element.BackupUser]; !ok {
+			return tlog.Error("backup-user not found in users")
+		}
+	}
+
+	if err := envQuotaCheck(element); err != nil {
+		return err
+	}
+
 	return element.elementS.check(user)
 }
 
@@ -93,10 +128,10 @@ func (element *elementMongodbS) DeleteFromKube() *tlog.RecordS {
 		return tlog.Error("element.EnvironmentID is empty")
 	}
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
 
 	return nil
-}
\ No newline at end of file
+}
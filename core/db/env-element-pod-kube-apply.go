@@ -90,6 +90,9 @@ func elementVariableCheck(element *elementPodS) CheckStepResultS {
 	if errs := element.GetVariableError(); len(errs) > 0 {
 		return stepFail("Variable errors")
 	}
+	if err := element.secretsCheck(); err != nil {
+		return stepFail(err.Message)
+	}
 	return stepSuccess("ok")
 }
 
@@ -178,7 +181,7 @@ func elementCheckKubePrepare(element *elementPodS) CheckStepResultS {
 		return stepSuccess("skiped: no run-cmd")
 	}
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return stepFail("kube.Client not ready")
@@ -308,6 +311,15 @@ func elementCheckRunningPods(element *elementPodS) CheckStepResultS {
 
 		pod := es.pods[podInKube.Name]
 		pod.NodeName = podInKube.Obj.Spec.NodeName
+		if restarts := podInKube.RestartCount(); exist && restarts > pod.RestartCount {
+			tlog.Warning("pod {{pod}} of element {{element}} restarted: {{reason}}", tlog.Vars{
+				"pod":     podInKube.Name,
+				"element": element.Name,
+				"reason":  podInKube.LastTerminationReason(),
+				"env":     element.EnvironmentID,
+				"event":   true,
+			})
+		}
 		pod.RestartCount = podInKube.RestartCount()
 		pod.Alerts = []string{}
 		podCheckResult := checkPod(&podS{
@@ -388,7 +400,7 @@ func elementCheckRunningPods(element *elementPodS) CheckStepResultS {
 
 func elementContainerCreateOrUpdate(element *elementPodS) (anyChange bool, err error) {
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return false, fmt.Errorf("kube.Client not ready")
@@ -633,7 +645,7 @@ func elementContainerCreateOrUpdate(element *elementPodS) (anyChange bool, err e
 // =============================================================
 
 func elementPods(element *elementPodS, onlyReady bool) (podList []*kube.PodS) {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return
@@ -664,7 +676,7 @@ func elementPods(element *elementPodS, onlyReady bool) (podList []*kube.PodS) {
 // =============================================================
 
 func elementCleanupPods(element *elementPodS) {
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return
@@ -774,7 +786,7 @@ func podCheckStorages(pod *podS) CheckStepResultS {
 func podGetAlertsFromKubeEvents(pod *podS) (AlertList []string) {
 	var timeout int64 = 600
 
-	kClient := kube.GetKube()
+	kClient := pod.inKube.KubeClient
 	if kClient == nil {
 		tlog.Error("kube.Client not ready")
 		return
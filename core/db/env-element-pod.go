@@ -1,6 +1,7 @@
 package db
 
 import (
+	"core/db2"
 	"core/kube"
 	"fmt"
 	"lib/tlog"
@@ -34,6 +35,9 @@ type elementPodS struct {
 
 	Schedule string              `toml:"schedule"` // cron schedule format
 	Actions  map[string][]string `toml:"actions"`  // key=action name, value=action script
+	Backup   elementPodBackupS   `toml:"backup"`   // snapshots of block storage
+
+	Profiling *elementProfilingS `toml:"profiling"` // nil = disabled
 
 	CPUReservedPC uint `toml:"cpu"` // PC = procent rdzenia, in % of vCores, eg 100 = 1 vcore, 250 = 2.5 vcore
 	CPULimitPC    uint `toml:"-"`   // PC = procent rdzenia, in % of vCores, eg 100 = 1 vcore, 250 = 2.5 vcore
@@ -112,6 +116,13 @@ type ElementScaleS struct {
 	CPUTargetProc uint `toml:"targetCPU"`
 }
 
+type elementPodBackupS struct {
+	Schedule string `toml:"schedule"`  // cron schedule format, in timezone of env schedule
+	Keep     int    `toml:"keep"`      // number of scheduled snapshots kept, default 7
+	KeepDays int    `toml:"keep-days"` // scheduled snapshots older than days are deleted, 0 = no limit
+	Export   bool   `toml:"export"`    // export snapshots to S3 backup target
+}
+
 type elementContainerServiceAccountS struct {
 	Name   string `toml:"name"`
 	Secret string `toml:"secret"`
@@ -206,6 +217,13 @@ func (element *elementPodS) check(user *UserS) *tlog.RecordS {
 		}
 	}
 
+	if err := element.backupCheck(); err != nil {
+		return err
+	}
+
+	if err := element.profilingCheck(); err != nil {
+		return err
+	}
 
 	if element.SourceGit.RepoName == "" || element.SourceGit.FilePath == "" {
 		// element from scratch bez git-repo
@@ -269,6 +287,10 @@ func (element *elementPodS) check(user *UserS) *tlog.RecordS {
 		element.Build.Script = "FROM scratch\n\n" + element.Build.Script + "\n"
 	}
 
+	if err := envQuotaCheck(element); err != nil {
+		return err
+	}
+
 	// run generic check
 	return element.elementS.check(user)
 }
@@ -296,6 +318,9 @@ func (element *elementPodS) Merge(el EnvElementS) *tlog.RecordS {
 	e.Build.ImageID = element.Build.ImageID
 	e.Scale = element.Scale
 	e.Stateful = element.Stateful
+	if e.Profiling != nil && element.Profiling != nil {
+		e.Profiling.Token = element.Profiling.Token
+	}
 
 	for k, v := range e.Variables {
 		elementVar, ok := element.Variables[k]
@@ -323,7 +348,7 @@ func (element *elementPodS) DeleteFromKube() *tlog.RecordS {
 		return tlog.Error("element.EnvironmentID is empty")
 	}
 
-	kClient := kube.GetKube()
+	kClient := element.kubeClient()
 	if kClient == nil {
 		return tlog.Error("kube.Client not ready")
 	}
@@ -384,5 +409,17 @@ func (element *elementPodS) VariablesGet(returnSecrets bool) map[string]string {
 		variables["EP_CRON_EXPRESSION"] = element.Schedule
 	}
 
+	if p := element.Profiling; p != nil {
+		variables["EP_PROFILING_PORT"] = fmt.Sprint(p.Port)
+		variables["EP_PROFILING_PATH"] = p.Path
+		variables["EP_PROFILING_INTERVAL"] = fmt.Sprint(p.IntervalSec)
+		variables["EP_PROFILING_TYPES"] = strings.Join(p.Types, ",")
+		variables["EP_PROFILING_CPU_SECONDS"] = fmt.Sprint(p.CPUSeconds)
+		if returnSecrets {
+			variables["EP_PROFILING_TOKEN"] = p.Token
+		}
+		variables["TIMONI_URL"] = db2.TheDomain.URL("")
+	}
+
 	return variables
 }
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"bytes"
+	"core/config"
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/google/uuid"
+)
+
+// Pods with `[profiling]` run entry-point which pulls profiles from pprof
+// HTTP endpoint of process and uploads them with version of element. Core
+// keeps profiles of last versions to compare them.
+
+// elementProfilingS is `[profiling]` of pod element
+type elementProfilingS struct {
+	Port        int      `toml:"port"`          // pprof HTTP port of process on localhost, default 6060
+	Path        string   `toml:"path"`          // default /debug/pprof
+	Interval    string   `toml:"interval"`      // default 10m, min 1m
+	IntervalSec int      `toml:"-"`             // parsed Interval
+	Types       []string `toml:"types"`         // default cpu, heap
+	CPUSeconds  int      `toml:"cpu-seconds"`   // duration of cpu profile, default 10
+	Keep        int      `toml:"keep"`          // profiles of type kept per version, default 20
+	KeepVersion int      `toml:"keep-versions"` // versions of element with profiles kept, default 5
+	Token       string   `toml:"-"`             // authorizes uploads of entry-point
+}
+
+var elementProfileTypes = []string{"cpu", "heap", "allocs", "goroutine", "mutex", "block", "threadcreate"}
+
+// ElementProfileS is single profile uploaded by entry-point of pod, data is
+// gzipped protobuf readable by `go tool pprof`
+type ElementProfileS struct {
+	ID          string
+	EnvID       string
+	ElementName string
+	Pod         string
+	Version     string // ELEMENT_VERSION of pod
+	Type        string
+	SizeBytes   int64
+	CreatedTime int64
+}
+
+// ElementProfileCompareS is difference of profiles of two versions of
+// element, values are averages per profile
+type ElementProfileCompareS struct {
+	Type       string
+	SampleType string
+	Unit       string
+	Base       ElementProfileVersionS
+	Target     ElementProfileVersionS
+	Functions  []ElementProfileFunctionS // sorted by absolute delta
+}
+
+type ElementProfileVersionS struct {
+	Version  string
+	Profiles int
+	Total    int64
+}
+
+type ElementProfileFunctionS struct {
+	Name    string
+	Base    int64 // flat value
+	Target  int64
+	Delta   int64
+	DeltaPC float64 // % of total of base
+}
+
+var ElementProfileMap = maps.NewSafe[string, *ElementProfileS](nil) // key=ID
+
+func LoadElementProfiles() {
+	ElementProfileMap = maps.NewSafe[string, *ElementProfileS](nil)
+	list, err := driver.ReadAll("element-profile")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		p := &ElementProfileS{}
+		if err := json.Unmarshal(buf, p); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		ElementProfileMap.Set(p.ID, p)
+	}
+}
+
+// profilingCheck validates `[profiling]` of pod element
+func (element *elementPodS) profilingCheck() *tlog.RecordS {
+	p := element.Profiling
+	if p == nil {
+		return nil
+	}
+
+	if p.Port == 0 {
+		p.Port = 6060
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return tlog.Error("profiling port is invalid")
+	}
+	if p.Path == "" {
+		p.Path = "/debug/pprof"
+	}
+	if p.Interval == "" {
+		p.Interval = "10m"
+	}
+	interval, err := time.ParseDuration(p.Interval)
+	if err != nil {
+		return tlog.Error(fmt.Sprintf("invalid profiling interval: %v", err))
+	}
+	if interval < time.Minute {
+		return tlog.Error("profiling interval can't be shorter than 1m")
+	}
+	p.IntervalSec = int(interval.Seconds())
+
+	if len(p.Types) == 0 {
+		p.Types = []string{"cpu", "heap"}
+	}
+	for _, t := range p.Types {
+		if !elementProfileTypeValid(t) {
+			return tlog.Error("invalid profile type {{type}}", tlog.Vars{
+				"type": t,
+			})
+		}
+	}
+	if p.CPUSeconds <= 0 {
+		p.CPUSeconds = 10
+	}
+	if p.CPUSeconds > 60 {
+		return tlog.Error("profiling cpu-seconds can't be longer than 60")
+	}
+	if p.Keep <= 0 {
+		p.Keep = 20
+	}
+	if p.KeepVersion <= 0 {
+		p.KeepVersion = 5
+	}
+	if p.Token == "" {
+		p.Token = uuid.NewString()
+	}
+	return nil
+}
+
+func elementProfileTypeValid(t string) bool {
+	for _, v := range elementProfileTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ElementProfilingGet returns `[profiling]` of element, nil when element is
+// not a pod or profiling is disabled
+func ElementProfilingGet(element EnvElementS) *elementProfilingS {
+	pod, ok := element.(*elementPodS)
+	if !ok || pod == nil {
+		return nil
+	}
+	return pod.Profiling
+}
+
+// ElementProfileList returns profiles of element, newest first, empty
+// profileType returns all types
+func ElementProfileList(envID, elementName, profileType string) []*ElementProfileS {
+	res := []*ElementProfileS{}
+	for _, p := range ElementProfileMap.Values() {
+		if p.EnvID == envID && p.ElementName == elementName && (profileType == "" || p.Type == profileType) {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedTime > res[j].CreatedTime })
+	return res
+}
+
+func elementProfileDataPath(id string) string {
+	return filepath.Join(config.DataPath(), "element-profile-data", id+".pb.gz")
+}
+
+// ElementProfileSave stores profile uploaded by entry-point of pod
+func ElementProfileSave(env *EnvironmentS, element EnvElementS, pod, version, profileType string, data []byte) *tlog.RecordS {
+
+	profiling := ElementProfilingGet(element)
+	if profiling == nil {
+		return tlog.Error("profiling of element is disabled")
+	}
+	if !elementProfileTypeValid(profileType) {
+		return tlog.Error("invalid profile type")
+	}
+	if _, err := profile.ParseData(data); err != nil {
+		return tlog.Error(fmt.Sprintf("invalid profile: %v", err))
+	}
+
+	p := &ElementProfileS{
+		ID:          newRBACID()[:16],
+		EnvID:       env.ID,
+		ElementName: element.GetName(),
+		Pod:         pod,
+		Version:     version,
+		Type:        profileType,
+		SizeBytes:   int64(len(data)),
+		CreatedTime: time.Now().Unix(),
+	}
+
+	if err := os.WriteFile(elementProfileDataPath(p.ID), data, 0644); err != nil {
+		return tlog.Error(err)
+	}
+	if err := driver.Write("element-profile", p.ID, p); err != nil {
+		os.Remove(elementProfileDataPath(p.ID))
+		return tlog.Error(err)
+	}
+	ElementProfileMap.Set(p.ID, p)
+
+	elementProfileRetention(env.ID, p.ElementName, profileType, profiling)
+	return nil
+}
+
+// elementProfileRetention keeps `keep` newest profiles of type for each of
+// `keep-versions` newest versions of element
+func elementProfileRetention(envID, elementName, profileType string, profiling *elementProfilingS) {
+	versions := map[string]int{}
+	for _, p := range ElementProfileList(envID, elementName, profileType) {
+		if _, ok := versions[p.Version]; !ok {
+			if len(versions) >= profiling.KeepVersion {
+				tlog.Error(p.Delete())
+				continue
+			}
+		}
+		versions[p.Version]++
+		if versions[p.Version] > profiling.Keep {
+			tlog.Error(p.Delete())
+		}
+	}
+}
+
+// Data returns gzipped protobuf of profile
+func (p *ElementProfileS) Data() ([]byte, *tlog.RecordS) {
+	buf, err := os.ReadFile(elementProfileDataPath(p.ID))
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	return buf, nil
+}
+
+func (p *ElementProfileS) Delete() *tlog.RecordS {
+	os.Remove(elementProfileDataPath(p.ID))
+	if err := driver.Delete("element-profile", p.ID); err != nil {
+		return tlog.Error(err)
+	}
+	ElementProfileMap.Delete(p.ID)
+	return nil
+}
+
+// elementProfilesDelete removes profiles of env, empty elementName removes
+// profiles of all elements
+func elementProfilesDelete(envID, elementName string) {
+	for _, p := range ElementProfileMap.Values() {
+		if p.EnvID == envID && (elementName == "" || p.ElementName == elementName) {
+			tlog.Error(p.Delete())
+		}
+	}
+}
+
+// ElementProfileMerge merges all profiles of type uploaded by pods of given
+// version of element, it returns number of merged profiles
+func ElementProfileMerge(envID, elementName, profileType, version string) (*profile.Profile, int, *tlog.RecordS) {
+
+	list := []*profile.Profile{}
+	for _, p := range ElementProfileList(envID, elementName, profileType) {
+		if p.Version != version {
+			continue
+		}
+		buf, err := p.Data()
+		if err != nil {
+			return nil, 0, err
+		}
+		prof, e := profile.ParseData(buf)
+		if e != nil {
+			return nil, 0, tlog.Error(e)
+		}
+		list = append(list, prof)
+	}
+	if len(list) == 0 {
+		return nil, 0, tlog.Error("no {{type}} profiles of version {{version}}", tlog.Vars{
+			"type":    profileType,
+			"version": version,
+		})
+	}
+
+	merged, err := profile.Merge(list)
+	if err != nil {
+		return nil, 0, tlog.Error(err)
+	}
+	return merged, len(list), nil
+}
+
+// ElementProfileMergeData returns merged profiles of version as gzipped
+// protobuf, eg. for `go tool pprof -diff_base`
+func ElementProfileMergeData(envID, elementName, profileType, version string) ([]byte, *tlog.RecordS) {
+	merged, _, err := ElementProfileMerge(envID, elementName, profileType, version)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := merged.Write(buf); err != nil {
+		return nil, tlog.Error(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// profileSampleIndex returns index of default sample type of profile, eg.
+// inuse_space of heap or alloc_space of allocs
+func profileSampleIndex(p *profile.Profile) int {
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			return i
+		}
+	}
+	return len(p.SampleType) - 1
+}
+
+// profileFlat returns flat values of functions, sum of values of samples
+// where function is on top of stack
+func profileFlat(p *profile.Profile, index int) (map[string]int64, int64) {
+	res := map[string]int64{}
+	total := int64(0)
+	for _, s := range p.Sample {
+		v := s.Value[index]
+		total += v
+		name := "unknown"
+		if len(s.Location) > 0 && len(s.Location[0].Line) > 0 && s.Location[0].Line[0].Function != nil {
+			name = s.Location[0].Line[0].Function.Name
+		}
+		res[name] += v
+	}
+	return res, total
+}
+
+// ElementProfileCompare compares profiles of type of two versions of
+// element and returns `top` functions with the biggest change
+func ElementProfileCompare(envID, elementName, profileType, baseVersion, targetVersion string, top int) (*ElementProfileCompareS, *tlog.RecordS) {
+
+	base, baseCount, err := ElementProfileMerge(envID, elementName, profileType, baseVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, targetCount, err := ElementProfileMerge(envID, elementName, profileType, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	index := profileSampleIndex(base)
+	if index < 0 || len(target.SampleType) != len(base.SampleType) {
+		return nil, tlog.Error("profiles are not comparable")
+	}
+
+	baseFlat, baseTotal := profileFlat(base, index)
+	targetFlat, targetTotal := profileFlat(target, index)
+
+	res := &ElementProfileCompareS{
+		Type:       profileType,
+		SampleType: base.SampleType[index].Type,
+		Unit:       base.SampleType[index].Unit,
+		Base: ElementProfileVersionS{
+			Version:  baseVersion,
+			Profiles: baseCount,
+			Total:    baseTotal / int64(baseCount),
+		},
+		Target: ElementProfileVersionS{
+			Version:  targetVersion,
+			Profiles: targetCount,
+			Total:    targetTotal / int64(targetCount),
+		},
+	}
+
+	names := map[string]bool{}
+	for name := range baseFlat {
+		names[name] = true
+	}
+	for name := range targetFlat {
+		names[name] = true
+	}
+	for name := range names {
+		f := ElementProfileFunctionS{
+			Name:   name,
+			Base:   baseFlat[name] / int64(baseCount),
+			Target: targetFlat[name] / int64(targetCount),
+		}
+		f.Delta = f.Target - f.Base
+		if res.Base.Total != 0 {
+			f.DeltaPC = 100 * float64(f.Delta) / float64(res.Base.Total)
+		}
+		res.Functions = append(res.Functions, f)
+	}
+
+	abs := func(v int64) int64 {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sort.Slice(res.Functions, func(i, j int) bool {
+		if abs(res.Functions[i].Delta) != abs(res.Functions[j].Delta) {
+			return abs(res.Functions[i].Delta) > abs(res.Functions[j].Delta)
+		}
+		return res.Functions[i].Name < res.Functions[j].Name
+	})
+	if top > 0 && len(res.Functions) > top {
+		res.Functions = res.Functions[:top]
+	}
+	return res, nil
+}
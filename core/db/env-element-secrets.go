@@ -0,0 +1,95 @@
+package db
+
+import (
+	"core/config"
+	"core/db/envelope"
+	"lib/tlog"
+	"path/filepath"
+	"strings"
+)
+
+// SecretsReEncrypt seals all secrets in element files (current, patch and
+// history versions) and DNS provider settings with current primary master key
+// and drops cached elements, so they are loaded again from disk.
+func SecretsReEncrypt(user *UserS) envelope.ReEncryptResultS {
+
+	res := envelope.ReEncryptDir(filepath.Join(config.DataPath(), "env"))
+
+	for _, dir := range []string{"dns-provider", "sso-provider", "sso-user"} {
+		x := envelope.ReEncryptDir(filepath.Join(config.DataPath(), dir))
+		res.Files += x.Files
+		res.Values += x.Values
+		res.Errors = append(res.Errors, x.Errors...)
+	}
+
+	for _, k := range ElementMap.Keys() {
+		ElementMap.Delete(k)
+	}
+
+	tlog.Info("secrets re-encrypted", tlog.Vars{
+		"user":   user.Email,
+		"files":  res.Files,
+		"values": res.Values,
+		"event":  true,
+	})
+	return res
+}
+
+// SecretsRotateMasterKey adds new master key to key file and re-encrypts all secrets.
+func SecretsRotateMasterKey(user *UserS) (envelope.ReEncryptResultS, *tlog.RecordS) {
+
+	keyID, err := envelope.RotateFileKey()
+	if err != nil {
+		return envelope.ReEncryptResultS{}, tlog.Error(err)
+	}
+
+	tlog.Info("master key rotated", tlog.Vars{
+		"user":  user.Email,
+		"keyID": keyID,
+		"event": true,
+	})
+
+	return SecretsReEncrypt(user), nil
+}
+
+// ExternalSecretChanged renders again elements using changed external secret
+// (and elements referencing their variables). Saved elements with changed
+// values are applied to kube by kubesync, which restarts their pods.
+func ExternalSecretChanged(sourceKey string) {
+
+	for _, key := range ElementMap.Keys() {
+		element := ElementMap.Get(key)
+		if element == nil || element.GetVariablesDependence() == nil {
+			continue
+		}
+
+		uses := false
+		for _, dep := range element.GetVariablesDependence().Keys() {
+			if dep == sourceKey || strings.HasPrefix(dep, sourceKey+"#") {
+				uses = true
+				break
+			}
+		}
+		if !uses {
+			continue
+		}
+
+		env := element.GetEnvironment()
+		if env == nil {
+			continue
+		}
+
+		tlog.Info("external secret changed, rendering element again", tlog.Vars{
+			"envID":   env.ID,
+			"element": element.GetName(),
+			"source":  sourceKey,
+			"event":   true,
+		})
+
+		element.RenderVariables()
+		if err := element.Save(nil); err != nil {
+			continue
+		}
+		env.ReRender(element.GetName())
+	}
+}
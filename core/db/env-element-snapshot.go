@@ -0,0 +1,633 @@
+package db
+
+import (
+	"core/db2"
+	"core/kube"
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ElementSnapshotS is point-in-time copy of block storage of pod element, one
+// CSI VolumeSnapshot per volume of every pod of StatefulSet
+type ElementSnapshotS struct {
+	ID          string
+	EnvID       string
+	ElementName string
+	Label       string
+	Scheduled   bool // made by `[backup]` schedule of element, subject of retention
+	Export      bool // exported to S3 backup target
+	Volumes     []ElementSnapshotVolumeS
+	State       string
+	Error       string
+	SizeBytes   int64
+
+	CreatedTime    int64
+	CreatedByEmail string
+}
+
+type ElementSnapshotVolumeS struct {
+	MountPath string
+	Ordinal   int // pod of StatefulSet
+	PVC       string
+	Snapshot  string // name of VolumeSnapshot
+	Ready     bool
+	SizeBytes int64
+}
+
+const (
+	ElementSnapshotPending = "pending"
+	ElementSnapshotReady   = "ready"
+	ElementSnapshotFailed  = "failed"
+)
+
+var (
+	ElementSnapshotMap = maps.NewSafe[string, *ElementSnapshotS](nil) // key=ID
+
+	// elements with restore in progress, key=envID/elementName, value=snapshot ID
+	elementSnapshotRestoring = maps.NewSafe[string, string](nil)
+)
+
+func LoadElementSnapshots() {
+	ElementSnapshotMap = maps.NewSafe[string, *ElementSnapshotS](nil)
+	list, err := driver.ReadAll("element-snapshot")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		s := &ElementSnapshotS{}
+		if err := json.Unmarshal(buf, s); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		ElementSnapshotMap.Set(s.ID, s)
+	}
+}
+
+// ElementSnapshotList returns snapshots of element, newest first, empty
+// elementName returns snapshots of all elements of env
+func ElementSnapshotList(envID, elementName string) []*ElementSnapshotS {
+	res := []*ElementSnapshotS{}
+	for _, s := range ElementSnapshotMap.Values() {
+		if s.EnvID == envID && (elementName == "" || s.ElementName == elementName) {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedTime > res[j].CreatedTime })
+	return res
+}
+
+func (s *ElementSnapshotS) save() *tlog.RecordS {
+	if err := driver.Write("element-snapshot", s.ID, s); err != nil {
+		return tlog.Error(err)
+	}
+	ElementSnapshotMap.Set(s.ID, s)
+	return nil
+}
+
+// snapshotElement returns pod element with block storage
+func snapshotElement(env *EnvironmentS, elementName string) (*elementPodS, *tlog.RecordS) {
+	if !db2.TheSettings.Longhorn() {
+		return nil, tlog.Error("volume snapshots require Longhorn storage")
+	}
+	element, ok := env.GetElement(elementName).(*elementPodS)
+	if !ok || element == nil {
+		return nil, tlog.Error("element not found or it is not a pod")
+	}
+	if !element.Stateful {
+		return nil, tlog.Error("element has no block storage")
+	}
+	return element, nil
+}
+
+// ElementSnapshotCreate snapshots all block volumes of element
+func ElementSnapshotCreate(env *EnvironmentS, elementName, label string, export, scheduled bool, user *UserS) (*ElementSnapshotS, *tlog.RecordS) {
+
+	element, err := snapshotElement(env, elementName)
+	if err != nil {
+		return nil, err
+	}
+	if elementSnapshotRestoring.Get(env.ID+"/"+elementName) != "" {
+		return nil, tlog.Error("restore of element is in progress")
+	}
+	if export {
+		if t := VolumeBackupTargetGet(); t == nil || t.URL == "" {
+			return nil, tlog.Error("backup target is not configured")
+		}
+	}
+
+	s := &ElementSnapshotS{
+		ID:          newRBACID()[:16],
+		EnvID:       env.ID,
+		ElementName: elementName,
+		Label:       strings.TrimSpace(label),
+		Scheduled:   scheduled,
+		Export:      export,
+		State:       ElementSnapshotPending,
+		CreatedTime: time.Now().Unix(),
+	}
+	s.CreatedByEmail = "Timoni"
+	if user != nil {
+		s.CreatedByEmail = user.Email
+	}
+
+	className := kube.VolumeSnapshotClass
+	if export {
+		className = kube.VolumeBackupClass
+	}
+
+	kClient := element.kubeClient()
+	if kClient == nil {
+		return nil, tlog.Error("kube.Client not ready")
+	}
+	mountPaths := []string{}
+	for mountPath, store := range element.Storage {
+		if store.Type == "block" {
+			mountPaths = append(mountPaths, mountPath)
+		}
+	}
+	sort.Strings(mountPaths)
+
+	for _, mountPath := range mountPaths {
+		for ordinal := 0; ; ordinal++ {
+			pvc := kube.StatefulSetPVCName(elementName, mountPath, ordinal)
+			if !kClient.PVCExist(env.ID, pvc) {
+				break
+			}
+			vol := ElementSnapshotVolumeS{
+				MountPath: mountPath,
+				Ordinal:   ordinal,
+				PVC:       pvc,
+				Snapshot:  "snap-" + s.ID + "-" + pvc,
+			}
+			if len(vol.Snapshot) > 253 {
+				vol.Snapshot = vol.Snapshot[:253]
+			}
+			ks := &kube.VolumeSnapshotS{
+				KubeClient: kClient,
+				Namespace:  env.ID,
+				Name:       vol.Snapshot,
+				PVCName:    pvc,
+				ClassName:  className,
+				Labels: map[string]string{
+					"timoni-env":      env.ID,
+					"element":         elementName,
+					"timoni-snapshot": s.ID,
+				},
+			}
+			if err := ks.Create(); err != nil {
+				s.deleteFromKube()
+				return nil, err
+			}
+			s.Volumes = append(s.Volumes, vol)
+		}
+	}
+	if len(s.Volumes) == 0 {
+		return nil, tlog.Error("element has no volumes yet, deploy it first")
+	}
+
+	if err := s.save(); err != nil {
+		s.deleteFromKube()
+		return nil, err
+	}
+
+	tlog.Info("element snapshot created", tlog.Vars{
+		"env":       env.ID,
+		"element":   elementName,
+		"snapshot":  s.ID,
+		"label":     s.Label,
+		"export":    export,
+		"scheduled": scheduled,
+		"user":      s.CreatedByEmail,
+		"event":     true,
+	})
+	return s, nil
+}
+
+// refresh updates state of pending snapshot from kube
+func (s *ElementSnapshotS) refresh() {
+	if s.State != ElementSnapshotPending {
+		return
+	}
+
+	kClient := envKube(s.EnvID)
+	if kClient == nil {
+		return
+	}
+	ready := true
+	s.SizeBytes = 0
+	for i := range s.Volumes {
+		vol := &s.Volumes[i]
+		ks := &kube.VolumeSnapshotS{KubeClient: kClient, Namespace: s.EnvID, Name: vol.Snapshot}
+		status, err := ks.Status()
+		if err != nil {
+			s.State = ElementSnapshotFailed
+			s.Error = "snapshot of " + vol.PVC + " not found"
+			break
+		}
+		if status.Error != "" {
+			s.State = ElementSnapshotFailed
+			s.Error = vol.PVC + ": " + status.Error
+			break
+		}
+		vol.Ready = status.Ready
+		vol.SizeBytes = status.SizeBytes
+		s.SizeBytes += status.SizeBytes
+		ready = ready && status.Ready
+	}
+	if s.State == ElementSnapshotPending && ready {
+		s.State = ElementSnapshotReady
+	}
+	if s.State == ElementSnapshotPending && time.Since(time.Unix(s.CreatedTime, 0)) > 12*time.Hour {
+		s.State = ElementSnapshotFailed
+		s.Error = "snapshot is not ready after 12 hours"
+	}
+	if s.State == ElementSnapshotPending {
+		return
+	}
+
+	tlog.Error(s.save())
+	if s.State == ElementSnapshotFailed {
+		tlog.Error("element snapshot failed", tlog.Vars{
+			"env":      s.EnvID,
+			"element":  s.ElementName,
+			"snapshot": s.ID,
+			"error":    s.Error,
+			"event":    true,
+		})
+	}
+}
+
+func (s *ElementSnapshotS) deleteFromKube() {
+	kClient := envKube(s.EnvID)
+	if kClient == nil {
+		return
+	}
+	for _, vol := range s.Volumes {
+		ks := &kube.VolumeSnapshotS{KubeClient: kClient, Namespace: s.EnvID, Name: vol.Snapshot}
+		tlog.Error(ks.Delete())
+	}
+}
+
+// Delete removes snapshot with its data, exported backup is removed from
+// backup target too
+func (s *ElementSnapshotS) Delete(user *UserS) *tlog.RecordS {
+
+	for _, id := range elementSnapshotRestoring.Values() {
+		if id == s.ID {
+			return tlog.Error("snapshot is being restored")
+		}
+	}
+
+	if EnvironmentMap.Get(s.EnvID) != nil {
+		s.deleteFromKube()
+	}
+	if err := driver.Delete("element-snapshot", s.ID); err != nil {
+		return tlog.Error(err)
+	}
+	ElementSnapshotMap.Delete(s.ID)
+
+	email := "Timoni"
+	if user != nil {
+		email = user.Email
+	}
+	tlog.Info("element snapshot deleted", tlog.Vars{
+		"env":      s.EnvID,
+		"element":  s.ElementName,
+		"snapshot": s.ID,
+		"user":     email,
+		"event":    true,
+	})
+	return nil
+}
+
+// --------------------------------------------------
+
+// Restore replaces volumes of element with the same name in target env by
+// data of snapshot. Target env can be the source env or its clone. Element
+// is stopped during restore.
+func (s *ElementSnapshotS) Restore(target *EnvironmentS, user *UserS) *tlog.RecordS {
+
+	if s.State != ElementSnapshotReady {
+		return tlog.Error("snapshot is not ready")
+	}
+	element, err := snapshotElement(target, s.ElementName)
+	if err != nil {
+		return err
+	}
+	if source := EnvironmentMap.Get(s.EnvID); source != nil && !source.SameCluster(target) {
+		return tlog.Error("snapshot can't be restored on other cluster, use backup of element")
+	}
+	for _, vol := range s.Volumes {
+		if store := element.Storage[vol.MountPath]; store == nil || store.Type != "block" {
+			return tlog.Error("element has no block storage mounted at " + vol.MountPath)
+		}
+	}
+
+	if !s.restoreLock(target.ID) {
+		return tlog.Error("restore of element is in progress")
+	}
+
+	wasStopped := element.GetStopped()
+	element.SetStopped(true)
+	if err := element.Save(user); err != nil {
+		elementSnapshotRestoring.Delete(target.ID + "/" + s.ElementName)
+		return err
+	}
+
+	go s.restore(target, wasStopped, user)
+	return nil
+}
+
+// restoreToClone waits for fresh snapshot of source element and restores it
+// into element of cloned env, which is kept stopped until data is restored
+func (s *ElementSnapshotS) restoreToClone(target *EnvironmentS, startAfter bool, user *UserS) {
+	defer PanicHandler()
+
+	waitFor(12*time.Hour, func() bool {
+		cur := ElementSnapshotMap.Get(s.ID)
+		return cur == nil || cur.State != ElementSnapshotPending
+	})
+
+	if s.State != ElementSnapshotReady || !s.restoreLock(target.ID) {
+		tlog.Error("element restore failed", tlog.Vars{
+			"env":        target.ID,
+			"element":    s.ElementName,
+			"source-env": s.EnvID,
+			"snapshot":   s.ID,
+			"error":      "snapshot is not ready",
+			"event":      true,
+		})
+		if element := target.GetElement(s.ElementName); element != nil {
+			element.SetStopped(!startAfter)
+			tlog.Error(element.Save(user))
+		}
+		return
+	}
+
+	s.restore(target, !startAfter, user)
+}
+
+func (s *ElementSnapshotS) restoreLock(envID string) bool {
+	key := envID + "/" + s.ElementName
+	locked := false
+	elementSnapshotRestoring.Commit(func(m map[string]string) {
+		if m[key] == "" {
+			m[key] = s.ID
+			locked = true
+		}
+	})
+	return locked
+}
+
+// waitFor checks fn every 3 seconds until it returns true or timeout
+func waitFor(timeout time.Duration, fn func() bool) bool {
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(3 * time.Second) {
+		if fn() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ElementSnapshotS) restore(target *EnvironmentS, wasStopped bool, user *UserS) {
+	defer PanicHandler()
+	defer elementSnapshotRestoring.Delete(target.ID + "/" + s.ElementName)
+
+	email := "Timoni"
+	if user != nil {
+		email = user.Email
+	}
+	vars := tlog.Vars{
+		"env":      target.ID,
+		"element":  s.ElementName,
+		"snapshot": s.ID,
+		"user":     email,
+		"event":    true,
+	}
+	if target.ID != s.EnvID {
+		vars["source-env"] = s.EnvID
+	}
+	tlog.Info("element restore started", vars)
+
+	err := s.restoreVolumes(target)
+
+	// start element again, also after failure, to not leave it stopped
+	if element := target.GetElement(s.ElementName); element != nil {
+		element.SetStopped(wasStopped)
+		tlog.Error(element.Save(user))
+	}
+
+	if err != nil {
+		vars["error"] = err.Message
+		tlog.Error("element restore failed", vars)
+		return
+	}
+	tlog.Info("element restore finished", vars)
+}
+
+func (s *ElementSnapshotS) restoreVolumes(target *EnvironmentS) *tlog.RecordS {
+
+	kClient := target.KubeClient()
+	if kClient == nil {
+		return tlog.Error("kube.Client not ready")
+	}
+	kClient.NamespaceCreate(target.ID)
+
+	element, ok := target.GetElement(s.ElementName).(*elementPodS)
+	if !ok || element == nil {
+		return tlog.Error("element not found")
+	}
+
+	// pods must release volumes before they're replaced
+	sts := &kube.StatefulSetS{KubeClient: kClient, Namespace: target.ID, Name: s.ElementName}
+	if !waitFor(10*time.Minute, func() bool {
+		if sts.Exist() {
+			tlog.Error(sts.Delete())
+			return false
+		}
+		return len(sts.PodList(false)) == 0
+	}) {
+		return tlog.Error("pods of element are still running")
+	}
+
+	copies := []*kube.VolumeSnapshotS{}
+	defer func() {
+		for _, c := range copies {
+			tlog.Error(c.DeleteCopy())
+		}
+	}()
+
+	pvcs := []string{}
+	for _, vol := range s.Volumes {
+
+		snapshotName := vol.Snapshot
+		if target.ID != s.EnvID {
+			src := &kube.VolumeSnapshotS{KubeClient: kClient, Namespace: s.EnvID, Name: vol.Snapshot}
+			c, err := src.CopyTo(target.ID, vol.Snapshot)
+			if err != nil {
+				return err
+			}
+			copies = append(copies, c)
+			if !waitFor(5*time.Minute, func() bool {
+				status, err := c.Status()
+				return err == nil && status.Ready
+			}) {
+				return tlog.Error("copy of snapshot is not ready")
+			}
+		}
+
+		pvc := kube.StatefulSetPVCName(s.ElementName, vol.MountPath, vol.Ordinal)
+		if err := kClient.PVCDelete(target.ID, pvc); err != nil {
+			return err
+		}
+		if !waitFor(5*time.Minute, func() bool { return !kClient.PVCExist(target.ID, pvc) }) {
+			return tlog.Error("volume " + pvc + " is still in use")
+		}
+
+		store := *element.Storage[vol.MountPath]
+		if sizeMB := int(vol.SizeBytes >> 20); sizeMB > store.MaxSizeMB {
+			store.MaxSizeMB = sizeMB
+		}
+		labels := map[string]string{
+			"timoni-env":      target.ID,
+			"element":         s.ElementName,
+			"timoni-snapshot": s.ID,
+		}
+		if err := kClient.PVCCreateFromSnapshot(target.ID, pvc, snapshotName, &store, labels); err != nil {
+			return err
+		}
+		pvcs = append(pvcs, pvc)
+	}
+
+	// copies of snapshots can be deleted when data is in volumes
+	if !waitFor(30*time.Minute, func() bool {
+		for _, pvc := range pvcs {
+			if !kClient.PVCBound(target.ID, pvc) {
+				return false
+			}
+		}
+		return true
+	}) {
+		return tlog.Error("restored volumes are not bound after 30 minutes")
+	}
+	return nil
+}
+
+// --------------------------------------------------
+
+// ElementSnapshotLoop makes scheduled snapshots of elements with `[backup]`,
+// applies retention and tracks state of pending snapshots
+func ElementSnapshotLoop() {
+	loopStart := time.Now()
+	for {
+		time.Sleep(time.Minute)
+
+		for _, s := range ElementSnapshotMap.Values() {
+			if EnvironmentMap.Get(s.EnvID) == nil {
+				// namespace of env with its snapshots is gone
+				tlog.Error(s.Delete(nil))
+				continue
+			}
+			s.refresh()
+		}
+
+		if !db2.TheSettings.Longhorn() {
+			continue
+		}
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete {
+				continue
+			}
+			for _, elementName := range env.Elements.Keys() {
+				element, ok := env.GetElement(elementName).(*elementPodS)
+				if !ok || element == nil || element.ToDelete || !element.Stateful || element.Backup.Schedule == "" {
+					continue
+				}
+				elementBackupScheduled(env, element, loopStart)
+				elementBackupRetention(env, element)
+			}
+		}
+	}
+}
+
+func elementBackupScheduled(env *EnvironmentS, element *elementPodS, loopStart time.Time) {
+
+	schedule, err := cron.ParseStandard(element.Backup.Schedule)
+	if err != nil {
+		return
+	}
+	loc := env.Schedule.Timezone
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	last := loopStart
+	for _, s := range ElementSnapshotList(env.ID, element.Name) {
+		if s.Scheduled {
+			last = time.Unix(s.CreatedTime, 0)
+			break
+		}
+	}
+	if schedule.Next(last.In(loc)).After(time.Now()) {
+		return
+	}
+
+	label := "scheduled " + time.Now().In(loc).Format("2006-01-02 15:04")
+	if _, err := ElementSnapshotCreate(env, element.Name, label, element.Backup.Export, true, nil); err != nil {
+		tlog.Error("scheduled element snapshot failed", tlog.Vars{
+			"env":     env.ID,
+			"element": element.Name,
+			"error":   err.Message,
+			"event":   true,
+		})
+	}
+}
+
+func elementBackupRetention(env *EnvironmentS, element *elementPodS) {
+
+	keep := element.Backup.Keep
+	minTime := int64(0)
+	if element.Backup.KeepDays > 0 {
+		minTime = time.Now().AddDate(0, 0, -element.Backup.KeepDays).Unix()
+	}
+
+	nr := 0
+	for _, s := range ElementSnapshotList(env.ID, element.Name) {
+		if !s.Scheduled || s.State == ElementSnapshotPending {
+			continue
+		}
+		nr++
+		if nr > keep || s.CreatedTime < minTime {
+			tlog.Error(s.Delete(nil))
+		}
+	}
+}
+
+// --------------------------------------------------
+
+// backupCheck validates `[backup]` of pod element
+func (element *elementPodS) backupCheck() *tlog.RecordS {
+	if element.Backup.Schedule == "" {
+		return nil
+	}
+	if !element.Stateful {
+		return tlog.Error("backup needs block storage")
+	}
+	if _, err := cron.ParseStandard(element.Backup.Schedule); err != nil {
+		return tlog.Error(fmt.Sprintf("invalid backup schedule: %v", err))
+	}
+	if element.Backup.Keep <= 0 {
+		element.Backup.Keep = 7
+	}
+	if element.Backup.KeepDays < 0 {
+		return tlog.Error("backup keep-days can't be negative")
+	}
+	return nil
+}
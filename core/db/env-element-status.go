@@ -1,6 +1,9 @@
 package db
 
-import "core/kube"
+import (
+	"core/kube"
+	"strings"
+)
 
 type ElementStatusS struct {
 	State        ElementState
@@ -11,6 +14,8 @@ type ElementStatusS struct {
 	PodCount int
 	pods     map[string]*ElementKubePodS // key=podName
 
+	Backup *ElementBackupStatusS `json:",omitempty"` // elements with backup targets
+
 	restart bool
 }
 
@@ -48,6 +53,21 @@ func (es *ElementStatusS) Save() {
 	}
 }
 
+// SetAlert replaces alert starting with prefix by msg, alerts of other
+// sources are kept, empty msg only drops the old alert
+func (es *ElementStatusS) SetAlert(prefix, msg string) {
+	alerts := []string{}
+	for _, a := range es.Alerts {
+		if !strings.HasPrefix(a, prefix) {
+			alerts = append(alerts, a)
+		}
+	}
+	if msg != "" {
+		alerts = append(alerts, prefix+msg)
+	}
+	es.Alerts = alerts
+}
+
 func (es *ElementStatusS) PodsGet() map[string]*ElementKubePodS {
 	return es.pods
 }
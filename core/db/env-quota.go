@@ -0,0 +1,523 @@
+package db
+
+import (
+	"core/db2/fp"
+	"core/kube"
+	"encoding/json"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// EnvQuotaS caps resources of env, quota is set for env (key `env:<id>`) or
+// for each env with tag (key `tag:<name>`). Limit of env is the lowest one of
+// quotas which apply to it, 0 = no limit. Quotas are checked when elements are
+// saved and mirrored to ResourceQuota of env namespace.
+type EnvQuotaS struct {
+	Key       string
+	CPUCores  float64 // requested by elements
+	RAMMB     int
+	StorageMB int
+	Pods      int
+	Domains   int
+
+	BudgetMonthly float64  // cost of env in month, see EnvQuotaPricesS
+	AlertEmails   []string // notified when budget is crossed
+
+	UpdateTime int64
+	UserEmail  string
+}
+
+// EnvQuotaUsageS is resources declared by elements of env
+type EnvQuotaUsageS struct {
+	CPUCores  float64
+	RAMMB     int
+	StorageMB int
+	Pods      int
+	Domains   int
+}
+
+// EnvQuotaPricesS are unit prices used to estimate cost of envs from usage of
+// CPU and RAM and declared storage
+type EnvQuotaPricesS struct {
+	Currency       string
+	CPUCoreHour    float64
+	RAMGBHour      float64
+	StorageGBMonth float64
+	UpdateTime     int64
+	UserEmail      string
+}
+
+// EnvCostS is cost of env in current month, it is accumulated by
+// EnvCostLoop from hourly rate of env
+type EnvCostS struct {
+	EnvID       string
+	Month       string // eg. 2026-10
+	Cost        float64
+	HourlyRate  float64
+	Projected   float64 // cost at the end of month with current rate
+	Budget      float64
+	BudgetAlert bool // alert was sent in this month
+	UpdateTime  int64
+}
+
+const (
+	quotaLimitRangeName = "timoni-defaults"
+	hoursInMonth        = 730
+)
+
+var quotaMap = maps.NewSafe[string, *EnvQuotaS](nil) // key=env:<id> or tag:<name>
+
+func quotaFileName(key string) string {
+	kind, name, _ := strings.Cut(key, ":")
+	return kind + "-" + conv.KeyString(name)
+}
+
+func LoadQuotas() {
+	list, err := driver.ReadAll("quota")
+	if err != nil {
+		tlog.Error(err)
+		return
+	}
+	for _, buf := range list {
+		q := &EnvQuotaS{}
+		if err := json.Unmarshal(buf, q); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		quotaMap.Set(q.Key, q)
+	}
+}
+
+func QuotaList() []*EnvQuotaS {
+	res := quotaMap.Values()
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+func QuotaSave(q *EnvQuotaS, user *UserS) *tlog.RecordS {
+
+	kind, name, _ := strings.Cut(q.Key, ":")
+	if (kind != "env" && kind != "tag") || name == "" {
+		return tlog.Error("quota key has to be `env:<id>` or `tag:<name>`")
+	}
+	if kind == "env" && EnvironmentMap.Get(name) == nil {
+		return tlog.Error("environment not found")
+	}
+	if q.CPUCores < 0 || q.RAMMB < 0 || q.StorageMB < 0 || q.Pods < 0 || q.Domains < 0 || q.BudgetMonthly < 0 {
+		return tlog.Error("quota can't be negative")
+	}
+	for _, email := range q.AlertEmails {
+		if !reEmail.MatchString(email) {
+			return tlog.Error("invalid email: " + email)
+		}
+	}
+
+	q.UpdateTime = time.Now().Unix()
+	q.UserEmail = user.Email
+	if err := driver.Write("quota", quotaFileName(q.Key), q); err != nil {
+		return tlog.Error(err)
+	}
+	quotaMap.Set(q.Key, q)
+
+	for _, env := range quotaEnvs(q.Key) {
+		envChanged(env.ID)
+	}
+
+	tlog.Info("quota saved", tlog.Vars{
+		"quota": q.Key,
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
+
+func QuotaDelete(key string, user *UserS) *tlog.RecordS {
+	if !quotaMap.Exists(key) {
+		return tlog.Error("quota not found")
+	}
+	if err := driver.Delete("quota", quotaFileName(key)); err != nil {
+		return tlog.Error(err)
+	}
+	envs := quotaEnvs(key)
+	quotaMap.Delete(key)
+	for _, env := range envs {
+		envChanged(env.ID)
+	}
+
+	tlog.Info("quota deleted", tlog.Vars{
+		"quota": key,
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
+
+// quotaEnvs returns envs to which quota applies
+func quotaEnvs(key string) []*EnvironmentS {
+	res := []*EnvironmentS{}
+	for _, env := range EnvironmentMap.Values() {
+		for _, k := range env.quotaKeys() {
+			if k == key {
+				res = append(res, env)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (env *EnvironmentS) quotaKeys() []string {
+	keys := []string{"env:" + env.ID}
+	if env.Tags != nil {
+		for _, tag := range env.Tags.List() {
+			keys = append(keys, "tag:"+tag)
+		}
+	}
+	return keys
+}
+
+// Quota returns limits of env, nil when no quota applies
+func (env *EnvironmentS) Quota() *EnvQuotaS {
+
+	var res *EnvQuotaS
+	minInt := func(a, b int) int {
+		if a == 0 || (b > 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	minFloat := func(a, b float64) float64 {
+		if a == 0 || (b > 0 && b < a) {
+			return b
+		}
+		return a
+	}
+
+	for _, key := range env.quotaKeys() {
+		q := quotaMap.Get(key)
+		if q == nil {
+			continue
+		}
+		if res == nil {
+			res = &EnvQuotaS{Key: "env:" + env.ID}
+		}
+		res.CPUCores = minFloat(res.CPUCores, q.CPUCores)
+		res.RAMMB = minInt(res.RAMMB, q.RAMMB)
+		res.StorageMB = minInt(res.StorageMB, q.StorageMB)
+		res.Pods = minInt(res.Pods, q.Pods)
+		res.Domains = minInt(res.Domains, q.Domains)
+		res.BudgetMonthly = minFloat(res.BudgetMonthly, q.BudgetMonthly)
+		res.AlertEmails = append(res.AlertEmails, q.AlertEmails...)
+	}
+	return res
+}
+
+// elementQuotaUsage returns resources declared by element, stopped elements
+// keep only their storage
+func elementQuotaUsage(el EnvElementS) EnvQuotaUsageS {
+	res := EnvQuotaUsageS{}
+	if el == nil || el.GetToDelete() {
+		return res
+	}
+
+	switch e := el.(type) {
+	case *elementPodS:
+		pods := int(e.Scale.NrOfPodsMax)
+		if pods < 1 {
+			pods = 1
+		}
+		res.Pods = pods
+		res.CPUCores = float64(e.CPUReservedPC) * float64(pods) / 100
+		res.RAMMB = int(e.RAMReservedMB) * pods
+		for _, storage := range e.Storage {
+			if storage.Type == "block" {
+				res.StorageMB += storage.MaxSizeMB * pods
+			}
+		}
+
+	case *elementElasticsearchS:
+		nodes := 0
+		for _, ns := range e.NodeSets {
+			nodes += ns.Count
+		}
+		if nodes < 1 {
+			nodes = 1
+		}
+		res.Pods = nodes
+		res.CPUCores = float64(e.CPUReservedPC) * float64(nodes) / 100
+		res.RAMMB = int(e.RAMReservedMB) * nodes
+		res.StorageMB = e.Storage * nodes
+
+	case *elementMongodbS:
+		members := e.MembersCount
+		if members < 1 {
+			members = 1
+		}
+		res.Pods = members
+		res.CPUCores = float64(e.CPUReservedPC) * float64(members) / 100
+		res.RAMMB = e.RAMReservedMB * members
+		res.StorageMB = e.StorageSize * 1024 * members
+
+	case *elementDomainS:
+		res.Domains = 1
+	}
+
+	if el.GetStopped() {
+		res = EnvQuotaUsageS{StorageMB: res.StorageMB}
+	}
+	return res
+}
+
+func (u *EnvQuotaUsageS) add(o EnvQuotaUsageS) {
+	u.CPUCores += o.CPUCores
+	u.RAMMB += o.RAMMB
+	u.StorageMB += o.StorageMB
+	u.Pods += o.Pods
+	u.Domains += o.Domains
+}
+
+// QuotaUsage returns resources declared by elements of env, element with the
+// same name as replace is counted as replace
+func (env *EnvironmentS) QuotaUsage(replace EnvElementS) EnvQuotaUsageS {
+	res := EnvQuotaUsageS{}
+	for _, elName := range env.Elements.Keys() {
+		if replace != nil && elName == replace.GetName() {
+			continue
+		}
+		res.add(elementQuotaUsage(env.GetElement(elName)))
+	}
+	if replace != nil {
+		res.add(elementQuotaUsage(replace))
+	}
+	return res
+}
+
+// exceeded returns resources of u over limits of quota, resources which
+// did not grow since than are skipped
+func (q *EnvQuotaS) exceeded(u EnvQuotaUsageS, than EnvQuotaUsageS) []string {
+	res := []string{}
+	if q.CPUCores > 0 && u.CPUCores > q.CPUCores && u.CPUCores > than.CPUCores {
+		res = append(res, fmt.Sprintf("cpu %.2f of %.2f cores", u.CPUCores, q.CPUCores))
+	}
+	if q.RAMMB > 0 && u.RAMMB > q.RAMMB && u.RAMMB > than.RAMMB {
+		res = append(res, fmt.Sprintf("ram %d of %d MB", u.RAMMB, q.RAMMB))
+	}
+	if q.StorageMB > 0 && u.StorageMB > q.StorageMB && u.StorageMB > than.StorageMB {
+		res = append(res, fmt.Sprintf("storage %d of %d MB", u.StorageMB, q.StorageMB))
+	}
+	if q.Pods > 0 && u.Pods > q.Pods && u.Pods > than.Pods {
+		res = append(res, fmt.Sprintf("pods %d of %d", u.Pods, q.Pods))
+	}
+	if q.Domains > 0 && u.Domains > q.Domains && u.Domains > than.Domains {
+		res = append(res, fmt.Sprintf("domains %d of %d", u.Domains, q.Domains))
+	}
+	return res
+}
+
+// envQuotaCheck rejects element which raises usage of env over its quota,
+// saves which do not raise usage pass, eg. after quota was lowered
+func envQuotaCheck(element EnvElementS) *tlog.RecordS {
+
+	env := element.GetEnvironment()
+	if env == nil || element.GetToDelete() {
+		return nil
+	}
+	quota := env.Quota()
+	if quota == nil {
+		return nil
+	}
+
+	current := env.QuotaUsage(nil)
+	if exceeded := quota.exceeded(env.QuotaUsage(element), current); len(exceeded) > 0 {
+		return tlog.Error("quota of environment exceeded: " + strings.Join(exceeded, ", "))
+	}
+	return nil
+}
+
+// QuotaApply mirrors quota of env to ResourceQuota of its namespace, pods
+// without requests get defaults from LimitRange
+func (env *EnvironmentS) QuotaApply(kClient *kube.ClientS) *tlog.RecordS {
+
+	rq := &kube.ResourceQuotaS{
+		KubeClient: kClient,
+		Namespace:  env.ID,
+		Name:       "timoni",
+		Labels:     map[string]string{"timoni-env": env.ID},
+	}
+	lr := &kube.LimitRangeS{
+		KubeClient: kClient,
+		Namespace:  env.ID,
+		Name:       quotaLimitRangeName,
+		Labels:     map[string]string{"timoni-env": env.ID},
+		DefaultRequest: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+	}
+
+	quota := env.Quota()
+	if quota == nil {
+		if rq.GetObj() != nil {
+			tlog.Error(rq.Delete())
+		}
+		if lr.GetObj() != nil {
+			tlog.Error(lr.Delete())
+		}
+		return nil
+	}
+
+	rq.Hard = corev1.ResourceList{}
+	if quota.CPUCores > 0 {
+		rq.Hard[corev1.ResourceRequestsCPU] = *resource.NewMilliQuantity(int64(quota.CPUCores*1000), resource.DecimalSI)
+	}
+	if quota.RAMMB > 0 {
+		rq.Hard[corev1.ResourceRequestsMemory] = *resource.NewQuantity(int64(quota.RAMMB)*1024*1024, resource.BinarySI)
+	}
+	if quota.StorageMB > 0 {
+		rq.Hard[corev1.ResourceRequestsStorage] = *resource.NewQuantity(int64(quota.StorageMB)*1024*1024, resource.BinarySI)
+	}
+	if quota.Pods > 0 {
+		// pods of builds, actions and rolling updates run next to elements
+		rq.Hard[corev1.ResourcePods] = *resource.NewQuantity(int64(quota.Pods*2+2), resource.DecimalSI)
+	}
+
+	if _, err := lr.CreateOrUpdate(); err != nil {
+		return tlog.Error(err)
+	}
+	if _, err := rq.CreateOrUpdate(); err != nil {
+		return tlog.Error(err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// cost
+
+func QuotaPricesGet() *EnvQuotaPricesS {
+	res := &EnvQuotaPricesS{}
+	if err := driver.Read("quota-prices", "default", res); err != nil {
+		return &EnvQuotaPricesS{}
+	}
+	return res
+}
+
+func QuotaPricesSave(p *EnvQuotaPricesS, user *UserS) *tlog.RecordS {
+	if p.CPUCoreHour < 0 || p.RAMGBHour < 0 || p.StorageGBMonth < 0 {
+		return tlog.Error("price can't be negative")
+	}
+	p.UpdateTime = time.Now().Unix()
+	p.UserEmail = user.Email
+	if err := driver.Write("quota-prices", "default", p); err != nil {
+		return tlog.Error(err)
+	}
+	tlog.Info("quota prices saved", tlog.Vars{
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
+
+// CostRate returns cost of env per hour from average usage of CPU and RAM
+// and declared storage
+func (env *EnvironmentS) CostRate(prices *EnvQuotaPricesS) float64 {
+	var cpu, ram float64
+	for _, elName := range env.Elements.Keys() {
+		el := env.GetElement(elName)
+		if el == nil || el.GetStopped() {
+			continue
+		}
+		c, r := el.GetResources()
+		cpu += c / 100 // in % of vCores
+		ram += r / 1024
+	}
+	storageGB := float64(env.QuotaUsage(nil).StorageMB) / 1024
+	return cpu*prices.CPUCoreHour + ram*prices.RAMGBHour + storageGB*prices.StorageGBMonth/hoursInMonth
+}
+
+func EnvCostGet(envID string) *EnvCostS {
+	res := &EnvCostS{}
+	if err := driver.Read("env-cost", envID, res); err != nil {
+		return &EnvCostS{EnvID: envID}
+	}
+	return res
+}
+
+// envCostUpdate adds cost of time since last update, gap after restart of
+// core is not counted
+func (env *EnvironmentS) envCostUpdate(prices *EnvQuotaPricesS, now time.Time) {
+
+	c := EnvCostGet(env.ID)
+	month := now.UTC().Format("2006-01")
+	if c.Month != month {
+		c = &EnvCostS{EnvID: env.ID, Month: month}
+	}
+
+	c.HourlyRate = env.CostRate(prices)
+	if c.UpdateTime > 0 {
+		elapsed := now.Sub(time.Unix(c.UpdateTime, 0))
+		if elapsed > 0 && elapsed < 15*time.Minute {
+			c.Cost += c.HourlyRate * elapsed.Hours()
+		}
+	}
+	c.UpdateTime = now.Unix()
+
+	endOfMonth := time.Date(now.UTC().Year(), now.UTC().Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	c.Projected = c.Cost + c.HourlyRate*endOfMonth.Sub(now).Hours()
+
+	c.Budget = 0
+	quota := env.Quota()
+	if quota != nil {
+		c.Budget = quota.BudgetMonthly
+	}
+	if c.Budget > 0 && c.Cost >= c.Budget && !c.BudgetAlert {
+		c.BudgetAlert = true
+		env.costBudgetAlert(c, quota.AlertEmails, prices.Currency)
+	}
+
+	tlog.Error(driver.Write("env-cost", env.ID, c))
+}
+
+func (env *EnvironmentS) costBudgetAlert(c *EnvCostS, emails []string, currency string) {
+
+	msg := fmt.Sprintf("Environment %s (%s) crossed its monthly budget: %.2f of %.2f %s, projected %.2f %s",
+		env.Name, env.ID, c.Cost, c.Budget, currency, c.Projected, currency)
+	tlog.Warning("env budget crossed", tlog.Vars{
+		"env":    env.ID,
+		"cost":   fmt.Sprintf("%.2f", c.Cost),
+		"budget": fmt.Sprintf("%.2f", c.Budget),
+		"event":  true,
+	})
+
+	sent := map[string]bool{}
+	for _, email := range emails {
+		if sent[email] {
+			continue
+		}
+		sent[email] = true
+		fp.SendEmail(email, "Timoni - budget of "+env.Name+" crossed", msg)
+	}
+}
+
+// EnvCostLoop accumulates cost of envs
+func EnvCostLoop() {
+	for {
+		time.Sleep(5 * time.Minute)
+
+		prices := QuotaPricesGet()
+		now := time.Now()
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete {
+				continue
+			}
+			env.envCostUpdate(prices, now)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package db
+
+import (
+	"core/config"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+)
+
+// Rules of env schedule beyond on/off crons:
+// - env with ExpireTime is deleted when it passes (TTL),
+// - env with IdleSleepMin stops its elements when domains get no requests
+//   for given minutes, domains of env call wake endpoint of core through
+//   Traefik forwardAuth, request is held until elements are ready again,
+// - crons do not start elements during events of blackout calendars,
+// - element can have own crons or opt out of idle sleep and calendars.
+
+// ElementScheduleS overrides schedule of env for element
+type ElementScheduleS struct {
+	OnCrons         []string // in timezone of env schedule, when set crons of env are ignored
+	OffCrons        []string
+	NoIdleSleep     bool // element is not stopped when env is idle
+	IgnoreCalendars bool // own on crons start element during blackout
+}
+
+const (
+	wakeServiceName = "core-wake"
+	wakeNamespace   = "timoni"
+	wakeReadyWait   = 10 * time.Minute
+)
+
+var (
+	envActivityMap = maps.NewSafe[string, time.Time](nil)     // key=env-id, last request to domains of env
+	envWakeMap     = maps.NewSafe[string, chan struct{}](nil) // key=env-id, closed when elements are started
+	envWakeLock    sync.Mutex
+)
+
+func (s *ElementScheduleS) hasCrons() bool {
+	return s != nil && len(s.OnCrons)+len(s.OffCrons) > 0
+}
+
+func (s *ElementScheduleS) check() *tlog.RecordS {
+	if s == nil {
+		return nil
+	}
+	for _, c := range append(append([]string{}, s.OnCrons...), s.OffCrons...) {
+		if _, err := cron.ParseStandard(c); err != nil {
+			return tlog.Error("invalid cron `{{cron}}`", tlog.Vars{"cron": c})
+		}
+	}
+	return nil
+}
+
+// ScheduleConfigured returns true when env or any of its elements has crons
+func (env *EnvironmentS) ScheduleConfigured() bool {
+	if env.Schedule.Configured() {
+		return true
+	}
+	for _, elName := range env.Elements.Keys() {
+		if el := env.GetElement(elName); el != nil && el.GetScheduleOverride().hasCrons() {
+			return true
+		}
+	}
+	return false
+}
+
+// SetScheduleRules sets TTL, idle sleep and blackout calendars of env
+func (env *EnvironmentS) SetScheduleRules(expireTime int64, idleSleepMin int, calendars []string, user *UserS) *tlog.RecordS {
+
+	if expireTime != 0 && expireTime < time.Now().Unix() {
+		return tlog.Error("expire time is in the past")
+	}
+	if idleSleepMin < 0 {
+		return tlog.Error("idle sleep can't be negative")
+	}
+	for _, name := range calendars {
+		if !scheduleCalendarMap.Exists(name) {
+			return tlog.Error("calendar {{calendar}} not found", tlog.Vars{"calendar": name})
+		}
+	}
+
+	env.Schedule.ExpireTime = expireTime
+	env.Schedule.IdleSleepMin = idleSleepMin
+	env.Schedule.Calendars = calendars
+	if idleSleepMin == 0 && len(env.Schedule.Sleeping) > 0 {
+		go env.Wake(wakeReadyWait)
+	}
+	envActivityMap.Set(env.ID, time.Now())
+
+	tlog.Info("env schedule rules set", tlog.Vars{
+		"env":          env.ID,
+		"expireTime":   expireTime,
+		"idleSleepMin": idleSleepMin,
+		"calendars":    calendars,
+		"event":        true,
+		"user":         user.Email,
+	})
+	return env.Save(user)
+}
+
+// SetElementSchedule sets own schedule of element, nil = schedule of env
+func (env *EnvironmentS) SetElementSchedule(element EnvElementS, s *ElementScheduleS, user *UserS) *tlog.RecordS {
+
+	if err := s.check(); err != nil {
+		return err
+	}
+	if s != nil && !s.hasCrons() && !s.NoIdleSleep && !s.IgnoreCalendars {
+		s = nil
+	}
+	element.SetScheduleOverride(s)
+	if err := element.Save(user); err != nil {
+		return err
+	}
+
+	tlog.Info("element {{element}} schedule set", tlog.Vars{
+		"element": element.GetName(),
+		"env":     env.ID,
+		"event":   true,
+		"user":    user.Email,
+	})
+
+	if env.ScheduleConfigured() {
+		return env.StartSchedule(user)
+	}
+	if s := EnvironmentSchedulersMap.Get(env.ID); s != nil {
+		s.Stop()
+		EnvironmentSchedulersMap.Delete(env.ID)
+	}
+	return nil
+}
+
+// scheduleElementCrons adds jobs of elements with own crons
+func (env *EnvironmentS) scheduleElementCrons(scheduler *gocron.Scheduler) *tlog.RecordS {
+	for _, elName := range env.Elements.Keys() {
+		el := env.GetElement(elName)
+		if el == nil || !el.GetScheduleOverride().hasCrons() {
+			continue
+		}
+		for _, c := range el.GetScheduleOverride().OnCrons {
+			if _, err := scheduler.Cron(c).Do(scheduleElement, env, elName, true); err != nil {
+				return tlog.Error(err.Error())
+			}
+		}
+		for _, c := range el.GetScheduleOverride().OffCrons {
+			if _, err := scheduler.Cron(c).Do(scheduleElement, env, elName, false); err != nil {
+				return tlog.Error(err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleElement starts or stops element by its own crons
+func scheduleElement(env *EnvironmentS, elName string, start bool) {
+	element := env.GetElement(elName)
+	if element == nil || element.GetToDelete() {
+		return
+	}
+	if start && !element.GetScheduleOverride().IgnoreCalendars {
+		if event := env.scheduleBlackout(time.Now()); event != "" {
+			tlog.Info("schedule start of {{element}} skipped, {{calendar}}", tlog.Vars{
+				"element":  elName,
+				"calendar": event,
+				"env":      env.ID,
+				"event":    true,
+			})
+			return
+		}
+	}
+	element.SetStopped(!start)
+	element.Save(nil)
+}
+
+// scheduleBlackout returns name and summary of calendar event lasting at t
+func (env *EnvironmentS) scheduleBlackout(t time.Time) string {
+	for _, name := range env.Schedule.Calendars {
+		c := scheduleCalendarMap.Get(name)
+		if c == nil {
+			continue
+		}
+		if e := c.Active(t); e != nil {
+			return name + ": " + e.Summary
+		}
+	}
+	return ""
+}
+
+// ScheduleBlackout returns event of blackout calendars of env lasting now
+func (env *EnvironmentS) ScheduleBlackout() string {
+	return env.scheduleBlackout(time.Now())
+}
+
+// WakeAddress returns address of forwardAuth middleware of env domains, empty
+// when idle sleep is disabled
+func (env *EnvironmentS) WakeAddress() string {
+	if env.Schedule.IdleSleepMin <= 0 {
+		return ""
+	}
+	addr := config.WakeAddr()
+	if addr == "" {
+		if env.ClusterName != "" {
+			// service of core is not reachable from other clusters
+			return ""
+		}
+		addr = "http://" + wakeServiceName + "." + wakeNamespace + ".svc:" + config.WakeHTTPPort()
+	}
+	return addr + "/wake/" + env.ID
+}
+
+// WakeService returns name and namespace of service of wake endpoint
+func WakeService() (string, string) {
+	return wakeServiceName, wakeNamespace
+}
+
+// Wake marks request to env and starts elements stopped by idle sleep, it
+// returns false when elements are not ready in timeout
+func (env *EnvironmentS) Wake(timeout time.Duration) bool {
+	envActivityMap.Set(env.ID, time.Now())
+
+	envWakeLock.Lock()
+	done, ok := envWakeMap.GetFull(env.ID)
+	if !ok {
+		if len(env.Schedule.Sleeping) == 0 {
+			envWakeLock.Unlock()
+			return true
+		}
+		done = make(chan struct{})
+		envWakeMap.Set(env.ID, done)
+		go env.wakeUp(done)
+	}
+	envWakeLock.Unlock()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (env *EnvironmentS) wakeUp(done chan struct{}) {
+	defer func() {
+		envWakeLock.Lock()
+		envWakeMap.Delete(env.ID)
+		envWakeLock.Unlock()
+		close(done)
+	}()
+	defer PanicHandler()
+
+	sleeping := map[string]bool{}
+	for _, elName := range env.Schedule.Sleeping {
+		sleeping[elName] = true
+	}
+
+	tlog.Info("env woken up by request", tlog.Vars{
+		"env":      env.ID,
+		"elements": env.Schedule.Sleeping,
+		"event":    true,
+	})
+
+	started := []string{}
+	for _, level := range env.ElementLevels() {
+		for _, elName := range level {
+			element := env.GetElement(elName)
+			if element == nil || !sleeping[elName] || element.GetToDelete() {
+				continue
+			}
+			element.SetStopped(false)
+			element.Save(nil)
+			started = append(started, elName)
+		}
+	}
+	env.Schedule.Sleeping = nil
+	env.Save(nil)
+
+	waitFor(wakeReadyWait, func() bool {
+		for _, elName := range started {
+			element := env.GetElement(elName)
+			if element != nil && element.GetStatus().State != ElementStatusReady {
+				return false
+			}
+		}
+		return true
+	})
+	envActivityMap.Set(env.ID, time.Now())
+}
+
+// scheduleWakeReset forgets elements stopped by idle sleep, crons decide
+// about them from now. Running wake up is waited for, otherwise it would
+// start elements which cron has just stopped.
+func (env *EnvironmentS) scheduleWakeReset() {
+	envWakeLock.Lock()
+	for {
+		done, ok := envWakeMap.GetFull(env.ID)
+		if !ok {
+			break
+		}
+		envWakeLock.Unlock()
+		<-done
+		envWakeLock.Lock()
+	}
+	defer envWakeLock.Unlock()
+
+	if len(env.Schedule.Sleeping) == 0 {
+		return
+	}
+	env.Schedule.Sleeping = nil
+	env.Save(nil)
+}
+
+// idleSleep stops elements of env without requests to its domains, domains
+// stay to wake env up
+func (env *EnvironmentS) idleSleep() {
+
+	hasDomain := false
+	sleep := []string{}
+	for _, elName := range env.Elements.Keys() {
+		element := env.GetElement(elName)
+		if element == nil || element.GetToDelete() {
+			continue
+		}
+		switch element.GetType() {
+		case ElementSourceTypeDomain:
+			hasDomain = true
+			continue
+		case ElementSourceTypePod, ElementSourceTypeMongodb, ElementSourceTypeElasticsearch:
+		default:
+			continue
+		}
+		if element.GetStopped() || element.GetUnschedulable() ||
+			(element.GetScheduleOverride() != nil && element.GetScheduleOverride().NoIdleSleep) {
+			continue
+		}
+		sleep = append(sleep, elName)
+	}
+	if !hasDomain || len(sleep) == 0 {
+		return
+	}
+
+	envWakeLock.Lock()
+	defer envWakeLock.Unlock()
+	if envWakeMap.Exists(env.ID) {
+		return
+	}
+
+	tlog.Info("env is idle for {{minutes}} minutes, stopping elements", tlog.Vars{
+		"minutes":  env.Schedule.IdleSleepMin,
+		"elements": sleep,
+		"env":      env.ID,
+		"event":    true,
+	})
+
+	for _, elName := range sleep {
+		element := env.GetElement(elName)
+		element.SetStopped(true)
+		element.Save(nil)
+	}
+	env.Schedule.Sleeping = sleep
+	env.Save(nil)
+}
+
+// EnvScheduleLoop deletes expired envs, puts idle envs to sleep and refreshes
+// blackout calendars
+func EnvScheduleLoop() {
+	for {
+		time.Sleep(time.Minute)
+
+		now := time.Now()
+		for _, env := range EnvironmentMap.Values() {
+			if env.ToDelete {
+				continue
+			}
+
+			if env.Schedule.ExpireTime > 0 && now.Unix() > env.Schedule.ExpireTime {
+				tlog.Info("env expired, deleting", tlog.Vars{
+					"env":   env.ID,
+					"event": true,
+				})
+				env.SetToDelete(true, DefaultUser)
+				continue
+			}
+
+			if env.Schedule.IdleSleepMin <= 0 || len(env.Schedule.Sleeping) > 0 {
+				continue
+			}
+			last, ok := envActivityMap.GetFull(env.ID)
+			if !ok {
+				// no requests since start of core
+				envActivityMap.Set(env.ID, now)
+				continue
+			}
+			if now.Sub(last) > time.Duration(env.Schedule.IdleSleepMin)*time.Minute {
+				env.idleSleep()
+			}
+		}
+
+		scheduleCalendarsRefresh()
+	}
+}
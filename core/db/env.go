@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +28,10 @@ var (
 	EnvironmentSchedulersMap     = maps.NewSafe[string, *gocron.Scheduler](nil)
 	ElementMap                   = maps.NewSafe[string, EnvElementS](nil)           // key='env_id/el_name'
 	EnvironmentDynamicGitSources = maps.NewSafe[string, *EnvDynamicGitSourceS](nil) // key=id
+
+	// EnvChanged is called with ID of env after env or its element is saved,
+	// kubesync sets it to apply changes without waiting for next resync
+	EnvChanged func(envID string)
 )
 
 type EnvironmentShortS struct {
@@ -38,12 +43,15 @@ type EnvironmentShortS struct {
 }
 
 type EnvironmentS struct {
-	ID          string // random, unique
-	Name        string
-	ClusterName string
+	ID               string // random, unique
+	Name             string
+	ClusterName      string // empty = local cluster, see kube.GetKubeCluster
+	ClusterMigration *EnvClusterMigrationS
 
 	Schedule EnvironmentScheduleS
 	GitOps   EnvironmentGitOpsConfigS
+	Terminal EnvironmentTerminalS
+	Alerts   EnvironmentAlertsS
 	ToDelete bool
 
 	CreationTime   int64
@@ -52,6 +60,7 @@ type EnvironmentS struct {
 	Elements            *maps.SafeMap[string, ElementType] // element-name => element-type
 	Tags                *set.Safe[string]
 	GlobalVariableCache *maps.SafeMap[string, ElementVariableS]
+	VariableSets        []string // imported to all elements, see VariableSetS
 
 	Status    map[ElementState]int // env.CalculateElementsStatuses()
 	Readiness ReadinessS           // env.CalculateElementsReadiness()
@@ -101,12 +110,35 @@ type EnvironmentScheduleS struct {
 	Timezone *time.Location
 	OnCrons  []string
 	OffCrons []string
+
+	// rules beyond crons, see env-schedule.go
+	ExpireTime   int64    // unix, env is deleted after it, 0 = never
+	IdleSleepMin int      // elements are stopped after minutes without ingress requests, 0 = disabled
+	Calendars    []string // names of ScheduleCalendarS, elements are not started during their events
+	Sleeping     []string // elements stopped by idle sleep, started by next request
 }
 
 func (s EnvironmentScheduleS) Configured() bool {
 	return len(s.OnCrons)+len(s.OffCrons) > 0
 }
 
+// EnvironmentTerminalS is policy of web terminal (/term) in environment
+type EnvironmentTerminalS struct {
+	Disabled       bool
+	IdleTimeoutMin int // 0 = config.TermIdleTimeoutMin
+}
+
+func (t EnvironmentTerminalS) IdleTimeout() time.Duration {
+	min := t.IdleTimeoutMin
+	if min <= 0 {
+		min, _ = strconv.Atoi(config.TermIdleTimeoutMin())
+	}
+	if min <= 0 {
+		min = 15
+	}
+	return time.Duration(min) * time.Minute
+}
+
 // --------------------------------------------
 
 func SyncWithDiskLoop() {
@@ -178,10 +210,17 @@ func (env *EnvironmentS) Save(user *UserS) *tlog.RecordS {
 	}
 
 	EnvironmentMap.Set(env.ID, env)
+	envChanged(env.ID)
 
 	return nil
 }
 
+func envChanged(envID string) {
+	if EnvChanged != nil {
+		EnvChanged(envID)
+	}
+}
+
 func (env *EnvironmentS) Create(user *UserS) *tlog.RecordS {
 
 	if env.Name == "" {
@@ -214,6 +253,16 @@ func (env *EnvironmentS) Delete(user *UserS) *tlog.RecordS {
 
 	EnvironmentMap.Delete(env.ID)
 	os.RemoveAll(filepath.Join(config.DataPath(), "env", env.ID))
+	envDriftDelete(env.ID)
+	envActivityMap.Delete(env.ID)
+	elementProfilesDelete(env.ID, "")
+	alertStateReset(env.ID)
+	sloStatusReset(env.ID)
+	driver.Delete("env-cost", env.ID)
+	if quotaMap.Exists("env:" + env.ID) {
+		driver.Delete("quota", quotaFileName("env:"+env.ID))
+		quotaMap.Delete("env:" + env.ID)
+	}
 
 	var email string
 	if user != nil {
@@ -375,7 +424,9 @@ func (env *EnvironmentS) ElementCloneWithoutSecrets(elementName string) EnvEleme
 	return out
 }
 
-func (env *EnvironmentS) Clone(user *UserS, targetEnvID, targetEnvName string) (*EnvironmentS, *tlog.RecordS) {
+// Clone copies env with its elements, withData restores volumes of pod
+// elements with block storage from fresh snapshots
+func (env *EnvironmentS) Clone(user *UserS, targetEnvID, targetEnvName string, withData bool) (*EnvironmentS, *tlog.RecordS) {
 	clonedEnv := utils.DeepCopy(*env)
 	clonedEnv.ID = targetEnvID
 	clonedEnv.Name = targetEnvName
@@ -388,14 +439,30 @@ func (env *EnvironmentS) Clone(user *UserS, targetEnvID, targetEnvName string) (
 		return nil, errx
 	}
 
+	snapshots := map[string]*ElementSnapshotS{} // key=elementName
 	for _, elementName := range env.Elements.Keys() {
 		element := env.cloneElement(elementName)
 		element.generateSecrets(true)
 		element.setEnvID(targetEnvID)
+
+		if pod, ok := element.(*elementPodS); ok && withData && pod.Stateful && !pod.ToDelete {
+			s, err := ElementSnapshotCreate(env, elementName, "clone to "+targetEnvID, false, false, user)
+			if err != nil {
+				return nil, err
+			}
+			snapshots[elementName] = s
+			element.SetStopped(true)
+		}
+
 		clonedEnv.Elements.Set(element.GetName(), element.GetType())
 		element.Save(user)
 	}
 
+	for elementName, s := range snapshots {
+		startAfter := !env.GetElement(elementName).GetStopped()
+		go s.restoreToClone(clonedEnv, startAfter, user)
+	}
+
 	return clonedEnv, nil
 }
 
@@ -571,8 +638,20 @@ func (env *EnvironmentS) SetSchedule(timezone string, onCron, offCron []string,
 			"user":  user.Email,
 		})
 
-		env.Schedule = EnvironmentScheduleS{}
-		return env.Save(user)
+		env.Schedule = EnvironmentScheduleS{
+			ExpireTime:   env.Schedule.ExpireTime,
+			IdleSleepMin: env.Schedule.IdleSleepMin,
+			Calendars:    env.Schedule.Calendars,
+			Sleeping:     env.Schedule.Sleeping,
+		}
+		if err := env.Save(user); err != nil {
+			return err
+		}
+		if env.ScheduleConfigured() {
+			// crons of elements
+			return env.StartSchedule(user)
+		}
+		return nil
 	}
 
 	if slice.Equal(onCron, env.Schedule.OnCrons) &&
@@ -589,11 +668,9 @@ func (env *EnvironmentS) SetSchedule(timezone string, onCron, offCron []string,
 		})
 	}
 
-	env.Schedule = EnvironmentScheduleS{
-		Timezone: location,
-		OnCrons:  onCron,
-		OffCrons: offCron,
-	}
+	env.Schedule.Timezone = location
+	env.Schedule.OnCrons = onCron
+	env.Schedule.OffCrons = offCron
 
 	tlog.Info("Enable schedule", tlog.Vars{
 		"event": true,
@@ -610,7 +687,11 @@ func (env *EnvironmentS) SetSchedule(timezone string, onCron, offCron []string,
 }
 
 func (env *EnvironmentS) StartSchedule(user *UserS) *tlog.RecordS {
-	scheduler := gocron.NewScheduler(env.Schedule.Timezone)
+	location := env.Schedule.Timezone
+	if location == nil {
+		location = time.UTC
+	}
+	scheduler := gocron.NewScheduler(location)
 	scheduler.SingletonModeAll()
 
 	for _, cron := range env.Schedule.OnCrons {
@@ -623,6 +704,9 @@ func (env *EnvironmentS) StartSchedule(user *UserS) *tlog.RecordS {
 			return tlog.Error(err.Error())
 		}
 	}
+	if err := env.scheduleElementCrons(scheduler); err != nil {
+		return err
+	}
 
 	if s := EnvironmentSchedulersMap.Get(env.ID); s != nil {
 		s.Stop()
@@ -632,26 +716,35 @@ func (env *EnvironmentS) StartSchedule(user *UserS) *tlog.RecordS {
 	return nil
 }
 
+// scheduleEnableEnv starts elements in order of dependencies, kubesync
+// applies each element when its dependencies are ready
 func scheduleEnableEnv(env *EnvironmentS) {
-	for _, elementName := range env.Elements.Keys() {
-		element := env.GetElement(elementName)
-		if element.GetUnschedulable() {
-			continue
+	if event := env.scheduleBlackout(time.Now()); event != "" {
+		tlog.Info("schedule start skipped, {{calendar}}", tlog.Vars{
+			"calendar": event,
+			"env":      env.ID,
+			"event":    true,
+		})
+		return
+	}
+	env.scheduleWakeReset()
+
+	for _, level := range env.ElementLevels() {
+		for _, elementName := range level {
+			element := env.GetElement(elementName)
+			if element == nil || element.GetUnschedulable() {
+				continue
+			}
+			element.SetStopped(false)
+			element.Save(nil)
 		}
-		element.SetStopped(false)
-		element.Save(nil)
 	}
 }
 
+// scheduleDisableEnv stops elements depending on others first
 func scheduleDisableEnv(env *EnvironmentS) {
-	for _, elementName := range env.Elements.Keys() {
-		element := env.GetElement(elementName)
-		if element.GetUnschedulable() {
-			continue
-		}
-		element.SetStopped(true)
-		element.Save(nil)
-	}
+	env.scheduleWakeReset()
+	env.scheduleStopLevels()
 }
 
 func (env *EnvironmentS) MostChangedElementsGet(interavl time.Duration) []MostChangedElementsS {
@@ -713,6 +806,7 @@ func (env *EnvironmentS) ElementDelete(elementName string, user *UserS) *tlog.Re
 	env.Elements.Delete(elementName)
 	env.statuses.Delete(elementName)
 	ElementMap.Delete(fmt.Sprintf("%s/%s", env.ID, elementName))
+	elementProfilesDelete(env.ID, elementName)
 	errx := env.Save(user)
 	if errx != nil {
 		return errx
@@ -893,6 +987,8 @@ func (env *EnvironmentS) FromGitOps() *tlog.RecordS {
 		element.Save(nil)
 	}
 
+	env.alertsFromGit(envInGit.Alerts)
+
 	// -----------------
 
 	return nil
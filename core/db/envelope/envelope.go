@@ -0,0 +1,319 @@
+// Package envelope encrypts secret values stored on disk.
+//
+// Every sealed value is encrypted with a data key (DEK) using AES-256-GCM,
+// the DEK itself is wrapped by a master key (KEK). Sealed values look like:
+//
+//	enc:v1:<kek-id>:<base64 wrapped dek>:<base64 nonce+ciphertext>
+//
+// KEKs come from a KMS stand-in, the `MasterKey` env variable or the
+// `MasterKeyFile` key file (in that order). Older KEKs are kept for
+// decryption only, so values sealed before a rotation can still be opened
+// until ReEncryptDir is run.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"lib/tlog"
+	"strings"
+	"sync"
+)
+
+const prefix = "enc:v1:"
+
+var (
+	ErrKeyNotFound = errors.New("envelope: master key not found")
+	ErrInvalid     = errors.New("envelope: invalid sealed value")
+
+	keyring = &keyringS{
+		deks: map[string][]byte{},
+	}
+)
+
+type keyringS struct {
+	mu       sync.RWMutex
+	primary  KEK
+	keks     map[string]KEK // key=kek-id
+	provider string
+
+	// current DEK of primary KEK, generated once per process
+	dek        []byte
+	dekWrapped string
+
+	// cache of unwrapped DEKs, key=kek-id:wrapped-dek
+	deks map[string][]byte
+}
+
+// Setup loads master keys from configured provider, should be called once on start.
+// Without any master key configured, values are stored as plain text. Error
+// is returned when configured keys can't be loaded, Timoni must not start
+// then as secrets would be written unencrypted.
+func Setup() error {
+	provider, keks, err := loadKEKs()
+	if err != nil {
+		return fmt.Errorf("envelope: loading master key: %w", err)
+	}
+	if len(keks) == 0 {
+		if provider != "" {
+			return fmt.Errorf("envelope: %s provider has no master key", provider)
+		}
+		tlog.Warning("envelope: no master key configured, secrets are stored as plain text")
+	}
+	setKEKs(provider, keks)
+	return nil
+}
+
+func setKEKs(provider string, keks []KEK) {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	keyring.provider = provider
+	keyring.primary = nil
+	keyring.keks = map[string]KEK{}
+	keyring.dek = nil
+	keyring.dekWrapped = ""
+	keyring.deks = map[string][]byte{}
+
+	for i, k := range keks {
+		if i == 0 {
+			keyring.primary = k
+		}
+		keyring.keks[k.ID()] = k
+	}
+}
+
+// Enabled returns true when there is a master key to seal values with.
+func Enabled() bool {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+	return keyring.primary != nil
+}
+
+// Status is returned by admin API
+type StatusS struct {
+	Enabled    bool
+	Provider   string
+	PrimaryKey string
+	Keys       []string
+}
+
+func Status() StatusS {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	s := StatusS{
+		Enabled:  keyring.primary != nil,
+		Provider: keyring.provider,
+	}
+	if keyring.primary != nil {
+		s.PrimaryKey = keyring.primary.ID()
+	}
+	for id := range keyring.keks {
+		s.Keys = append(s.Keys, id)
+	}
+	return s
+}
+
+// IsSealed returns true if value was produced by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// SealedWith returns id of the master key used to seal value.
+func SealedWith(value string) string {
+	if !IsSealed(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+// Seal encrypts value with primary master key.
+// Empty and already sealed values are returned unchanged.
+func Seal(value string) (string, error) {
+	if value == "" || IsSealed(value) {
+		return value, nil
+	}
+
+	kekID, dek, dekWrapped, err := currentDEK()
+	if err != nil {
+		return "", err
+	}
+	if dek == nil {
+		// encryption disabled
+		return value, nil
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(value), []byte(kekID))
+
+	return fmt.Sprintf("%s%s:%s:%s",
+		prefix,
+		kekID,
+		dekWrapped,
+		base64.RawStdEncoding.EncodeToString(ciphertext),
+	), nil
+}
+
+// Open decrypts value sealed by Seal. Not sealed values are returned unchanged.
+func Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrInvalid
+	}
+	kekID, dekWrapped := parts[0], parts[1]
+
+	dek, err := unwrapDEK(kekID, dekWrapped)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", ErrInvalid
+	}
+
+	plain, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], []byte(kekID))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// MustSeal is Seal which logs error and returns empty string on failure,
+// plain text is never returned.
+func MustSeal(value string) string {
+	sealed, err := Seal(value)
+	if tlog.Error(err) != nil {
+		return ""
+	}
+	return sealed
+}
+
+// MustOpen is Open which logs error and returns empty string on failure.
+func MustOpen(value string) string {
+	plain, err := Open(value)
+	if tlog.Error(err) != nil {
+		return ""
+	}
+	return plain
+}
+
+// Reseal opens value and seals it again with primary master key and current data key.
+// Not sealed values are sealed.
+func Reseal(value string) (string, error) {
+	plain, err := Open(value)
+	if err != nil {
+		return "", err
+	}
+	return Seal(plain)
+}
+
+// resetDEK forces new data key to be generated and wrapped by primary master key.
+func resetDEK() {
+	keyring.mu.Lock()
+	keyring.dek = nil
+	keyring.dekWrapped = ""
+	keyring.mu.Unlock()
+}
+
+// ---
+
+func currentDEK() (string, []byte, string, error) {
+	keyring.mu.RLock()
+	primary, dek, dekWrapped := keyring.primary, keyring.dek, keyring.dekWrapped
+	keyring.mu.RUnlock()
+
+	if primary == nil {
+		return "", nil, "", nil
+	}
+	if dek != nil {
+		return primary.ID(), dek, dekWrapped, nil
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	if keyring.dek != nil {
+		return primary.ID(), keyring.dek, keyring.dekWrapped, nil
+	}
+
+	dek = make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", nil, "", err
+	}
+	wrapped, err := primary.Wrap(dek)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	keyring.dek = dek
+	keyring.dekWrapped = base64.RawStdEncoding.EncodeToString(wrapped)
+	keyring.deks[primary.ID()+":"+keyring.dekWrapped] = dek
+
+	return primary.ID(), keyring.dek, keyring.dekWrapped, nil
+}
+
+func unwrapDEK(kekID, dekWrapped string) ([]byte, error) {
+	cacheKey := kekID + ":" + dekWrapped
+
+	keyring.mu.RLock()
+	dek, ok := keyring.deks[cacheKey]
+	kek := keyring.keks[kekID]
+	keyring.mu.RUnlock()
+
+	if ok {
+		return dek, nil
+	}
+	if kek == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kekID)
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(dekWrapped)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	dek, err = kek.Unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring.mu.Lock()
+	keyring.deks[cacheKey] = dek
+	keyring.mu.Unlock()
+
+	return dek, nil
+}
@@ -0,0 +1,219 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupKeyFile configures `MasterKeyFile` provider with key file in temp dir
+func setupKeyFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "keys", "master.key")
+	t.Setenv("MasterKey", "")
+	t.Setenv("MasterKeyKMSAddr", "")
+	t.Setenv("MasterKeyFile", path)
+
+	if err := Setup(); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	t.Cleanup(func() { setKEKs("", nil) })
+	return path
+}
+
+func TestSealOpen(t *testing.T) {
+	kek, err := newLocalKEK(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setKEKs(ProviderEnv, []KEK{kek})
+	t.Cleanup(func() { setKEKs("", nil) })
+
+	sealed, err := Seal("db-password")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "db-password") {
+		t.Fatalf("Seal() = %q, want sealed value", sealed)
+	}
+	if SealedWith(sealed) != kek.ID() {
+		t.Errorf("SealedWith() = %q, want %q", SealedWith(sealed), kek.ID())
+	}
+
+	if plain, err := Open(sealed); err != nil || plain != "db-password" {
+		t.Errorf("Open() = %q, %v", plain, err)
+	}
+	if again, _ := Seal(sealed); again != sealed {
+		t.Error("Seal() of sealed value changed it")
+	}
+	if empty, _ := Seal(""); empty != "" {
+		t.Errorf("Seal(\"\") = %q", empty)
+	}
+	if plain, _ := Open("not sealed"); plain != "not sealed" {
+		t.Errorf("Open() of plain value = %q", plain)
+	}
+
+	tampered := sealed[:len(sealed)-4] + "AAAA"
+	if _, err := Open(tampered); err == nil {
+		t.Error("Open() of tampered value expected error")
+	}
+
+	other, _ := newLocalKEK([]byte(strings.Repeat("x", 32)))
+	setKEKs(ProviderEnv, []KEK{other})
+	if _, err := Open(sealed); err == nil {
+		t.Error("Open() of value sealed with unknown master key expected error")
+	}
+}
+
+func TestSealFailsClosed(t *testing.T) {
+	srv := httptest.NewServer(NewKMSStandIn("kms-token"))
+	t.Setenv("MasterKeyKMSAddr", srv.URL)
+	t.Setenv("MasterKeyKMSToken", "kms-token")
+	if err := Setup(); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	t.Cleanup(func() { setKEKs("", nil) })
+
+	sealed, err := Seal("secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if plain, _ := Open(sealed); plain != "secret" {
+		t.Errorf("Open() = %q", plain)
+	}
+
+	// KMS is unreachable, new data key can't be wrapped
+	srv.Close()
+	resetDEK()
+	if _, err := Seal("secret"); err == nil {
+		t.Fatal("Seal() with unreachable KMS expected error")
+	}
+	if got := MustSeal("secret"); got != "" {
+		t.Errorf("MustSeal() with unreachable KMS = %q, want empty", got)
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	t.Setenv("MasterKeyKMSAddr", "")
+	t.Cleanup(func() { setKEKs("", nil) })
+
+	// directory of key file can't be created
+	blocker := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocker, nil, 0600)
+	t.Setenv("MasterKey", "")
+	t.Setenv("MasterKeyFile", filepath.Join(blocker, "keys", "master.key"))
+	if err := Setup(); err == nil {
+		t.Error("Setup() with unwritable key file expected error")
+	}
+
+	t.Setenv("MasterKey", "not-base64!")
+	if err := Setup(); err == nil {
+		t.Error("Setup() with invalid MasterKey expected error")
+	}
+
+	t.Setenv("MasterKey", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err := Setup(); err != nil || !Enabled() {
+		t.Errorf("Setup() with MasterKey error = %v, enabled = %v", err, Enabled())
+	}
+}
+
+func TestRotateFileKey(t *testing.T) {
+	path := setupKeyFile(t)
+
+	oldID := Status().PrimaryKey
+	sealed, err := Seal("before rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newID, err := RotateFileKey()
+	if err != nil {
+		t.Fatalf("RotateFileKey() error = %v", err)
+	}
+	if newID == oldID || Status().PrimaryKey != newID || len(Status().Keys) != 2 {
+		t.Fatalf("RotateFileKey() status = %+v, old key %s", Status(), oldID)
+	}
+
+	// old key is kept for decryption
+	if plain, err := Open(sealed); err != nil || plain != "before rotation" {
+		t.Errorf("Open() of value sealed before rotation = %q, %v", plain, err)
+	}
+	resealed, err := Reseal(sealed)
+	if err != nil || SealedWith(resealed) != newID {
+		t.Errorf("Reseal() sealed with %q, %v, want %s", SealedWith(resealed), err, newID)
+	}
+
+	buf, _ := os.ReadFile(path)
+	if lines := strings.Fields(string(buf)); len(lines) != 2 {
+		t.Errorf("key file has %d keys, want 2", len(lines))
+	}
+}
+
+func TestReEncryptDir(t *testing.T) {
+	setupKeyFile(t)
+
+	oldSealed, err := Seal("old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID, err := RotateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	files := map[string]any{
+		"env/a/element.json": map[string]any{
+			"Variables": map[string]any{
+				"PASSWORD": map[string]any{"Secret": true, "CurrentValue": oldSealed},
+				"TOKEN":    map[string]any{"Secret": true, "CurrentValue": "plain-token", "FrontValue": "{{ secret }}"},
+				"PORT":     map[string]any{"Secret": false, "CurrentValue": "8080"},
+			},
+		},
+		"settings/sso.json": map[string]any{"ClientSecret": oldSealed},
+		"env/b/plain.json":  map[string]any{"Name": "nothing to seal"},
+	}
+	for name, doc := range files {
+		buf, _ := json.Marshal(doc)
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+		if err := os.WriteFile(filepath.Join(root, name), buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := ReEncryptDir(root)
+	if res.Files != 2 || res.Values != 3 || len(res.Errors) != 0 {
+		t.Fatalf("ReEncryptDir() = %+v, want 2 files and 3 values", res)
+	}
+
+	read := func(name string) map[string]any {
+		doc := map[string]any{}
+		buf, _ := os.ReadFile(filepath.Join(root, name))
+		json.Unmarshal(buf, &doc)
+		return doc
+	}
+	vars := read("env/a/element.json")["Variables"].(map[string]any)
+	for name, want := range map[string]string{"PASSWORD": "old-secret", "TOKEN": "plain-token"} {
+		value := vars[name].(map[string]any)["CurrentValue"].(string)
+		if SealedWith(value) != newID {
+			t.Errorf("%s sealed with %q, want %s", name, SealedWith(value), newID)
+		}
+		if plain, _ := Open(value); plain != want {
+			t.Errorf("%s = %q, want %q", name, plain, want)
+		}
+	}
+	if port := vars["PORT"].(map[string]any)["CurrentValue"]; port != "8080" {
+		t.Errorf("PORT = %v, not secret value was changed", port)
+	}
+	if SealedWith(read("settings/sso.json")["ClientSecret"].(string)) != newID {
+		t.Error("ClientSecret was not resealed with new key")
+	}
+
+	setKEKs("", nil)
+	if res := ReEncryptDir(root); len(res.Errors) == 0 {
+		t.Error("ReEncryptDir() without master key expected error")
+	}
+}
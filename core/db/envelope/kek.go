@@ -0,0 +1,178 @@
+package envelope
+
+import (
+	"core/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KEK wraps and unwraps data keys.
+type KEK interface {
+	// ID is stored in every sealed value, must not contain `:`
+	ID() string
+	Wrap(dek []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+const (
+	ProviderKMS  = "kms"
+	ProviderEnv  = "env"
+	ProviderFile = "file"
+)
+
+// loadKEKs returns KEKs of first configured provider, primary first.
+func loadKEKs() (string, []KEK, error) {
+
+	if config.MasterKeyKMSAddr() != "" {
+		return ProviderKMS, []KEK{
+			&kmsKEK{
+				addr:  config.MasterKeyKMSAddr(),
+				keyID: config.MasterKeyKMSKeyID(),
+			},
+		}, nil
+	}
+
+	if config.MasterKey() != "" {
+		keks, err := parseLocalKeys(strings.Split(config.MasterKey(), ","))
+		return ProviderEnv, keks, err
+	}
+
+	if config.MasterKeyFile() == "" {
+		return "", nil, nil
+	}
+
+	buf, err := os.ReadFile(config.MasterKeyFile())
+	if os.IsNotExist(err) {
+		// first start, generate key
+		if err := os.MkdirAll(filepath.Dir(config.MasterKeyFile()), 0700); err != nil {
+			return ProviderFile, nil, err
+		}
+		if _, err := RotateFileKey(); err != nil {
+			return ProviderFile, nil, err
+		}
+		buf, err = os.ReadFile(config.MasterKeyFile())
+	}
+	if err != nil {
+		return ProviderFile, nil, err
+	}
+
+	keks, err := parseLocalKeys(strings.Split(string(buf), "\n"))
+	return ProviderFile, keks, err
+}
+
+func parseLocalKeys(lines []string) ([]KEK, error) {
+	keks := []KEK{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, errors.New("envelope: master key is not valid base64")
+		}
+		k, err := newLocalKEK(key)
+		if err != nil {
+			return nil, err
+		}
+		keks = append(keks, k)
+	}
+	return keks, nil
+}
+
+// RotateFileKey generates new master key and puts it on top of `MasterKeyFile`,
+// old keys stay in the file for decryption. Returns id of the new key.
+// After rotation ReEncryptDir should be called.
+func RotateFileKey() (string, error) {
+	if config.MasterKeyKMSAddr() != "" || config.MasterKey() != "" {
+		return "", errors.New("envelope: master key is not managed by key file, rotate it in its provider")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	kek, err := newLocalKEK(key)
+	if err != nil {
+		return "", err
+	}
+
+	old, _ := os.ReadFile(config.MasterKeyFile())
+	content := base64.StdEncoding.EncodeToString(key) + "\n" + string(old)
+
+	tmp := config.MasterKeyFile() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, config.MasterKeyFile()); err != nil {
+		return "", err
+	}
+
+	if keyring.provider == ProviderFile {
+		// reload keyring
+		keks, err := parseLocalKeys(strings.Split(content, "\n"))
+		if err != nil {
+			return "", err
+		}
+		setKEKs(ProviderFile, keks)
+	}
+
+	return kek.ID(), nil
+}
+
+// ---
+
+type localKEK struct {
+	id  string
+	gcm cipher.AEAD
+}
+
+func newLocalKEK(key []byte) (*localKEK, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("envelope: master key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &localKEK{
+		id:  "local-" + hex.EncodeToString(sum[:4]),
+		gcm: gcm,
+	}, nil
+}
+
+func (k *localKEK) ID() string {
+	return k.id
+}
+
+func (k *localKEK) Wrap(dek []byte) ([]byte, error) {
+	nonce := make([]byte, k.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.gcm.Seal(nonce, nonce, dek, []byte(k.id)), nil
+}
+
+func (k *localKEK) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < k.gcm.NonceSize() {
+		return nil, ErrInvalid
+	}
+	return k.gcm.Open(nil, wrapped[:k.gcm.NonceSize()], wrapped[k.gcm.NonceSize():], []byte(k.id))
+}
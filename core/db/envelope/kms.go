@@ -0,0 +1,234 @@
+package envelope
+
+import (
+	"bytes"
+	"core/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kmsKEK wraps data keys with remote KMS speaking Vault transit API:
+//
+//	POST /v1/transit/encrypt/<key> {"plaintext": "<base64>"}
+//	POST /v1/transit/decrypt/<key> {"ciphertext": "vault:v1:..."}
+type kmsKEK struct {
+	addr  string
+	keyID string
+}
+
+var kmsClient = &http.Client{Timeout: 10 * time.Second}
+
+func (k *kmsKEK) ID() string {
+	return "kms-" + k.keyID
+}
+
+func (k *kmsKEK) Wrap(dek []byte) ([]byte, error) {
+	res := struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}{}
+
+	err := k.call("encrypt", map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(res.Data.Ciphertext), nil
+}
+
+func (k *kmsKEK) Unwrap(wrapped []byte) ([]byte, error) {
+	res := struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}{}
+
+	err := k.call("decrypt", map[string]string{
+		"ciphertext": string(wrapped),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(res.Data.Plaintext)
+}
+
+func (k *kmsKEK) call(action string, req any, res any) error {
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/transit/%s/%s", strings.TrimSuffix(k.addr, "/"), action, k.keyID)
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Vault-Token", config.MasterKeyKMSToken())
+
+	httpRes, err := kmsClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("envelope: kms %s failed with status %d", action, httpRes.StatusCode)
+	}
+	return json.NewDecoder(httpRes.Body).Decode(res)
+}
+
+// ---
+
+// KMSStandIn is minimal in-memory implementation of Vault transit API,
+// for local development and tests. Keys are versioned, rotate adds new version
+// and old versions are still used for decryption.
+type KMSStandIn struct {
+	Token string
+
+	mu   sync.Mutex
+	keys map[string][]cipher.AEAD // key=name, value=versions
+}
+
+func NewKMSStandIn(token string) *KMSStandIn {
+	return &KMSStandIn{
+		Token: token,
+		keys:  map[string][]cipher.AEAD{},
+	}
+}
+
+func (s *KMSStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if s.Token != "" && r.Header.Get("X-Vault-Token") != s.Token {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) < 4 || path[0] != "v1" || path[1] != "transit" {
+		http.NotFound(w, r)
+		return
+	}
+
+	req := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	var data map[string]any
+	var err error
+
+	switch {
+	case path[2] == "encrypt":
+		data, err = s.encrypt(path[3], req["plaintext"])
+	case path[2] == "decrypt":
+		data, err = s.decrypt(path[3], req["ciphertext"])
+	case path[2] == "keys" && len(path) == 5 && path[4] == "rotate":
+		err = s.rotate(path[3])
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {err.Error()}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (s *KMSStandIn) rotate(name string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys[name] = append(s.keys[name], gcm)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *KMSStandIn) encrypt(name, plaintext string) (map[string]any, error) {
+	s.mu.Lock()
+	exists := len(s.keys[name]) > 0
+	s.mu.Unlock()
+	if !exists {
+		if err := s.rotate(name); err != nil {
+			return nil, err
+		}
+	}
+
+	plain, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	version := len(s.keys[name])
+	gcm := s.keys[name][version-1]
+	s.mu.Unlock()
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"ciphertext": fmt.Sprintf("vault:v%d:%s", version,
+			base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)),
+		),
+		"key_version": version,
+	}, nil
+}
+
+func (s *KMSStandIn) decrypt(name, ciphertext string) (map[string]any, error) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("invalid ciphertext")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil {
+		return nil, errors.New("invalid ciphertext version")
+	}
+
+	s.mu.Lock()
+	versions := s.keys[name]
+	s.mu.Unlock()
+	if version < 1 || version > len(versions) {
+		return nil, errors.New("key version not found")
+	}
+	gcm := versions[version-1]
+
+	buf, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(buf) < gcm.NonceSize() {
+		return nil, errors.New("invalid ciphertext")
+	}
+	plain, err := gcm.Open(nil, buf[:gcm.NonceSize()], buf[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString(plain),
+	}, nil
+}
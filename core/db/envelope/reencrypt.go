@@ -0,0 +1,145 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"lib/tlog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fields of variable objects holding secret value, see db.ElementVariableS
+var secretFields = []string{"FirstValue", "CurrentValue", "ResolvedValue"}
+
+type ReEncryptResultS struct {
+	Files  int
+	Values int
+	Errors []string
+}
+
+// ReEncryptDir rewrites every JSON file under root, so all sealed values are
+// sealed with current primary master key. Plain text values of variables
+// marked as `Secret` are sealed as well (migration of data saved before
+// encryption was enabled).
+func ReEncryptDir(root string) ReEncryptResultS {
+
+	res := ReEncryptResultS{}
+	if !Enabled() {
+		res.Errors = append(res.Errors, "encryption is disabled, no master key")
+		return res
+	}
+
+	resetDEK()
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		n, err := reEncryptFile(path)
+		if err != nil {
+			tlog.Error(err, tlog.Vars{
+				"path": path,
+			})
+			res.Errors = append(res.Errors, path+": "+err.Error())
+			return nil
+		}
+		if n > 0 {
+			res.Files++
+			res.Values += n
+		}
+		return nil
+	})
+
+	tlog.Info("envelope: re-encryption done", tlog.Vars{
+		"files":  res.Files,
+		"values": res.Values,
+		"errors": len(res.Errors),
+	})
+	return res
+}
+
+func reEncryptFile(path string) (int, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Contains(buf, []byte(prefix)) && !bytes.Contains(buf, []byte(`"Secret": true`)) &&
+		!bytes.Contains(buf, []byte(`"Secret":true`)) {
+		return 0, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	doc, err = reEncryptValue(doc, &count)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	out, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		return 0, err
+	}
+	return count, os.Rename(tmp, path)
+}
+
+func reEncryptValue(v any, count *int) (any, error) {
+	switch x := v.(type) {
+
+	case string:
+		if !IsSealed(x) {
+			return x, nil
+		}
+		*count++
+		return Reseal(x)
+
+	case []any:
+		for i := range x {
+			var err error
+			if x[i], err = reEncryptValue(x[i], count); err != nil {
+				return nil, err
+			}
+		}
+		return x, nil
+
+	case map[string]any:
+		for k := range x {
+			var err error
+			if x[k], err = reEncryptValue(x[k], count); err != nil {
+				return nil, err
+			}
+		}
+
+		if secret, _ := x["Secret"].(bool); secret {
+			for _, field := range secretFields {
+				s, ok := x[field].(string)
+				if !ok || s == "" || IsSealed(s) || s == "{{ secret }}" {
+					continue
+				}
+				sealed, err := Seal(s)
+				if err != nil {
+					return nil, err
+				}
+				x[field] = sealed
+				*count++
+			}
+		}
+		return x, nil
+	}
+
+	return v, nil
+}
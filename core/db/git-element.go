@@ -28,6 +28,7 @@ type GitEnvS struct {
 	Tags        []string
 	Teams       []string
 	Element     map[string]SourceGitS
+	Alerts      EnvironmentAlertsS
 	Error       string
 	FileContent []byte
 }
@@ -37,6 +38,8 @@ type GitEnv2S struct { // from TOML file
 	Tags        []string
 	Teams       []string
 	Element     map[string]SourceGitS
+	Alert       map[string]*AlertRuleS `toml:"alert"`
+	AlertRoute  []*AlertRouteS         `toml:"alert-route"`
 }
 
 type ElementsInGitRepoCacheS struct {
@@ -182,6 +185,15 @@ func (gitEnv *GitEnvS) Validate() (success bool) {
 	gitEnv.Tags = newEnv.Tags
 	gitEnv.Element = newEnv.Element
 
+	gitEnv.Alerts = EnvironmentAlertsS{
+		Rules:  newEnv.Alert,
+		Routes: newEnv.AlertRoute,
+	}
+	if err := gitEnv.Alerts.check(); err != nil {
+		gitEnv.Error = "Environment alerts: " + err.Message
+		return false
+	}
+
 	return true
 }
 
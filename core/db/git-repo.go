@@ -1457,6 +1457,17 @@ func (gitRepo *GitRepoS) triggerUpdate(branch, latestCommit string) {
 				element.GetStatus().NewerVersion = latestCommit != element.GetSource().CommitHash
 				continue
 			}
+			if domain := env.SLOBlocksAutoUpdate(); domain != "" {
+				element.GetStatus().NewerVersion = latestCommit != element.GetSource().CommitHash
+				tlog.Warning("auto update of {{element}} held, error budget of {{domain}} is exhausted", tlog.Vars{
+					"env":     env.ID,
+					"element": elName,
+					"domain":  domain,
+					"commit":  latestCommit,
+					"event":   true,
+				})
+				continue
+			}
 
 			env.SetElementVersion(elName, branch, latestCommit, nil)
 		}
@@ -12,5 +12,6 @@ const (
 	Glob_ManageGlobalMemebers                    // mozliwosc zarzadzania globalnymi zespołami i uczestnikami zespołów
 	Glob_CreateAndDeleteEnvs                     // mozliwosc tworzenia i usuwania srodowisk
 	Glob_CreateAndDeleteGitRepos                 // mozliwosc tworzenia i usuwania git-reposow
+	Glob_ManageSystem                            // mozliwosc zmian w strefie admina (klastry, sekrety, DNS, kwoty, kalendarze)
 	__Glob_Iter                                  // used for iteration, do not remove
 )
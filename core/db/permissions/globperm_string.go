@@ -14,12 +14,13 @@ func _() {
 	_ = x[Glob_ManageGlobalMemebers-3]
 	_ = x[Glob_CreateAndDeleteEnvs-4]
 	_ = x[Glob_CreateAndDeleteGitRepos-5]
-	_ = x[__Glob_Iter-6]
+	_ = x[Glob_ManageSystem-6]
+	_ = x[__Glob_Iter-7]
 }
 
-const _GlobPerm_name = "Glob_AccessToWebUIGlob_AccessToAdminZoneGlob_AccessToKubeGlob_ManageGlobalMemebersGlob_CreateAndDeleteEnvsGlob_CreateAndDeleteGitRepos__Glob_Iter"
+const _GlobPerm_name = "Glob_AccessToWebUIGlob_AccessToAdminZoneGlob_AccessToKubeGlob_ManageGlobalMemebersGlob_CreateAndDeleteEnvsGlob_CreateAndDeleteGitReposGlob_ManageSystem__Glob_Iter"
 
-var _GlobPerm_index = [...]uint8{0, 18, 40, 57, 82, 106, 134, 145}
+var _GlobPerm_index = [...]uint8{0, 18, 40, 57, 82, 106, 134, 151, 162}
 
 func (i GlobPerm) String() string {
 	if i >= GlobPerm(len(_GlobPerm_index)-1) {
@@ -20,43 +20,111 @@ type PermGroup struct {
 
 func (pg PermGroup) ToFrontPerm() FrontPerm {
 	front := FrontPerm{
-		Global:   map[string]PermExplained{},
+		Global:   GlobMaskToFront(pg.Global),
 		Envs:     map[string]map[string]PermExplained{},
 		GitRepos: map[string]map[string]PermExplained{},
 	}
 
-	// Global
+	// Envs
+	for tag, mask := range pg.Envs {
+		front.Envs[tag] = EnvMaskToFront(mask)
+	}
+
+	// GitRepos
+	for tag, mask := range pg.GitRepos {
+		front.GitRepos[tag] = RepoMaskToFront(mask)
+	}
+	return front
+}
+
+func GlobMaskToFront(mask Mask) map[string]PermExplained {
+	m := map[string]PermExplained{}
 	for i := GlobPerm(0); i < __Glob_Iter; i++ {
-		front.Global[i.String()] = PermExplained{
+		m[i.String()] = PermExplained{
 			Index: uint8(i),
-			IsSet: bitmap.GetBit(pg.Global, i),
+			IsSet: bitmap.GetBit(mask, i),
 		}
 	}
+	return m
+}
 
-	// Envs
-	for tag, mask := range pg.Envs {
-		m := map[string]PermExplained{}
-		for i := EnvPerm(0); i < __Env_Iter; i++ {
-			m[i.String()] = PermExplained{
-				Index: uint8(i),
-				IsSet: bitmap.GetBit(mask, i),
-			}
+func EnvMaskToFront(mask Mask) map[string]PermExplained {
+	m := map[string]PermExplained{}
+	for i := EnvPerm(0); i < __Env_Iter; i++ {
+		m[i.String()] = PermExplained{
+			Index: uint8(i),
+			IsSet: bitmap.GetBit(mask, i),
 		}
-		front.Envs[tag] = m
 	}
+	return m
+}
 
-	// GitRepos
-	for tag, mask := range pg.GitRepos {
-		m := map[string]PermExplained{}
-		for i := RepoPerm(0); i < __Repo_Iter; i++ {
-			m[i.String()] = PermExplained{
-				Index: uint8(i),
-				IsSet: bitmap.GetBit(mask, i),
-			}
+func RepoMaskToFront(mask Mask) map[string]PermExplained {
+	m := map[string]PermExplained{}
+	for i := RepoPerm(0); i < __Repo_Iter; i++ {
+		m[i.String()] = PermExplained{
+			Index: uint8(i),
+			IsSet: bitmap.GetBit(mask, i),
 		}
-		front.GitRepos[tag] = m
 	}
-	return front
+	return m
+}
+
+// EnvMask returns permissions of environment with tags, `id:*` applies to all environments
+func (pg PermGroup) EnvMask(tags []string) Mask {
+	mask := pg.Envs["id:*"]
+	for _, tag := range tags {
+		mask.Join(pg.Envs[tag])
+	}
+	return mask
+}
+
+// RepoMask returns permissions of git repo with tags, `id:*` applies to all repos
+func (pg PermGroup) RepoMask(tags []string) Mask {
+	mask := pg.GitRepos["id:*"]
+	for _, tag := range tags {
+		mask.Join(pg.GitRepos[tag])
+	}
+	return mask
+}
+
+// GlobPerms returns all global permissions
+func GlobPerms() []GlobPerm {
+	res := []GlobPerm{}
+	for i := GlobPerm(0); i < __Glob_Iter; i++ {
+		res = append(res, i)
+	}
+	return res
+}
+
+// ParseGlobPerm returns permission by name, eg. `Glob_AccessToAdminZone`
+func ParseGlobPerm(name string) (GlobPerm, bool) {
+	for i := GlobPerm(0); i < __Glob_Iter; i++ {
+		if i.String() == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ParseEnvPerm returns permission by name, eg. `Env_ElementTerminal`
+func ParseEnvPerm(name string) (EnvPerm, bool) {
+	for i := EnvPerm(0); i < __Env_Iter; i++ {
+		if i.String() == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ParseRepoPerm returns permission by name
+func ParseRepoPerm(name string) (RepoPerm, bool) {
+	for i := RepoPerm(0); i < __Repo_Iter; i++ {
+		if i.String() == name {
+			return i, true
+		}
+	}
+	return 0, false
 }
 
 type Mask uint32
@@ -0,0 +1,247 @@
+package db
+
+import (
+	perms "core/db/permissions"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/bitmap"
+	"strings"
+)
+
+type permKind uint8
+
+const (
+	permGlobal permKind = iota
+	permEnv
+	permRepo
+)
+
+// PermSourceS is rule which sets checked permission
+type PermSourceS struct {
+	Source  string // team, role-binding, token
+	Name    string // team or role name
+	Subject string `json:",omitempty"` // team or user of role binding
+	Scope   string
+	Element string `json:",omitempty"`
+	Effect  string // allow, deny, limit
+	Expires int64  `json:",omitempty"`
+	Reason  string `json:",omitempty"`
+}
+
+// PermExplainS says why user has or lacks permission
+type PermExplainS struct {
+	Perm    string
+	Target  string `json:",omitempty"`
+	Element string `json:",omitempty"`
+	Allowed bool
+	Reason  string
+	Sources []PermSourceS
+}
+
+// permSelectors returns keys of PermGroup.Envs / GitRepos matching object
+func permSelectors(id string, tags []string) []string {
+	return append([]string{"id:*", "id:" + id}, tags...)
+}
+
+// evalPerm is the only place where permissions are calculated: allow from
+// teams or role bindings, any active deny binding wins, API token can only
+// narrow result. Element bindings apply only when element is checked.
+func (user *UserS) evalPerm(kind permKind, id string, tags []string, element string, bit uint8, explain *PermExplainS) bool {
+
+	if user == nil {
+		return false
+	}
+
+	allow, deny, limited := false, false, false
+	add := func(s PermSourceS) {
+		if explain != nil {
+			explain.Sources = append(explain.Sources, s)
+		}
+	}
+
+	var selectors []string
+	if kind != permGlobal {
+		selectors = permSelectors(id, tags)
+	}
+
+	// teams
+	for _, tID := range user.Teams.List() {
+		team := TeamMap.Get(tID)
+		if team == nil {
+			continue
+		}
+		switch kind {
+		case permGlobal:
+			if bitmap.GetBit(team.Permissions.Global, bit) {
+				allow = true
+				add(PermSourceS{Source: "team", Name: team.Name, Scope: ScopeGlobal, Effect: "allow"})
+			}
+		case permEnv, permRepo:
+			group, prefix := team.Permissions.Envs, ScopeEnv
+			if kind == permRepo {
+				group, prefix = team.Permissions.GitRepos, ScopeRepo
+			}
+			for _, sel := range selectors {
+				if mask, ok := group[sel]; ok && bitmap.GetBit(mask, bit) {
+					allow = true
+					add(PermSourceS{Source: "team", Name: team.Name, Scope: prefix + sel, Effect: "allow"})
+				}
+			}
+		}
+	}
+
+	// role bindings
+	for _, b := range RoleBindingMap.Values() {
+		if !b.Active() || !b.appliesTo(user) {
+			continue
+		}
+		role := RoleMap.Get(b.RoleID)
+		if role == nil {
+			continue
+		}
+
+		var mask perms.Mask
+		switch {
+		case kind == permGlobal && b.Scope == ScopeGlobal:
+			mask = role.Global
+		case kind == permEnv && strings.HasPrefix(b.Scope, ScopeEnv):
+			if b.Element != "" && b.Element != element {
+				continue
+			}
+			if !permSelectorMatch(strings.TrimPrefix(b.Scope, ScopeEnv), selectors) {
+				continue
+			}
+			mask = role.Env
+		case kind == permRepo && strings.HasPrefix(b.Scope, ScopeRepo):
+			if !permSelectorMatch(strings.TrimPrefix(b.Scope, ScopeRepo), selectors) {
+				continue
+			}
+			mask = role.Repo
+		default:
+			continue
+		}
+		if !bitmap.GetBit(mask, bit) {
+			continue
+		}
+
+		s := PermSourceS{
+			Source:  "role-binding",
+			Name:    role.Name,
+			Scope:   b.Scope,
+			Element: b.Element,
+			Effect:  "allow",
+			Expires: b.ExpiresTime,
+			Reason:  b.Reason,
+		}
+		if explain != nil {
+			s.Subject = b.Subject()
+		}
+		if b.Deny {
+			deny = true
+			s.Effect = "deny"
+		} else {
+			allow = true
+		}
+		add(s)
+	}
+
+	// API token
+	if user.Token != nil {
+		var mask perms.Mask
+		switch kind {
+		case permGlobal:
+			mask = user.Token.Permissions.Global
+		case permEnv:
+			mask = user.Token.Permissions.EnvMask(selectors)
+		case permRepo:
+			mask = user.Token.Permissions.RepoMask(selectors)
+		}
+		if !bitmap.GetBit(mask, bit) {
+			limited = true
+			add(PermSourceS{Source: "token", Name: user.Token.Name, Effect: "limit"})
+		}
+	}
+
+	allowed := allow && !deny && !limited
+	if explain != nil {
+		explain.Allowed = allowed
+		switch {
+		case deny:
+			explain.Reason = "denied by role binding"
+		case !allow:
+			explain.Reason = "no team or role binding grants this permission"
+		case limited:
+			explain.Reason = "permission is not included in API token"
+		default:
+			explain.Reason = "granted by team or role binding"
+			for _, s := range explain.Sources {
+				if s.Effect == "allow" && s.Expires != 0 {
+					explain.Reason += " (includes time-bound grant)"
+					break
+				}
+			}
+		}
+	}
+	return allowed
+}
+
+func permSelectorMatch(selector string, selectors []string) bool {
+	for _, s := range selectors {
+		if s == selector {
+			return true
+		}
+	}
+	return false
+}
+
+// ExplainPerm says why user has or lacks permission, perm is name of
+// permission (Glob_*, Env_*, Repo_*), target is env ID or git repo name
+func (user *UserS) ExplainPerm(perm, target, element string) (*PermExplainS, *tlog.RecordS) {
+
+	res := &PermExplainS{
+		Perm:    perm,
+		Target:  target,
+		Element: element,
+		Sources: []PermSourceS{},
+	}
+
+	switch {
+	case strings.HasPrefix(perm, "Glob_"):
+		p, ok := perms.ParseGlobPerm(perm)
+		if !ok {
+			return nil, tlog.Error("unknown permission: " + perm)
+		}
+		res.Target, res.Element = "", ""
+		user.evalPerm(permGlobal, "", nil, "", uint8(p), res)
+
+	case strings.HasPrefix(perm, "Env_"):
+		p, ok := perms.ParseEnvPerm(perm)
+		if !ok {
+			return nil, tlog.Error("unknown permission: " + perm)
+		}
+		env := EnvironmentMap.Get(target)
+		if env == nil {
+			return nil, tlog.Error("environment not found")
+		}
+		if element != "" && env.GetElement(element) == nil {
+			return nil, tlog.Error(fmt.Sprintf("element `%s` not found", element))
+		}
+		user.evalPerm(permEnv, env.ID, env.Tags.List(), element, uint8(p), res)
+
+	case strings.HasPrefix(perm, "Repo_"):
+		p, ok := perms.ParseRepoPerm(perm)
+		if !ok {
+			return nil, tlog.Error("unknown permission: " + perm)
+		}
+		repo := GitRepoGetByName(target)
+		if repo == nil {
+			return nil, tlog.Error("git repo not found")
+		}
+		res.Element = ""
+		user.evalPerm(permRepo, repo.Name, repo.Tags.List(), "", uint8(p), res)
+
+	default:
+		return nil, tlog.Error("unknown permission: " + perm)
+	}
+	return res, nil
+}
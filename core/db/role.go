@@ -0,0 +1,302 @@
+package db
+
+import (
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoleS is reusable named set of permissions, it gives nothing until it's
+// bound to team or user by RoleBindingS
+type RoleS struct {
+	ID          string
+	Name        string
+	Description string
+	Global      perms.Mask
+	Env         perms.Mask
+	Repo        perms.Mask
+
+	UpdateTime     int64
+	UpdatedByEmail string
+}
+
+// RoleBindingS grants (or with Deny takes away) permissions of role to team
+// or user in scope:
+//
+//	global          - global permissions of role
+//	env:<selector>  - environments with tag, `id:<env-id>` or `id:*` for all
+//	repo:<selector> - git repos with tag, `id:<repo-name>` or `id:*` for all
+//
+// Env binding can be limited to one element. Deny wins over every allow.
+// Binding with ExpiresTime is time-bound grant (break-glass access).
+type RoleBindingS struct {
+	ID          string
+	RoleID      string
+	TeamID      string // TeamID or UserID is set
+	UserID      string
+	Scope       string
+	Element     string // only env scope, empty = all elements
+	Deny        bool
+	ExpiresTime int64 // 0 = never
+	Reason      string
+
+	CreatedTime    int64
+	CreatedByEmail string
+}
+
+const (
+	ScopeGlobal = "global"
+	ScopeEnv    = "env:"
+	ScopeRepo   = "repo:"
+)
+
+var (
+	RoleMap        = maps.NewSafe[string, *RoleS](nil)        // key=ID
+	RoleBindingMap = maps.NewSafe[string, *RoleBindingS](nil) // key=ID
+)
+
+func LoadRoles() {
+	RoleMap = maps.NewSafe[string, *RoleS](nil)
+	list, err := driver.ReadAll("role")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		r := &RoleS{}
+		if err := json.Unmarshal(buf, r); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		RoleMap.Set(r.ID, r)
+	}
+
+	RoleBindingMap = maps.NewSafe[string, *RoleBindingS](nil)
+	list, err = driver.ReadAll("role-binding")
+	if err != nil {
+		tlog.Error(err)
+	}
+	for _, buf := range list {
+		b := &RoleBindingS{}
+		if err := json.Unmarshal(buf, b); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		RoleBindingMap.Set(b.ID, b)
+	}
+}
+
+func newRBACID() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func RoleGetByName(name string) *RoleS {
+	for _, r := range RoleMap.Values() {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// RoleList returns roles sorted by name
+func RoleList() []*RoleS {
+	res := RoleMap.Values()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Save creates role (empty ID) or updates it
+func (r *RoleS) Save(user *UserS) *tlog.RecordS {
+
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return tlog.Error("role name is required")
+	}
+	if other := RoleGetByName(r.Name); other != nil && other.ID != r.ID {
+		return tlog.Error("role with this name already exists")
+	}
+	if r.ID == "" {
+		r.ID = newRBACID()
+	} else if RoleMap.Get(r.ID) == nil {
+		return tlog.Error("role not found")
+	}
+
+	r.UpdateTime = time.Now().Unix()
+	r.UpdatedByEmail = user.Email
+	if err := driver.Write("role", r.ID, r); err != nil {
+		return tlog.Error(err)
+	}
+	RoleMap.Set(r.ID, r)
+
+	tlog.Info("role saved", tlog.Vars{
+		"role":  r.Name,
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
+
+// Delete removes role and its bindings
+func (r *RoleS) Delete(user *UserS) *tlog.RecordS {
+
+	for _, b := range RoleBindingMap.Values() {
+		if b.RoleID == r.ID {
+			if err := b.Delete(user); err != nil {
+				return err
+			}
+		}
+	}
+	if err := driver.Delete("role", r.ID); err != nil {
+		return tlog.Error(err)
+	}
+	RoleMap.Delete(r.ID)
+
+	tlog.Info("role deleted", tlog.Vars{
+		"role":  r.Name,
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
+
+// --------------------------------------------------
+
+func (b *RoleBindingS) Active() bool {
+	return b.ExpiresTime == 0 || b.ExpiresTime > time.Now().Unix()
+}
+
+// Subject returns name of team or email of user
+func (b *RoleBindingS) Subject() string {
+	if b.TeamID != "" {
+		if t := TeamMap.Get(b.TeamID); t != nil {
+			return "team " + t.Name
+		}
+		return "team " + b.TeamID
+	}
+	if u := GetUserByID(b.UserID); u != nil {
+		return "user " + u.Email
+	}
+	return "user " + b.UserID
+}
+
+func (b *RoleBindingS) appliesTo(user *UserS) bool {
+	if b.UserID != "" {
+		return b.UserID == user.ID
+	}
+	return user.Teams.Exists(b.TeamID)
+}
+
+func (b *RoleBindingS) check() *tlog.RecordS {
+	if RoleMap.Get(b.RoleID) == nil {
+		return tlog.Error("role not found")
+	}
+	if (b.TeamID == "") == (b.UserID == "") {
+		return tlog.Error("binding needs team or user")
+	}
+	if b.TeamID != "" && TeamMap.Get(b.TeamID) == nil {
+		return tlog.Error("team not found")
+	}
+	if b.UserID != "" && GetUserByID(b.UserID) == nil {
+		return tlog.Error("user not found")
+	}
+
+	switch {
+	case b.Scope == ScopeGlobal:
+	case strings.HasPrefix(b.Scope, ScopeEnv) && len(b.Scope) > len(ScopeEnv):
+	case strings.HasPrefix(b.Scope, ScopeRepo) && len(b.Scope) > len(ScopeRepo):
+	default:
+		return tlog.Error("invalid scope, use `global`, `env:<tag>` or `repo:<tag>`")
+	}
+	if b.Element != "" && !strings.HasPrefix(b.Scope, ScopeEnv) {
+		return tlog.Error("element can be set only in env scope")
+	}
+	if b.ExpiresTime != 0 && b.ExpiresTime <= time.Now().Unix() {
+		return tlog.Error("expiration time is in the past")
+	}
+	return nil
+}
+
+// Create saves new binding
+func (b *RoleBindingS) Create(user *UserS) *tlog.RecordS {
+
+	b.Scope = strings.TrimSpace(b.Scope)
+	b.Element = strings.TrimSpace(b.Element)
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	b.ID = newRBACID()
+	b.CreatedTime = time.Now().Unix()
+	b.CreatedByEmail = user.Email
+	if err := driver.Write("role-binding", b.ID, b); err != nil {
+		return tlog.Error(err)
+	}
+	RoleBindingMap.Set(b.ID, b)
+
+	vars := tlog.Vars{
+		"role":    RoleMap.Get(b.RoleID).Name,
+		"subject": b.Subject(),
+		"scope":   b.Scope,
+		"deny":    b.Deny,
+		"user":    user.Email,
+		"event":   true,
+	}
+	if b.Element != "" {
+		vars["element"] = b.Element
+	}
+	if b.ExpiresTime != 0 {
+		vars["expires"] = time.Unix(b.ExpiresTime, 0).UTC().Format(time.RFC3339)
+		vars["reason"] = b.Reason
+	}
+	tlog.Info("role binding created", vars)
+	return nil
+}
+
+func (b *RoleBindingS) Delete(user *UserS) *tlog.RecordS {
+	if err := driver.Delete("role-binding", b.ID); err != nil {
+		return tlog.Error(err)
+	}
+	RoleBindingMap.Delete(b.ID)
+
+	email := "Timoni"
+	if user != nil {
+		email = user.Email
+	}
+	tlog.Info("role binding deleted", tlog.Vars{
+		"role-binding": b.ID,
+		"subject":      b.Subject(),
+		"scope":        b.Scope,
+		"active":       b.Active(),
+		"user":         email,
+		"event":        true,
+	})
+	return nil
+}
+
+// RoleBindingsDeleteBySubject removes bindings of deleted team or user
+func RoleBindingsDeleteBySubject(teamID, userID string, user *UserS) {
+	for _, b := range RoleBindingMap.Values() {
+		if teamID != "" && b.TeamID == teamID || userID != "" && b.UserID == userID {
+			tlog.Error(b.Delete(user))
+		}
+	}
+}
+
+// RoleBindingCleanupLoop removes expired time-bound grants, they stop working
+// at expiration time anyway, removal is for audit log
+func RoleBindingCleanupLoop() {
+	for {
+		for _, b := range RoleBindingMap.Values() {
+			if !b.Active() {
+				tlog.Error(b.Delete(nil))
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScheduleCalendarS is holiday/blackout calendar imported from iCal, env
+// schedule does not start elements during its events. Calendar with URL is
+// imported again once a day.
+type ScheduleCalendarS struct {
+	Name       string
+	URL        string
+	Timezone   string // of all-day and floating events, default X-WR-TIMEZONE of file or UTC
+	Events     []ScheduleCalendarEventS
+	ImportTime int64
+	UserEmail  string
+}
+
+type ScheduleCalendarEventS struct {
+	Summary string
+	Begin   int64 // unix
+	End     int64 // unix, exclusive
+	Yearly  bool  // RRULE:FREQ=YEARLY, other recurrences are not supported
+}
+
+const scheduleCalendarRefresh = 24 * time.Hour
+
+var scheduleCalendarMap = maps.NewSafe[string, *ScheduleCalendarS](nil) // key=name
+
+func LoadScheduleCalendars() {
+	list, err := driver.ReadAll("schedule-calendar")
+	if err != nil {
+		tlog.Error(err)
+		return
+	}
+	for _, buf := range list {
+		c := &ScheduleCalendarS{}
+		if err := json.Unmarshal(buf, c); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		scheduleCalendarMap.Set(c.Name, c)
+	}
+}
+
+func ScheduleCalendarList() []*ScheduleCalendarS {
+	res := scheduleCalendarMap.Values()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func ScheduleCalendarGet(name string) *ScheduleCalendarS {
+	return scheduleCalendarMap.Get(name)
+}
+
+// ScheduleCalendarImport parses iCal data, data is downloaded from url when
+// empty, and saves calendar under name
+func ScheduleCalendarImport(name, url, timezone string, data []byte, user *UserS) (*ScheduleCalendarS, *tlog.RecordS) {
+
+	if name == "" || conv.KeyString(name) != name {
+		return nil, tlog.Error("calendar name has to be lowercase letters, digits and `-`")
+	}
+	if len(data) == 0 {
+		if url == "" {
+			return nil, tlog.Error("iCal data or URL is required")
+		}
+		var err *tlog.RecordS
+		if data, err = scheduleCalendarDownload(url); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &ScheduleCalendarS{
+		Name:     name,
+		URL:      url,
+		Timezone: timezone,
+	}
+	if err := c.parse(data); err != nil {
+		return nil, err
+	}
+	c.ImportTime = time.Now().Unix()
+	c.UserEmail = user.Email
+
+	if err := driver.Write("schedule-calendar", c.Name, c); err != nil {
+		return nil, tlog.Error(err)
+	}
+	scheduleCalendarMap.Set(c.Name, c)
+
+	tlog.Info("schedule calendar {{calendar}} imported, {{events}} events", tlog.Vars{
+		"calendar": c.Name,
+		"events":   len(c.Events),
+		"user":     user.Email,
+		"event":    true,
+	})
+	return c, nil
+}
+
+func ScheduleCalendarDelete(name string, user *UserS) *tlog.RecordS {
+
+	if !scheduleCalendarMap.Exists(name) {
+		return tlog.Error("calendar not found")
+	}
+	for _, env := range EnvironmentMap.Values() {
+		for _, c := range env.Schedule.Calendars {
+			if c == name {
+				return tlog.Error("calendar is used by environment {{env}}", tlog.Vars{
+					"env": env.Name,
+				})
+			}
+		}
+	}
+
+	if err := driver.Delete("schedule-calendar", name); err != nil {
+		return tlog.Error(err)
+	}
+	scheduleCalendarMap.Delete(name)
+
+	tlog.Info("schedule calendar {{calendar}} deleted", tlog.Vars{
+		"calendar": name,
+		"user":     user.Email,
+		"event":    true,
+	})
+	return nil
+}
+
+func scheduleCalendarDownload(url string) ([]byte, *tlog.RecordS) {
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, tlog.Error("calendar download failed: {{status}}", tlog.Vars{
+			"status": res.Status,
+			"url":    url,
+		})
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	return data, nil
+}
+
+// parse reads VEVENTs of iCal data (RFC 5545), only dates, summary and yearly
+// recurrence are used
+func (c *ScheduleCalendarS) parse(data []byte) *tlog.RecordS {
+
+	// unfold lines, continuation starts with space or tab
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "BEGIN:VCALENDAR" {
+		return tlog.Error("invalid iCal data, BEGIN:VCALENDAR is missing")
+	}
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "X-WR-TIMEZONE:") && c.Timezone == "" {
+			c.Timezone = strings.TrimSpace(strings.TrimPrefix(line, "X-WR-TIMEZONE:"))
+		}
+	}
+	loc := time.UTC
+	if c.Timezone != "" {
+		l, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return tlog.Error("invalid timezone {{tz}}", tlog.Vars{"tz": c.Timezone})
+		}
+		loc = l
+	}
+
+	c.Events = []ScheduleCalendarEventS{}
+	var event *ScheduleCalendarEventS
+	allDay := false
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(key, ";")
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &ScheduleCalendarEventS{}
+			allDay = false
+
+		case name == "END" && value == "VEVENT" && event != nil:
+			if event.Begin == 0 {
+				event = nil
+				continue
+			}
+			if event.End <= event.Begin {
+				if allDay {
+					event.End = time.Unix(event.Begin, 0).In(loc).AddDate(0, 0, 1).Unix()
+				} else {
+					event.End = event.Begin
+				}
+			}
+			c.Events = append(c.Events, *event)
+			event = nil
+
+		case event == nil:
+			continue
+
+		case name == "SUMMARY":
+			event.Summary = strings.ReplaceAll(value, `\,`, ",")
+
+		case name == "DTSTART" || name == "DTEND":
+			t, date, err := icalTime(params, value, loc)
+			if err != nil {
+				return tlog.Error("invalid {{name}} `{{value}}`", tlog.Vars{
+					"name":  name,
+					"value": value,
+				})
+			}
+			if name == "DTSTART" {
+				event.Begin = t.Unix()
+				allDay = date
+			} else {
+				event.End = t.Unix()
+			}
+
+		case name == "RRULE":
+			event.Yearly = strings.Contains(value, "FREQ=YEARLY")
+		}
+	}
+
+	sort.Slice(c.Events, func(i, j int) bool { return c.Events[i].Begin < c.Events[j].Begin })
+	return nil
+}
+
+// icalTime parses DATE or DATE-TIME value, time without zone is in TZID or loc
+func icalTime(params, value string, loc *time.Location) (time.Time, bool, error) {
+	for _, p := range strings.Split(params, ";") {
+		if strings.HasPrefix(p, "TZID=") {
+			if l, err := time.LoadLocation(strings.Trim(p[len("TZID="):], `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	if len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// Active returns event of calendar which lasts at t
+func (c *ScheduleCalendarS) Active(t time.Time) *ScheduleCalendarEventS {
+	for idx := range c.Events {
+		e := &c.Events[idx]
+		if !e.Yearly {
+			if t.Unix() >= e.Begin && t.Unix() < e.End {
+				return e
+			}
+			continue
+		}
+
+		begin := time.Unix(e.Begin, 0).UTC()
+		end := time.Unix(e.End, 0).UTC()
+		for _, year := range []int{t.Year() - 1, t.Year()} {
+			shift := year - begin.Year()
+			if shift < 0 {
+				continue
+			}
+			if !t.Before(begin.AddDate(shift, 0, 0)) && t.Before(end.AddDate(shift, 0, 0)) {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleCalendarsRefresh imports calendars with URL again
+func scheduleCalendarsRefresh() {
+	for _, c := range scheduleCalendarMap.Values() {
+		if c.URL == "" || time.Since(time.Unix(c.ImportTime, 0)) < scheduleCalendarRefresh {
+			continue
+		}
+		data, err := scheduleCalendarDownload(c.URL)
+		if err != nil {
+			c.ImportTime = time.Now().Unix() // next try tomorrow, old events are kept
+			continue
+		}
+		ScheduleCalendarImport(c.Name, c.URL, c.Timezone, data, &UserS{Email: c.UserEmail})
+	}
+}
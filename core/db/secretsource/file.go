@@ -0,0 +1,76 @@
+package secretsource
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileS reads secrets from files mounted into core pod (eg. CSI secrets store).
+// File can be JSON object, `KEY=VALUE` lines or single value, path must be
+// inside one of AllowedDirs, `{env}` in dir is replaced by env ID.
+type FileS struct {
+	AllowedDirs []string
+}
+
+func (FileS) Name() string {
+	return "file"
+}
+
+func (f FileS) CheckPath(path, namespace string) error {
+	clean := strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	if !pathAllowed(clean, f.AllowedDirs, namespace) {
+		return errors.New("file is outside of allowed secret directories: /" + clean)
+	}
+	return nil
+}
+
+func (f FileS) Read(path string) (*SecretS, error) {
+	path = filepath.Clean("/" + path)
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	buf = bytes.TrimSpace(buf)
+
+	secret := &SecretS{
+		Data: map[string]string{},
+	}
+
+	if bytes.HasPrefix(buf, []byte("{")) {
+		data := map[string]any{}
+		if err := json.Unmarshal(buf, &data); err == nil {
+			for k, v := range data {
+				if s, ok := v.(string); ok {
+					secret.Data[k] = s
+					continue
+				}
+				b, _ := json.Marshal(v)
+				secret.Data[k] = string(b)
+			}
+			return secret, nil
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			// not an env file, whole content is the value
+			return &SecretS{
+				Data: map[string]string{"": string(buf)},
+			}, nil
+		}
+		secret.Data[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+	}
+	return secret, nil
+}
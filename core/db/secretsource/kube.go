@@ -0,0 +1,43 @@
+package secretsource
+
+import (
+	"errors"
+)
+
+// KubeSecretS reads secrets from kubernetes cluster, path is `namespace/name`.
+// Elements can read only secrets of namespace of their env. Get reads data of
+// secret from cluster, it's set by db so this package doesn't depend on kube.
+type KubeSecretS struct {
+	Get func(namespace, name string) (map[string]string, error)
+}
+
+func (KubeSecretS) Name() string {
+	return "k8s-secret"
+}
+
+func (KubeSecretS) CheckPath(path, namespace string) error {
+	ns, _, err := ParsePathNamespace(path)
+	if err != nil {
+		return err
+	}
+	if namespace == "" || ns != namespace {
+		return errors.New("k8s-secret can be read only from namespace of environment: " + path)
+	}
+	return nil
+}
+
+func (s KubeSecretS) Read(path string) (*SecretS, error) {
+	ns, name, err := ParsePathNamespace(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Get == nil {
+		return nil, errors.New("k8s-secret: cluster is not configured")
+	}
+
+	data, err := s.Get(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretS{Data: data}, nil
+}
@@ -0,0 +1,349 @@
+// Package secretsource resolves variable references to secrets kept outside
+// of Timoni, eg:
+//
+//	{{vault:kv/data/app#password}}
+//	{{k8s-secret:namespace/name#key}}
+//	{{file:/run/secrets/db.json#password}}
+//
+// Values are cached per source (provider + path) and refreshed in background,
+// leases are renewed when provider supports it. Changed values are reported
+// to callback registered in Loop.
+package secretsource
+
+import (
+	"core/config"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/maps"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// group 0: {{vault:kv/data/app#password}}
+	// group 1: vault
+	// group 2: kv/data/app
+	// group 3: password
+	RegexReference = regexp.MustCompile(`{{([a-z0-9\-]+):([^#{}\s]+)(?:#([^{}\s]+))?}}`)
+
+	ErrProviderNotFound = errors.New("secret source provider not found")
+	ErrKeyNotFound      = errors.New("key not found in secret source")
+
+	providers = maps.NewSafe[string, Provider](nil) // key=provider name
+	cache     = maps.NewSafe[string, *entryS](nil)  // key=provider:path
+
+	// DefaultTTL is used when provider does not return lease duration
+	DefaultTTL = 5 * time.Minute
+)
+
+// Provider reads secrets from external source.
+type Provider interface {
+	Name() string
+	Read(path string) (*SecretS, error)
+}
+
+// PathChecker is implemented by providers limiting which paths env can read,
+// namespace is ID of env of element using the reference.
+type PathChecker interface {
+	CheckPath(path, namespace string) error
+}
+
+// LeaseRenewer is implemented by providers supporting lease renewal.
+type LeaseRenewer interface {
+	Renew(secret *SecretS) (time.Duration, error)
+}
+
+type SecretS struct {
+	Data      map[string]string
+	LeaseID   string
+	LeaseTTL  time.Duration
+	Renewable bool
+}
+
+type entryS struct {
+	mu sync.Mutex
+
+	provider string
+	path     string
+	secret   *SecretS
+	hash     string
+	fetched  time.Time
+	expires  time.Time
+	lastUsed time.Time
+	err      error
+}
+
+// Register adds provider, provider with the same name is replaced.
+func Register(p Provider) {
+	providers.Set(p.Name(), p)
+}
+
+// Providers returns names of registered providers
+func Providers() []string {
+	names := providers.Keys()
+	sort.Strings(names)
+	return names
+}
+
+// SourceKey returns cache key of reference, used as dependence key of variables.
+func SourceKey(provider, path string) string {
+	return provider + ":" + path
+}
+
+// Resolve returns value of key from secret at path for env namespace, reading
+// it from provider if it is not cached yet. Stale cached value is returned
+// when provider fails.
+func Resolve(namespace, provider, path, key string) (string, error) {
+
+	p := providers.Get(provider)
+	if p == nil {
+		return "", fmt.Errorf("%w: %s", ErrProviderNotFound, provider)
+	}
+	if c, ok := p.(PathChecker); ok {
+		if err := c.CheckPath(path, namespace); err != nil {
+			return "", err
+		}
+	}
+
+	e := cache.Get(SourceKey(provider, path))
+	if e == nil {
+		e = &entryS{
+			provider: provider,
+			path:     path,
+		}
+		cache.Set(SourceKey(provider, path), e)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastUsed = time.Now()
+	if e.secret == nil {
+		e.refresh(p)
+	}
+	if e.secret == nil {
+		return "", e.err
+	}
+
+	if key == "" {
+		if len(e.secret.Data) == 1 {
+			for _, v := range e.secret.Data {
+				return v, nil
+			}
+		}
+		if v, ok := e.secret.Data[""]; ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("%w: key is required, secret has %d keys", ErrKeyNotFound, len(e.secret.Data))
+	}
+
+	v, ok := e.secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return v, nil
+}
+
+// refresh reads secret from provider, returns true when value has changed.
+func (e *entryS) refresh(p Provider) bool {
+	secret, err := p.Read(e.path)
+	e.err = err
+	if err != nil {
+		tlog.Error(err, tlog.Vars{
+			"provider": e.provider,
+			"path":     e.path,
+		})
+		// keep stale value, try again soon
+		e.expires = time.Now().Add(30 * time.Second)
+		return false
+	}
+
+	hash := hashData(secret.Data)
+	changed := e.secret != nil && hash != e.hash
+
+	ttl := secret.LeaseTTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	e.secret = secret
+	e.hash = hash
+	e.fetched = time.Now()
+	e.expires = e.fetched.Add(ttl)
+	return changed
+}
+
+// renew extends lease of secret, or reads it again when renewal is not possible.
+func (e *entryS) renew(p Provider) bool {
+	if r, ok := p.(LeaseRenewer); ok && e.secret != nil && e.secret.Renewable && e.secret.LeaseID != "" {
+		ttl, err := r.Renew(e.secret)
+		if err == nil && ttl > 0 {
+			e.expires = time.Now().Add(ttl)
+			return false
+		}
+		tlog.Warning("secret lease renewal failed, reading secret again", tlog.Vars{
+			"provider": e.provider,
+			"path":     e.path,
+			"error":    err,
+		})
+	}
+	return e.refresh(p)
+}
+
+func hashData(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00", k, data[k])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Loop refreshes cached secrets before their lease expires, and calls
+// onChange with source key (provider:path) of every changed secret.
+// Secrets not used for one hour are dropped from cache.
+func Loop(onChange func(sourceKey string)) {
+	for {
+		time.Sleep(10 * time.Second)
+		RefreshNow(false, onChange)
+	}
+}
+
+// RefreshNow checks all cached secrets, with force=true every secret is read
+// again from its provider regardless of lease.
+func RefreshNow(force bool, onChange func(sourceKey string)) {
+	for _, key := range cache.Keys() {
+		e := cache.Get(key)
+		if e == nil {
+			continue
+		}
+		p := providers.Get(e.provider)
+		if p == nil {
+			continue
+		}
+
+		e.mu.Lock()
+		if time.Since(e.lastUsed) > time.Hour {
+			e.mu.Unlock()
+			cache.Delete(key)
+			continue
+		}
+
+		changed := false
+		switch {
+		case force:
+			changed = e.refresh(p)
+
+		case time.Until(e.expires) < e.expires.Sub(e.fetched)/3:
+			// less than 1/3 of lease left
+			changed = e.renew(p)
+		}
+		e.mu.Unlock()
+
+		if changed {
+			tlog.Info("external secret changed", tlog.Vars{
+				"source": key,
+			})
+			if onChange != nil {
+				onChange(key)
+			}
+		}
+	}
+}
+
+// StatusS describes cached secret, without values
+type StatusS struct {
+	Source    string
+	Keys      []string
+	Fetched   int64
+	Expires   int64
+	Renewable bool
+	Error     string
+}
+
+func Status() []StatusS {
+	res := []StatusS{}
+	for _, key := range cache.Keys() {
+		e := cache.Get(key)
+		if e == nil {
+			continue
+		}
+
+		e.mu.Lock()
+		s := StatusS{
+			Source:  key,
+			Fetched: e.fetched.Unix(),
+			Expires: e.expires.Unix(),
+		}
+		if e.err != nil {
+			s.Error = e.err.Error()
+		}
+		if e.secret != nil {
+			s.Renewable = e.secret.Renewable
+			for k := range e.secret.Data {
+				s.Keys = append(s.Keys, k)
+			}
+			sort.Strings(s.Keys)
+		}
+		e.mu.Unlock()
+
+		res = append(res, s)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Source < res[j].Source })
+	return res
+}
+
+// ParsePathNamespace splits `namespace/name` path
+func ParsePathNamespace(path string) (string, string, error) {
+	ns, name, ok := strings.Cut(path, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", errors.New("path must be in format `namespace/name`: " + path)
+	}
+	return ns, name, nil
+}
+
+// pathAllowed returns true when path is inside one of allowed prefixes,
+// `{env}` in prefix is replaced by namespace
+func pathAllowed(path string, allowed []string, namespace string) bool {
+	for _, prefix := range allowed {
+		prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+		if prefix == "" {
+			continue
+		}
+		if strings.Contains(prefix, "{env}") {
+			if namespace == "" {
+				continue
+			}
+			prefix = strings.ReplaceAll(prefix, "{env}", namespace)
+		}
+		if strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Setup registers providers enabled in config, kubeGet reads secrets of
+// k8s-secret provider.
+func Setup(kubeGet func(namespace, name string) (map[string]string, error)) {
+	Register(KubeSecretS{Get: kubeGet})
+	Register(FileS{
+		AllowedDirs: strings.Split(config.SecretFileDirs(), ","),
+	})
+	if config.SecretVaultAddr() != "" {
+		vault := NewVault(config.SecretVaultAddr(), config.SecretVaultToken())
+		vault.AllowedPaths = strings.Split(config.SecretVaultPaths(), ",")
+		Register(vault)
+	}
+}
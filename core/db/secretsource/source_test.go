@@ -0,0 +1,125 @@
+package secretsource
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+func TestResolveVault(t *testing.T) {
+	standIn := NewVaultStandIn(testToken)
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	standIn.Put("kv/data/env-a/db", map[string]any{"password": "a-secret", "user": "app"}, 0)
+	standIn.Put("kv/data/env-b/db", map[string]any{"password": "b-secret"}, 0)
+	standIn.Put("database/creds/env-a", map[string]any{"password": "dynamic"}, time.Hour)
+
+	vault := NewVault(srv.URL, testToken)
+	vault.AllowedPaths = []string{"kv/data/{env}", "database/creds"}
+	Register(vault)
+
+	tests := []struct {
+		name      string
+		namespace string
+		path      string
+		key       string
+		want      string
+		wantErr   bool
+	}{
+		{"kv v2", "env-a", "kv/data/env-a/db", "password", "a-secret", false},
+		{"other key", "env-a", "kv/data/env-a/db", "user", "app", false},
+		{"dynamic secret", "env-a", "database/creds/env-a", "password", "dynamic", false},
+		{"path of other env", "env-a", "kv/data/env-b/db", "password", "", true},
+		{"path outside allow-list", "env-a", "secret/root", "", "", true},
+		{"path traversal", "env-a", "kv/data/env-a/../env-b/db", "password", "", true},
+		{"missing key", "env-a", "kv/data/env-a/db", "nope", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.namespace, "vault", tt.path, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// cached value is refreshed from vault
+	standIn.Put("kv/data/env-a/db", map[string]any{"password": "rotated", "user": "app"}, 0)
+	changed := []string{}
+	RefreshNow(true, func(key string) { changed = append(changed, key) })
+	if got, _ := Resolve("env-a", "vault", "kv/data/env-a/db", "password"); got != "rotated" {
+		t.Errorf("Resolve() after refresh = %q, want rotated", got)
+	}
+	if len(changed) != 1 || changed[0] != SourceKey("vault", "kv/data/env-a/db") {
+		t.Errorf("RefreshNow() changed = %v", changed)
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"env-a/db.json": `{"password": "json-secret", "port": 5432}`,
+		"env-a/app.env": "# comment\nTOKEN=\"env-secret\"\n",
+		"env-a/single":  "single-secret\n",
+		"env-b/db.json": `{"password": "b-secret"}`,
+	} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Register(FileS{AllowedDirs: []string{filepath.Join(dir, "{env}")}})
+
+	tests := []struct {
+		name    string
+		path    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"json", "env-a/db.json", "password", "json-secret", false},
+		{"json number", "env-a/db.json", "port", "5432", false},
+		{"env file", "env-a/app.env", "TOKEN", "env-secret", false},
+		{"single value", "env-a/single", "", "single-secret", false},
+		{"file of other env", "env-b/db.json", "password", "", true},
+		{"path traversal", "env-a/../env-b/db.json", "password", "", true},
+		{"outside of dir", "../etc/passwd", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve("env-a", "file", filepath.Join(dir, tt.path), tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveKubeNamespace(t *testing.T) {
+	Register(KubeSecretS{})
+
+	// secrets of other namespaces are rejected before cluster is called
+	for _, path := range []string{"timoni/core-secret", "env-b/db", "env-a"} {
+		if _, err := Resolve("env-a", "k8s-secret", path, "password"); err == nil {
+			t.Errorf("Resolve(%q) expected error", path)
+		}
+	}
+}
+
+func TestResolveProviderNotFound(t *testing.T) {
+	if _, err := Resolve("env-a", "unknown", "x", ""); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("Resolve() error = %v, want ErrProviderNotFound", err)
+	}
+}
@@ -0,0 +1,274 @@
+package secretsource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"lib/utils/random"
+)
+
+// VaultS reads secrets using Vault HTTP API, both KV v1 and v2 engines are
+// supported (v2 paths contain `/data/`). Leases of dynamic secrets are renewed.
+// Only paths under AllowedPaths can be read, `{env}` is replaced by env ID.
+type VaultS struct {
+	Addr         string
+	Token        string
+	AllowedPaths []string
+
+	client *http.Client
+}
+
+func NewVault(addr, token string) *VaultS {
+	return &VaultS{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *VaultS) Name() string {
+	return "vault"
+}
+
+func (v *VaultS) CheckPath(path, namespace string) error {
+	clean := strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	if clean != strings.Trim(path, "/") || !pathAllowed(clean, v.AllowedPaths, namespace) {
+		return errors.New("vault path is not allowed: " + path)
+	}
+	return nil
+}
+
+type vaultResponseS struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int             `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Errors        []string        `json:"errors"`
+}
+
+func (v *VaultS) Read(path string) (*SecretS, error) {
+	res := &vaultResponseS{}
+	if err := v.call(http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), nil, res); err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return nil, err
+	}
+
+	// KV v2 keeps values in data.data
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	secret := &SecretS{
+		Data:      map[string]string{},
+		LeaseID:   res.LeaseID,
+		LeaseTTL:  time.Duration(res.LeaseDuration) * time.Second,
+		Renewable: res.Renewable,
+	}
+	for k, val := range data {
+		switch x := val.(type) {
+		case string:
+			secret.Data[k] = x
+		default:
+			buf, _ := json.Marshal(x)
+			secret.Data[k] = string(buf)
+		}
+	}
+	return secret, nil
+}
+
+func (v *VaultS) Renew(secret *SecretS) (time.Duration, error) {
+	res := &vaultResponseS{}
+	err := v.call(http.MethodPut, "/v1/sys/leases/renew", map[string]any{
+		"lease_id":  secret.LeaseID,
+		"increment": int(secret.LeaseTTL.Seconds()),
+	}, res)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res.LeaseDuration) * time.Second, nil
+}
+
+func (v *VaultS) call(method, path string, req any, res *vaultResponseS) error {
+	var body *bytes.Reader
+	if req != nil {
+		buf, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	httpReq, err := http.NewRequest(method, v.Addr+path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("X-Vault-Token", v.Token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := v.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	json.NewDecoder(httpRes.Body).Decode(res)
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault %s %s: status %d %v", method, path, httpRes.StatusCode, res.Errors)
+	}
+	return nil
+}
+
+// ---
+
+// VaultStandIn is minimal in-memory Vault server for local development and tests.
+// It serves KV v1/v2 reads and writes, dynamic secrets with leases and lease renewal.
+type VaultStandIn struct {
+	Token string
+
+	mu      sync.Mutex
+	secrets map[string]*standInSecretS // key=path without /v1/
+	leases  map[string]string          // key=lease id, value=path
+}
+
+type standInSecretS struct {
+	data     map[string]any
+	version  int
+	leaseTTL int // seconds, >0 for dynamic secrets
+}
+
+func NewVaultStandIn(token string) *VaultStandIn {
+	return &VaultStandIn{
+		Token:   token,
+		secrets: map[string]*standInSecretS{},
+		leases:  map[string]string{},
+	}
+}
+
+// Put stores new version of secret at path, leaseTTL > 0 makes it dynamic secret with lease.
+func (s *VaultStandIn) Put(path string, data map[string]any, leaseTTL time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path = strings.Trim(path, "/")
+	sec := s.secrets[path]
+	if sec == nil {
+		sec = &standInSecretS{}
+		s.secrets[path] = sec
+	}
+	sec.data = data
+	sec.version++
+	sec.leaseTTL = int(leaseTTL.Seconds())
+}
+
+func (s *VaultStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if s.Token != "" && r.Header.Get("X-Vault-Token") != s.Token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+
+	if path == "sys/leases/renew" {
+		req := struct {
+			LeaseID   string `json:"lease_id"`
+			Increment int    `json:"increment"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		s.mu.Lock()
+		secPath, ok := s.leases[req.LeaseID]
+		sec := s.secrets[secPath]
+		s.mu.Unlock()
+
+		if !ok || sec == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"lease not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"lease_id":       req.LeaseID,
+			"lease_duration": sec.leaseTTL,
+			"renewable":      true,
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		req := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(path, "/data/") {
+			req, _ = req["data"].(map[string]any)
+		}
+		s.Put(path, req, 0)
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	case http.MethodGet:
+		s.mu.Lock()
+		sec := s.secrets[path]
+		var data map[string]any
+		if sec != nil {
+			data, _ = copyData(sec.data)
+		}
+		s.mu.Unlock()
+
+		if sec == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {}})
+			return
+		}
+
+		res := map[string]any{
+			"data": data,
+		}
+		if strings.Contains(path, "/data/") {
+			res["data"] = map[string]any{
+				"data": data,
+				"metadata": map[string]any{
+					"version": sec.version,
+				},
+			}
+		}
+		if sec.leaseTTL > 0 {
+			leaseID := path + "/" + random.String(12)
+			s.mu.Lock()
+			s.leases[leaseID] = path
+			s.mu.Unlock()
+
+			res["lease_id"] = leaseID
+			res["lease_duration"] = sec.leaseTTL
+			res["renewable"] = true
+		}
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+func copyData(in map[string]any) (map[string]any, error) {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	return out, json.Unmarshal(buf, &out)
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"core/db2"
+	"lib/tlog"
+	"lib/utils/random"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var reServiceAccountName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+
+// ServiceAccountEmail returns email of service account, it is never a real
+// mailbox, only identifies account in events and team members lists
+func ServiceAccountEmail(name string) string {
+	return name + "@service-account." + db2.TheDomain.Name()
+}
+
+// ServiceAccountCreate creates non-human user, it can't log in and uses only
+// API tokens
+func ServiceAccountCreate(name string, user *UserS) (*UserS, *tlog.RecordS) {
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !reServiceAccountName.MatchString(name) {
+		return nil, tlog.Error("invalid service account name, use lowercase letters, digits and '-'")
+	}
+
+	email := ServiceAccountEmail(name)
+	if GetUserByEmail(email) != nil {
+		return nil, tlog.Error("service account already exists")
+	}
+
+	sa := &UserS{
+		Email:              email,
+		Name:               name,
+		CreatedTimeStamp:   time.Now().UTC().Unix(),
+		CreatedByUserID:    user.ID,
+		CreatedByUserEmail: user.Email,
+		Theme:              "light",
+		GitToken:           random.ID(),
+		Activated:          true,
+		ServiceAccount:     true,
+	}
+	sa.Save() // save generates ID
+	UserMapID.Set(sa.ID, sa)
+	UserMapEmail.Set(email, sa)
+
+	tlog.Info("service account created", tlog.Vars{
+		"service-account": email,
+		"user":            user.Email,
+		"event":           true,
+	})
+	return sa, nil
+}
+
+// ServiceAccountList returns service accounts sorted by name
+func ServiceAccountList() []*UserS {
+	userUpdateMap(true)
+	res := []*UserS{}
+	for _, u := range UserMapID.Values() {
+		if u.ServiceAccount {
+			res = append(res, u)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// ServiceAccountDelete revokes tokens of service account, removes it from
+// teams and deletes it
+func ServiceAccountDelete(sa *UserS, user *UserS) *tlog.RecordS {
+
+	if !sa.ServiceAccount {
+		return tlog.Error("user is not a service account")
+	}
+
+	APITokensRevokeByUser(sa.ID, user)
+	RoleBindingsDeleteBySubject("", sa.ID, user)
+	for _, tID := range sa.Teams.List() {
+		if t := TeamMap.Get(tID); t != nil {
+			t.RemoveUser(sa)
+		}
+	}
+
+	sa.Delete()
+	UserMapID.Delete(sa.ID)
+	UserMapEmail.Delete(strings.ToLower(sa.Email))
+
+	tlog.Info("service account deleted", tlog.Vars{
+		"service-account": sa.Email,
+		"user":            user.Email,
+		"event":           true,
+	})
+	return nil
+}
@@ -69,6 +69,16 @@ func SessionsAllLoad() *maps.SafeMap[string, SessionObjectS] {
 	return sess
 }
 
+// SessionsDeleteByUser logs out user from all devices
+func SessionsDeleteByUser(userID string) {
+	for _, sess := range SessionMap.Values() {
+		if sess.UserID == userID {
+			SessionMap.Delete(sess.ID)
+		}
+	}
+	SessionsAllSave()
+}
+
 func SessionsAllDelete() {
 	SessionMap = maps.New[string, SessionObjectS](nil).Safe()
 	SessionsAllSave()
@@ -0,0 +1,551 @@
+package db
+
+import (
+	"context"
+	"core/db/envelope"
+	"core/db2"
+	"core/db2/fp"
+	"core/sso"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lib/tlog"
+	"lib/utils/random"
+	"lib/utils/slice"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SSOProviderS is identity provider of organization, users log in by OIDC or
+// SAML instead of email and TOTP token. Groups of identity provider are
+// mapped to teams, users are created on first login and blocked when
+// identity provider disables them (OIDC refresh token is rejected).
+// Identity provider can't be asked about SAML users, their sessions end
+// with SessionNotOnOrAfter of assertion or SessionHours.
+type SSOProviderS struct {
+	ID             string
+	OrganizationID string
+	Name           string // shown on login page
+	Variant        string // oidc, saml
+	Enabled        bool
+	EmailDomains   []string          // allowed email domains, empty = all
+	TeamMapping    map[string]string // group of identity provider: team name
+	Deprovision    bool              // block users disabled by identity provider and remove them from mapped teams
+	SessionHours   int               // max session time, default 24 h
+
+	OIDC sso.OIDCS // ClientSecret is sealed
+	SAML sso.SAMLS // PrivateKey is sealed
+
+	UpdateTime int64
+	UserEmail  string
+}
+
+// SSOUserS links user with identity of SSO provider, key=user ID
+type SSOUserS struct {
+	UserID       string
+	ProviderID   string
+	Subject      string
+	Groups       []string
+	RefreshToken string // sealed, OIDC only
+	Disabled     bool   // deprovisioned, user is in Blacklisted team
+	LoginTime    int64
+	SyncTime     int64
+}
+
+const ssoSyncInterval = 15 * time.Minute
+
+// SSOBaseURL returns external URL of API used in redirects of identity providers
+func SSOBaseURL() string {
+	if port := db2.TheDomain.Port(); port != 443 && port != 0 {
+		return fmt.Sprintf("https://%s:%d", db2.TheDomain.Name(), port)
+	}
+	return "https://" + db2.TheDomain.Name()
+}
+
+func ssoProviderOpen(p *SSOProviderS) *SSOProviderS {
+	if p.OIDC.ClientSecret != "" {
+		p.OIDC.ClientSecret = envelope.MustOpen(p.OIDC.ClientSecret)
+	}
+	if p.SAML.PrivateKey != "" {
+		p.SAML.PrivateKey = envelope.MustOpen(p.SAML.PrivateKey)
+	}
+	return p
+}
+
+// SSOProviderGet returns provider with plain secrets
+func SSOProviderGet(id string) *SSOProviderS {
+	p := &SSOProviderS{}
+	if err := driver.Read("sso-provider", id, p); err != nil {
+		return nil
+	}
+	return ssoProviderOpen(p)
+}
+
+// SSOProviderList returns providers of organization sorted by name
+func SSOProviderList(organizationID string) []*SSOProviderS {
+	res := []*SSOProviderS{}
+	list, err := driver.ReadAll("sso-provider")
+	if err != nil {
+		tlog.Error(err)
+		return res
+	}
+	for _, buf := range list {
+		p := &SSOProviderS{}
+		if err := json.Unmarshal(buf, p); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		if p.OrganizationID == organizationID {
+			res = append(res, ssoProviderOpen(p))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// SSOProviderForEmail returns enabled provider which must be used by users
+// with email domain, nil if email and TOTP token can be used
+func SSOProviderForEmail(email string) *SSOProviderS {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, p := range SSOProviderList(db2.TheOrganization.ID()) {
+		if p.Enabled && slice.Contains(p.EmailDomains, domain) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Front returns copy of provider with hidden secrets
+func (p *SSOProviderS) Front() SSOProviderS {
+	res := *p
+	if res.OIDC.ClientSecret != "" {
+		res.OIDC.ClientSecret = "{{ secret }}"
+	}
+	if res.SAML.PrivateKey != "" {
+		res.SAML.PrivateKey = "{{ secret }}"
+	}
+	p.setURLs(&res)
+	return res
+}
+
+func (p *SSOProviderS) setURLs(res *SSOProviderS) {
+	res.OIDC.RedirectURL = SSOBaseURL() + "/api/sso-callback"
+	res.SAML.EntityID = SSOBaseURL() + "/api/sso-saml-metadata?id=" + url.QueryEscape(p.ID)
+	res.SAML.ACSURL = SSOBaseURL() + "/api/sso-saml-acs"
+}
+
+// Provider returns OIDC or SAML implementation
+func (p *SSOProviderS) Provider() (sso.Provider, *tlog.RecordS) {
+	x := *p
+	p.setURLs(&x)
+	switch p.Variant {
+	case sso.VariantOIDC:
+		return &x.OIDC, nil
+	case sso.VariantSAML:
+		return &x.SAML, nil
+	}
+	return nil, tlog.Error("unknown SSO variant: " + p.Variant)
+}
+
+// SAMLMetadata returns XML metadata of Timoni as SAML service provider
+func (p *SSOProviderS) SAMLMetadata() ([]byte, *tlog.RecordS) {
+	if p.Variant != sso.VariantSAML {
+		return nil, tlog.Error("provider is not SAML")
+	}
+	x := *p
+	p.setURLs(&x)
+	buf, err := x.SAML.Metadata()
+	if err != nil {
+		return nil, tlog.Error(err)
+	}
+	return buf, nil
+}
+
+// Save validates and stores provider, secrets equal to `{{ secret }}` are
+// kept from previous version, SAML certificate is generated when empty.
+func (p *SSOProviderS) Save(user *UserS) *tlog.RecordS {
+
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return tlog.Error("name is required")
+	}
+	var old *SSOProviderS
+	if p.ID == "" {
+		p.ID = random.ID()
+	} else if old = SSOProviderGet(p.ID); old == nil {
+		return tlog.Error("SSO provider not found: " + p.ID)
+	}
+	if p.OrganizationID == "" {
+		p.OrganizationID = db2.TheOrganization.ID()
+	}
+	if p.SessionHours < 0 {
+		return tlog.Error("session hours must be positive")
+	}
+	for i, domain := range p.EmailDomains {
+		p.EmailDomains[i] = strings.ToLower(strings.TrimSpace(domain))
+	}
+	for group, teamName := range p.TeamMapping {
+		if teamName == BlacklistedTeamName {
+			return tlog.Error("group can't be mapped to team " + BlacklistedTeamName)
+		}
+		if GetTeamByName(teamName) == nil {
+			return tlog.Error("team not found: " + teamName + " (group " + group + ")")
+		}
+	}
+
+	if old != nil && old.OrganizationID != p.OrganizationID {
+		return tlog.Error("provider belongs to other organization")
+	}
+	if old != nil {
+		if p.OIDC.ClientSecret == "{{ secret }}" {
+			p.OIDC.ClientSecret = old.OIDC.ClientSecret
+		}
+		if p.SAML.PrivateKey == "{{ secret }}" {
+			p.SAML.PrivateKey = old.SAML.PrivateKey
+		}
+	}
+
+	switch p.Variant {
+	case sso.VariantOIDC:
+		if err := p.OIDC.Check(); err != nil {
+			return tlog.Error(err)
+		}
+		p.SAML = sso.SAMLS{}
+	case sso.VariantSAML:
+		if p.SAML.Certificate == "" {
+			cert, key, err := sso.GenerateCertificate(db2.TheDomain.Name())
+			if err != nil {
+				return tlog.Error(err)
+			}
+			p.SAML.Certificate = cert
+			p.SAML.PrivateKey = key
+		}
+		if err := p.SAML.Check(); err != nil {
+			return tlog.Error(err)
+		}
+		p.OIDC = sso.OIDCS{}
+	default:
+		return tlog.Error("unknown SSO variant: " + p.Variant)
+	}
+
+	stored := *p
+	stored.OIDC.RedirectURL = ""
+	stored.SAML.EntityID = ""
+	stored.SAML.ACSURL = ""
+	if stored.OIDC.ClientSecret != "" {
+		stored.OIDC.ClientSecret = envelope.MustSeal(stored.OIDC.ClientSecret)
+	}
+	if stored.SAML.PrivateKey != "" {
+		stored.SAML.PrivateKey = envelope.MustSeal(stored.SAML.PrivateKey)
+	}
+	stored.UpdateTime = time.Now().UTC().Unix()
+	stored.UserEmail = user.Email
+
+	if err := driver.Write("sso-provider", p.ID, stored); err != nil {
+		return tlog.Error(err)
+	}
+
+	tlog.Info("SSO provider saved", tlog.Vars{
+		"provider": p.Name,
+		"variant":  p.Variant,
+		"enabled":  p.Enabled,
+		"user":     user.Email,
+		"event":    true,
+	})
+	return nil
+}
+
+// Delete removes provider, linked users can log in by email and TOTP token
+func (p *SSOProviderS) Delete(user *UserS) *tlog.RecordS {
+	if err := driver.Delete("sso-provider", p.ID); err != nil {
+		return tlog.Error(err)
+	}
+	for _, link := range ssoUserList() {
+		if link.ProviderID == p.ID {
+			tlog.Error(driver.Delete("sso-user", link.UserID))
+		}
+	}
+
+	tlog.Info("SSO provider deleted", tlog.Vars{
+		"provider": p.Name,
+		"user":     user.Email,
+		"event":    true,
+	})
+	return nil
+}
+
+// --------------------------------------------------
+
+func ssoUserGet(userID string) *SSOUserS {
+	link := &SSOUserS{}
+	if err := driver.Read("sso-user", userID, link); err != nil {
+		return nil
+	}
+	return link
+}
+
+func ssoUserList() []*SSOUserS {
+	res := []*SSOUserS{}
+	list, err := driver.ReadAll("sso-user")
+	if err != nil {
+		tlog.Error(err)
+		return res
+	}
+	for _, buf := range list {
+		link := &SSOUserS{}
+		if err := json.Unmarshal(buf, link); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		res = append(res, link)
+	}
+	return res
+}
+
+func (link *SSOUserS) save() {
+	tlog.Error(driver.Write("sso-user", link.UserID, link))
+}
+
+// SSOUserManaged returns true if user must log in by SSO provider
+func SSOUserManaged(user *UserS) bool {
+	link := ssoUserGet(user.ID)
+	if link == nil {
+		return false
+	}
+	p := SSOProviderGet(link.ProviderID)
+	return p != nil && p.Enabled
+}
+
+// syncTeams adds user to teams of groups and removes from other mapped teams
+func (p *SSOProviderS) syncTeams(user *UserS, groups []string) {
+	member := map[string]bool{}
+	for group, teamName := range p.TeamMapping {
+		member[teamName] = member[teamName] || slice.Contains(groups, group)
+	}
+
+	for teamName, in := range member {
+		team := GetTeamByName(teamName)
+		if team == nil {
+			tlog.Warning("SSO team mapping: team not found", tlog.Vars{
+				"provider": p.Name,
+				"team":     teamName,
+			})
+			continue
+		}
+		switch {
+		case in && !user.Teams.Exists(team.ID):
+			team.AddUser(user)
+		case !in && user.Teams.Exists(team.ID):
+			team.RemoveUser(user)
+		default:
+			continue
+		}
+		tlog.Info("SSO team membership changed", tlog.Vars{
+			"provider": p.Name,
+			"team":     teamName,
+			"member":   in,
+			"user":     user.Email,
+			"event":    true,
+		})
+	}
+}
+
+// Login provisions user confirmed by identity provider: creates user on
+// first login, updates team membership by groups, unblocks deprovisioned user.
+func (p *SSOProviderS) Login(identity *sso.IdentityS) (*UserS, *tlog.RecordS) {
+
+	email := strings.ToLower(identity.Email)
+	if !reEmail.MatchString(email) {
+		return nil, tlog.Error("invalid email address: " + email)
+	}
+	if strings.Split(email, "@")[0] == "default" {
+		return nil, tlog.Error("email can not be 'default'")
+	}
+	if len(p.EmailDomains) > 0 && !slice.Contains(p.EmailDomains, email[strings.LastIndex(email, "@")+1:]) {
+		return nil, tlog.Error("email domain is not allowed: " + email)
+	}
+
+	user := GetUserByEmail(email)
+	if user == nil {
+		user = &UserS{
+			Email:               email,
+			Name:                email,
+			CreatedTimeStamp:    time.Now().UTC().Unix(),
+			CreatedGitRepoLimit: 0,
+			Theme:               "light",
+			GitToken:            random.ID(),
+			TotpIssuer:          db2.TheSettings.Name(),
+			Activated:           true,
+		}
+		if identity.Name != "" {
+			user.Name = identity.Name
+		}
+		user.Save() // save generates ID
+
+		isAdmin := false
+		if org := fp.OrganizationGetByID(p.OrganizationID); !org.NotValid() {
+			for _, admin := range org.Admins().Iter() {
+				if email == admin.Email() {
+					GetTeamByName(AdminTeamName).AddUser(user)
+					isAdmin = true
+					break
+				}
+			}
+		}
+
+		tlog.Info("SSO user created", tlog.Vars{
+			"provider": p.Name,
+			"user":     email,
+			"admin":    isAdmin,
+			"event":    true,
+		})
+	}
+
+	if user.ServiceAccount {
+		return nil, tlog.Error("service account can not log in")
+	}
+
+	link := ssoUserGet(user.ID)
+	if link != nil && link.ProviderID != p.ID && SSOProviderGet(link.ProviderID) != nil {
+		return nil, tlog.Error("user is managed by other SSO provider")
+	}
+	if link != nil && link.ProviderID == p.ID && link.Subject != identity.Subject {
+		return nil, tlog.Error("user is linked with other identity of SSO provider")
+	}
+	if link == nil || link.ProviderID != p.ID {
+		link = &SSOUserS{
+			UserID:     user.ID,
+			ProviderID: p.ID,
+			Subject:    identity.Subject,
+		}
+	}
+
+	if blacklisted := GetTeamByName(BlacklistedTeamName); blacklisted != nil && user.Teams.Exists(blacklisted.ID) {
+		if !link.Disabled {
+			return nil, tlog.Error("user is blacklisted")
+		}
+		blacklisted.RemoveUser(user)
+		tlog.Info("SSO user enabled", tlog.Vars{
+			"provider": p.Name,
+			"user":     email,
+			"event":    true,
+		})
+	}
+	link.Disabled = false
+
+	link.Groups = identity.Groups
+	link.RefreshToken = ""
+	if identity.RefreshToken != "" {
+		link.RefreshToken = envelope.MustSeal(identity.RefreshToken)
+	}
+	link.LoginTime = time.Now().UTC().Unix()
+	link.SyncTime = link.LoginTime
+	link.save()
+
+	p.syncTeams(user, identity.Groups)
+
+	if !user.Activated {
+		user.Activated = true
+		user.Save()
+	}
+	return user, nil
+}
+
+// SessionExpires returns end of session created by SSO login
+func (p *SSOProviderS) SessionExpires(identity *sso.IdentityS) time.Time {
+	hours := p.SessionHours
+	if hours == 0 {
+		hours = 24
+	}
+	res := time.Now().Add(time.Duration(hours) * time.Hour)
+	if !identity.Expires.IsZero() && identity.Expires.Before(res) {
+		res = identity.Expires
+	}
+	return res
+}
+
+// deprovision blocks user disabled by identity provider
+func (p *SSOProviderS) deprovision(user *UserS, link *SSOUserS, reason string) {
+	for _, teamName := range p.TeamMapping {
+		if team := GetTeamByName(teamName); team != nil && user.Teams.Exists(team.ID) {
+			team.RemoveUser(user)
+		}
+	}
+	if blacklisted := GetTeamByName(BlacklistedTeamName); blacklisted != nil {
+		blacklisted.AddUser(user)
+	}
+	SessionsDeleteByUser(user.ID)
+
+	link.Disabled = true
+	link.RefreshToken = ""
+	link.SyncTime = time.Now().UTC().Unix()
+	link.save()
+
+	tlog.Info("SSO user deprovisioned", tlog.Vars{
+		"provider": p.Name,
+		"user":     user.Email,
+		"reason":   reason,
+		"event":    true,
+	})
+}
+
+// SSOSyncLoop checks users of OIDC providers by refresh tokens, updates
+// their teams and deprovisions users disabled by identity provider
+func SSOSyncLoop() {
+	for {
+		time.Sleep(ssoSyncInterval)
+		ssoSync()
+	}
+}
+
+func ssoSync() {
+	providers := map[string]*SSOProviderS{}
+
+	for _, link := range ssoUserList() {
+		if link.Disabled || link.RefreshToken == "" {
+			continue
+		}
+		p, ok := providers[link.ProviderID]
+		if !ok {
+			p = SSOProviderGet(link.ProviderID)
+			providers[link.ProviderID] = p
+		}
+		if p == nil || !p.Enabled || p.Variant != sso.VariantOIDC {
+			continue
+		}
+		user := GetUserByID(link.UserID)
+		if user == nil {
+			continue
+		}
+
+		o := p.OIDC
+		o.RedirectURL = SSOBaseURL() + "/api/sso-callback"
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		identity, err := o.Refresh(ctx, envelope.MustOpen(link.RefreshToken))
+		cancel()
+
+		if errors.Is(err, sso.ErrUserDisabled) {
+			if p.Deprovision {
+				p.deprovision(user, link, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			tlog.Warning("SSO refresh failed", tlog.Vars{
+				"provider": p.Name,
+				"user":     user.Email,
+				"error":    err.Error(),
+			})
+			continue
+		}
+
+		link.Groups = identity.Groups
+		link.RefreshToken = envelope.MustSeal(identity.RefreshToken)
+		link.SyncTime = time.Now().UTC().Unix()
+		link.save()
+
+		p.syncTeams(user, identity.Groups)
+	}
+}
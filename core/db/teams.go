@@ -85,6 +85,7 @@ func (t *Team) Delete() {
 	}
 
 	TeamMap.Delete(t.ID)
+	RoleBindingsDeleteBySubject(t.ID, "", nil)
 }
 
 func LoadTeams() {
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"core/config"
+	"encoding/json"
+	"lib/tlog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TermSessionS is web terminal session, output of session is recorded as
+// asciicast v2 in TermSessionS.RecordingPath()
+type TermSessionS struct {
+	ID          string
+	UserID      string
+	UserEmail   string
+	UserIP      string
+	EnvID       string
+	ElementName string
+	Pod         string
+	Container   string
+
+	StartTime int64
+	EndTime   int64  // 0 = session is open
+	EndReason string // closed, idle-timeout, error, ...
+	BytesIn   int64  // keyboard -> pod
+	BytesOut  int64  // pod -> terminal
+}
+
+func termRecordingDir() string {
+	return filepath.Join(config.DataPath(), "term-recording")
+}
+
+func (s *TermSessionS) RecordingPath() string {
+	return filepath.Join(termRecordingDir(), s.ID+".cast")
+}
+
+func (s *TermSessionS) Save() *tlog.RecordS {
+	if err := driver.Write("term-session", s.ID, s); err != nil {
+		return tlog.Error(err)
+	}
+	return nil
+}
+
+func TermSessionGet(id string) *TermSessionS {
+	s := &TermSessionS{}
+	if id == "" || driver.Read("term-session", id, s) != nil {
+		return nil
+	}
+	return s
+}
+
+// TermSessionList returns sessions of environment, newest first
+func TermSessionList(envID string) []*TermSessionS {
+	res := []*TermSessionS{}
+	list, err := driver.ReadAll("term-session")
+	if err != nil {
+		tlog.Error(err)
+		return res
+	}
+	for _, buf := range list {
+		s := &TermSessionS{}
+		if err := json.Unmarshal(buf, s); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		if envID == "" || s.EnvID == envID {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartTime > res[j].StartTime })
+	return res
+}
+
+func (s *TermSessionS) delete() {
+	if err := os.Remove(s.RecordingPath()); err != nil && !os.IsNotExist(err) {
+		tlog.Error(err)
+	}
+	tlog.Error(driver.Delete("term-session", s.ID))
+}
+
+// TermSessionCleanupLoop removes recordings older than config.TermRecordingDays
+func TermSessionCleanupLoop() {
+	for {
+		days, _ := strconv.Atoi(config.TermRecordingDays())
+		if days > 0 {
+			limit := time.Now().AddDate(0, 0, -days).Unix()
+			for _, s := range TermSessionList("") {
+				if s.EndTime > 0 && s.EndTime < limit {
+					s.delete()
+				}
+			}
+		}
+		time.Sleep(6 * time.Hour)
+	}
+}
+
+// TermSessionsCloseOrphaned marks sessions open during restart as closed
+func TermSessionsCloseOrphaned() {
+	for _, s := range TermSessionList("") {
+		if s.EndTime == 0 {
+			s.EndTime = time.Now().Unix()
+			s.EndReason = "server restart"
+			tlog.Error(s.Save())
+		}
+	}
+}
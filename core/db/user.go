@@ -34,6 +34,11 @@ type UserS struct {
 	LastActionTimeStamp int64
 	Logout              int8
 	Teams               *set.Set[string]
+	ServiceAccount      bool
+
+	// Token is set when request is authenticated by API token, permissions
+	// of user are limited to permissions of token
+	Token *APITokenS `json:"-"`
 
 	LastVisited *maps.SafeMap[string, int64] // env-id: timestamp
 }
@@ -228,18 +233,16 @@ func (user *UserS) GetKubeName() string {
 }
 
 func (user *UserS) HasGlobPerm(perm permissions.GlobPerm) bool {
-	mask := permissions.Mask(0)
-	for _, tID := range user.Teams.List() {
-		team := TeamMap.Get(tID)
-		if team == nil {
-			continue
-		}
-		mask.Join(team.Permissions.Global)
-	}
-	return bitmap.GetBit(mask, perm)
+	return user.evalPerm(permGlobal, "", nil, "", uint8(perm), nil)
 }
 
 func (user *UserS) HasEnvPerm(envID string, perm permissions.EnvPerm) bool {
+	return user.HasElementPerm(envID, "", perm)
+}
+
+// HasElementPerm checks permission to element of environment, it includes
+// role bindings limited to this element
+func (user *UserS) HasElementPerm(envID, elementName string, perm permissions.EnvPerm) bool {
 	if envID == "" {
 		return false
 	}
@@ -249,20 +252,7 @@ func (user *UserS) HasEnvPerm(envID string, perm permissions.EnvPerm) bool {
 		return false
 	}
 
-	mask := permissions.Mask(0)
-	for _, tID := range user.Teams.List() {
-		team := TeamMap.Get(tID)
-		if team == nil {
-			continue
-		}
-		for _, tag := range env.Tags.List() {
-			mask.Join(team.Permissions.Envs[tag])
-		}
-		// join glob env permissions
-		mask.Join(team.Permissions.Envs["id:*"])
-	}
-
-	return bitmap.GetBit(mask, perm)
+	return user.evalPerm(permEnv, env.ID, env.Tags.List(), elementName, uint8(perm), nil)
 }
 
 func (user *UserS) HasRepoPerm(repoName string, perm permissions.RepoPerm) bool {
@@ -275,19 +265,7 @@ func (user *UserS) HasRepoPerm(repoName string, perm permissions.RepoPerm) bool
 		return false
 	}
 
-	mask := permissions.Mask(0)
-	for _, tID := range user.Teams.List() {
-		team := TeamMap.Get(tID)
-		if team == nil {
-			continue
-		}
-		for _, tag := range repo.Tags.List() {
-			mask.Join(team.Permissions.GitRepos[tag])
-		}
-		// join glob repo permissions
-		mask.Join(team.Permissions.GitRepos["id:*"])
-	}
-	return bitmap.GetBit(mask, perm)
+	return user.evalPerm(permRepo, repo.Name, repo.Tags.List(), "", uint8(perm), nil)
 }
 
 // returns map[string]PermToFront
@@ -299,12 +277,10 @@ func (u *UserS) GetPerms() permissions.PermGroup {
 		return res
 	}
 
-	for _, tID := range u.Teams.List() {
-		t, ok := TeamMap.GetFull(tID)
-		if !ok {
-			continue
+	for _, perm := range permissions.GlobPerms() {
+		if u.HasGlobPerm(perm) {
+			bitmap.SetBit(&res.Global, perm)
 		}
-		res.Global |= t.Permissions.Global
 	}
 
 	return res
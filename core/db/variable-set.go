@@ -0,0 +1,288 @@
+package db
+
+import (
+	perms "core/db/permissions"
+	"encoding/json"
+	"lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VariableSetS is named set of variables owned by organization or team,
+// environments and elements import them by name. Precedence from lowest:
+// sets imported by environment, sets imported by element (in given order),
+// variables declared by element itself.
+type VariableSetS struct {
+	Name        string // uniq, used in `variable-sets = ["smtp"]`
+	Description string
+	TeamID      string // owner, empty = whole organization
+	Variables   map[string]*ElementVariableS
+
+	UpdateTime int64
+	UserEmail  string
+}
+
+type VariableSetUsageS struct {
+	EnvID   string
+	EnvName string
+	Element string
+}
+
+var VariableSetMap = maps.NewSafe[string, *VariableSetS](nil) // key=name
+
+func variableSetDependence(name string) string {
+	return "variable-set:" + name
+}
+
+func LoadVariableSets() {
+	VariableSetMap = maps.NewSafe[string, *VariableSetS](nil)
+	setsB, err := driver.ReadAll("variable-set")
+	if err != nil {
+		tlog.Error(err)
+		return
+	}
+	for _, buf := range setsB {
+		set := &VariableSetS{}
+		if err := json.Unmarshal(buf, set); err != nil {
+			tlog.Error(err)
+			continue
+		}
+		VariableSetMap.Set(set.Name, set)
+	}
+}
+
+// CanUseVariableSet returns true if user can import the set, organization
+// sets can be used by everyone, team sets by team members only.
+func (user *UserS) CanUseVariableSet(set *VariableSetS) bool {
+	if set == nil {
+		return false
+	}
+	if set.TeamID == "" || user.Teams.Exists(set.TeamID) {
+		return true
+	}
+	return user.HasGlobPerm(perms.Glob_ManageGlobalMemebers)
+}
+
+// CanManageVariableSet returns true if user can change or delete the set.
+func (user *UserS) CanManageVariableSet(set *VariableSetS) bool {
+	if user.HasGlobPerm(perms.Glob_ManageGlobalMemebers) {
+		return true
+	}
+	return set != nil && set.TeamID != "" && user.Teams.Exists(set.TeamID)
+}
+
+// Front returns copy of set with hidden secret values
+func (set *VariableSetS) Front() VariableSetS {
+	res := *set
+	res.Variables = map[string]*ElementVariableS{}
+	for name, v := range set.Variables {
+		x := *v
+		if x.Secret {
+			x.FirstValue = "{{ secret }}"
+			x.CurrentValue = "{{ secret }}"
+			x.ResolvedValue = "{{ secret }}"
+		}
+		res.Variables[name] = &x
+	}
+	return res
+}
+
+// Save validates and stores the set, elements using it are rendered again.
+// Secret values equal to `{{ secret }}` are kept from previous version of the set.
+func (set *VariableSetS) Save(user *UserS) ([]VariableSetUsageS, *tlog.RecordS) {
+
+	if !reSimpleName1.MatchString(set.Name) {
+		return nil, tlog.Error("variable set name contains characters that are not allowed: " + set.Name)
+	}
+	if set.TeamID != "" && TeamMap.Get(set.TeamID) == nil {
+		return nil, tlog.Error("team not found: " + set.TeamID)
+	}
+	if set.Variables == nil {
+		set.Variables = map[string]*ElementVariableS{}
+	}
+
+	old := VariableSetMap.Get(set.Name)
+	for name, v := range set.Variables {
+		if !regexVariableName.MatchString(name) {
+			return nil, tlog.Error("invalid variable name: " + name)
+		}
+		if err := v.Field.Check(); err != nil {
+			return nil, tlog.Error("variable " + name + ": " + err.Error())
+		}
+
+		v.System = false
+		v.Errors = nil
+		v.ErrorMessages = nil
+		v.VariableSet = ""
+
+		if !v.Secret {
+			continue
+		}
+		if v.CurrentValue == "{{ secret }}" || v.CurrentValue == "" {
+			if old != nil && old.Variables[name] != nil && old.Variables[name].Secret {
+				v.CurrentValue = old.Variables[name].CurrentValue
+			} else {
+				// same generated value for all elements importing the set
+				v.CurrentValue = RandString(24)
+			}
+		}
+		v.FirstValue = ""
+		v.ResolvedValue = ""
+	}
+
+	set.UpdateTime = time.Now().Unix()
+	set.UserEmail = user.Email
+
+	if err := driver.Write("variable-set", set.Name, set); err != nil {
+		return nil, tlog.Error(err)
+	}
+	VariableSetMap.Set(set.Name, set)
+
+	tlog.Info("variable set saved: {{set}}", tlog.Vars{
+		"set":   set.Name,
+		"user":  user.Email,
+		"event": true,
+	})
+
+	return VariableSetChanged(set.Name), nil
+}
+
+func (set *VariableSetS) Delete(user *UserS) *tlog.RecordS {
+	if err := driver.Delete("variable-set", set.Name); err != nil {
+		return tlog.Error(err)
+	}
+	VariableSetMap.Delete(set.Name)
+
+	tlog.Info("variable set deleted: {{set}}", tlog.Vars{
+		"set":   set.Name,
+		"user":  user.Email,
+		"event": true,
+	})
+
+	VariableSetChanged(set.Name)
+	return nil
+}
+
+// VariableSetAffected returns elements importing the set (directly or by environment).
+func VariableSetAffected(name string) []VariableSetUsageS {
+	res := []VariableSetUsageS{}
+	dep := variableSetDependence(name)
+
+	for _, key := range ElementMap.Keys() {
+		element := ElementMap.Get(key)
+		if element == nil || element.GetVariablesDependence() == nil {
+			continue
+		}
+		if _, ok := element.GetVariablesDependence().GetFull(dep); !ok {
+			continue
+		}
+
+		envID, elName, _ := strings.Cut(key, "/")
+		usage := VariableSetUsageS{
+			EnvID:   envID,
+			Element: elName,
+		}
+		if env := EnvironmentMap.Get(envID); env != nil {
+			usage.EnvName = env.Name
+		}
+		res = append(res, usage)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].EnvID != res[j].EnvID {
+			return res[i].EnvID < res[j].EnvID
+		}
+		return res[i].Element < res[j].Element
+	})
+	return res
+}
+
+// VariableSetChanged renders again environments with elements importing the set,
+// saved elements with changed values are applied to kube by kubesync.
+func VariableSetChanged(name string) []VariableSetUsageS {
+	affected := VariableSetAffected(name)
+
+	envs := map[string]bool{}
+	for _, usage := range affected {
+		if envs[usage.EnvID] {
+			continue
+		}
+		envs[usage.EnvID] = true
+
+		// all elements, also those referencing variables of affected elements
+		if env := EnvironmentMap.Get(usage.EnvID); env != nil {
+			env.ReRender("")
+		}
+	}
+
+	return affected
+}
+
+// importVariableSets replaces variables imported from sets with current
+// values of the sets. Variables declared by element are never overridden.
+func (element *elementS) importVariableSets() {
+
+	previous := map[string]*ElementVariableS{}
+	for name, v := range element.Variables {
+		if v.VariableSet != "" {
+			previous[name] = v
+			delete(element.Variables, name)
+		}
+	}
+
+	names := []string{}
+	if env := element.GetEnvironment(); env != nil {
+		names = append(names, env.VariableSets...)
+	}
+	names = append(names, element.VariableSets...)
+
+	imported := map[string]*ElementVariableS{}
+	for _, setName := range names {
+		set := VariableSetMap.Get(setName)
+		if set == nil {
+			tlog.Error("variable set not found", tlog.Vars{
+				"envID":   element.EnvironmentID,
+				"element": element.Name,
+				"set":     setName,
+			})
+			element.VariablesDependence.Set(variableSetDependence(setName), false)
+			continue
+		}
+		element.VariablesDependence.Set(variableSetDependence(setName), true)
+
+		for varName, v := range set.Variables {
+			x := *v
+			x.VariableSet = setName
+			x.FirstValue = x.CurrentValue
+			x.ResolvedValue = ""
+			if p, ok := previous[varName]; ok && p.VariableSet == setName {
+				// keep sealed value, so history is not changed when value is the same
+				x.ResolvedValue = p.ResolvedValue
+			}
+			imported[varName] = &x
+		}
+	}
+
+	for varName, v := range imported {
+		if _, ok := element.Variables[varName]; ok {
+			continue
+		}
+		element.Variables[varName] = v
+	}
+}
+
+// checkVariableSets returns error when user can't use sets imported by element
+func (element *elementS) checkVariableSets(user *UserS) *tlog.RecordS {
+	for _, name := range element.VariableSets {
+		set := VariableSetMap.Get(name)
+		if set == nil {
+			return tlog.Error("variable set not found: " + name)
+		}
+		if user != nil && !user.CanUseVariableSet(set) {
+			return tlog.Error("permission denied to variable set: " + name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"core/db/envelope"
+	"core/kube"
+	"lib/tlog"
+	"strings"
+	"time"
+)
+
+// VolumeBackupTargetS is S3 compatible storage where Longhorn exports element
+// snapshots made with `export`. Secret key is sealed with envelope encryption.
+type VolumeBackupTargetS struct {
+	URL        string // eg. s3://bucket@us-east-1/timoni, empty = export disabled
+	Endpoint   string // for S3 compatible storage, eg. https://minio.example.com
+	AccessKey  string
+	SecretKey  string
+	UpdateTime int64
+	UserEmail  string
+}
+
+func VolumeBackupTargetGet() *VolumeBackupTargetS {
+	res := &VolumeBackupTargetS{}
+	if err := driver.Read("volume-backup-target", "default", res); err != nil {
+		return nil
+	}
+	return res
+}
+
+// Front returns target with hidden secret key
+func (t *VolumeBackupTargetS) Front() VolumeBackupTargetS {
+	res := *t
+	if res.SecretKey != "" {
+		res.SecretKey = "{{ secret }}"
+	}
+	return res
+}
+
+// VolumeBackupTargetSave stores target and configures it in Longhorn, secret
+// key equal to `{{ secret }}` is kept from previously saved target
+func VolumeBackupTargetSave(t *VolumeBackupTargetS, user *UserS) *tlog.RecordS {
+
+	t.URL = strings.TrimSpace(t.URL)
+	if t.URL != "" && !strings.HasPrefix(t.URL, "s3://") {
+		return tlog.Error("backup target url must be like s3://bucket@region/path")
+	}
+
+	if t.SecretKey == "{{ secret }}" {
+		t.SecretKey = ""
+		if current := VolumeBackupTargetGet(); current != nil && current.SecretKey != "" {
+			key, err := envelope.Open(current.SecretKey)
+			if err != nil {
+				return tlog.Error("secret key of backup target could not be decrypted, check master key: {{error}}", tlog.Vars{
+					"error": err.Error(),
+				})
+			}
+			t.SecretKey = key
+		}
+	}
+	if t.URL != "" && (t.AccessKey == "" || t.SecretKey == "") {
+		return tlog.Error("access key and secret key are required")
+	}
+
+	if err := kube.GetKube().LonghornBackupTargetSet(t.URL, t.Endpoint, t.AccessKey, t.SecretKey); err != nil {
+		return err
+	}
+	// exported snapshots of envs on other clusters use the same target
+	for _, c := range kube.ClusterList() {
+		if kClient := kube.GetKubeCluster(c.Name); !c.Local && c.Enabled && kClient != nil {
+			kClient.LonghornBackupTargetSet(t.URL, t.Endpoint, t.AccessKey, t.SecretKey)
+		}
+	}
+
+	t.UpdateTime = time.Now().UTC().Unix()
+	t.UserEmail = user.Email
+	if t.SecretKey != "" {
+		t.SecretKey = envelope.MustSeal(t.SecretKey)
+	}
+	if err := driver.Write("volume-backup-target", "default", t); err != nil {
+		return tlog.Error(err)
+	}
+
+	tlog.Info("volume backup target saved", tlog.Vars{
+		"url":   t.URL,
+		"user":  user.Email,
+		"event": true,
+	})
+	return nil
+}
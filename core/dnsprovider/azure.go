@@ -0,0 +1,219 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const azureAPIVersion = "2018-05-01"
+
+type azureS struct {
+	Endpoint      string
+	LoginEndpoint string
+	settings      Settings
+
+	mu          sync.Mutex
+	token       string
+	tokenExpire time.Time
+}
+
+type azureRecordSetS struct {
+	Name       string `json:"name,omitempty"`
+	Type       string `json:"type,omitempty"` // Microsoft.Network/dnszones/TXT
+	Properties struct {
+		TTL         int                `json:"TTL"`
+		Fqdn        string             `json:"fqdn,omitempty"`
+		ARecords    []azureARecordS    `json:"ARecords,omitempty"`
+		CNAMERecord *azureCNAMERecordS `json:"CNAMERecord,omitempty"`
+		TXTRecords  []azureTXTRecordS  `json:"TXTRecords,omitempty"`
+	} `json:"properties"`
+}
+
+type azureARecordS struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type azureCNAMERecordS struct {
+	Cname string `json:"cname"`
+}
+
+type azureTXTRecordS struct {
+	Value []string `json:"value"`
+}
+
+func newAzure(settings Settings) (Provider, error) {
+	return &azureS{
+		Endpoint:      "https://management.azure.com",
+		LoginEndpoint: "https://login.microsoftonline.com",
+		settings:      settings,
+	}, nil
+}
+
+func (a *azureS) accessToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.tokenExpire) > time.Minute {
+		return a.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.settings["client_id"]},
+		"client_secret": {a.settings["client_secret"]},
+		"scope":         {a.Endpoint + "/.default"},
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		a.LoginEndpoint+"/"+a.settings["tenant_id"]+"/oauth2/v2.0/token",
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if _, err := call(req, &res); err != nil {
+		return "", err
+	}
+
+	a.token = res.AccessToken
+	a.tokenExpire = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+func (a *azureS) zone(zone string) string {
+	if a.settings["zone"] != "" {
+		return UnFqdn(a.settings["zone"])
+	}
+	return UnFqdn(zone)
+}
+
+func (a *azureS) zoneURL(zone string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s",
+		a.Endpoint,
+		a.settings["subscription_id"],
+		a.settings["resource_group"],
+		a.zone(zone),
+	)
+}
+
+func (a *azureS) recordURL(zone string, record RecordS) string {
+	return a.zoneURL(zone) + "/" + record.Type + "/" + RelativeName(record.Name, a.zone(zone)) + "?api-version=" + azureAPIVersion
+}
+
+func (a *azureS) call(method, url string, body, res any) (int, error) {
+	token, err := a.accessToken()
+	if err != nil {
+		return 0, err
+	}
+	req, err := newRequest(method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return call(req, res)
+}
+
+// values returns current values of record set, nil when it does not exist
+func (a *azureS) values(zone string, record RecordS) ([]string, error) {
+	rs := &azureRecordSetS{}
+	status, err := a.call(http.MethodGet, a.recordURL(zone, record), nil, rs)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rs.values(), nil
+}
+
+func (rs *azureRecordSetS) values() []string {
+	res := []string{}
+	for _, r := range rs.Properties.ARecords {
+		res = append(res, r.IPv4Address)
+	}
+	if rs.Properties.CNAMERecord != nil {
+		res = append(res, rs.Properties.CNAMERecord.Cname)
+	}
+	for _, r := range rs.Properties.TXTRecords {
+		res = append(res, strings.Join(r.Value, ""))
+	}
+	return res
+}
+
+func (a *azureS) put(zone string, record RecordS, values []string) error {
+	rs := azureRecordSetS{}
+	rs.Properties.TTL = record.ttl()
+	for _, v := range values {
+		switch record.Type {
+		case TypeA:
+			rs.Properties.ARecords = append(rs.Properties.ARecords, azureARecordS{IPv4Address: v})
+		case TypeCNAME:
+			rs.Properties.CNAMERecord = &azureCNAMERecordS{Cname: v}
+		case TypeTXT:
+			rs.Properties.TXTRecords = append(rs.Properties.TXTRecords, azureTXTRecordS{Value: []string{v}})
+		}
+	}
+	_, err := a.call(http.MethodPut, a.recordURL(zone, record), rs, nil)
+	return err
+}
+
+func (a *azureS) Upsert(zone string, record RecordS) error {
+	if err := record.Check(a.zone(zone)); err != nil {
+		return err
+	}
+	current, err := a.values(zone, record)
+	if err != nil {
+		return err
+	}
+	return a.put(zone, record, mergeValues(current, record))
+}
+
+func (a *azureS) Delete(zone string, record RecordS) error {
+	current, err := a.values(zone, record)
+	if err != nil || current == nil {
+		return err
+	}
+
+	values := removeValue(current, record)
+	if len(values) > 0 {
+		return a.put(zone, record, values)
+	}
+	_, err = a.call(http.MethodDelete, a.recordURL(zone, record), nil, nil)
+	return err
+}
+
+func (a *azureS) List(zone string) ([]RecordS, error) {
+	res := []RecordS{}
+	next := a.zoneURL(zone) + "/recordsets?api-version=" + azureAPIVersion
+	for next != "" {
+		page := struct {
+			Value    []azureRecordSetS `json:"value"`
+			NextLink string            `json:"nextLink"`
+		}{}
+		if _, err := a.call(http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, rs := range page.Value {
+			recordType := rs.Type[strings.LastIndex(rs.Type, "/")+1:]
+			for _, v := range rs.values() {
+				res = append(res, RecordS{
+					Type:  recordType,
+					Name:  AbsoluteName(rs.Name, a.zone(zone)),
+					Value: v,
+					TTL:   rs.Properties.TTL,
+				})
+			}
+		}
+		next = page.NextLink
+	}
+	return res, nil
+}
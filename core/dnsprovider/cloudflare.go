@@ -0,0 +1,167 @@
+package dnsprovider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type cloudflareS struct {
+	Endpoint string
+	settings Settings
+}
+
+type cloudflareRecordS struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+type cloudflareResponseS[T any] struct {
+	Success    bool `json:"success"`
+	Result     T    `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// newCloudflare uses API token, or global API key with email
+func newCloudflare(settings Settings) (Provider, error) {
+	if settings["token"] == "" && (settings["email"] == "" || settings["key"] == "") {
+		return nil, errors.New("cloudflare: `token` or `email` with `key` is required")
+	}
+	return &cloudflareS{
+		Endpoint: "https://api.cloudflare.com/client/v4",
+		settings: settings,
+	}, nil
+}
+
+func (c *cloudflareS) call(method, path string, body, res any) error {
+	req, err := newRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if c.settings["token"] != "" {
+		req.Header.Set("Authorization", "Bearer "+c.settings["token"])
+	} else {
+		req.Header.Set("X-Auth-Email", c.settings["email"])
+		req.Header.Set("X-Auth-Key", c.settings["key"])
+	}
+	_, err = call(req, res)
+	return err
+}
+
+func (c *cloudflareS) zoneID(zone string) (string, error) {
+	res := &cloudflareResponseS[[]struct {
+		ID string `json:"id"`
+	}]{}
+	if err := c.call(http.MethodGet, "/zones?name="+url.QueryEscape(UnFqdn(zone)), nil, res); err != nil {
+		return "", err
+	}
+	if len(res.Result) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+	}
+	return res.Result[0].ID, nil
+}
+
+func (c *cloudflareS) records(zoneID string, query url.Values) ([]cloudflareRecordS, error) {
+	records := []cloudflareRecordS{}
+	for page := 1; ; page++ {
+		query.Set("page", fmt.Sprint(page))
+		query.Set("per_page", "100")
+
+		res := &cloudflareResponseS[[]cloudflareRecordS]{}
+		if err := c.call(http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, res); err != nil {
+			return nil, err
+		}
+		records = append(records, res.Result...)
+		if page >= res.ResultInfo.TotalPages {
+			return records, nil
+		}
+	}
+}
+
+func (c *cloudflareS) Upsert(zone string, record RecordS) error {
+	if err := record.Check(zone); err != nil {
+		return err
+	}
+	zoneID, err := c.zoneID(zone)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.records(zoneID, url.Values{
+		"type": {record.Type},
+		"name": {UnFqdn(record.Name)},
+	})
+	if err != nil {
+		return err
+	}
+
+	body := cloudflareRecordS{
+		Type:    record.Type,
+		Name:    UnFqdn(record.Name),
+		Content: record.Value,
+		TTL:     record.ttl(),
+	}
+
+	for _, r := range existing {
+		if record.Type == TypeTXT && r.Content != record.Value {
+			continue
+		}
+		return c.call(http.MethodPut, "/zones/"+zoneID+"/dns_records/"+r.ID, body, nil)
+	}
+	return c.call(http.MethodPost, "/zones/"+zoneID+"/dns_records", body, nil)
+}
+
+func (c *cloudflareS) Delete(zone string, record RecordS) error {
+	zoneID, err := c.zoneID(zone)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"type": {record.Type},
+		"name": {UnFqdn(record.Name)},
+	}
+	if record.Value != "" {
+		query.Set("content", record.Value)
+	}
+	existing, err := c.records(zoneID, query)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range existing {
+		if err := c.call(http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+r.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cloudflareS) List(zone string) ([]RecordS, error) {
+	zoneID, err := c.zoneID(zone)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.records(zoneID, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	res := []RecordS{}
+	for _, r := range existing {
+		res = append(res, RecordS{
+			Type:  r.Type,
+			Name:  r.Name,
+			Value: r.Content,
+			TTL:   r.TTL,
+		})
+	}
+	return res, nil
+}
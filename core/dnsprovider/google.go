@@ -0,0 +1,283 @@
+package dnsprovider
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const googleScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+
+// googleS uses Cloud DNS API with service account key (JSON file content)
+type googleS struct {
+	Endpoint string
+	project  string
+	account  googleServiceAccountS
+	key      *rsa.PrivateKey
+
+	mu          sync.Mutex
+	token       string
+	tokenExpire time.Time
+}
+
+type googleServiceAccountS struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type googleRecordSetS struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	RRDatas []string `json:"rrdatas"`
+}
+
+func newGoogle(settings Settings) (Provider, error) {
+	g := &googleS{
+		Endpoint: "https://dns.googleapis.com/dns/v1",
+		project:  settings["project"],
+	}
+	if err := json.Unmarshal([]byte(settings["service_account_json"]), &g.account); err != nil {
+		return nil, fmt.Errorf("google: service_account_json: %w", err)
+	}
+	if g.account.TokenURI == "" {
+		g.account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(g.account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("google: private_key of service account is not valid PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("google: private_key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("google: private_key must be RSA key")
+	}
+	g.key = rsaKey
+	return g, nil
+}
+
+// accessToken exchanges signed JWT for OAuth2 access token
+func (g *googleS) accessToken() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.token != "" && time.Until(g.tokenExpire) > time.Minute {
+		return g.token, nil
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   g.account.ClientEmail,
+		"scope": googleScope,
+		"aud":   g.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	req, err := http.NewRequest(http.MethodPost, g.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if _, err := call(req, &res); err != nil {
+		return "", err
+	}
+
+	g.token = res.AccessToken
+	g.tokenExpire = now.Add(time.Duration(res.ExpiresIn) * time.Second)
+	return g.token, nil
+}
+
+func (g *googleS) call(method, path string, body, res any) error {
+	token, err := g.accessToken()
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(method, g.Endpoint+"/projects/"+url.PathEscape(g.project)+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	_, err = call(req, res)
+	return err
+}
+
+// managedZone returns name of managed zone with DNS name
+func (g *googleS) managedZone(zone string) (string, error) {
+	res := struct {
+		ManagedZones []struct {
+			Name string `json:"name"`
+		} `json:"managedZones"`
+	}{}
+	if err := g.call(http.MethodGet, "/managedZones?dnsName="+url.QueryEscape(Fqdn(zone)), nil, &res); err != nil {
+		return "", err
+	}
+	if len(res.ManagedZones) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+	}
+	return res.ManagedZones[0].Name, nil
+}
+
+func (g *googleS) recordSets(managedZone string, query url.Values) ([]googleRecordSetS, error) {
+	res := []googleRecordSetS{}
+	for {
+		page := struct {
+			RRSets        []googleRecordSetS `json:"rrsets"`
+			NextPageToken string             `json:"nextPageToken"`
+		}{}
+		if err := g.call(http.MethodGet, "/managedZones/"+managedZone+"/rrsets?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		res = append(res, page.RRSets...)
+		if page.NextPageToken == "" {
+			return res, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+func (g *googleS) current(managedZone string, record RecordS) (*googleRecordSetS, error) {
+	sets, err := g.recordSets(managedZone, url.Values{
+		"name": {Fqdn(record.Name)},
+		"type": {record.Type},
+	})
+	if err != nil || len(sets) == 0 {
+		return nil, err
+	}
+	return &sets[0], nil
+}
+
+func (rs googleRecordSetS) values() []string {
+	res := []string{}
+	for _, v := range rs.RRDatas {
+		if rs.Type == TypeTXT {
+			v = unquoteTXT(v)
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func (g *googleS) newRecordSet(record RecordS, ttl int, values []string) *googleRecordSetS {
+	rs := &googleRecordSetS{
+		Name: Fqdn(record.Name),
+		Type: record.Type,
+		TTL:  ttl,
+	}
+	for _, v := range values {
+		switch record.Type {
+		case TypeTXT:
+			v = quoteTXT(v)
+		case TypeCNAME:
+			v = Fqdn(v)
+		}
+		rs.RRDatas = append(rs.RRDatas, v)
+	}
+	return rs
+}
+
+// change replaces record set, deletions must be equal to current record set
+func (g *googleS) change(managedZone string, deletion, addition *googleRecordSetS) error {
+	body := map[string][]googleRecordSetS{}
+	if deletion != nil {
+		body["deletions"] = []googleRecordSetS{*deletion}
+	}
+	if addition != nil {
+		body["additions"] = []googleRecordSetS{*addition}
+	}
+	return g.call(http.MethodPost, "/managedZones/"+managedZone+"/changes", body, nil)
+}
+
+func (g *googleS) Upsert(zone string, record RecordS) error {
+	if err := record.Check(zone); err != nil {
+		return err
+	}
+	managedZone, err := g.managedZone(zone)
+	if err != nil {
+		return err
+	}
+	current, err := g.current(managedZone, record)
+	if err != nil {
+		return err
+	}
+
+	values := []string{}
+	if current != nil {
+		values = current.values()
+	}
+	return g.change(managedZone, current, g.newRecordSet(record, record.ttl(), mergeValues(values, record)))
+}
+
+func (g *googleS) Delete(zone string, record RecordS) error {
+	managedZone, err := g.managedZone(zone)
+	if err != nil {
+		return err
+	}
+	current, err := g.current(managedZone, record)
+	if err != nil || current == nil {
+		return err
+	}
+
+	values := removeValue(current.values(), record)
+	if len(values) > 0 {
+		return g.change(managedZone, current, g.newRecordSet(record, current.TTL, values))
+	}
+	return g.change(managedZone, current, nil)
+}
+
+func (g *googleS) List(zone string) ([]RecordS, error) {
+	managedZone, err := g.managedZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := g.recordSets(managedZone, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	res := []RecordS{}
+	for _, rs := range sets {
+		for _, v := range rs.values() {
+			res = append(res, RecordS{
+				Type:  rs.Type,
+				Name:  UnFqdn(rs.Name),
+				Value: v,
+				TTL:   rs.TTL,
+			})
+		}
+	}
+	return res, nil
+}
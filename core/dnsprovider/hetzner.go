@@ -0,0 +1,144 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type hetznerS struct {
+	Endpoint string
+	token    string
+}
+
+type hetznerRecordS struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"` // relative to zone
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl"`
+}
+
+func newHetzner(settings Settings) (Provider, error) {
+	return &hetznerS{
+		Endpoint: "https://dns.hetzner.com/api/v1",
+		token:    settings["token"],
+	}, nil
+}
+
+func (h *hetznerS) call(method, path string, body, res any) error {
+	req, err := newRequest(method, h.Endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Auth-API-Token", h.token)
+	_, err = call(req, res)
+	return err
+}
+
+func (h *hetznerS) zoneID(zone string) (string, error) {
+	res := struct {
+		Zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}{}
+	if err := h.call(http.MethodGet, "/zones?name="+url.QueryEscape(UnFqdn(zone)), nil, &res); err != nil {
+		return "", err
+	}
+	for _, z := range res.Zones {
+		if z.Name == UnFqdn(zone) {
+			return z.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+}
+
+func (h *hetznerS) records(zoneID string) ([]hetznerRecordS, error) {
+	res := struct {
+		Records []hetznerRecordS `json:"records"`
+	}{}
+	err := h.call(http.MethodGet, "/records?zone_id="+url.QueryEscape(zoneID), nil, &res)
+	return res.Records, err
+}
+
+func (h *hetznerS) Upsert(zone string, record RecordS) error {
+	if err := record.Check(zone); err != nil {
+		return err
+	}
+	zoneID, err := h.zoneID(zone)
+	if err != nil {
+		return err
+	}
+	existing, err := h.records(zoneID)
+	if err != nil {
+		return err
+	}
+
+	body := hetznerRecordS{
+		ZoneID: zoneID,
+		Type:   record.Type,
+		Name:   RelativeName(record.Name, zone),
+		Value:  record.Value,
+		TTL:    record.ttl(),
+	}
+
+	for _, r := range existing {
+		if r.Type != body.Type || r.Name != body.Name {
+			continue
+		}
+		if record.Type == TypeTXT && r.Value != record.Value {
+			continue
+		}
+		return h.call(http.MethodPut, "/records/"+r.ID, body, nil)
+	}
+	return h.call(http.MethodPost, "/records", body, nil)
+}
+
+func (h *hetznerS) Delete(zone string, record RecordS) error {
+	zoneID, err := h.zoneID(zone)
+	if err != nil {
+		return err
+	}
+	existing, err := h.records(zoneID)
+	if err != nil {
+		return err
+	}
+
+	name := RelativeName(record.Name, zone)
+	for _, r := range existing {
+		if r.Type != record.Type || r.Name != name {
+			continue
+		}
+		if record.Value != "" && r.Value != record.Value {
+			continue
+		}
+		if err := h.call(http.MethodDelete, "/records/"+r.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *hetznerS) List(zone string) ([]RecordS, error) {
+	zoneID, err := h.zoneID(zone)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := h.records(zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []RecordS{}
+	for _, r := range existing {
+		res = append(res, RecordS{
+			Type:  r.Type,
+			Name:  AbsoluteName(r.Name, zone),
+			Value: r.Value,
+			TTL:   r.TTL,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// newRequest returns request with JSON body
+func newRequest(method, url string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// call sends request and decodes JSON response into res, when res is not nil
+func call(req *http.Request, res any) (int, error) {
+	httpRes, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer httpRes.Body.Close()
+
+	buf, _ := io.ReadAll(httpRes.Body)
+	if httpRes.StatusCode >= 300 {
+		return httpRes.StatusCode, fmt.Errorf("%s %s: status %d %s", req.Method, req.URL.Path, httpRes.StatusCode, bytes.TrimSpace(buf))
+	}
+	if res == nil || len(buf) == 0 {
+		return httpRes.StatusCode, nil
+	}
+	return httpRes.StatusCode, json.Unmarshal(buf, res)
+}
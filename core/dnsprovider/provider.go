@@ -0,0 +1,248 @@
+// Package dnsprovider manages records in external DNS services. Every
+// implementation is registered under variant name and created from
+// settings (credentials), eg:
+//
+//	p, err := dnsprovider.New("hetzner", dnsprovider.Settings{"token": "..."})
+//	err = p.Upsert("example.com", dnsprovider.RecordS{Type: "A", Name: "app.example.com", Value: "1.2.3.4"})
+//
+// Record names are FQDNs without trailing dot. Upsert replaces A and CNAME
+// records, TXT records with other values are kept (many ACME challenges can
+// be pending for the same name).
+package dnsprovider
+
+import (
+	"errors"
+	"fmt"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+)
+
+const (
+	TypeA     = "A"
+	TypeCNAME = "CNAME"
+	TypeTXT   = "TXT"
+
+	DefaultTTL = 300
+)
+
+var (
+	ErrZoneNotFound = errors.New("DNS zone not found")
+
+	registry = maps.NewSafe[string, FactoryS](nil) // key=variant name
+)
+
+type RecordS struct {
+	Type  string
+	Name  string
+	Value string
+	TTL   int
+}
+
+type Provider interface {
+	Upsert(zone string, record RecordS) error
+	// Delete removes record with given value, empty value removes all records of type and name
+	Delete(zone string, record RecordS) error
+	List(zone string) ([]RecordS, error)
+}
+
+type Settings map[string]string
+
+type FieldS struct {
+	Name     string
+	Secret   bool
+	Required bool
+}
+
+type FactoryS struct {
+	Name   string // variant name
+	Fields []FieldS
+	New    func(settings Settings) (Provider, error)
+}
+
+func init() {
+	Register(FactoryS{
+		Name: "cloudflare",
+		Fields: []FieldS{
+			{Name: "token", Secret: true},
+			{Name: "email"},
+			{Name: "key", Secret: true},
+		},
+		New: newCloudflare,
+	})
+	Register(FactoryS{
+		Name: "azure",
+		Fields: []FieldS{
+			{Name: "tenant_id", Required: true},
+			{Name: "client_id", Required: true},
+			{Name: "client_secret", Secret: true, Required: true},
+			{Name: "subscription_id", Required: true},
+			{Name: "resource_group", Required: true},
+			{Name: "zone"},
+		},
+		New: newAzure,
+	})
+	Register(FactoryS{
+		Name: "route53",
+		Fields: []FieldS{
+			{Name: "access_key_id", Required: true},
+			{Name: "secret_access_key", Secret: true, Required: true},
+			{Name: "hosted_zone_id"},
+		},
+		New: newRoute53,
+	})
+	Register(FactoryS{
+		Name: "google",
+		Fields: []FieldS{
+			{Name: "project", Required: true},
+			{Name: "service_account_json", Secret: true, Required: true},
+		},
+		New: newGoogle,
+	})
+	Register(FactoryS{
+		Name: "hetzner",
+		Fields: []FieldS{
+			{Name: "token", Secret: true, Required: true},
+		},
+		New: newHetzner,
+	})
+	Register(FactoryS{
+		Name: "rfc2136",
+		Fields: []FieldS{
+			{Name: "server", Required: true}, // host:port
+			{Name: "tsig_key"},
+			{Name: "tsig_secret", Secret: true},
+			{Name: "tsig_algorithm"}, // default hmac-sha256
+		},
+		New: newRFC2136,
+	})
+}
+
+// Register adds implementation, implementation with the same name is replaced.
+func Register(f FactoryS) {
+	registry.Set(f.Name, f)
+}
+
+// Variants returns names of registered implementations
+func Variants() []string {
+	names := registry.Keys()
+	sort.Strings(names)
+	return names
+}
+
+func Factory(variant string) (FactoryS, bool) {
+	return registry.GetFull(variant)
+}
+
+// New returns provider of variant, required settings are checked.
+func New(variant string, settings Settings) (Provider, error) {
+	f, ok := registry.GetFull(variant)
+	if !ok {
+		return nil, fmt.Errorf("DNS provider variant not supported: %s", variant)
+	}
+	for _, field := range f.Fields {
+		if field.Required && settings[field.Name] == "" {
+			return nil, fmt.Errorf("DNS provider %s: setting `%s` is required", variant, field.Name)
+		}
+	}
+	return f.New(settings)
+}
+
+// Check returns error when record can't be managed by providers
+func (r RecordS) Check(zone string) error {
+	switch r.Type {
+	case TypeA, TypeCNAME, TypeTXT:
+	default:
+		return errors.New("record type not supported: " + r.Type)
+	}
+	if !InZone(r.Name, zone) {
+		return fmt.Errorf("record %s is not in zone %s", r.Name, zone)
+	}
+	if r.Value == "" {
+		return errors.New("record value is required")
+	}
+	return nil
+}
+
+func (r RecordS) ttl() int {
+	if r.TTL <= 0 {
+		return DefaultTTL
+	}
+	return r.TTL
+}
+
+// InZone returns true if name is zone or its subdomain
+func InZone(name, zone string) bool {
+	name = UnFqdn(strings.ToLower(name))
+	zone = UnFqdn(strings.ToLower(zone))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// RelativeName returns name relative to zone, `@` for zone apex
+func RelativeName(name, zone string) string {
+	name = UnFqdn(name)
+	zone = UnFqdn(zone)
+	if strings.EqualFold(name, zone) {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+// AbsoluteName is reverse of RelativeName
+func AbsoluteName(name, zone string) string {
+	name = UnFqdn(name)
+	if name == "@" || name == "" {
+		return UnFqdn(zone)
+	}
+	if InZone(name, zone) {
+		return name
+	}
+	return name + "." + UnFqdn(zone)
+}
+
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func UnFqdn(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
+
+// mergeValues returns values of record set after upsert
+func mergeValues(current []string, record RecordS) []string {
+	if record.Type != TypeTXT {
+		return []string{record.Value}
+	}
+	for _, v := range current {
+		if v == record.Value {
+			return current
+		}
+	}
+	return append(current, record.Value)
+}
+
+// removeValue returns values of record set after delete
+func removeValue(current []string, record RecordS) []string {
+	if record.Value == "" {
+		return nil
+	}
+	res := []string{}
+	for _, v := range current {
+		if v != record.Value {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func quoteTXT(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func unquoteTXT(value string) string {
+	value = strings.TrimPrefix(strings.TrimSuffix(value, `"`), `"`)
+	return strings.ReplaceAll(value, `\"`, `"`)
+}
@@ -0,0 +1,160 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rfc2136S sends dynamic updates (RFC 2136) to primary name server,
+// records are listed with zone transfer (AXFR)
+type rfc2136S struct {
+	server    string
+	keyName   string
+	secret    string
+	algorithm string
+}
+
+func newRFC2136(settings Settings) (Provider, error) {
+	r := &rfc2136S{
+		server:    settings["server"],
+		keyName:   settings["tsig_key"],
+		secret:    settings["tsig_secret"],
+		algorithm: settings["tsig_algorithm"],
+	}
+	if !strings.Contains(r.server, ":") {
+		r.server += ":53"
+	}
+	if r.algorithm == "" {
+		r.algorithm = dns.HmacSHA256
+	}
+	r.algorithm = dns.Fqdn(r.algorithm)
+	if (r.keyName == "") != (r.secret == "") {
+		return nil, fmt.Errorf("rfc2136: `tsig_key` and `tsig_secret` must be set together")
+	}
+	if r.keyName != "" {
+		r.keyName = dns.Fqdn(r.keyName)
+	}
+	return r, nil
+}
+
+func (r *rfc2136S) tsig(msg *dns.Msg) map[string]string {
+	if r.keyName == "" {
+		return nil
+	}
+	msg.SetTsig(r.keyName, r.algorithm, 300, time.Now().Unix())
+	return map[string]string{r.keyName: r.secret}
+}
+
+func (r *rfc2136S) exchange(msg *dns.Msg) error {
+	client := &dns.Client{
+		Net:        "tcp",
+		Timeout:    30 * time.Second,
+		TsigSecret: r.tsig(msg),
+	}
+	res, _, err := client.Exchange(msg, r.server)
+	if err != nil {
+		return err
+	}
+	if res.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136: server %s returned %s", r.server, dns.RcodeToString[res.Rcode])
+	}
+	return nil
+}
+
+func (r *rfc2136S) rr(record RecordS) (dns.RR, error) {
+	value := record.Value
+	switch record.Type {
+	case TypeTXT:
+		value = quoteTXT(value)
+	case TypeCNAME:
+		value = dns.Fqdn(value)
+	}
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record.Name), record.ttl(), record.Type, value))
+}
+
+// rrset returns empty record set used to remove all records of name and type
+func (r *rfc2136S) rrset(record RecordS) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{
+		Name:   dns.Fqdn(record.Name),
+		Rrtype: dns.StringToType[record.Type],
+		Class:  dns.ClassINET,
+	}}
+}
+
+func (r *rfc2136S) Upsert(zone string, record RecordS) error {
+	if err := record.Check(zone); err != nil {
+		return err
+	}
+	rr, err := r.rr(record)
+	if err != nil {
+		return err
+	}
+
+	msg := &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(zone))
+	if record.Type == TypeTXT {
+		// Remove changes header of RR, copy is required
+		msg.Remove([]dns.RR{dns.Copy(rr)})
+	} else {
+		msg.RemoveRRset([]dns.RR{r.rrset(record)})
+	}
+	msg.Insert([]dns.RR{rr})
+	return r.exchange(msg)
+}
+
+func (r *rfc2136S) Delete(zone string, record RecordS) error {
+	msg := &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(zone))
+	if record.Value == "" {
+		msg.RemoveRRset([]dns.RR{r.rrset(record)})
+	} else {
+		rr, err := r.rr(record)
+		if err != nil {
+			return err
+		}
+		msg.Remove([]dns.RR{rr})
+	}
+	return r.exchange(msg)
+}
+
+func (r *rfc2136S) List(zone string) ([]RecordS, error) {
+	msg := &dns.Msg{}
+	msg.SetAxfr(dns.Fqdn(zone))
+
+	transfer := &dns.Transfer{TsigSecret: r.tsig(msg)}
+	envelopes, err := transfer.In(msg, r.server)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []RecordS{}
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		for _, rr := range env.RR {
+			record := RecordS{
+				Name: UnFqdn(rr.Header().Name),
+				TTL:  int(rr.Header().Ttl),
+			}
+			switch v := rr.(type) {
+			case *dns.A:
+				record.Type = TypeA
+				record.Value = v.A.String()
+			case *dns.CNAME:
+				record.Type = TypeCNAME
+				record.Value = UnFqdn(v.Target)
+			case *dns.TXT:
+				record.Type = TypeTXT
+				record.Value = strings.Join(v.Txt, "")
+			default:
+				continue
+			}
+			res = append(res, record)
+		}
+	}
+	return res, nil
+}
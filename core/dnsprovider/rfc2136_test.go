@@ -0,0 +1,187 @@
+package dnsprovider
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testZone       = "example.com"
+	testTsigKey    = "timoni."
+	testTsigSecret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// testServerS is minimal primary server, applies updates and serves AXFR
+type testServerS struct {
+	mu      sync.Mutex
+	records []dns.RR
+}
+
+func (s *testServerS) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	res := &dns.Msg{}
+	res.SetReply(req)
+
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		res.Rcode = dns.RcodeNotAuth
+		w.WriteMsg(res)
+		return
+	}
+	tsig := req.IsTsig()
+
+	if req.Opcode == dns.OpcodeUpdate {
+		s.mu.Lock()
+		for _, rr := range req.Ns {
+			s.update(rr)
+		}
+		s.mu.Unlock()
+		res.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+		w.WriteMsg(res)
+		return
+	}
+
+	if len(req.Question) == 1 && req.Question[0].Qtype == dns.TypeAXFR {
+		s.mu.Lock()
+		soa, _ := dns.NewRR(testZone + ". 300 IN SOA ns." + testZone + ". admin." + testZone + ". 1 60 60 60 60")
+		rrs := append([]dns.RR{soa}, s.records...)
+		rrs = append(rrs, soa)
+		s.mu.Unlock()
+
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: rrs}
+		close(ch)
+		(&dns.Transfer{}).Out(w, req, ch)
+		return
+	}
+
+	res.Rcode = dns.RcodeNotImplemented
+	w.WriteMsg(res)
+}
+
+func (s *testServerS) update(rr dns.RR) {
+	hdr := rr.Header()
+	switch hdr.Class {
+	case dns.ClassANY: // remove RRset
+		s.filter(func(x dns.RR) bool {
+			return x.Header().Name == hdr.Name && x.Header().Rrtype == hdr.Rrtype
+		})
+	case dns.ClassNONE: // remove RR
+		hdr.Class = dns.ClassINET
+		s.filter(func(x dns.RR) bool {
+			return dns.IsDuplicate(x, rr)
+		})
+	default:
+		s.records = append(s.records, rr)
+	}
+}
+
+func (s *testServerS) filter(remove func(dns.RR) bool) {
+	res := []dns.RR{}
+	for _, rr := range s.records {
+		if !remove(rr) {
+			res = append(res, rr)
+		}
+	}
+	s.records = res
+}
+
+func testRFC2136(t *testing.T) Provider {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{
+		Listener:   listener,
+		Handler:    &testServerS{},
+		TsigSecret: map[string]string{testTsigKey: testTsigSecret},
+		// default accepts only queries and notifies
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	p, err := New("rfc2136", Settings{
+		"server":      listener.Addr().String(),
+		"tsig_key":    testTsigKey,
+		"tsig_secret": testTsigSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testList(t *testing.T, p Provider) []string {
+	records, err := p.List(testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := []string{}
+	for _, r := range records {
+		res = append(res, r.Type+" "+r.Name+" "+r.Value)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func testEqual(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRFC2136(t *testing.T) {
+	p := testRFC2136(t)
+
+	for _, r := range []RecordS{
+		{Type: TypeA, Name: "app.example.com", Value: "10.0.0.1"},
+		{Type: TypeA, Name: "app.example.com", Value: "10.0.0.2"}, // replaces
+		{Type: TypeCNAME, Name: "www.example.com", Value: "app.example.com"},
+		{Type: TypeTXT, Name: "_acme-challenge.example.com", Value: "first"},
+		{Type: TypeTXT, Name: "_acme-challenge.example.com", Value: "second"}, // kept together
+	} {
+		if err := p.Upsert(testZone, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testEqual(t, testList(t, p),
+		"A app.example.com 10.0.0.2",
+		"CNAME www.example.com app.example.com",
+		"TXT _acme-challenge.example.com first",
+		"TXT _acme-challenge.example.com second",
+	)
+
+	if err := p.Delete(testZone, RecordS{Type: TypeTXT, Name: "_acme-challenge.example.com", Value: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Delete(testZone, RecordS{Type: TypeA, Name: "app.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	testEqual(t, testList(t, p),
+		"CNAME www.example.com app.example.com",
+		"TXT _acme-challenge.example.com second",
+	)
+
+	if err := p.Upsert(testZone, RecordS{Type: TypeA, Name: "app.other.com", Value: "10.0.0.1"}); err == nil {
+		t.Fatal("record outside of zone must be rejected")
+	}
+}
+
+func TestRFC2136BadSecret(t *testing.T) {
+	p := testRFC2136(t)
+	p.(*rfc2136S).secret = "YmFkYmFkYmFkYmFk"
+
+	if err := p.Upsert(testZone, RecordS{Type: TypeA, Name: "app.example.com", Value: "10.0.0.1"}); err == nil {
+		t.Fatal("update with bad TSIG secret must fail")
+	}
+}
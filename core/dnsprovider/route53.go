@@ -0,0 +1,329 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const route53XMLNS = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+type route53S struct {
+	Endpoint string
+	settings Settings
+}
+
+type route53RecordSetS struct {
+	Name            string
+	Type            string
+	TTL             int
+	ResourceRecords struct {
+		ResourceRecord []struct {
+			Value string
+		}
+	}
+}
+
+type route53ChangeRequestS struct {
+	XMLName     xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS       string   `xml:"xmlns,attr"`
+	ChangeBatch struct {
+		Changes struct {
+			Change []route53ChangeS
+		}
+	}
+}
+
+type route53ChangeS struct {
+	Action            string // UPSERT, DELETE
+	ResourceRecordSet route53RecordSetS
+}
+
+func newRoute53(settings Settings) (Provider, error) {
+	return &route53S{
+		Endpoint: "https://route53.amazonaws.com",
+		settings: settings,
+	}, nil
+}
+
+func (r *route53S) call(method, path string, query url.Values, body, res any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = xml.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	u := r.Endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	awsSign(req, payload, r.settings["access_key_id"], r.settings["secret_access_key"], "us-east-1", "route53", time.Now().UTC())
+
+	httpRes, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	buf, _ := io.ReadAll(httpRes.Body)
+	if httpRes.StatusCode >= 300 {
+		return fmt.Errorf("route53 %s %s: status %d %s", method, path, httpRes.StatusCode, bytes.TrimSpace(buf))
+	}
+	if res == nil {
+		return nil
+	}
+	return xml.Unmarshal(buf, res)
+}
+
+func (r *route53S) zoneID(zone string) (string, error) {
+	if r.settings["hosted_zone_id"] != "" {
+		return r.settings["hosted_zone_id"], nil
+	}
+
+	res := struct {
+		HostedZones struct {
+			HostedZone []struct {
+				ID   string `xml:"Id"`
+				Name string
+			}
+		}
+	}{}
+	err := r.call(http.MethodGet, "/2013-04-01/hostedzonesbyname", url.Values{
+		"dnsname":  {Fqdn(zone)},
+		"maxitems": {"1"},
+	}, nil, &res)
+	if err != nil {
+		return "", err
+	}
+	for _, z := range res.HostedZones.HostedZone {
+		if strings.EqualFold(z.Name, Fqdn(zone)) {
+			return strings.TrimPrefix(z.ID, "/hostedzone/"), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+}
+
+// recordSets returns record sets starting from name and type, all when name is empty
+func (r *route53S) recordSets(zoneID, name, recordType string) ([]route53RecordSetS, error) {
+	res := []route53RecordSetS{}
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", Fqdn(name))
+		query.Set("type", recordType)
+		query.Set("maxitems", "1")
+	}
+
+	for {
+		page := struct {
+			ResourceRecordSets struct {
+				ResourceRecordSet []route53RecordSetS
+			}
+			IsTruncated    bool
+			NextRecordName string
+			NextRecordType string
+		}{}
+		if err := r.call(http.MethodGet, "/2013-04-01/hostedzone/"+zoneID+"/rrset", query, nil, &page); err != nil {
+			return nil, err
+		}
+		res = append(res, page.ResourceRecordSets.ResourceRecordSet...)
+		if name != "" || !page.IsTruncated {
+			return res, nil
+		}
+		query.Set("name", page.NextRecordName)
+		query.Set("type", page.NextRecordType)
+	}
+}
+
+func (r *route53S) values(zoneID string, record RecordS) ([]string, int, error) {
+	sets, err := r.recordSets(zoneID, record.Name, record.Type)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, rs := range sets {
+		if !strings.EqualFold(rs.Name, Fqdn(record.Name)) || rs.Type != record.Type {
+			continue
+		}
+		return rs.values(), rs.TTL, nil
+	}
+	return nil, 0, nil
+}
+
+func (rs route53RecordSetS) values() []string {
+	res := []string{}
+	for _, v := range rs.ResourceRecords.ResourceRecord {
+		if rs.Type == TypeTXT {
+			res = append(res, unquoteTXT(v.Value))
+		} else {
+			res = append(res, v.Value)
+		}
+	}
+	return res
+}
+
+func (r *route53S) change(zoneID, action string, record RecordS, ttl int, values []string) error {
+	rs := route53RecordSetS{
+		Name: Fqdn(record.Name),
+		Type: record.Type,
+		TTL:  ttl,
+	}
+	for _, v := range values {
+		if record.Type == TypeTXT {
+			v = quoteTXT(v)
+		}
+		rs.ResourceRecords.ResourceRecord = append(rs.ResourceRecords.ResourceRecord, struct{ Value string }{v})
+	}
+
+	req := route53ChangeRequestS{XMLNS: route53XMLNS}
+	req.ChangeBatch.Changes.Change = []route53ChangeS{{
+		Action:            action,
+		ResourceRecordSet: rs,
+	}}
+	return r.call(http.MethodPost, "/2013-04-01/hostedzone/"+zoneID+"/rrset/", nil, req, nil)
+}
+
+func (r *route53S) Upsert(zone string, record RecordS) error {
+	if err := record.Check(zone); err != nil {
+		return err
+	}
+	zoneID, err := r.zoneID(zone)
+	if err != nil {
+		return err
+	}
+	current, _, err := r.values(zoneID, record)
+	if err != nil {
+		return err
+	}
+	return r.change(zoneID, "UPSERT", record, record.ttl(), mergeValues(current, record))
+}
+
+func (r *route53S) Delete(zone string, record RecordS) error {
+	zoneID, err := r.zoneID(zone)
+	if err != nil {
+		return err
+	}
+	current, ttl, err := r.values(zoneID, record)
+	if err != nil || len(current) == 0 {
+		return err
+	}
+
+	values := removeValue(current, record)
+	if len(values) > 0 {
+		return r.change(zoneID, "UPSERT", record, ttl, values)
+	}
+	// DELETE must match current record set
+	return r.change(zoneID, "DELETE", record, ttl, current)
+}
+
+func (r *route53S) List(zone string) ([]RecordS, error) {
+	zoneID, err := r.zoneID(zone)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := r.recordSets(zoneID, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	res := []RecordS{}
+	for _, rs := range sets {
+		for _, v := range rs.values() {
+			res = append(res, RecordS{
+				Type:  rs.Type,
+				Name:  UnFqdn(rs.Name),
+				Value: v,
+				TTL:   rs.TTL,
+			})
+		}
+	}
+	return res, nil
+}
+
+// awsSign adds AWS Signature Version 4 headers to request
+func awsSign(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-date":           amzDate,
+		"x-amz-content-sha256": payloadHash,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + strings.TrimSpace(headers[k]) + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// url.Values.Encode sorts by key, spaces must be %20
+	canonicalQuery := strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -2,11 +2,14 @@ package ingress
 
 import (
 	"core/config"
+	"core/db"
 	"core/db2"
 	"core/kube"
 	"core/modulestate"
 	"lib/tlog"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -17,19 +20,82 @@ func Setup() {
 
 	kClient.ApplyYamlFilesInDir(filepath.Join(config.ModulesPath(), "ingress"), nil)
 
+	entryPoints := db.TraefikEntryPointsRequired()
+	for {
+		if tlog.Error(apply(entryPoints)) == nil {
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	go loop(entryPoints)
+}
+
+// loop adds and removes entrypoints used by tcp and udp domain elements
+func loop(active []kube.TraefikEntryPointS) {
+	for {
+		time.Sleep(30 * time.Second)
+
+		required := db.TraefikEntryPointsRequired()
+		if reflect.DeepEqual(required, active) {
+			continue
+		}
+
+		tlog.Info("ingress-traefik entrypoints changed", tlog.Vars{
+			"entryPoints": required,
+			"event":       true,
+		})
+		if tlog.Error(apply(required)) == nil {
+			active = required
+		}
+	}
+}
+
+// apply configures traefik DaemonSet and its services with entrypoints,
+// waits for load balancer of the service
+func apply(entryPoints []kube.TraefikEntryPointS) *tlog.RecordS {
+
+	kClient := kube.GetKube()
+
 	// -------------------------------------------------
 	// traefik
 
+	// static configuration is CMD of ingress-traefik image, entrypoints
+	// are appended to it by entry-point
+	args := []string{}
+	tcpPorts := map[int32]int32{
+		80:  80,
+		443: 443,
+	}
+	udpPorts := map[int32]int32{}
+	exposeTCP := []int32{80, 443, 9000}
+	exposeUDP := []int32{}
+
+	for _, ep := range entryPoints {
+		args = append(args, ep.Arg())
+		if ep.Protocol == "udp" {
+			udpPorts[ep.Port] = ep.Port
+			exposeUDP = append(exposeUDP, ep.Port)
+		} else {
+			tcpPorts[ep.Port] = ep.Port
+			exposeTCP = append(exposeTCP, ep.Port)
+		}
+	}
+
 	traefik := &kube.DaemonSetS{
-		KubeClient:          kClient,
-		Namespace:           "timoni",
-		Name:                "ingress-traefik",
-		Image:               "timoni/ingress-traefik:" + db2.TheSettings.ReleaseGitTag(),
+		KubeClient: kClient,
+		Namespace:  "timoni",
+		Name:       "ingress-traefik",
+		Image:      "timoni/ingress-traefik:" + db2.TheSettings.ReleaseGitTag(),
+		Envs: map[string]string{
+			"EP_EXTRA_ARGS": strings.Join(args, ";"),
+		},
 		ImagePullAlways:     true,
-		ExposePorts:         []int32{80, 443, 9000},
+		ExposePorts:         exposeTCP,
+		ExposePortsUDP:      exposeUDP,
 		ServiceAccountName:  "traefik-ingress-controller",
 		ServiceAccountMount: true,
-		// Annotations:         db2.TheIngress.Traefik_Annotations(), 
+		// Annotations:         db2.TheIngress.Traefik_Annotations(),
 		// Privileged:             true,
 		// HostPID: true,
 		// WritableRootFilesystem: true,
@@ -40,21 +106,32 @@ func Setup() {
 		// 	limits:
 		// 	  memory: 1Gi
 		// 	  # cpu: '10000m'
-		//   ports:
-		// 	- name: web
-		// 	  containerPort: 80
-		// 	- name: websecure
-		// 	  containerPort: 443
-		// 	- name: traefik
-		// 	  containerPort: 9000
+	}
+	if _, err := traefik.CreateOrUpdate(); err != nil {
+		return tlog.Error(err)
+	}
 
+	// -------------------------------------------------
+	// services, load balancer can't mix protocols
+
+	udpService := kube.ServiceS{
+		KubeClient: kClient,
+		Namespace:  "timoni",
+		Name:       "ingress-traefik-udp",
+		TargetSelector: map[string]string{
+			"element": "ingress-traefik",
+		},
+		LoadBalancer: true,
+		Internal:     db2.TheIngress.Traefik_Internal(),
+		Protocol:     "udp",
+		Ports:        udpPorts,
 	}
-	for {
-		_, err := traefik.CreateOrUpdate()
-		if tlog.Error(err) == nil {
-			break
+	if len(udpPorts) > 0 {
+		if _, err := udpService.CreateOrUpdate(); err != nil {
+			return tlog.Error(err)
 		}
-		time.Sleep(5 * time.Second)
+	} else if udpService.Exist() {
+		tlog.Error(udpService.Delete())
 	}
 
 	for {
@@ -68,10 +145,7 @@ func Setup() {
 			LoadBalancer: true,
 			// Annotations:  db2.TheIngress.Traefik_Annotations(),
 			Internal: db2.TheIngress.Traefik_Internal(),
-			Ports: map[int32]int32{
-				80:  80,
-				443: 443,
-			},
+			Ports:    tcpPorts,
 		}
 		_, err := isvc.CreateOrUpdate()
 		tlog.Error(err)
@@ -86,4 +160,14 @@ func Setup() {
 			break
 		}
 	}
+
+	kube.TraefikEntryPointsActive.Commit(func(data map[string]kube.TraefikEntryPointS) {
+		for k := range data {
+			delete(data, k)
+		}
+		for _, ep := range entryPoints {
+			data[ep.Name] = ep
+		}
+	})
+	return nil
 }
@@ -0,0 +1,319 @@
+package kube
+
+import (
+	"core/db2"
+	"core/modulestate"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	log "lib/tlog"
+	"lib/utils/maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	restclient "k8s.io/client-go/rest"
+)
+
+// Clusters are entries of db2.Kube table, each with its kubeconfig. Cluster
+// of Timoni itself (settings of installation) is local one, it is used by
+// environments without ClusterName.
+
+var (
+	clusterNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	clusterHealthMap  = maps.NewSafe[string, ClusterHealthS](nil) // key=cluster-name
+	clusterRetryMap   = maps.NewSafe[string, time.Time](nil)      // key=cluster-name, next connect after failure
+)
+
+type ClusterS struct {
+	ID      string
+	Name    string
+	Local   bool
+	Enabled bool
+	Health  ClusterHealthS
+}
+
+type ClusterHealthS struct {
+	State     db2.StateT
+	Message   string
+	CheckTime int64
+	Nodes     int
+	Version   string
+}
+
+// LocalClusterName returns name of cluster on which Timoni runs
+func LocalClusterName() string {
+	if db2.TheKube != nil && !db2.TheKube.NotValid() && db2.TheKube.Name() != "" {
+		return db2.TheKube.Name()
+	}
+	if db2.TheSettings != nil {
+		return db2.TheSettings.Name()
+	}
+	return ""
+}
+
+func isLocalCluster(name string) bool {
+	return name == "" || name == LocalClusterName()
+}
+
+func ClusterNameCheck(name string) error {
+	if !clusterNameRegexp.MatchString(name) {
+		return errors.New("invalid cluster name, use lowercase letters, digits and '-'")
+	}
+	return nil
+}
+
+// clusterGet returns registered cluster from db2.Kube
+func clusterGet(name string) db2.Kube {
+	if ClusterNameCheck(name) != nil {
+		return nil
+	}
+	k := db2.KubeList("Name = '"+name+"'", "", 0, 1).First()
+	if k.NotValid() {
+		return nil
+	}
+	return k
+}
+
+// GetKubeCluster returns client of cluster, nil when cluster is not
+// registered, disabled or not reachable
+func GetKubeCluster(name string) *ClientS {
+
+	if isLocalCluster(name) {
+		return GetKube()
+	}
+
+	if kClient := clientMap.Get(name); kClient != nil {
+		return kClient
+	}
+
+	if time.Now().Before(clusterRetryMap.Get(name)) {
+		return nil
+	}
+
+	k := clusterGet(name)
+	if k == nil || !k.Enabled() {
+		return nil
+	}
+	kClient, err := NewClient([]byte(k.Config()))
+	if err != nil {
+		clusterRetryMap.Set(name, time.Now().Add(30*time.Second))
+		return nil
+	}
+	kClient.Cluster = name
+	if _, err := clusterPing(kClient); err != nil {
+		log.Error(err, log.Vars{"cluster": name})
+		clusterRetryMap.Set(name, time.Now().Add(30*time.Second))
+		return nil
+	}
+
+	clusterRetryMap.Delete(name)
+	clientMap.Set(name, kClient)
+	return kClient
+}
+
+// clusterPing returns version of cluster, unreachable cluster fails after
+// timeout
+func clusterPing(kClient *ClientS) (*version.Info, error) {
+	config := restclient.CopyConfig(kClient.Config)
+	config.Timeout = 10 * time.Second
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return dc.ServerVersion()
+}
+
+// ClusterReset drops cached client, eg. after change of kubeconfig
+func ClusterReset(name string) {
+	if !isLocalCluster(name) {
+		clientMap.Delete(name)
+		clusterRetryMap.Delete(name)
+	}
+}
+
+// ClusterList returns registered clusters, local first
+func ClusterList() []ClusterS {
+
+	local := LocalClusterName()
+	res := []ClusterS{{
+		Name:    local,
+		Local:   true,
+		Enabled: true,
+		Health:  clusterHealthMap.Get(local),
+	}}
+	if db2.TheKube != nil && !db2.TheKube.NotValid() {
+		res[0].ID = db2.TheKube.ID()
+	}
+
+	for _, k := range db2.KubeList("", "Name", 0, 1000).Iter() {
+		if k.Name() == local {
+			continue
+		}
+		res = append(res, ClusterS{
+			ID:      k.ID(),
+			Name:    k.Name(),
+			Enabled: k.Enabled(),
+			Health:  clusterHealthMap.Get(k.Name()),
+		})
+	}
+	return res
+}
+
+// ClusterExists returns true for local or enabled cluster
+func ClusterExists(name string) bool {
+	if isLocalCluster(name) {
+		return true
+	}
+	k := clusterGet(name)
+	return k != nil && k.Enabled()
+}
+
+// ClusterSave registers cluster or updates its kubeconfig, config is checked
+// by connecting to the cluster
+func ClusterSave(name, config string, enabled bool) error {
+
+	if err := ClusterNameCheck(name); err != nil {
+		return err
+	}
+	if isLocalCluster(name) {
+		return errors.New("local cluster can't be changed")
+	}
+
+	k := clusterGet(name)
+	if config == "" && k != nil {
+		config = k.Config()
+	}
+	if enabled {
+		kClient, err := NewClient([]byte(config))
+		if err != nil {
+			return errors.New("invalid kubeconfig: " + err.Message)
+		}
+		if _, err := clusterPing(kClient); err != nil {
+			return fmt.Errorf("unable to connect to cluster: %v", err)
+		}
+	}
+
+	if k == nil {
+		k = db2.KubeCreate(config, name, db2.TheOrganization)
+		if k.NotValid() {
+			return errors.New(k.InfoLastTrace().Message)
+		}
+	} else if info := k.SetConfig(config); info.NotValid() {
+		return errors.New(info.InfoLastTrace().Message)
+	}
+	if info := k.SetEnabled(enabled); info.NotValid() {
+		return errors.New(info.InfoLastTrace().Message)
+	}
+
+	ClusterReset(name)
+	return nil
+}
+
+// ClusterDelete removes cluster from registry
+func ClusterDelete(name string) error {
+	if isLocalCluster(name) {
+		return errors.New("local cluster can't be deleted")
+	}
+	k := clusterGet(name)
+	if k == nil {
+		return errors.New("cluster not found")
+	}
+	if info := k.Delete(); info.NotValid() {
+		return errors.New(info.InfoLastTrace().Message)
+	}
+	ClusterReset(name)
+	clusterHealthMap.Delete(name)
+	return nil
+}
+
+// ClusterCheck checks connection and nodes of cluster, result is kept as
+// health of cluster
+func ClusterCheck(name string) (db2.StateT, string) {
+
+	health := ClusterHealthS{
+		State:     db2.State_error,
+		CheckTime: time.Now().Unix(),
+	}
+	defer func() {
+		clusterHealthMap.Set(name, health)
+	}()
+
+	kClient := clientMap.Get(name)
+	if isLocalCluster(name) {
+		kClient = clientMap.Get("")
+	}
+	if kClient == nil {
+		kClient = GetKubeCluster(name)
+	}
+	if kClient == nil {
+		health.Message = "unable to connect to cluster " + name
+		return health.State, health.Message
+	}
+
+	info, err := clusterPing(kClient)
+	if err != nil {
+		// connection could be broken, new client is made next time
+		ClusterReset(name)
+		health.Message = fmt.Sprintf("cluster %s: %v", name, err)
+		return health.State, health.Message
+	}
+	health.Version = info.GitVersion
+
+	nodes, err := kClient.API.CoreV1().Nodes().List(kClient.CTX, metav1.ListOptions{})
+	if err != nil {
+		health.Message = fmt.Sprintf("cluster %s: %v", name, err)
+		return health.State, health.Message
+	}
+	notReady := 0
+	for _, node := range nodes.Items {
+		health.Nodes++
+		for _, c := range node.Status.Conditions {
+			if c.Type == "Ready" && c.Status != "True" {
+				notReady++
+			}
+		}
+	}
+	if health.Nodes == 0 {
+		health.Message = "cluster " + name + " has no nodes"
+		return health.State, health.Message
+	}
+	if notReady > 0 {
+		health.Message = fmt.Sprintf("cluster %s: %d of %d nodes not ready", name, notReady, health.Nodes)
+		return health.State, health.Message
+	}
+
+	health.State = db2.State_ready
+	return health.State, ""
+}
+
+// clusterChecksLoop keeps health check of each registered cluster in
+// modulestate
+func clusterChecksLoop() {
+	registered := map[string]bool{}
+	for {
+		current := map[string]bool{}
+		for _, c := range ClusterList() {
+			if !c.Enabled {
+				continue
+			}
+			name := c.Name
+			current[name] = true
+			if !registered[name] {
+				modulestate.StatusByModulesAdd("kube/"+name, func() (db2.StateT, string) {
+					return ClusterCheck(name)
+				})
+			}
+		}
+		for name := range registered {
+			if !current[name] {
+				modulestate.StatusByModulesDelete("kube/" + name)
+				clusterHealthMap.Delete(name)
+			}
+		}
+		registered = current
+		time.Sleep(time.Minute)
+	}
+}
@@ -32,6 +32,10 @@ func (s *ConfigMapsS) CreateOrUpdate() (anyChange bool, err error) {
 		return false, errors.New("Namespace cant be empty")
 	}
 
+	desired := *s
+	desired.KubeClient, desired.Obj = nil, nil
+	hash := driftHash(desired)
+
 	var configMapsOld []byte
 	configMaps, err := s.KubeClient.API.CoreV1().ConfigMaps(s.Namespace).Get(s.KubeClient.CTX, s.Name, metav1.GetOptions{})
 	if err == nil {
@@ -70,14 +74,18 @@ func (s *ConfigMapsS) CreateOrUpdate() (anyChange bool, err error) {
 		}
 
 		if len(patch) == 2 {
+			driftApplied(s.KubeClient, "ConfigMap", s.Namespace, s.Name, hash)
 			return false, nil
 		}
 
+		driftCheck(s.KubeClient, "ConfigMap", s.Namespace, s.Name, hash, configMapsOld, configMapsNew, patch)
+
 		s.Obj, err = s.KubeClient.API.CoreV1().ConfigMaps(s.Namespace).Patch(s.KubeClient.CTX, s.Name, types.MergePatchType, patch, metav1.PatchOptions{})
 		if err != nil {
 			return false, err
 		}
 	}
+	driftApplied(s.KubeClient, "ConfigMap", s.Namespace, s.Name, hash)
 	return true, nil
 }
 
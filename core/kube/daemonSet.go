@@ -30,6 +30,7 @@ type DaemonSetS struct {
 	Annotations            map[string]string
 	PodLabels              map[string]string
 	ExposePorts            []int32
+	ExposePortsUDP         []int32
 	Storage                map[string]*StorageS
 	RunAsUser              []int64
 	Privileged             bool
@@ -335,6 +336,13 @@ func (d *DaemonSetS) CreateOrUpdate() (diff string, err error) {
 			ContainerPort: portNr,
 		})
 	}
+	for _, portNr := range d.ExposePortsUDP {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          fmt.Sprint("u", portNr),
+			Protocol:      corev1.ProtocolUDP,
+			ContainerPort: portNr,
+		})
+	}
 
 	daemon.Spec.Template.Spec.Containers[0].Ports = ports
 
@@ -73,6 +73,10 @@ func (d *DeploymentS) CreateOrUpdate() (anyChange bool, err error) {
 		d.ServiceAccountMount = true
 	}
 
+	desired := *d
+	desired.KubeClient, desired.Obj = nil, nil
+	hash := driftHash(desired)
+
 	var deployOld []byte
 	deploy, err := d.KubeClient.API.AppsV1().Deployments(d.Namespace).Get(d.KubeClient.CTX, d.Name, metav1.GetOptions{})
 	if err == nil {
@@ -648,6 +652,9 @@ func (d *DeploymentS) CreateOrUpdate() (anyChange bool, err error) {
 
 	if len(deployOld) == 0 {
 		d.Obj, err = d.KubeClient.API.AppsV1().Deployments(d.Namespace).Create(d.KubeClient.CTX, deploy, metav1.CreateOptions{})
+		if err == nil {
+			driftApplied(d.KubeClient, "Deployment", d.Namespace, d.Name, hash)
+		}
 		return true, err
 
 	}
@@ -663,13 +670,17 @@ func (d *DeploymentS) CreateOrUpdate() (anyChange bool, err error) {
 	}
 
 	if len(patch) == 2 {
+		driftApplied(d.KubeClient, "Deployment", d.Namespace, d.Name, hash)
 		d.GetObj()
 		return false, nil
 	}
 
+	driftCheck(d.KubeClient, "Deployment", d.Namespace, d.Name, hash, deployOld, deployNew, patch)
+
 	d.Obj, err = d.KubeClient.API.AppsV1().Deployments(d.Namespace).Patch(d.KubeClient.CTX, d.Name, types.MergePatchType, patch, metav1.PatchOptions{})
 	log.Error(err, string(patch))
 	if err == nil {
+		driftApplied(d.KubeClient, "Deployment", d.Namespace, d.Name, hash)
 		log.Info("Deployment patched", log.Vars{
 			"old":        string(deployOld),
 			"new":        string(deployNew),
@@ -813,6 +824,7 @@ func (kube *ClientS) DeploymentMap(namespace string) map[string]*DeploymentS {
 }
 
 func (d *DeploymentS) Delete() error {
+	driftForget(d.KubeClient, "Deployment", d.Namespace, d.Name)
 	return d.KubeClient.API.AppsV1().Deployments(d.Namespace).Delete(d.KubeClient.CTX, d.Name, metav1.DeleteOptions{})
 }
 
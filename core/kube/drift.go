@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"lib/utils/maps"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// Drift is change of object made in cluster outside of Timoni: desired state
+// of object is the same as at last apply, but object differs from it. It is
+// reported by DriftHook before object is patched back.
+
+type DriftS struct {
+	Cluster   string
+	Kind      string
+	Namespace string
+	Name      string
+	Desired   string // merge patch which restores desired state
+	Live      string // merge patch with values found in cluster
+	Time      int64
+}
+
+var (
+	// DriftHook is called with drift found before it is overwritten
+	DriftHook func(DriftS)
+
+	driftAppliedMap = maps.NewSafe[string, string](nil) // key=cluster/kind/ns/name, hash of desired state at last apply
+)
+
+// driftHash returns hash of desired state, clients and objects have to be
+// removed from it by caller
+func driftHash(desired interface{}) string {
+	buf, err := json.Marshal(desired)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+func driftKey(kClient *ClientS, kind, namespace, name string) string {
+	return kClient.Cluster + "/" + kind + "/" + namespace + "/" + name
+}
+
+// driftCheck reports drift when object has to be patched although desired
+// state did not change since last apply
+func driftCheck(kClient *ClientS, kind, namespace, name, hash string, old, new, patch []byte) {
+
+	if DriftHook == nil || hash == "" {
+		return
+	}
+	if driftAppliedMap.Get(driftKey(kClient, kind, namespace, name)) != hash {
+		return
+	}
+
+	live, err := jsonpatch.CreateMergePatch(new, old)
+	if err != nil {
+		return
+	}
+	DriftHook(DriftS{
+		Cluster:   kClient.Cluster,
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Desired:   string(patch),
+		Live:      string(live),
+		Time:      time.Now().Unix(),
+	})
+}
+
+// driftApplied remembers desired state which is in cluster now
+func driftApplied(kClient *ClientS, kind, namespace, name, hash string) {
+	if hash != "" {
+		driftAppliedMap.Set(driftKey(kClient, kind, namespace, name), hash)
+	}
+}
+
+// driftForget drops state of deleted object
+func driftForget(kClient *ClientS, kind, namespace, name string) {
+	driftAppliedMap.Delete(driftKey(kClient, kind, namespace, name))
+}
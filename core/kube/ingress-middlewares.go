@@ -0,0 +1,360 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	log "lib/tlog"
+	"lib/utils/conv"
+	"lib/utils/maps"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HTTPOptionsS are options of domain element translated to traefik middlewares
+type HTTPOptionsS struct {
+	RateLimit      *RateLimitS   `toml:"rate-limit"`
+	IPAllow        []string      `toml:"ip-allow"` // IPs or CIDRs, others get 403
+	IPDeny         []string      `toml:"ip-deny"`  // IPs or CIDRs which get 403
+	Headers        *HeadersS     `toml:"headers"`
+	CORS           *CORSS        `toml:"cors"`
+	Redirects      []RegexRuleS  `toml:"redirects"` // regex on full URL
+	Rewrites       []RegexRuleS  `toml:"rewrites"`  // regex on path
+	Retry          *RetryS       `toml:"retry"`
+	CircuitBreaker string        `toml:"circuit-breaker"` // eg. 'NetworkErrorRatio() > 0.30'
+	Compress       bool          `toml:"compress"`
+	ForwardAuth    *ForwardAuthS `toml:"forward-auth"`
+	Wake           string        `toml:"-"` // forwardAuth which holds request until sleeping env is started
+}
+
+type RateLimitS struct {
+	Average int    `toml:"average"` // requests per period from one IP
+	Burst   int    `toml:"burst"`
+	Period  string `toml:"period"` // default 1s
+}
+
+type HeadersS struct {
+	Request  map[string]string `toml:"request"`  // empty value removes header
+	Response map[string]string `toml:"response"` // empty value removes header
+}
+
+type CORSS struct {
+	AllowOrigins     []string `toml:"allow-origins"`
+	AllowMethods     []string `toml:"allow-methods"`
+	AllowHeaders     []string `toml:"allow-headers"`
+	ExposeHeaders    []string `toml:"expose-headers"`
+	AllowCredentials bool     `toml:"allow-credentials"`
+	MaxAge           int      `toml:"max-age"` // seconds
+}
+
+type RegexRuleS struct {
+	Regex       string `toml:"regex"`
+	Replacement string `toml:"replacement"`
+	Permanent   bool   `toml:"permanent"` // redirects only
+}
+
+type RetryS struct {
+	Attempts        int    `toml:"attempts"`
+	InitialInterval string `toml:"initial-interval"` // eg. 100ms
+}
+
+type ForwardAuthS struct {
+	Address             string   `toml:"address"` // eg. http://oauth2-proxy.auth:4180/oauth2/auth
+	TrustForwardHeader  bool     `toml:"trust-forward-header"`
+	AuthRequestHeaders  []string `toml:"auth-request-headers"`
+	AuthResponseHeaders []string `toml:"auth-response-headers"` // copied to request of service
+	InsecureSkipVerify  bool     `toml:"insecure-skip-verify"`
+}
+
+// Check returns error of first invalid option
+func (o *HTTPOptionsS) Check() error {
+	if o.RateLimit != nil {
+		if err := o.RateLimit.Check(); err != nil {
+			return err
+		}
+	}
+	for _, ip := range append(append([]string{}, o.IPAllow...), o.IPDeny...) {
+		if err := checkIPRange(ip); err != nil {
+			return err
+		}
+	}
+	for _, r := range append(append([]string{}, regexRules(o.Redirects)...), regexRules(o.Rewrites)...) {
+		if _, err := regexp.Compile(r); err != nil {
+			return fmt.Errorf("invalid regex `%s`: %w", r, err)
+		}
+	}
+	if o.Retry != nil {
+		if o.Retry.Attempts <= 0 {
+			return errors.New("retry.attempts must be greater than 0")
+		}
+		if err := checkDuration("retry.initial-interval", o.Retry.InitialInterval); err != nil {
+			return err
+		}
+	}
+	if o.ForwardAuth != nil {
+		u, err := url.Parse(o.ForwardAuth.Address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("forward-auth.address must be http or https URL")
+		}
+	}
+	return nil
+}
+
+func (r *RateLimitS) Check() error {
+	if r.Average <= 0 {
+		return errors.New("rate-limit.average must be greater than 0")
+	}
+	if r.Burst < 0 {
+		return errors.New("rate-limit.burst can't be negative")
+	}
+	return checkDuration("rate-limit.period", r.Period)
+}
+
+func checkIPRange(ip string) error {
+	if strings.Contains(ip, "/") {
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return fmt.Errorf("invalid CIDR `%s`", ip)
+		}
+		return nil
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP `%s`", ip)
+	}
+	return nil
+}
+
+func checkDuration(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return fmt.Errorf("%s: invalid duration `%s`", name, value)
+	}
+	return nil
+}
+
+func regexRules(rules []RegexRuleS) []string {
+	res := []string{}
+	for _, r := range rules {
+		res = append(res, r.Regex)
+	}
+	return res
+}
+
+func stringsToInterface(list []string) []interface{} {
+	res := []interface{}{}
+	for _, s := range list {
+		res = append(res, s)
+	}
+	return res
+}
+
+func stringMapToInterface(m map[string]string) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func (r *RateLimitS) spec() map[string]interface{} {
+	period := r.Period
+	if period == "" {
+		period = "1s"
+	}
+	burst := r.Burst
+	if burst == 0 {
+		burst = r.Average
+	}
+	return map[string]interface{}{
+		"rateLimit": map[string]interface{}{
+			"average": int64(r.Average),
+			"burst":   int64(burst),
+			"period":  period,
+		},
+	}
+}
+
+// httpMiddlewareS is middleware of ingress, name is relative to ingress name
+type httpMiddlewareS struct {
+	name string
+	spec map[string]interface{}
+}
+
+// ipDenyMiddleware rejects all requests, used by route matching denied IPs
+var ipDenyMiddleware = httpMiddlewareS{"ip-deny", map[string]interface{}{
+	"ipWhiteList": map[string]interface{}{
+		"sourceRange": []interface{}{"255.255.255.255/32"},
+	},
+}}
+
+// before returns middlewares applied before basic auth
+func (o *HTTPOptionsS) before() []httpMiddlewareS {
+	res := []httpMiddlewareS{}
+
+	if len(o.IPAllow) > 0 {
+		res = append(res, httpMiddlewareS{"ip-allow", map[string]interface{}{
+			"ipWhiteList": map[string]interface{}{
+				"sourceRange": stringsToInterface(o.IPAllow),
+			},
+		}})
+	}
+	if o.RateLimit != nil {
+		res = append(res, httpMiddlewareS{"rate-limit", o.RateLimit.spec()})
+	}
+	for idx, r := range o.Redirects {
+		res = append(res, httpMiddlewareS{fmt.Sprint("redirect-", idx), map[string]interface{}{
+			"redirectRegex": map[string]interface{}{
+				"regex":       r.Regex,
+				"replacement": r.Replacement,
+				"permanent":   r.Permanent,
+			},
+		}})
+	}
+	if o.ForwardAuth != nil {
+		spec := map[string]interface{}{
+			"address":            o.ForwardAuth.Address,
+			"trustForwardHeader": o.ForwardAuth.TrustForwardHeader,
+		}
+		if len(o.ForwardAuth.AuthRequestHeaders) > 0 {
+			spec["authRequestHeaders"] = stringsToInterface(o.ForwardAuth.AuthRequestHeaders)
+		}
+		if len(o.ForwardAuth.AuthResponseHeaders) > 0 {
+			spec["authResponseHeaders"] = stringsToInterface(o.ForwardAuth.AuthResponseHeaders)
+		}
+		if o.ForwardAuth.InsecureSkipVerify {
+			spec["tls"] = map[string]interface{}{"insecureSkipVerify": true}
+		}
+		res = append(res, httpMiddlewareS{"forward-auth", map[string]interface{}{"forwardAuth": spec}})
+	}
+	return res
+}
+
+// after returns middlewares applied after basic auth
+func (o *HTTPOptionsS) after() []httpMiddlewareS {
+	res := []httpMiddlewareS{}
+
+	if o.Wake != "" {
+		res = append(res, httpMiddlewareS{"wake", map[string]interface{}{
+			"forwardAuth": map[string]interface{}{
+				"address": o.Wake,
+			},
+		}})
+	}
+
+	if o.Headers != nil && (len(o.Headers.Request) > 0 || len(o.Headers.Response) > 0) {
+		spec := map[string]interface{}{}
+		if len(o.Headers.Request) > 0 {
+			spec["customRequestHeaders"] = stringMapToInterface(o.Headers.Request)
+		}
+		if len(o.Headers.Response) > 0 {
+			spec["customResponseHeaders"] = stringMapToInterface(o.Headers.Response)
+		}
+		res = append(res, httpMiddlewareS{"headers", map[string]interface{}{"headers": spec}})
+	}
+	if o.CORS != nil {
+		spec := map[string]interface{}{
+			"accessControlAllowOriginList":  stringsToInterface(o.CORS.AllowOrigins),
+			"accessControlAllowMethods":     stringsToInterface(o.CORS.AllowMethods),
+			"accessControlAllowHeaders":     stringsToInterface(o.CORS.AllowHeaders),
+			"accessControlExposeHeaders":    stringsToInterface(o.CORS.ExposeHeaders),
+			"accessControlAllowCredentials": o.CORS.AllowCredentials,
+			"addVaryHeader":                 true,
+		}
+		if o.CORS.MaxAge > 0 {
+			spec["accessControlMaxAge"] = int64(o.CORS.MaxAge)
+		}
+		res = append(res, httpMiddlewareS{"cors", map[string]interface{}{"headers": spec}})
+	}
+	for idx, r := range o.Rewrites {
+		res = append(res, httpMiddlewareS{fmt.Sprint("rewrite-", idx), map[string]interface{}{
+			"replacePathRegex": map[string]interface{}{
+				"regex":       r.Regex,
+				"replacement": r.Replacement,
+			},
+		}})
+	}
+	if o.Compress {
+		res = append(res, httpMiddlewareS{"compress", map[string]interface{}{
+			"compress": map[string]interface{}{},
+		}})
+	}
+	if o.Retry != nil {
+		spec := map[string]interface{}{
+			"attempts": int64(o.Retry.Attempts),
+		}
+		if o.Retry.InitialInterval != "" {
+			spec["initialInterval"] = o.Retry.InitialInterval
+		}
+		res = append(res, httpMiddlewareS{"retry", map[string]interface{}{"retry": spec}})
+	}
+	if o.CircuitBreaker != "" {
+		res = append(res, httpMiddlewareS{"circuit-breaker", map[string]interface{}{
+			"circuitBreaker": map[string]interface{}{
+				"expression": o.CircuitBreaker,
+			},
+		}})
+	}
+	return res
+}
+
+// middlewares of ingress which are not used anymore are deleted when names change,
+// key='namespace/ingress-name', value=joined names
+var ingressMiddlewaresMap = maps.NewSafe[string, string](nil)
+
+// traefikMiddlewaresApply creates middlewares of ingress and returns their references
+func (i Ingress2S) traefikMiddlewaresApply(list []httpMiddlewareS) ([]string, *log.RecordS) {
+	refs := []string{}
+	for _, m := range list {
+		name := conv.KeyString(i.Name + "-" + m.name)
+		if err := traefikCRDApply(i.KubeClient, "Middleware", i.Namespace, name, i.Labels, m.spec); err != nil {
+			return nil, err
+		}
+		refs = append(refs, fmt.Sprintf("%s-%s@kubernetescrd", i.Namespace, name))
+	}
+	return refs, nil
+}
+
+// traefikMiddlewaresCleanup deletes middlewares created by traefikMiddlewaresApply
+// for ingress which are not in names
+func (i Ingress2S) traefikMiddlewaresCleanup(names []string) *log.RecordS {
+	if len(i.Labels) == 0 {
+		return nil
+	}
+
+	keep := []string{}
+	keepSet := map[string]bool{}
+	for _, ref := range names {
+		name := strings.TrimSuffix(strings.TrimPrefix(ref, i.Namespace+"-"), "@kubernetescrd")
+		keep = append(keep, name)
+		keepSet[name] = true
+	}
+	sort.Strings(keep)
+
+	key := i.Namespace + "/" + i.Name
+	joined := strings.Join(keep, ",")
+	if v, ok := ingressMiddlewaresMap.GetFull(key); ok && v == joined {
+		return nil
+	}
+
+	prefix := conv.KeyString(i.Name) + "-"
+	list, err := traefikCRDList(i.KubeClient, "Middleware", i.Namespace, i.Labels)
+	if err != nil {
+		return err
+	}
+	for idx := range list.Items {
+		name := list.Items[idx].GetName()
+		if !strings.HasPrefix(name, prefix) || keepSet[name] {
+			continue
+		}
+		if err := i.KubeClient.CRD.Delete(i.KubeClient.CTX, &list.Items[idx]); err != nil {
+			return log.Error(err)
+		}
+	}
+
+	ingressMiddlewaresMap.Set(key, joined)
+	return nil
+}
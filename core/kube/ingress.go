@@ -13,10 +13,12 @@ import (
 )
 
 type DomainPathS struct {
-	ElementName string `toml:"element"`
-	Port        int32  `toml:"port"`
-	Prefix      string `toml:"prefix"`
-	Label       string `toml:"label"`
+	ElementName string      `toml:"element"`
+	Port        int32       `toml:"port"`
+	Prefix      string      `toml:"prefix"`
+	Scheme      string      `toml:"scheme"` // http (default), h2c (eg. gRPC without TLS), https
+	RateLimit   *RateLimitS `toml:"rate-limit"`
+	Label       string      `toml:"label"`
 }
 
 func cmdRunAndPrintOutput(args ...string) (success bool) {
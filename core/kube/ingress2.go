@@ -6,6 +6,7 @@ import (
 	"lib/tlog"
 	log "lib/tlog"
 	"lib/utils/conv"
+	"lib/utils/maps"
 	"reflect"
 	"sort"
 	"strings"
@@ -20,6 +21,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// ingresses without IngressRoute, key='namespace/name'
+var ingressRoutesDeletedMap = maps.NewSafe[string, bool](nil)
+
 // Ingress2S ...
 type Ingress2S struct {
 	KubeClient          *ClientS
@@ -40,6 +44,7 @@ type Ingress2S struct {
 	HeaderBufferSize    int // default 8k, large-client-header-buffers
 	Obj                 *netV1.Ingress
 	Auth                string
+	HTTP                HTTPOptionsS // rate limits, IP lists, headers...
 }
 
 func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
@@ -90,6 +95,7 @@ func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
 
 	// ---
 	traefikMiddlewares := []string{}
+	rewriteMiddlewares := 0 // first middlewares are path rewrites of ingress paths
 	pathTypePrefix := netV1.PathTypePrefix
 	paths := []netV1.HTTPIngressPath{}
 
@@ -99,9 +105,34 @@ func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
 	}
 	sort.Strings(keys)
 
+	routePaths := map[string]*DomainPathS{}
+	routeMiddlewares := map[string][]string{}
+	ownMiddlewares := []string{} // created by traefikMiddlewaresApply
+
 	for _, path := range keys {
 		target := i.Paths[path]
 
+		// h2c and https backends, and paths with own rate limit are routed by IngressRoute
+		if target.Scheme != "" && target.Scheme != "http" || target.RateLimit != nil {
+			routePaths[path] = target
+			if target.RateLimit != nil {
+				refs, err := i.traefikMiddlewaresApply([]httpMiddlewareS{{"rate-limit-" + path, target.RateLimit.spec()}})
+				if err != nil {
+					return "", err
+				}
+				routeMiddlewares[path] = append(routeMiddlewares[path], refs...)
+				ownMiddlewares = append(ownMiddlewares, refs...)
+			}
+			if target.Prefix != "" {
+				middleware, err := i.traefikPathRewriteAdd(path, target.Prefix)
+				if log.Error(err) != nil {
+					return "", log.Error(err)
+				}
+				routeMiddlewares[path] = append(routeMiddlewares[path], middleware)
+			}
+			continue
+		}
+
 		// Set ingress paths
 		paths = append(paths, netV1.HTTPIngressPath{
 			Path:     path,
@@ -123,6 +154,7 @@ func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
 				return "", log.Error(err)
 			}
 			traefikMiddlewares = append(traefikMiddlewares, middleware)
+			rewriteMiddlewares++
 		}
 
 	}
@@ -175,6 +207,13 @@ func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
 		traefikMiddlewares = append(traefikMiddlewares, "timoni-remove-www@kubernetescrd")
 	}
 
+	refs, e := i.traefikMiddlewaresApply(i.HTTP.before())
+	if e != nil {
+		return "", e
+	}
+	traefikMiddlewares = append(traefikMiddlewares, refs...)
+	ownMiddlewares = append(ownMiddlewares, refs...)
+
 	if i.Auth != "" {
 		// ingress basic auth
 		// ---------------------------
@@ -206,6 +245,68 @@ func (i *Ingress2S) CreateOrUpdate() (diff string, status *log.RecordS) {
 		traefikMiddlewares = append(traefikMiddlewares, fmt.Sprintf("%s-%s@kubernetescrd", i.Namespace, authSecretName))
 	}
 
+	refs, e = i.traefikMiddlewaresApply(i.HTTP.after())
+	if e != nil {
+		return "", e
+	}
+	traefikMiddlewares = append(traefikMiddlewares, refs...)
+	ownMiddlewares = append(ownMiddlewares, refs...)
+
+	if len(i.HTTP.IPDeny) > 0 {
+		refs, e = i.traefikMiddlewaresApply([]httpMiddlewareS{ipDenyMiddleware})
+		if e != nil {
+			return "", e
+		}
+		ownMiddlewares = append(ownMiddlewares, refs...)
+	}
+	if e := i.traefikMiddlewaresCleanup(ownMiddlewares); e != nil {
+		return "", e
+	}
+
+	// IngressRoute
+	routeName := i.Name + "-route"
+	if len(routePaths) > 0 || len(i.HTTP.IPDeny) > 0 {
+		route := ingressRouteS{
+			KubeClient:      i.KubeClient,
+			Namespace:       i.Namespace,
+			Name:            routeName,
+			Labels:          i.Labels,
+			Domains:         []string{i.Domain},
+			Paths:           routePaths,
+			Middlewares:     traefikMiddlewares[rewriteMiddlewares:],
+			PathMiddlewares: routeMiddlewares,
+			DenyIPs:         i.HTTP.IPDeny,
+		}
+		if len(i.HTTP.IPDeny) > 0 {
+			route.DenyMiddleware = fmt.Sprintf("%s-%s@kubernetescrd", i.Namespace, conv.KeyString(i.Name+"-"+ipDenyMiddleware.name))
+		}
+		if i.WWWredirect {
+			route.Domains = append(route.Domains, "www."+i.Domain)
+		}
+		if i.HTTPS {
+			route.TLSSecretName = i.HTTPSSecretName
+		}
+		if err := route.CreateOrUpdate(); err != nil {
+			return "", err
+		}
+
+		ingressRoutesDeletedMap.Delete(i.Namespace + "/" + i.Name)
+
+	} else if key := i.Namespace + "/" + i.Name; len(i.Labels) > 0 && !ingressRoutesDeletedMap.Exists(key) {
+		if err := TraefikCRDCleanup(i.KubeClient, TraefikKindIngressRoute, i.Namespace, i.Labels, ""); err != nil {
+			return "", err
+		}
+		ingressRoutesDeletedMap.Set(key, true)
+	}
+
+	if len(paths) == 0 {
+		// all paths are routed by IngressRoute
+		if len(ingressOld) > 0 {
+			return "ingress deleted", log.Error(ingressCtl.Delete(i.KubeClient.CTX, i.Name, metav1.DeleteOptions{}))
+		}
+		return "", nil
+	}
+
 	// Apply middlewares
 	if len(traefikMiddlewares) > 0 {
 		ingress.ObjectMeta.Annotations["traefik.ingress.kubernetes.io/router.middlewares"] = strings.Join(traefikMiddlewares, ",")
@@ -0,0 +1,283 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	log "lib/tlog"
+	"lib/utils/maps"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	TraefikKindIngressRoute    = "IngressRoute"
+	TraefikKindIngressRouteTCP = "IngressRouteTCP"
+	TraefikKindIngressRouteUDP = "IngressRouteUDP"
+)
+
+// TraefikEntryPointS is additional entrypoint of ingress-traefik, used by
+// IngressRouteTCP and IngressRouteUDP of domain elements.
+type TraefikEntryPointS struct {
+	Name     string // eg. tcp-5432
+	Protocol string // tcp, udp
+	Port     int32
+}
+
+// TraefikEntryPointsActive are entrypoints configured in running ingress-traefik, key=name
+var TraefikEntryPointsActive = maps.NewSafe[string, TraefikEntryPointS](nil)
+
+func TraefikEntryPointGet(protocol string, port int32) TraefikEntryPointS {
+	return TraefikEntryPointS{
+		Name:     fmt.Sprintf("%s-%d", protocol, port),
+		Protocol: protocol,
+		Port:     port,
+	}
+}
+
+// Arg returns traefik static configuration of entrypoint
+func (e TraefikEntryPointS) Arg() string {
+	return fmt.Sprintf("--entrypoints.%s.address=:%d/%s", e.Name, e.Port, e.Protocol)
+}
+
+// IngressRouteTCPS is Traefik IngressRouteTCP, connections of entrypoint are
+// routed by SNI (TLS) or all of them when Domain is empty.
+type IngressRouteTCPS struct {
+	KubeClient     *ClientS
+	Namespace      string
+	Name           string
+	Labels         map[string]string
+	EntryPoint     string
+	Domain         string // HostSNI, empty = `*` (plain TCP, only one route per entrypoint)
+	TLSSecretName  string // TLS terminated by traefik
+	TLSPassthrough bool   // TLS terminated by service
+	ServiceName    string
+	ServicePort    int32
+}
+
+func (r *IngressRouteTCPS) CreateOrUpdate() *log.RecordS {
+	sni := "*"
+	if r.Domain != "" {
+		sni = r.Domain
+	}
+
+	spec := map[string]interface{}{
+		"entryPoints": []interface{}{r.EntryPoint},
+		"routes": []interface{}{
+			map[string]interface{}{
+				"match": fmt.Sprintf("HostSNI(`%s`)", sni),
+				"services": []interface{}{
+					map[string]interface{}{
+						"name": r.ServiceName,
+						"port": int64(r.ServicePort),
+					},
+				},
+			},
+		},
+	}
+	switch {
+	case r.TLSPassthrough:
+		spec["tls"] = map[string]interface{}{"passthrough": true}
+	case r.TLSSecretName != "":
+		spec["tls"] = map[string]interface{}{"secretName": r.TLSSecretName}
+	}
+
+	return traefikCRDApply(r.KubeClient, TraefikKindIngressRouteTCP, r.Namespace, r.Name, r.Labels, spec)
+}
+
+// IngressRouteUDPS is Traefik IngressRouteUDP, UDP has no SNI so entrypoint
+// can be used by one route only.
+type IngressRouteUDPS struct {
+	KubeClient  *ClientS
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	EntryPoint  string
+	ServiceName string
+	ServicePort int32
+}
+
+func (r *IngressRouteUDPS) CreateOrUpdate() *log.RecordS {
+	spec := map[string]interface{}{
+		"entryPoints": []interface{}{r.EntryPoint},
+		"routes": []interface{}{
+			map[string]interface{}{
+				"services": []interface{}{
+					map[string]interface{}{
+						"name": r.ServiceName,
+						"port": int64(r.ServicePort),
+					},
+				},
+			},
+		},
+	}
+
+	return traefikCRDApply(r.KubeClient, TraefikKindIngressRouteUDP, r.Namespace, r.Name, r.Labels, spec)
+}
+
+// ingressRouteS is Traefik IngressRoute for paths with backends which can't
+// be described by networking/v1 Ingress (h2c, https).
+type ingressRouteS struct {
+	KubeClient      *ClientS
+	Namespace       string
+	Name            string
+	Labels          map[string]string
+	Domains         []string
+	Paths           map[string]*DomainPathS
+	Middlewares     []string            // used by all paths
+	PathMiddlewares map[string][]string // key=path, used before Middlewares
+	DenyIPs         []string            // requests from IPs are rejected by DenyMiddleware
+	DenyMiddleware  string
+	TLSSecretName   string
+}
+
+func (r *ingressRouteS) CreateOrUpdate() *log.RecordS {
+	hosts := []string{}
+	for _, domain := range r.Domains {
+		hosts = append(hosts, fmt.Sprintf("Host(`%s`)", domain))
+	}
+
+	keys := []string{}
+	for k := range r.Paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	routes := []interface{}{}
+	for _, path := range keys {
+		target := r.Paths[path]
+		scheme := target.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		route := map[string]interface{}{
+			"kind":  "Rule",
+			"match": fmt.Sprintf("(%s) && PathPrefix(`%s`)", strings.Join(hosts, " || "), path),
+			"services": []interface{}{
+				map[string]interface{}{
+					"name":   target.ElementName,
+					"port":   int64(target.Port),
+					"scheme": scheme,
+				},
+			},
+		}
+		middlewares := []interface{}{}
+		for _, name := range append(append([]string{}, r.PathMiddlewares[path]...), r.Middlewares...) {
+			middlewares = append(middlewares, map[string]interface{}{"name": name})
+		}
+		if len(middlewares) > 0 {
+			route["middlewares"] = middlewares
+		}
+		routes = append(routes, route)
+	}
+
+	if len(r.DenyIPs) > 0 {
+		ips := []string{}
+		for _, ip := range r.DenyIPs {
+			ips = append(ips, "`"+ip+"`")
+		}
+		routes = append(routes, map[string]interface{}{
+			"kind":     "Rule",
+			"match":    fmt.Sprintf("(%s) && ClientIP(%s)", strings.Join(hosts, " || "), strings.Join(ips, ", ")),
+			"priority": int64(1000000),
+			"middlewares": []interface{}{
+				map[string]interface{}{"name": r.DenyMiddleware},
+			},
+			"services": []interface{}{
+				map[string]interface{}{
+					"name": "noop@internal",
+					"kind": "TraefikService",
+				},
+			},
+		})
+	}
+
+	spec := map[string]interface{}{
+		"entryPoints": []interface{}{"web"},
+		"routes":      routes,
+	}
+	if r.TLSSecretName != "" {
+		spec["entryPoints"] = []interface{}{"web", "websecure"}
+		spec["tls"] = map[string]interface{}{"secretName": r.TLSSecretName}
+	}
+
+	return traefikCRDApply(r.KubeClient, TraefikKindIngressRoute, r.Namespace, r.Name, r.Labels, spec)
+}
+
+func traefikCRD(kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "traefik.containo.us",
+		Version: "v1alpha1",
+		Kind:    kind,
+	})
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// traefikCRDApply creates Traefik object or updates it when spec or labels are changed
+func traefikCRDApply(kClient *ClientS, kind, namespace, name string, labels map[string]string, spec map[string]interface{}) *log.RecordS {
+
+	if kClient == nil {
+		return log.Error("KubeClient cant be empty")
+	}
+	if name == "" || namespace == "" {
+		return log.Error("Name and Namespace cant be empty")
+	}
+
+	obj := traefikCRD(kind, namespace, name)
+	err := kClient.CRD.Get(kClient.CTX, client.ObjectKeyFromObject(obj), obj)
+	if err != nil {
+		obj = traefikCRD(kind, namespace, name)
+		obj.SetLabels(labels)
+		obj.Object["spec"] = spec
+		return log.Error(kClient.CRD.Create(kClient.CTX, obj))
+	}
+
+	// numbers of object from API are int64, compare JSON
+	oldSpec, _ := json.Marshal(obj.Object["spec"])
+	newSpec, _ := json.Marshal(spec)
+	oldLabels, _ := json.Marshal(obj.GetLabels())
+	newLabels, _ := json.Marshal(labels)
+	if string(oldSpec) == string(newSpec) && string(oldLabels) == string(newLabels) {
+		return nil
+	}
+
+	obj.SetLabels(labels)
+	obj.Object["spec"] = spec
+	return log.Error(kClient.CRD.Update(kClient.CTX, obj))
+}
+
+func traefikCRDList(kClient *ClientS, kind, namespace string, labels map[string]string) (*unstructured.UnstructuredList, *log.RecordS) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "traefik.containo.us",
+		Version: "v1alpha1",
+		Kind:    kind + "List",
+	})
+	err := kClient.CRD.List(kClient.CTX, list, client.InNamespace(namespace), client.MatchingLabels(labels))
+	return list, log.Error(err)
+}
+
+// TraefikCRDCleanup deletes Traefik objects of kind matching labels, except keep
+func TraefikCRDCleanup(kClient *ClientS, kind, namespace string, labels map[string]string, keep string) *log.RecordS {
+
+	list, err := traefikCRDList(kClient, kind, namespace, labels)
+	if err != nil {
+		return err
+	}
+
+	for i := range list.Items {
+		if list.Items[i].GetName() == keep {
+			continue
+		}
+		if err := kClient.CRD.Delete(kClient.CTX, &list.Items[i]); err != nil {
+			return log.Error(err)
+		}
+	}
+	return nil
+}
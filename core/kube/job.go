@@ -0,0 +1,142 @@
+package kube
+
+import (
+	"errors"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JobS runs pod to completion once, eg. backup or restore of database
+type JobS struct {
+	KubeClient     *ClientS
+	Namespace      string
+	Name           string
+	Labels         map[string]string
+	InitContainers []corev1.Container
+	Containers     []corev1.Container
+	Volumes        []corev1.Volume
+	Obj            *batchv1.Job
+}
+
+type JobStatusS int
+
+const (
+	JobStatusRunning JobStatusS = iota
+	JobStatusSucceeded
+	JobStatusFailed
+	JobStatusNotFound
+)
+
+func (j *JobS) Create() error {
+
+	if j.KubeClient == nil {
+		return errors.New("KubeClient cant be empty")
+	}
+	if j.Name == "" || j.Namespace == "" {
+		return errors.New("Name and Namespace cant be empty")
+	}
+
+	// logs of failed container are kept as its termination message
+	for _, list := range [][]corev1.Container{j.InitContainers, j.Containers} {
+		for i := range list {
+			list[i].TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+		}
+	}
+
+	backoffLimit := int32(0)
+	ttl := int32(24 * 60 * 60)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   j.Name,
+			Labels: j.Labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: j.Labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: BoolPtr(false),
+					EnableServiceLinks:           BoolPtr(false),
+					InitContainers:               j.InitContainers,
+					Containers:                   j.Containers,
+					Volumes:                      j.Volumes,
+				},
+			},
+		},
+	}
+
+	var err error
+	j.Obj, err = j.KubeClient.API.BatchV1().Jobs(j.Namespace).Create(j.KubeClient.CTX, job, metav1.CreateOptions{})
+	return err
+}
+
+// Status returns state of job and, when it failed, termination message of
+// failed container
+func (j *JobS) Status() (JobStatusS, string) {
+
+	job, err := j.KubeClient.API.BatchV1().Jobs(j.Namespace).Get(j.KubeClient.CTX, j.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return JobStatusNotFound, "job not found"
+	}
+	if err != nil {
+		return JobStatusRunning, ""
+	}
+	j.Obj = job
+
+	switch {
+	case job.Status.Succeeded > 0:
+		return JobStatusSucceeded, j.terminationMessage()
+	case job.Status.Failed > 0:
+		msg := j.terminationMessage()
+		if msg == "" {
+			msg = "job failed"
+		}
+		return JobStatusFailed, msg
+	}
+	return JobStatusRunning, ""
+}
+
+// terminationMessage returns last termination message of job containers
+func (j *JobS) terminationMessage() string {
+
+	pods, err := j.KubeClient.API.CoreV1().Pods(j.Namespace).List(j.KubeClient.CTX, metav1.ListOptions{
+		LabelSelector: "job-name=" + j.Name,
+	})
+	if err != nil {
+		return ""
+	}
+
+	msg := ""
+	for _, pod := range pods.Items {
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if t := cs.State.Terminated; t != nil && t.Message != "" {
+				msg = strings.TrimSpace(t.Message)
+				if t.ExitCode != 0 {
+					return cs.Name + ": " + msg
+				}
+			}
+		}
+	}
+	return msg
+}
+
+// Delete removes job with its pods
+func (j *JobS) Delete() error {
+	propagation := metav1.DeletePropagationBackground
+	err := j.KubeClient.API.BatchV1().Jobs(j.Namespace).Delete(j.KubeClient.CTX, j.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
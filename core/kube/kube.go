@@ -79,6 +79,7 @@ type ClientS struct {
 	CTX     context.Context
 	Dynamic *dynamic.DynamicClient
 	Metrics *metricsv.Clientset
+	Cluster string // name of cluster, empty for local one
 
 	IngressOldVersion bool
 }
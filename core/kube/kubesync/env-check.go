@@ -4,12 +4,20 @@ import (
 	"core/db"
 	"core/kube"
 	"lib/tlog"
+	"strings"
 	"sync"
 	"time"
 )
 
-func envCheck(env *db.EnvironmentS) {
-	defer db.PanicHandler()
+// prefixes of dependency alerts of element, alerts of other sources are kept
+const (
+	alertDependsOnMissing = "depends-on element not found: "
+	alertDependsOnWaiting = "waiting for "
+)
+
+// envCheck applies env to its cluster, error is returned when env could not
+// be checked and should be retried
+func envCheck(env *db.EnvironmentS) *tlog.RecordS {
 
 	timeStart := time.Now()
 	defer func() {
@@ -22,17 +30,18 @@ func envCheck(env *db.EnvironmentS) {
 		}
 	}()
 
-	kClient := kube.GetKube()
-	if kClient == nil {
-		tlog.Error("kube.Client not ready")
-		return
+	// env is moved to other cluster
+	if env.ClusterMigrationResume() {
+		return nil
 	}
 
-	defer func() {
-		defer envLoopCheckingLock.Unlock()
-		envLoopCheckingLock.Lock()
-		envLoopChecking[env.ID] = false
-	}()
+	kClient := env.KubeClient()
+	if kClient == nil {
+		return tlog.Error("kube.Client of cluster {{cluster}} not ready", tlog.Vars{
+			"env":     env.ID,
+			"cluster": env.ClusterName,
+		})
+	}
 
 	if env.ToDelete {
 
@@ -40,7 +49,7 @@ func envCheck(env *db.EnvironmentS) {
 		ns := kClient.NamespaceGet(env.ID)
 		if ns == nil {
 			env.Delete(nil)
-			return
+			return nil
 		}
 
 		if ns.Status.Phase != "Terminating" {
@@ -48,7 +57,7 @@ func envCheck(env *db.EnvironmentS) {
 			kClient.NamespaceDelete(env.ID)
 		}
 
-		return
+		return nil
 	}
 
 
@@ -58,39 +67,64 @@ func envCheck(env *db.EnvironmentS) {
 	}
 
 
-	go updateResources(env)
+	go updateResources(env, kClient)
+	env.QuotaApply(kClient)
 
 	if env.GitOps.Enabled {
 		env.FromGitOps()
 	}
 
-	wg := new(sync.WaitGroup)
-	for _, elName := range env.Elements.Keys() {
-		element := env.GetElement(elName)
-		if element.GetToDelete() {
-			if element.DeleteFromKube() == nil {
-				env.ElementDelete(elName, nil)
+	// elements are applied level by level, element waits until its
+	// dependencies are ready
+	for _, level := range env.ElementLevels() {
+		wg := new(sync.WaitGroup)
+		for _, elName := range level {
+			element := env.GetElement(elName)
+			if element.GetToDelete() {
+				if element.DeleteFromKube() == nil {
+					env.ElementDelete(elName, nil)
+				}
+				continue
+			}
+
+			if !element.GetActive() {
+				element.DeleteFromKube()
+				continue
+			}
+
+			es := element.GetStatus()
+			missing := env.ElementDependenciesMissing(element)
+			es.SetAlert(alertDependsOnMissing, strings.Join(missing, ", "))
+			if len(missing) > 0 {
+				es.SetAlert(alertDependsOnWaiting, "")
+				es.Save()
+				continue
+			}
+
+			waiting := env.ElementDependenciesWaiting(element)
+			es.SetAlert(alertDependsOnWaiting, strings.Join(waiting, ", "))
+			if len(waiting) > 0 {
+				if es.State == db.ElementStatusNew {
+					es.State = db.ElementStatusDeploying
+				}
+				es.Save()
+				continue
 			}
-			continue
-		}
 
-		if element.GetActive() {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
 				element.KubeApply()
 			}()
-		} else {
-			element.DeleteFromKube()
 		}
+		wg.Wait()
 	}
-	wg.Wait()
+	return nil
 }
 
-func updateResources(env *db.EnvironmentS) {
+func updateResources(env *db.EnvironmentS, cli *kube.ClientS) {
 	requestedCPU := 0
 	requestedRAM := 0
-	cli := kube.GetKube()
 	for _, v := range cli.PodListAll(env.ID) {
 		for _, pod := range v.Obj.Spec.Containers {
 			requestedCPU += int(pod.Resources.Requests.Cpu().Value())
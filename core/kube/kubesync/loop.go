@@ -6,17 +6,11 @@ import (
 	"core/db2"
 	"core/kube"
 	"lib/tlog"
-	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var (
-	envLoopCheckingLock = &sync.Mutex{}
-	envLoopChecking     = map[string]bool{}
-)
-
 func Loop() {
 	defer db.PanicHandler()
 	kClient := kube.GetKube()
@@ -29,12 +23,14 @@ func Loop() {
 		}
 
 		// start scheduler
-		if env.Schedule.Configured() {
+		if env.ScheduleConfigured() {
 			env.StartSchedule(nil)
 		}
 	}
 
 	go GarbagePodCollectorLoop()
+	go wakeServe()
+	go wakeServiceCreate()
 
 	targetGitTag := db2.TheSettings.ReleaseGitTag()
 	if config.GitTag != "???" && config.GitTag != targetGitTag {
@@ -47,8 +43,25 @@ func Loop() {
 
 	// ------------------------------------------------------------------
 
+	db.EnvChanged = envEnqueue
+	for i := 0; i < reconcileWorkers; i++ {
+		go reconcileWorker()
+	}
+	envEnqueueAll()
+
+	lastResync := time.Now()
 	for {
+		watchClusters()
+
 		go kClient.PodCacheUpdate()
+		for _, c := range kube.ClusterList() {
+			if c.Local || !c.Enabled {
+				continue
+			}
+			if cClient := kube.GetKubeCluster(c.Name); cClient != nil {
+				go cClient.PodCacheUpdate()
+			}
+		}
 		kube.LastSyncTime = time.Now().UTC()
 		kClient.UpdateNodesInfo()
 		cpu, ram, _ := kube.GetKube().GetClusterUsage(false)
@@ -57,16 +70,10 @@ func Loop() {
 		db.System.ClusterInfo.Resources.CPUCapacity = kube.NodesInfo.TotalCpus
 		db.System.ClusterInfo.Resources.RAMCapacity = kube.NodesInfo.TotalMem
 
-		envLoopCheckingLock.Lock()
-		for _, env := range db.EnvironmentMap.Values() {
-
-			if !envLoopChecking[env.ID] {
-				envLoopChecking[env.ID] = true
-				go envCheck(env)
-			}
-
+		if time.Since(lastResync) > reconcileResync {
+			lastResync = time.Now()
+			envEnqueueAll()
 		}
-		envLoopCheckingLock.Unlock()
 
 		time.Sleep(4 * time.Second)
 	}
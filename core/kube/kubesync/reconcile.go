@@ -0,0 +1,104 @@
+package kubesync
+
+import (
+	"core/db"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Envs are reconciled by workers of rate limited queue. Env is queued when it
+// or its element is saved, when watched objects of its namespace change and
+// on periodic resync. Env with failed elements is retried with backoff
+// growing per env, env with elements in progress is checked again shortly.
+
+const (
+	reconcileWorkers       = 8
+	reconcileResync        = 5 * time.Minute
+	reconcileProgressDelay = 4 * time.Second
+	reconcileGitOpsDelay   = 30 * time.Second
+)
+
+var envQueue = workqueue.NewNamedRateLimitingQueue(
+	workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(2*time.Second, 5*time.Minute),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(20), 100)},
+	),
+	"envs",
+)
+
+// envEnqueue queues env to be checked, other IDs are ignored
+func envEnqueue(envID string) {
+	if envID != "" && db.EnvironmentMap.Exists(envID) {
+		envQueue.Add(envID)
+	}
+}
+
+// envEnqueueAll queues all envs, it is resync of missed changes
+func envEnqueueAll() {
+	for _, envID := range db.EnvironmentMap.Keys() {
+		envQueue.Add(envID)
+	}
+}
+
+func reconcileWorker() {
+	for {
+		item, shutdown := envQueue.Get()
+		if shutdown {
+			return
+		}
+		reconcile(item.(string))
+	}
+}
+
+func reconcile(envID string) {
+	defer envQueue.Done(envID)
+	defer db.PanicHandler()
+
+	env := db.EnvironmentMap.Get(envID)
+	if env == nil {
+		envQueue.Forget(envID)
+		return
+	}
+
+	if err := envCheck(env); err != nil {
+		envQueue.AddRateLimited(envID)
+		return
+	}
+	if !db.EnvironmentMap.Exists(envID) {
+		envQueue.Forget(envID)
+		return
+	}
+
+	failed, inProgress := envElementsState(env)
+	if failed {
+		envQueue.AddRateLimited(envID)
+		return
+	}
+	envQueue.Forget(envID)
+
+	switch {
+	case inProgress || env.ToDelete || env.ClusterMigration != nil:
+		envQueue.AddAfter(envID, reconcileProgressDelay)
+	case env.GitOps.Enabled:
+		envQueue.AddAfter(envID, reconcileGitOpsDelay)
+	}
+}
+
+// envElementsState returns if any element failed or is not settled yet
+func envElementsState(env *db.EnvironmentS) (failed bool, inProgress bool) {
+	for _, elName := range env.Elements.Keys() {
+		element := env.GetElement(elName)
+		if element == nil {
+			continue
+		}
+		switch element.GetStatus().State {
+		case db.ElementStatusFailed:
+			failed = true
+		case db.ElementStatusNew, db.ElementStatusBuilding, db.ElementStatusDeploying, db.ElementStatusTerminating:
+			inProgress = true
+		}
+	}
+	return failed, inProgress
+}
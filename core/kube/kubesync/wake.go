@@ -0,0 +1,78 @@
+package kubesync
+
+import (
+	"core/config"
+	"core/db"
+	"core/kube"
+	"lib/tlog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Domains of envs with idle sleep call wake endpoint through traefik
+// forwardAuth on each request. Endpoint marks activity of env and holds
+// request until sleeping elements are ready, 2xx lets request through.
+
+const wakePage = `<!DOCTYPE html>
+<html><head><meta http-equiv="refresh" content="5"><title>Starting</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 20vh">
+Environment is starting, this page will reload in a moment...
+</body></html>`
+
+func wakeServe() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wake/", wakeHandler)
+	tlog.Fatal(http.ListenAndServe(":"+config.WakeHTTPPort(), mux))
+}
+
+func wakeHandler(w http.ResponseWriter, r *http.Request) {
+	env := db.EnvironmentMap.Get(strings.TrimPrefix(r.URL.Path, "/wake/"))
+	if env == nil || env.ToDelete {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	wait, _ := strconv.Atoi(config.WakeWaitSec())
+	if wait <= 0 {
+		wait = 25
+	}
+	if env.Wake(time.Duration(wait) * time.Second) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", "5")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(wakePage))
+}
+
+// wakeServiceCreate creates service used by forwardAuth of env domains
+func wakeServiceCreate() {
+	port, _ := strconv.Atoi(config.WakeHTTPPort())
+	name, namespace := db.WakeService()
+
+	svc := kube.ServiceS{
+		KubeClient: kube.GetKube(),
+		Namespace:  namespace,
+		Name:       name,
+		Ports:      map[int32]int32{int32(port): int32(port)},
+		TargetSelector: map[string]string{
+			"element": "core",
+		},
+		Labels: map[string]string{
+			"element": name,
+		},
+	}
+	for {
+		_, err := svc.CreateOrUpdate()
+		if tlog.Error(err) == nil {
+			return
+		}
+		tlog.Warning("Waiting for core-wake service ...")
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,116 @@
+package kubesync
+
+import (
+	"core/kube"
+	"lib/tlog"
+	"lib/utils/maps"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watches of clusters queue env when objects in its namespace change:
+// deployments, statefulsets and pods made by Timoni, and warning events.
+
+type clusterWatchS struct {
+	kClient *kube.ClientS
+	stop    chan struct{}
+}
+
+var clusterWatchMap = maps.NewSafe[string, *clusterWatchS](nil) // key=cluster-name, local is empty
+
+// watchClusters starts watch of each reachable cluster and stops watches of
+// removed ones, watch is started again when client of cluster is changed
+func watchClusters() {
+
+	current := map[string]*kube.ClientS{"": kube.GetKube()}
+	for _, c := range kube.ClusterList() {
+		if c.Local || !c.Enabled {
+			continue
+		}
+		current[c.Name] = kube.GetKubeCluster(c.Name)
+	}
+
+	for name, kClient := range current {
+		w := clusterWatchMap.Get(name)
+		if w != nil && w.kClient == kClient {
+			continue
+		}
+		if w != nil {
+			close(w.stop)
+			clusterWatchMap.Delete(name)
+		}
+		if kClient == nil {
+			continue
+		}
+		clusterWatchMap.Set(name, watchCluster(kClient))
+	}
+
+	for _, name := range clusterWatchMap.Keys() {
+		if _, ok := current[name]; !ok {
+			close(clusterWatchMap.Get(name).stop)
+			clusterWatchMap.Delete(name)
+		}
+	}
+}
+
+func watchCluster(kClient *kube.ClientS) *clusterWatchS {
+
+	w := &clusterWatchS{
+		kClient: kClient,
+		stop:    make(chan struct{}),
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    watchEnqueue,
+		UpdateFunc: func(old, new interface{}) { watchEnqueue(new) },
+		DeleteFunc: watchEnqueue,
+	}
+
+	labeled := informers.NewSharedInformerFactoryWithOptions(kClient.API, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = "timoni-env"
+		}),
+	)
+	warnings := informers.NewSharedInformerFactoryWithOptions(kClient.API, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = "type=" + corev1.EventTypeWarning
+		}),
+	)
+
+	for _, informer := range []cache.SharedIndexInformer{
+		labeled.Apps().V1().Deployments().Informer(),
+		labeled.Apps().V1().StatefulSets().Informer(),
+		labeled.Core().V1().Pods().Informer(),
+		warnings.Core().V1().Events().Informer(),
+	} {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			tlog.Error(err, tlog.Vars{"cluster": kClient.Cluster})
+		}
+	}
+
+	labeled.Start(w.stop)
+	warnings.Start(w.stop)
+	return w
+}
+
+// watchEnqueue queues env of object, objects out of envs are ignored by queue
+func watchEnqueue(obj interface{}) {
+	if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tomb.Obj
+	}
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		envEnqueue(o.Namespace)
+	case *appsv1.StatefulSet:
+		envEnqueue(o.Namespace)
+	case *corev1.Pod:
+		envEnqueue(o.Namespace)
+	case *corev1.Event:
+		envEnqueue(o.InvolvedObject.Namespace)
+	}
+}
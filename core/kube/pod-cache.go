@@ -10,12 +10,14 @@ import (
 )
 
 var (
-	PodCache = maps.NewSafe[string, podCacheDataS](nil)
+	PodCache          = maps.NewSafe[string, podCacheDataS](nil)
+	podCacheByCluster = maps.NewSafe[string, map[string]podCacheDataS](nil) // key=cluster-name
 )
 
 type podCacheDataS struct {
-	EnvID       string
-	ElementName string
+	EnvID        string
+	ElementName  string
+	RestartCount int // of all containers, sent to node-agent
 }
 
 func (ctl *ClientS) PodCacheUpdate() {
@@ -47,12 +49,26 @@ func (ctl *ClientS) PodCacheUpdate() {
 
 			}
 		}
+		restarts := 0
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts += int(status.RestartCount)
+		}
 		tmp[podID] = podCacheDataS{
-			EnvID:       pod.Namespace,
-			ElementName: elementName,
+			EnvID:        pod.Namespace,
+			ElementName:  elementName,
+			RestartCount: restarts,
+		}
+	}
+	podCacheByCluster.Set(ctl.Cluster, tmp)
+
+	// pods of all clusters
+	all := map[string]podCacheDataS{}
+	for _, m := range podCacheByCluster.Values() {
+		for k, v := range m {
+			all[k] = v
 		}
 	}
-	PodCache = maps.New(tmp).Safe()
+	PodCache = maps.New(all).Safe()
 }
 
 func PodCacheIter() map[string]podCacheDataS {
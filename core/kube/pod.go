@@ -231,6 +231,19 @@ func (pod *PodS) RestartCount() int32 {
 	return pod.Obj.Status.ContainerStatuses[0].RestartCount
 }
 
+// LastTerminationReason returns why the last container of pod ended, eg.
+// `OOMKilled, exit code 137`
+func (pod *PodS) LastTerminationReason() string {
+	if len(pod.Obj.Status.ContainerStatuses) == 0 {
+		return ""
+	}
+	t := pod.Obj.Status.ContainerStatuses[0].LastTerminationState.Terminated
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s, exit code %d", t.Reason, t.ExitCode)
+}
+
 func (pod *PodS) StartTime() int64 {
 	if len(pod.Obj.Status.ContainerStatuses) == 0 {
 		return 0
@@ -0,0 +1,179 @@
+package kube
+
+import (
+	"encoding/json"
+	"errors"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ResourceQuotaS caps resources requested by pods of namespace, quota of
+// requests needs LimitRangeS with default requests of containers
+type ResourceQuotaS struct {
+	KubeClient *ClientS
+	Namespace  string
+	Name       string
+	Hard       corev1.ResourceList
+	Labels     map[string]string
+	Obj        *corev1.ResourceQuota
+}
+
+func (q *ResourceQuotaS) CreateOrUpdate() (diff string, err error) {
+
+	if q.KubeClient == nil {
+		return "", errors.New("KubeClient cant be empty")
+	}
+	if q.Name == "" {
+		return "", errors.New("Name cant be empty")
+	}
+	if q.Namespace == "" {
+		return "", errors.New("Namespace cant be empty")
+	}
+
+	var quotaOld []byte
+	quota, err := q.KubeClient.API.CoreV1().ResourceQuotas(q.Namespace).Get(q.KubeClient.CTX, q.Name, metav1.GetOptions{})
+	if err == nil {
+		quotaOld, err = json.Marshal(quota)
+		if err != nil {
+			panic(err)
+		}
+
+	} else {
+		quota = &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: q.Name,
+			},
+		}
+	}
+
+	quota.ObjectMeta.Labels = q.Labels
+	quota.Spec.Hard = q.Hard
+
+	// ---
+
+	if len(quotaOld) == 0 {
+		q.Obj, err = q.KubeClient.API.CoreV1().ResourceQuotas(q.Namespace).Create(q.KubeClient.CTX, quota, metav1.CreateOptions{})
+		return "creating new obj", err
+	}
+
+	quotaNew, err := json.Marshal(quota)
+	if err != nil {
+		panic(err)
+	}
+
+	patch, err := jsonpatch.CreateMergePatch(quotaOld, quotaNew)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(patch) == 2 {
+		return "", nil
+	}
+
+	q.Obj, err = q.KubeClient.API.CoreV1().ResourceQuotas(q.Namespace).Patch(q.KubeClient.CTX, q.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return string(patch), err
+}
+
+func (q *ResourceQuotaS) GetObj() *corev1.ResourceQuota {
+
+	var err error
+	q.Obj, err = q.KubeClient.API.CoreV1().ResourceQuotas(q.Namespace).Get(q.KubeClient.CTX, q.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+
+	return q.Obj
+}
+
+func (q *ResourceQuotaS) Delete() error {
+	return q.KubeClient.API.CoreV1().ResourceQuotas(q.Namespace).Delete(q.KubeClient.CTX, q.Name, metav1.DeleteOptions{})
+}
+
+// LimitRangeS sets default requests of containers without them
+type LimitRangeS struct {
+	KubeClient     *ClientS
+	Namespace      string
+	Name           string
+	DefaultRequest corev1.ResourceList
+	Labels         map[string]string
+	Obj            *corev1.LimitRange
+}
+
+func (l *LimitRangeS) CreateOrUpdate() (diff string, err error) {
+
+	if l.KubeClient == nil {
+		return "", errors.New("KubeClient cant be empty")
+	}
+	if l.Name == "" {
+		return "", errors.New("Name cant be empty")
+	}
+	if l.Namespace == "" {
+		return "", errors.New("Namespace cant be empty")
+	}
+
+	var limitOld []byte
+	limit, err := l.KubeClient.API.CoreV1().LimitRanges(l.Namespace).Get(l.KubeClient.CTX, l.Name, metav1.GetOptions{})
+	if err == nil {
+		limitOld, err = json.Marshal(limit)
+		if err != nil {
+			panic(err)
+		}
+
+	} else {
+		limit = &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: l.Name,
+			},
+		}
+	}
+
+	limit.ObjectMeta.Labels = l.Labels
+	limit.Spec.Limits = []corev1.LimitRangeItem{
+		{
+			Type:           corev1.LimitTypeContainer,
+			DefaultRequest: l.DefaultRequest,
+		},
+	}
+
+	// ---
+
+	if len(limitOld) == 0 {
+		l.Obj, err = l.KubeClient.API.CoreV1().LimitRanges(l.Namespace).Create(l.KubeClient.CTX, limit, metav1.CreateOptions{})
+		return "creating new obj", err
+	}
+
+	limitNew, err := json.Marshal(limit)
+	if err != nil {
+		panic(err)
+	}
+
+	patch, err := jsonpatch.CreateMergePatch(limitOld, limitNew)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(patch) == 2 {
+		return "", nil
+	}
+
+	l.Obj, err = l.KubeClient.API.CoreV1().LimitRanges(l.Namespace).Patch(l.KubeClient.CTX, l.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return string(patch), err
+}
+
+func (l *LimitRangeS) GetObj() *corev1.LimitRange {
+
+	var err error
+	l.Obj, err = l.KubeClient.API.CoreV1().LimitRanges(l.Namespace).Get(l.KubeClient.CTX, l.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+
+	return l.Obj
+}
+
+func (l *LimitRangeS) Delete() error {
+	return l.KubeClient.API.CoreV1().LimitRanges(l.Namespace).Delete(l.KubeClient.CTX, l.Name, metav1.DeleteOptions{})
+}
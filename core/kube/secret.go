@@ -34,6 +34,10 @@ func (s *SecretS) CreateOrUpdate() (diff string, err error) {
 		return "", errors.New("Namespace cant be empty")
 	}
 
+	desired := *s
+	desired.KubeClient, desired.Obj = nil, nil
+	hash := driftHash(desired)
+
 	var secretOld []byte
 	secret, err := s.KubeClient.API.CoreV1().Secrets(s.Namespace).Get(s.KubeClient.CTX, s.Name, metav1.GetOptions{})
 	if err == nil {
@@ -60,6 +64,9 @@ func (s *SecretS) CreateOrUpdate() (diff string, err error) {
 
 	if len(secretOld) == 0 {
 		s.Obj, err = s.KubeClient.API.CoreV1().Secrets(s.Namespace).Create(s.KubeClient.CTX, secret, metav1.CreateOptions{})
+		if err == nil {
+			driftApplied(s.KubeClient, "Secret", s.Namespace, s.Name, hash)
+		}
 		time.Sleep(1 * time.Second)
 		return "creating new obj", err
 	}
@@ -75,10 +82,16 @@ func (s *SecretS) CreateOrUpdate() (diff string, err error) {
 	}
 
 	if len(patch) == 2 {
+		driftApplied(s.KubeClient, "Secret", s.Namespace, s.Name, hash)
 		return "", nil
 	}
 
+	driftCheck(s.KubeClient, "Secret", s.Namespace, s.Name, hash, secretOld, secretNew, patch)
+
 	s.Obj, err = s.KubeClient.API.CoreV1().Secrets(s.Namespace).Patch(s.KubeClient.CTX, s.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		driftApplied(s.KubeClient, "Secret", s.Namespace, s.Name, hash)
+	}
 	return string(patch), err
 }
 
@@ -98,5 +111,6 @@ func (s *SecretS) Exist() bool {
 }
 
 func (s *SecretS) Delete() error {
+	driftForget(s.KubeClient, "Secret", s.Namespace, s.Name)
 	return s.KubeClient.API.CoreV1().Secrets(s.Namespace).Delete(s.KubeClient.CTX, s.Name, metav1.DeleteOptions{})
 }
@@ -44,6 +44,10 @@ func (s *ServiceS) CreateOrUpdate() (diff string, err error) {
 
 	// ---
 
+	desired := *s
+	desired.KubeClient, desired.Obj = nil, nil
+	hash := driftHash(desired)
+
 	var svcOld []byte
 	svc, err := s.KubeClient.API.CoreV1().Services(s.Namespace).Get(s.KubeClient.CTX, s.Name, metav1.GetOptions{})
 	if err == nil {
@@ -152,6 +156,9 @@ func (s *ServiceS) CreateOrUpdate() (diff string, err error) {
 
 	if len(svcOld) == 0 {
 		s.Obj, err = s.KubeClient.API.CoreV1().Services(s.Namespace).Create(s.KubeClient.CTX, svc, metav1.CreateOptions{})
+		if err == nil {
+			driftApplied(s.KubeClient, "Service", s.Namespace, s.Name, hash)
+		}
 		return "creating new obj", err
 	}
 
@@ -166,10 +173,16 @@ func (s *ServiceS) CreateOrUpdate() (diff string, err error) {
 	}
 
 	if len(patch) == 2 {
+		driftApplied(s.KubeClient, "Service", s.Namespace, s.Name, hash)
 		return "", nil
 	}
 
+	driftCheck(s.KubeClient, "Service", s.Namespace, s.Name, hash, svcOld, svcNew, patch)
+
 	s.Obj, err = s.KubeClient.API.CoreV1().Services(s.Namespace).Patch(s.KubeClient.CTX, s.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		driftApplied(s.KubeClient, "Service", s.Namespace, s.Name, hash)
+	}
 	return string(patch), err
 }
 
@@ -189,5 +202,6 @@ func (s *ServiceS) Exist() bool {
 }
 
 func (s *ServiceS) Delete() error {
+	driftForget(s.KubeClient, "Service", s.Namespace, s.Name)
 	return s.KubeClient.API.CoreV1().Services(s.Namespace).Delete(s.KubeClient.CTX, s.Name, metav1.DeleteOptions{})
 }
@@ -13,6 +13,7 @@ import (
 
 func Setup() {
 	modulestate.StatusByModulesAdd("api", Check)
+	go clusterChecksLoop()
 
 	for {
 		state, msg := Check()
@@ -78,6 +79,10 @@ func longhornInstall() error {
 		time.Sleep(20 * time.Second)
 	}
 
+	// CSI snapshots of longhorn volumes, used by element backups
+	kclient.ApplyYamlFilesInDir(filepath.Join(config.ModulesPath(), "kube", "volume-snapshot"), nil)
+	tlog.Error(kclient.VolumeSnapshotClassesEnsure())
+
 	return setDefaultStorageClass("longhorn")
 }
 
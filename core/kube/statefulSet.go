@@ -65,6 +65,10 @@ func (s *StatefulSetS) CreateOrUpdate() (anyChange bool, err error) {
 		return false, errors.New("namespace cant be empty")
 	}
 
+	desired := *s
+	desired.KubeClient, desired.Obj = nil, nil
+	hash := driftHash(desired)
+
 	var statefulSetOld []byte
 	statefulSet, err := s.KubeClient.API.AppsV1().StatefulSets(s.Namespace).Get(s.KubeClient.CTX, s.Name, metav1.GetOptions{})
 	if err == nil {
@@ -691,6 +695,9 @@ func (s *StatefulSetS) CreateOrUpdate() (anyChange bool, err error) {
 
 	if len(statefulSetOld) == 0 {
 		s.Obj, err = s.KubeClient.API.AppsV1().StatefulSets(s.Namespace).Create(s.KubeClient.CTX, statefulSet, metav1.CreateOptions{})
+		if err == nil {
+			driftApplied(s.KubeClient, "StatefulSet", s.Namespace, s.Name, hash)
+		}
 		return true, err
 
 	}
@@ -706,12 +713,16 @@ func (s *StatefulSetS) CreateOrUpdate() (anyChange bool, err error) {
 	}
 
 	if len(patch) == 2 {
+		driftApplied(s.KubeClient, "StatefulSet", s.Namespace, s.Name, hash)
 		return false, nil
 	}
 
+	driftCheck(s.KubeClient, "StatefulSet", s.Namespace, s.Name, hash, statefulSetOld, statefulSetNew, patch)
+
 	s.Obj, err = s.KubeClient.API.AppsV1().StatefulSets(s.Namespace).Patch(s.KubeClient.CTX, s.Name, types.MergePatchType, patch, metav1.PatchOptions{})
 	tlog.Error(err, string(patch))
 	if err == nil {
+		driftApplied(s.KubeClient, "StatefulSet", s.Namespace, s.Name, hash)
 		tlog.Info("StatefulSet patched", tlog.Vars{
 			"old":        string(statefulSetOld),
 			"new":        string(statefulSetNew),
@@ -742,6 +753,7 @@ func (s *StatefulSetS) Exist() bool {
 }
 
 func (s *StatefulSetS) Delete() error {
+	driftForget(s.KubeClient, "StatefulSet", s.Namespace, s.Name)
 	return s.KubeClient.API.AppsV1().StatefulSets(s.Namespace).Delete(s.KubeClient.CTX, s.Name, metav1.DeleteOptions{})
 }
 
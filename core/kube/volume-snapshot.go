@@ -0,0 +1,356 @@
+package kube
+
+import (
+	"fmt"
+	log "lib/tlog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	VolumeSnapshotClass = "longhorn-snapshot" // snapshot kept in Longhorn volume
+	VolumeBackupClass   = "longhorn-backup"   // backup exported to Longhorn backup target (S3)
+
+	longhornNamespace        = "longhorn-system"
+	longhornBackupSecretName = "timoni-backup-target"
+)
+
+// VolumeSnapshotS is CSI VolumeSnapshot of one PVC
+type VolumeSnapshotS struct {
+	KubeClient *ClientS
+	Namespace  string
+	Name       string
+	PVCName    string
+	ClassName  string
+	Labels     map[string]string
+}
+
+type VolumeSnapshotStatusS struct {
+	Ready       bool
+	SizeBytes   int64
+	Error       string
+	ContentName string
+}
+
+// StatefulSetPVCName returns name of PVC created by StatefulSet from volume
+// claim template of block storage
+func StatefulSetPVCName(stsName, mountPath string, ordinal int) string {
+	return fmt.Sprintf("%s-%s-%d", getKeyString(stsName+mountPath), stsName, ordinal)
+}
+
+func volumeSnapshotObj(kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "snapshot.storage.k8s.io",
+		Version: "v1",
+		Kind:    kind,
+	})
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func (s *VolumeSnapshotS) Create() *log.RecordS {
+
+	if s.KubeClient == nil {
+		return log.Error("KubeClient cant be empty")
+	}
+	if s.Name == "" || s.Namespace == "" || s.PVCName == "" {
+		return log.Error("Name, Namespace and PVCName cant be empty")
+	}
+	if s.ClassName == "" {
+		s.ClassName = VolumeSnapshotClass
+	}
+
+	obj := volumeSnapshotObj("VolumeSnapshot", s.Namespace, s.Name)
+	obj.SetLabels(s.Labels)
+	obj.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": s.ClassName,
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": s.PVCName,
+		},
+	}
+	return log.Error(s.KubeClient.CRD.Create(s.KubeClient.CTX, obj))
+}
+
+func (s *VolumeSnapshotS) GetObj() (*unstructured.Unstructured, *log.RecordS) {
+	obj := volumeSnapshotObj("VolumeSnapshot", s.Namespace, s.Name)
+	if err := s.KubeClient.CRD.Get(s.KubeClient.CTX, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return nil, log.Error(err)
+	}
+	return obj, nil
+}
+
+func (s *VolumeSnapshotS) Status() (VolumeSnapshotStatusS, *log.RecordS) {
+
+	res := VolumeSnapshotStatusS{}
+	obj, err := s.GetObj()
+	if err != nil {
+		return res, err
+	}
+
+	res.Ready, _, _ = unstructured.NestedBool(obj.Object, "status", "readyToUse")
+	res.ContentName, _, _ = unstructured.NestedString(obj.Object, "status", "boundVolumeSnapshotContentName")
+	res.Error, _, _ = unstructured.NestedString(obj.Object, "status", "error", "message")
+	if size, ok, _ := unstructured.NestedString(obj.Object, "status", "restoreSize"); ok {
+		if q, err := resource.ParseQuantity(size); err == nil {
+			res.SizeBytes = q.Value()
+		}
+	}
+	return res, nil
+}
+
+// Delete removes snapshot, its data is removed by deletion policy of class
+func (s *VolumeSnapshotS) Delete() *log.RecordS {
+	obj := volumeSnapshotObj("VolumeSnapshot", s.Namespace, s.Name)
+	err := s.KubeClient.CRD.Delete(s.KubeClient.CTX, obj)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return log.Error(err)
+}
+
+// CopyTo makes snapshot available in other namespace, PVC can be restored only
+// from snapshot in its own namespace. Copy is pre-provisioned snapshot bound to
+// the same snapshot handle with `Retain` policy, so deleting copy never
+// removes data of original.
+func (s *VolumeSnapshotS) CopyTo(namespace, name string) (*VolumeSnapshotS, *log.RecordS) {
+
+	status, err := s.Status()
+	if err != nil {
+		return nil, err
+	}
+	if !status.Ready || status.ContentName == "" {
+		return nil, log.Error("snapshot is not ready")
+	}
+
+	content := volumeSnapshotObj("VolumeSnapshotContent", "", status.ContentName)
+	if err := s.KubeClient.CRD.Get(s.KubeClient.CTX, client.ObjectKeyFromObject(content), content); err != nil {
+		return nil, log.Error(err)
+	}
+	handle, _, _ := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	driver, _, _ := unstructured.NestedString(content.Object, "spec", "driver")
+	class, _, _ := unstructured.NestedString(content.Object, "spec", "volumeSnapshotClassName")
+	if handle == "" || driver == "" {
+		return nil, log.Error("snapshot content has no handle")
+	}
+
+	contentCopyName := volumeSnapshotCopyContentName(namespace, name)
+	contentCopy := volumeSnapshotObj("VolumeSnapshotContent", "", contentCopyName)
+	contentCopy.SetLabels(s.Labels)
+	contentCopy.Object["spec"] = map[string]interface{}{
+		"deletionPolicy":          "Retain",
+		"driver":                  driver,
+		"volumeSnapshotClassName": class,
+		"source": map[string]interface{}{
+			"snapshotHandle": handle,
+		},
+		"volumeSnapshotRef": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}
+	if err := s.KubeClient.CRD.Create(s.KubeClient.CTX, contentCopy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, log.Error(err)
+	}
+
+	snapCopy := volumeSnapshotObj("VolumeSnapshot", namespace, name)
+	snapCopy.SetLabels(s.Labels)
+	snapCopy.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": class,
+		"source": map[string]interface{}{
+			"volumeSnapshotContentName": contentCopyName,
+		},
+	}
+	if err := s.KubeClient.CRD.Create(s.KubeClient.CTX, snapCopy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, log.Error(err)
+	}
+
+	return &VolumeSnapshotS{
+		KubeClient: s.KubeClient,
+		Namespace:  namespace,
+		Name:       name,
+		ClassName:  class,
+		Labels:     s.Labels,
+	}, nil
+}
+
+// DeleteCopy removes snapshot made by CopyTo with its content, data stays
+// with original snapshot
+func (s *VolumeSnapshotS) DeleteCopy() *log.RecordS {
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	content := volumeSnapshotObj("VolumeSnapshotContent", "", volumeSnapshotCopyContentName(s.Namespace, s.Name))
+	err := s.KubeClient.CRD.Delete(s.KubeClient.CTX, content)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return log.Error(err)
+}
+
+func volumeSnapshotCopyContentName(namespace, name string) string {
+	res := getKeyString(namespace + "-" + name)
+	if len(res) > 253 {
+		res = res[:253]
+	}
+	return res
+}
+
+// --------------------------------------------------
+
+// PVCExist returns true when PVC exists, also when it's being deleted
+func (kube *ClientS) PVCExist(namespace, name string) bool {
+	_, err := kube.API.CoreV1().PersistentVolumeClaims(namespace).Get(kube.CTX, name, metav1.GetOptions{})
+	return err == nil
+}
+
+func (kube *ClientS) PVCDelete(namespace, name string) *log.RecordS {
+	err := kube.API.CoreV1().PersistentVolumeClaims(namespace).Delete(kube.CTX, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return log.Error(err)
+}
+
+// PVCBound returns true when PVC has volume, PVC restored from snapshot is
+// bound only after data is restored
+func (kube *ClientS) PVCBound(namespace, name string) bool {
+	pvc, err := kube.API.CoreV1().PersistentVolumeClaims(namespace).Get(kube.CTX, name, metav1.GetOptions{})
+	return err == nil && pvc.Status.Phase == corev1.ClaimBound
+}
+
+// PVCCreateFromSnapshot creates PVC with data of snapshot, PVC must have name
+// expected by StatefulSet to be adopted by it
+func (kube *ClientS) PVCCreateFromSnapshot(namespace, name, snapshotName string, store *StorageS, labels map[string]string) *log.RecordS {
+
+	storName := (*string)(nil)
+	if store.Class != "" {
+		storName = &store.Class
+	}
+	apiGroup := "snapshot.storage.k8s.io"
+	fs := corev1.PersistentVolumeFilesystem
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			VolumeMode:       &fs,
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: storName,
+			DataSource: &corev1.TypedLocalObjectReference{
+				APIGroup: &apiGroup,
+				Kind:     "VolumeSnapshot",
+				Name:     snapshotName,
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dMi", store.MaxSizeMB)),
+				},
+			},
+		},
+	}
+
+	_, err := kube.API.CoreV1().PersistentVolumeClaims(namespace).Create(kube.CTX, pvc, metav1.CreateOptions{})
+	return log.Error(err)
+}
+
+// --------------------------------------------------
+
+// VolumeSnapshotClassesEnsure creates snapshot classes of Longhorn CSI driver,
+// it waits for VolumeSnapshot CRDs to be established
+func (kube *ClientS) VolumeSnapshotClassesEnsure() *log.RecordS {
+
+	classes := map[string]string{
+		VolumeSnapshotClass: "snap",
+		VolumeBackupClass:   "bak",
+	}
+
+	for name, longhornType := range classes {
+		obj := volumeSnapshotObj("VolumeSnapshotClass", "", name)
+		obj.Object["driver"] = "driver.longhorn.io"
+		obj.Object["deletionPolicy"] = "Delete"
+		obj.Object["parameters"] = map[string]interface{}{
+			"type": longhornType,
+		}
+
+		var err error
+		for i := 0; i < 30; i++ {
+			err = kube.CRD.Create(kube.CTX, obj)
+			if err == nil || apierrors.IsAlreadyExists(err) {
+				err = nil
+				break
+			}
+			log.Info("Waiting for VolumeSnapshot CRDs")
+			time.Sleep(10 * time.Second)
+		}
+		if err != nil {
+			return log.Error(err)
+		}
+	}
+	return nil
+}
+
+// LonghornBackupTargetSet configures S3 compatible storage where Longhorn
+// exports backups, eg. url `s3://bucket@us-east-1/timoni`, empty url
+// disables export
+func (kube *ClientS) LonghornBackupTargetSet(url, endpoint, accessKey, secretKey string) *log.RecordS {
+
+	secretName := ""
+	if url != "" {
+		secret := &SecretS{
+			KubeClient: kube,
+			Namespace:  longhornNamespace,
+			Name:       longhornBackupSecretName,
+			Type:       corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				"AWS_ACCESS_KEY_ID":     []byte(accessKey),
+				"AWS_SECRET_ACCESS_KEY": []byte(secretKey),
+			},
+		}
+		if endpoint != "" {
+			secret.Data["AWS_ENDPOINTS"] = []byte(endpoint)
+		}
+		if _, err := secret.CreateOrUpdate(); err != nil {
+			return log.Error(err)
+		}
+		secretName = longhornBackupSecretName
+	}
+
+	settings := map[string]string{
+		"backup-target":                   url,
+		"backup-target-credential-secret": secretName,
+	}
+	for name, value := range settings {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(schema.GroupVersionKind{
+			Group:   "longhorn.io",
+			Version: "v1beta2",
+			Kind:    "Setting",
+		})
+		obj.SetNamespace(longhornNamespace)
+		obj.SetName(name)
+
+		if err := kube.CRD.Get(kube.CTX, client.ObjectKeyFromObject(obj), obj); err != nil {
+			obj.Object["value"] = value
+			if err := kube.CRD.Create(kube.CTX, obj); err != nil {
+				return log.Error(err)
+			}
+			continue
+		}
+		obj.Object["value"] = value
+		if err := kube.CRD.Update(kube.CTX, obj); err != nil {
+			return log.Error(err)
+		}
+	}
+	return nil
+}
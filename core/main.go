@@ -2,6 +2,7 @@ package main
 
 import (
 	"core/api"
+	"core/certprovider"
 	"core/db"
 	"core/db2"
 	"core/gitprovider"
@@ -41,7 +42,7 @@ func main() {
 	go imageregistry.Setup()
 	go imagebuilder.Setup()
 
-	// certprovider.Setup()
+	certprovider.Setup()
 	go metrics.Setup()
 
 	kubesync.Loop()
@@ -29,3 +29,7 @@ func Loop() {
 func StatusByModulesAdd(name string, fn func() (db2.StateT, string)) {
 	checks.Set(name, fn)
 }
+
+func StatusByModulesDelete(name string) {
+	checks.Delete(name)
+}
@@ -0,0 +1,215 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lib/utils/maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCS is OpenID Connect provider, authorization code flow with PKCE
+type OIDCS struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string   // empty for public clients
+	RedirectURL  string   // set by caller, eg. https://timoni.example.com/api/sso-callback
+	Scopes       []string // default openid, email, profile
+	GroupsClaim  string   // default `groups`
+}
+
+type oidcProviderCacheS struct {
+	provider *oidc.Provider
+	created  time.Time
+}
+
+// discovery documents, key=issuer
+var oidcProviderCache = maps.NewSafe[string, oidcProviderCacheS](nil)
+
+func (o *OIDCS) Check() error {
+	if o.Issuer == "" {
+		return errors.New("issuer is required")
+	}
+	if o.ClientID == "" {
+		return errors.New("client id is required")
+	}
+	return nil
+}
+
+func (o *OIDCS) provider(ctx context.Context) (*oidc.Provider, error) {
+	if c, ok := oidcProviderCache.GetFull(o.Issuer); ok && time.Since(c.created) < time.Hour {
+		return c.provider, nil
+	}
+	p, err := oidc.NewProvider(ctx, o.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviderCache.Set(o.Issuer, oidcProviderCacheS{provider: p, created: time.Now()})
+	return p, nil
+}
+
+func (o *OIDCS) config(p *oidc.Provider) *oauth2.Config {
+	scopes := o.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	return &oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  o.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+func (o *OIDCS) AuthURL(ctx context.Context) (string, LoginS, error) {
+	p, err := o.provider(ctx)
+	if err != nil {
+		return "", LoginS{}, err
+	}
+
+	login := LoginS{
+		State:        randomString(),
+		Nonce:        randomString(),
+		CodeVerifier: randomString(),
+		Created:      time.Now(),
+	}
+	url := o.config(p).AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(login.CodeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return url, login, nil
+}
+
+func (o *OIDCS) Callback(ctx context.Context, r *http.Request, login LoginS) (*IdentityS, error) {
+	if login.Expired() {
+		return nil, ErrLoginExpired
+	}
+	if e := r.FormValue("error"); e != "" {
+		return nil, fmt.Errorf("identity provider: %s %s", e, r.FormValue("error_description"))
+	}
+	if r.FormValue("state") != login.State {
+		return nil, errors.New("invalid state")
+	}
+	code := r.FormValue("code")
+	if code == "" {
+		return nil, errors.New("code is empty")
+	}
+
+	p, err := o.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := o.config(p).Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", login.CodeVerifier))
+	if err != nil {
+		return nil, err
+	}
+	identity, err := o.identity(ctx, p, token, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity.RefreshToken = token.RefreshToken
+	return identity, nil
+}
+
+// Refresh checks that user is still active in identity provider, returns
+// current identity with new refresh token (when rotated by provider)
+// or ErrUserDisabled.
+func (o *OIDCS) Refresh(ctx context.Context, refreshToken string) (*IdentityS, error) {
+	p, err := o.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts := o.config(p).TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken})
+	token, err := ts.Token()
+	if err != nil {
+		var re *oauth2.RetrieveError
+		if errors.As(err, &re) && (re.ErrorCode == "invalid_grant" || re.Response != nil && re.Response.StatusCode == http.StatusUnauthorized) {
+			return nil, ErrUserDisabled
+		}
+		return nil, err
+	}
+
+	identity, err := o.identity(ctx, p, token, "")
+	if err != nil {
+		return nil, err
+	}
+	identity.RefreshToken = token.RefreshToken
+	if identity.RefreshToken == "" {
+		identity.RefreshToken = refreshToken
+	}
+	return identity, nil
+}
+
+// identity reads claims of ID token, missing ones are taken from userinfo
+func (o *OIDCS) identity(ctx context.Context, p *oidc.Provider, token *oauth2.Token, nonce string) (*IdentityS, error) {
+	claims := map[string]interface{}{}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken != "" {
+		idToken, err := p.Verifier(&oidc.Config{ClientID: o.ClientID}).Verify(ctx, rawIDToken)
+		if err != nil {
+			return nil, err
+		}
+		if nonce != "" && idToken.Nonce != nonce {
+			return nil, errors.New("invalid nonce")
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, err
+		}
+	} else if nonce != "" {
+		return nil, errors.New("id_token is missing in token response")
+	}
+
+	groupsClaim := o.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	if _, ok := claims["email"]; !ok || claims[groupsClaim] == nil {
+		if p.UserInfoEndpoint() != "" {
+			info, err := p.UserInfo(ctx, oauth2.StaticTokenSource(token))
+			if err != nil {
+				return nil, err
+			}
+			if claims["sub"] != nil && info.Subject != claims["sub"] {
+				return nil, errors.New("userinfo subject doesn't match id_token")
+			}
+			extra := map[string]interface{}{}
+			if err := info.Claims(&extra); err != nil {
+				return nil, err
+			}
+			for k, v := range extra {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, errors.New("email is not verified by identity provider")
+	}
+
+	identity := &IdentityS{
+		Groups: claimStrings(claims[groupsClaim]),
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+
+	if identity.Subject == "" {
+		return nil, errors.New("claim `sub` is missing")
+	}
+	if identity.Email == "" {
+		return nil, errors.New("claim `email` is missing, add scope `email`")
+	}
+	return identity, nil
+}
@@ -0,0 +1,327 @@
+package sso
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"lib/utils/maps"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+)
+
+// SAMLS is SAML 2.0 service provider of one identity provider
+type SAMLS struct {
+	MetadataURL     string // identity provider metadata, MetadataURL or MetadataXML is required
+	MetadataXML     string
+	EntityID        string // service provider, set by caller, eg. https://timoni.example.com/api/sso-saml-metadata?id=x
+	ACSURL          string // set by caller, eg. https://timoni.example.com/api/sso-saml-acs
+	Certificate     string // PEM, service provider, see GenerateCertificate
+	PrivateKey      string // PEM
+	EmailAttribute  string // default NameID or one of well known attributes (email, mail...)
+	NameAttribute   string // default `displayName`, `name` or `cn`
+	GroupsAttribute string // default `groups`, `memberOf`...
+}
+
+type samlMetadataCacheS struct {
+	metadata *saml.EntityDescriptor
+	created  time.Time
+}
+
+// identity provider metadata, key=url
+var samlMetadataCache = maps.NewSafe[string, samlMetadataCacheS](nil)
+
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailaddress", "Email",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"urn:oid:1.3.6.1.4.1.5923.1.1.1.6", // eduPersonPrincipalName
+	}
+	samlNameAttributes = []string{
+		"displayName", "name", "cn",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+	}
+	samlGroupsAttributes = []string{
+		"groups", "memberOf", "Groups", "Role",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+		"http://schemas.xmlsoap.org/claims/Group",
+	}
+)
+
+func (s *SAMLS) Check() error {
+	if s.MetadataURL == "" && s.MetadataXML == "" {
+		return errors.New("identity provider metadata url or xml is required")
+	}
+	if s.MetadataXML != "" {
+		if _, err := parseSAMLMetadata([]byte(s.MetadataXML)); err != nil {
+			return fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	if _, err := tls.X509KeyPair([]byte(s.Certificate), []byte(s.PrivateKey)); err != nil {
+		return fmt.Errorf("invalid service provider certificate: %w", err)
+	}
+	return nil
+}
+
+// GenerateCertificate returns self-signed certificate and key of service
+// provider, valid for 10 years
+func GenerateCertificate(commonName string) (certPEM, keyPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return "", "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certPEM, keyPEM, nil
+}
+
+// parseSAMLMetadata accepts <EntityDescriptor> or <EntitiesDescriptor>
+func parseSAMLMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	if err := xrv.Validate(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	entity := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, entity)
+	if err != nil && strings.Contains(err.Error(), "<EntitiesDescriptor>") {
+		entities := &saml.EntitiesDescriptor{}
+		if err := xml.Unmarshal(data, entities); err != nil {
+			return nil, err
+		}
+		for i, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				return &entities.EntityDescriptors[i], nil
+			}
+		}
+		return nil, errors.New("no entity with IDPSSODescriptor")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entity.IDPSSODescriptors) == 0 {
+		return nil, errors.New("no IDPSSODescriptor")
+	}
+	return entity, nil
+}
+
+func (s *SAMLS) metadata(ctx context.Context) (*saml.EntityDescriptor, error) {
+	if s.MetadataXML != "" {
+		return parseSAMLMetadata([]byte(s.MetadataXML))
+	}
+
+	if c, ok := samlMetadataCache.GetFull(s.MetadataURL); ok && time.Since(c.created) < time.Hour {
+		return c.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.MetadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata %s: status %d", s.MetadataURL, resp.StatusCode)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseSAMLMetadata(buf)
+	if err != nil {
+		return nil, err
+	}
+	samlMetadataCache.Set(s.MetadataURL, samlMetadataCacheS{metadata: metadata, created: time.Now()})
+	return metadata, nil
+}
+
+// serviceProvider returns crewjam/saml service provider, idp metadata is
+// not required to render metadata of service provider
+func (s *SAMLS) serviceProvider(ctx context.Context, withIDP bool) (*saml.ServiceProvider, error) {
+	pair, err := tls.X509KeyPair([]byte(s.Certificate), []byte(s.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service provider key must be RSA")
+	}
+	entityURL, err := url.Parse(s.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(s.ACSURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          s.EntityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *entityURL,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if withIDP {
+		sp.IDPMetadata, err = s.metadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+// Metadata returns XML metadata of service provider, uploaded to identity provider
+func (s *SAMLS) Metadata() ([]byte, error) {
+	sp, err := s.serviceProvider(context.Background(), false)
+	if err != nil {
+		return nil, err
+	}
+	return xml.MarshalIndent(sp.Metadata(), "", "  ")
+}
+
+func (s *SAMLS) AuthURL(ctx context.Context) (string, LoginS, error) {
+	sp, err := s.serviceProvider(ctx, true)
+	if err != nil {
+		return "", LoginS{}, err
+	}
+
+	binding := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if binding == "" {
+		return "", LoginS{}, errors.New("identity provider doesn't support HTTP-Redirect binding")
+	}
+	req, err := sp.MakeAuthenticationRequest(binding, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", LoginS{}, err
+	}
+
+	login := LoginS{
+		State:     randomString(),
+		RequestID: req.ID,
+		Created:   time.Now(),
+	}
+	u, err := req.Redirect(login.State, sp)
+	if err != nil {
+		return "", LoginS{}, err
+	}
+	return u.String(), login, nil
+}
+
+// Callback validates SAMLResponse posted to ACS, assertion must be signed by
+// identity provider and match AuthnRequest of login
+func (s *SAMLS) Callback(ctx context.Context, r *http.Request, login LoginS) (*IdentityS, error) {
+	if login.Expired() {
+		return nil, ErrLoginExpired
+	}
+	if r.FormValue("RelayState") != login.State {
+		return nil, errors.New("invalid RelayState")
+	}
+
+	sp, err := s.serviceProvider(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	assertion, err := sp.ParseResponse(r, []string{login.RequestID})
+	if err != nil {
+		var ire *saml.InvalidResponseError
+		if errors.As(err, &ire) {
+			return nil, fmt.Errorf("invalid SAML response: %w", ire.PrivateErr)
+		}
+		return nil, err
+	}
+
+	identity := &IdentityS{}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.Subject = assertion.Subject.NameID.Value
+	}
+	for _, st := range assertion.AuthnStatements {
+		if st.SessionNotOnOrAfter != nil && (identity.Expires.IsZero() || st.SessionNotOnOrAfter.Before(identity.Expires)) {
+			identity.Expires = *st.SessionNotOnOrAfter
+		}
+	}
+
+	attributes := map[string][]string{}
+	for _, st := range assertion.AttributeStatements {
+		for _, attr := range st.Attributes {
+			values := []string{}
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			for _, name := range []string{attr.Name, attr.FriendlyName} {
+				if name != "" {
+					attributes[name] = append(attributes[name], values...)
+				}
+			}
+		}
+	}
+	first := func(configured string, defaults []string) []string {
+		if configured != "" {
+			return attributes[configured]
+		}
+		for _, name := range defaults {
+			if len(attributes[name]) > 0 {
+				return attributes[name]
+			}
+		}
+		return nil
+	}
+
+	if v := first(s.EmailAttribute, samlEmailAttributes); len(v) > 0 {
+		identity.Email = v[0]
+	} else if strings.Contains(identity.Subject, "@") {
+		identity.Email = identity.Subject
+	}
+	if v := first(s.NameAttribute, samlNameAttributes); len(v) > 0 {
+		identity.Name = v[0]
+	}
+	identity.Groups = claimStrings(first(s.GroupsAttribute, samlGroupsAttributes))
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+
+	if identity.Subject == "" {
+		return nil, errors.New("NameID is missing")
+	}
+	if identity.Email == "" {
+		return nil, errors.New("email attribute is missing")
+	}
+	return identity, nil
+}
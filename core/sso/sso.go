@@ -0,0 +1,116 @@
+// Package sso implements login by external identity providers, OpenID
+// Connect (authorization code flow with PKCE) and SAML 2.0 (HTTP-Redirect
+// request, HTTP-POST response). Login is done in two steps:
+//
+//	url, login, err := provider.AuthURL(ctx) // redirect user, keep login until callback
+//	identity, err := provider.Callback(ctx, r, login)
+//
+// Providers don't keep any state, caller stores LoginS between steps and
+// decides what to do with returned IdentityS (users, teams, sessions).
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	VariantOIDC = "oidc"
+	VariantSAML = "saml"
+
+	// LoginTimeout is max time between AuthURL and Callback
+	LoginTimeout = 10 * time.Minute
+)
+
+var (
+	// ErrUserDisabled is returned by Refresh when identity provider doesn't
+	// accept user anymore (disabled, deleted, access revoked)
+	ErrUserDisabled = errors.New("user is disabled by identity provider")
+	ErrLoginExpired = errors.New("login expired, try again")
+)
+
+type Provider interface {
+	AuthURL(ctx context.Context) (string, LoginS, error)
+	// Callback validates response of identity provider
+	Callback(ctx context.Context, r *http.Request, login LoginS) (*IdentityS, error)
+}
+
+// LoginS is started login, kept by caller between AuthURL and Callback
+type LoginS struct {
+	State        string // OIDC `state`, SAML `RelayState`
+	Nonce        string // OIDC
+	CodeVerifier string // OIDC PKCE
+	RequestID    string // SAML AuthnRequest ID
+	Created      time.Time
+}
+
+func (l LoginS) Expired() bool {
+	return time.Since(l.Created) > LoginTimeout
+}
+
+// IdentityS is user confirmed by identity provider
+type IdentityS struct {
+	Subject      string // OIDC `sub`, SAML NameID
+	Email        string
+	Name         string
+	Groups       []string
+	RefreshToken string    // OIDC only, used to check if user is still active
+	Expires      time.Time // SAML SessionNotOnOrAfter, zero = not set
+}
+
+func randomString() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// pkceChallenge returns S256 code challenge of verifier, RFC 7636
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// claimStrings returns value of claim or attribute which can be a string or
+// list of strings, empty and duplicated values are removed
+func claimStrings(v interface{}) []string {
+	res := []string{}
+	switch x := v.(type) {
+	case string:
+		// some providers send groups as one comma separated value
+		for _, s := range strings.Split(x, ",") {
+			res = append(res, strings.TrimSpace(s))
+		}
+	case []string:
+		res = append(res, x...)
+	case []interface{}:
+		for _, item := range x {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+	}
+	return uniq(res)
+}
+
+func uniq(list []string) []string {
+	m := map[string]bool{}
+	res := []string{}
+	for _, s := range list {
+		if s == "" || m[s] {
+			continue
+		}
+		m[s] = true
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res
+}
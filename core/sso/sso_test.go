@@ -0,0 +1,374 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// mockOIDC is minimal OpenID provider: discovery, jwks, token and userinfo
+type mockOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	codes    map[string]url.Values // code -> authorization request
+	disabled map[string]bool       // refresh tokens of disabled users
+	groups   []string
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{
+		key:      key,
+		codes:    map[string]url.Values{},
+		disabled: map[string]bool{},
+		groups:   []string{"devs", "ops"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/auth",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"userinfo_endpoint":                     m.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		r.ParseForm()
+
+		fail := func(code string) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": code})
+		}
+
+		nonce := ""
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			auth, ok := m.codes[r.PostForm.Get("code")]
+			if !ok {
+				fail("invalid_grant")
+				return
+			}
+			delete(m.codes, r.PostForm.Get("code"))
+			if pkceChallenge(r.PostForm.Get("code_verifier")) != auth.Get("code_challenge") {
+				fail("invalid_grant")
+				return
+			}
+			nonce = auth.Get("nonce")
+		case "refresh_token":
+			if m.disabled[r.PostForm.Get("refresh_token")] {
+				fail("invalid_grant")
+				return
+			}
+		default:
+			fail("unsupported_grant_type")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-1",
+			"id_token":      m.idToken(t, nonce),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": "user-1"})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockOIDC) idToken(t *testing.T, nonce string) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "k1"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            "user-1",
+		"aud":            "timoni",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          "John@Example.com",
+		"email_verified": true,
+		"name":           "John",
+		"groups":         m.groups,
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	raw, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// authorize simulates user accepting login in identity provider, returns
+// callback request
+func (m *mockOIDC) authorize(t *testing.T, authURL string) *http.Request {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("PKCE is missing: %s", authURL)
+	}
+	if q.Get("client_id") != "timoni" || q.Get("redirect_uri") != "https://timoni.test/api/sso-callback" {
+		t.Fatalf("invalid auth url: %s", authURL)
+	}
+
+	code := randomString()
+	m.mu.Lock()
+	m.codes[code] = q
+	m.mu.Unlock()
+
+	return httptest.NewRequest("GET", "https://timoni.test/api/sso-callback?"+url.Values{
+		"code":  {code},
+		"state": {q.Get("state")},
+	}.Encode(), nil)
+}
+
+func TestOIDC(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockOIDC(t)
+	o := &OIDCS{
+		Issuer:       idp.URL,
+		ClientID:     "timoni",
+		ClientSecret: "secret",
+		RedirectURL:  "https://timoni.test/api/sso-callback",
+	}
+
+	authURL, login, err := o.AuthURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := o.Callback(ctx, idp.authorize(t, authURL), login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "john@example.com" || identity.Name != "John" {
+		t.Fatalf("invalid identity %+v", identity)
+	}
+	if strings.Join(identity.Groups, ",") != "devs,ops" || identity.RefreshToken != "refresh-1" {
+		t.Fatalf("invalid identity %+v", identity)
+	}
+
+	// code can't be used twice, state must match
+	req := idp.authorize(t, authURL)
+	bad := login
+	bad.State = "other"
+	if _, err := o.Callback(ctx, req, bad); err == nil {
+		t.Fatal("invalid state accepted")
+	}
+	bad = login
+	bad.CodeVerifier = randomString()
+	if _, err := o.Callback(ctx, req, bad); err == nil {
+		t.Fatal("invalid code_verifier accepted")
+	}
+	bad = login
+	bad.Nonce = "other"
+	if _, err := o.Callback(ctx, idp.authorize(t, authURL), bad); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("invalid nonce accepted: %v", err)
+	}
+
+	// refresh
+	idp.groups = []string{"ops"}
+	identity, err = o.Refresh(ctx, "refresh-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(identity.Groups, ",") != "ops" {
+		t.Fatalf("groups not refreshed %+v", identity)
+	}
+
+	idp.disabled["refresh-1"] = true
+	if _, err := o.Refresh(ctx, "refresh-1"); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("expected ErrUserDisabled, got %v", err)
+	}
+}
+
+// --------------------------------------------------
+
+type mockSAMLServiceProviders struct {
+	sp *saml.EntityDescriptor
+}
+
+func (m mockSAMLServiceProviders) GetServiceProvider(r *http.Request, id string) (*saml.EntityDescriptor, error) {
+	if id != m.sp.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return m.sp, nil
+}
+
+func mockSAMLIdentityProvider(t *testing.T) *saml.IdentityProvider {
+	certPEM, keyPEM, err := GenerateCertificate("idp.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(pair.Certificate[0])
+	metadataURL, _ := url.Parse("https://idp.test/metadata")
+	ssoURL, _ := url.Parse("https://idp.test/sso")
+	return &saml.IdentityProvider{
+		Key:         pair.PrivateKey,
+		Certificate: cert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+}
+
+func TestSAML(t *testing.T) {
+	ctx := context.Background()
+	idp := mockSAMLIdentityProvider(t)
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, err := GenerateCertificate("timoni.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SAMLS{
+		MetadataXML: string(idpMetadata),
+		EntityID:    "https://timoni.test/api/sso-saml-metadata?id=p1",
+		ACSURL:      "https://timoni.test/api/sso-saml-acs",
+		Certificate: certPEM,
+		PrivateKey:  keyPEM,
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	spMetadataXML, err := s.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spMetadata := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(spMetadataXML, spMetadata); err != nil {
+		t.Fatal(err)
+	}
+	idp.ServiceProviderProvider = mockSAMLServiceProviders{sp: spMetadata}
+
+	// login: SP redirects user to IdP, IdP posts response to ACS
+	respond := func(authURL string, session *saml.Session) *http.Request {
+		idpReq, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest("GET", authURL, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idpReq.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := (saml.DefaultAssertionMaker{}).MakeAssertion(idpReq, session); err != nil {
+			t.Fatal(err)
+		}
+		form, err := idpReq.PostBinding()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if form.URL != s.ACSURL {
+			t.Fatalf("invalid ACS %s", form.URL)
+		}
+		req := httptest.NewRequest("POST", form.URL, strings.NewReader(url.Values{
+			"SAMLResponse": {form.SAMLResponse},
+			"RelayState":   {form.RelayState},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	session := &saml.Session{
+		ID:         "s1",
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		Index:      "1",
+		NameID:     "jane",
+		UserEmail:  "Jane@Example.com",
+		CustomAttributes: []saml.Attribute{{
+			Name:       "groups",
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values: []saml.AttributeValue{
+				{Type: "xs:string", Value: "ops"},
+				{Type: "xs:string", Value: "devs"},
+			},
+		}},
+	}
+
+	authURL, login, err := s.AuthURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, "https://idp.test/sso?") {
+		t.Fatalf("invalid auth url %s", authURL)
+	}
+	identity, err := s.Callback(ctx, respond(authURL, session), login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "jane" || identity.Email != "jane@example.com" || strings.Join(identity.Groups, ",") != "devs,ops" {
+		t.Fatalf("invalid identity %+v", identity)
+	}
+
+	// response to other request
+	_, other, err := s.AuthURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.State = login.State
+	if _, err := s.Callback(ctx, respond(authURL, session), other); err == nil {
+		t.Fatal("response to other AuthnRequest accepted")
+	}
+
+	// response signed by other identity provider
+	s2 := *s
+	evil := mockSAMLIdentityProvider(t)
+	evilMetadata, _ := xml.Marshal(evil.Metadata())
+	s2.MetadataXML = string(evilMetadata)
+	if _, err := s2.Callback(ctx, respond(authURL, session), login); err == nil {
+		t.Fatal("response signed by other identity provider accepted")
+	}
+}
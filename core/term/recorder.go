@@ -0,0 +1,114 @@
+package term
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// recorderS writes asciicast v2 (https://docs.asciinema.org/manual/asciicast/v2/),
+// only output and resize events are recorded, keyboard input is not stored
+// because it may contain passwords
+type recorderS struct {
+	mu      sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	start   time.Time
+	pending []byte // incomplete utf-8 sequence
+}
+
+type asciicastHeaderS struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func newRecorder(path, title string) (*recorderS, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recorderS{
+		file:  f,
+		buf:   bufio.NewWriter(f),
+		start: time.Now(),
+	}
+	header, _ := json.Marshal(asciicastHeaderS{
+		Version:   2,
+		Width:     80,
+		Height:    24,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm"},
+	})
+	r.buf.Write(header)
+	r.buf.WriteByte('\n')
+	return r, nil
+}
+
+func (r *recorderS) event(code, data string) {
+	line, _ := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6,
+		code,
+		data,
+	})
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+}
+
+// Output records data written to terminal, multi-byte characters split
+// between reads are joined
+func (r *recorderS) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, p...)
+	n := len(r.pending)
+	for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(r.pending[i]) {
+			if !utf8.FullRune(r.pending[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	if n > 0 {
+		r.event("o", string(r.pending[:n]))
+	}
+	r.pending = append(r.pending[:0], r.pending[n:]...)
+}
+
+func (r *recorderS) Resize(cols, rows uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *recorderS) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Flush()
+}
+
+func (r *recorderS) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.buf.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,63 @@
+package term
+
+import (
+	"core/db"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//go:embed replay.html
+var ReplayHTML string
+
+// Replay renders player of recorded session, ticket is created by
+// /api/env-terminal-session-replay
+func Replay(w http.ResponseWriter, r *http.Request) {
+	ticket := r.FormValue("ticket")
+	t, ok := ticketGet(replayTickets, ticket, false)
+	if !ok {
+		fmt.Fprint(w, "ERROR: replay link expired, open replay again")
+		return
+	}
+
+	session := db.TermSessionGet(t.SessionID)
+	if session == nil {
+		fmt.Fprint(w, "ERROR: session not found")
+		return
+	}
+
+	strings.NewReplacer(
+		"{{URL}}", "/term-recording?ticket="+ticket,
+		"{{TITLE}}", fmt.Sprintf("%s:%s %s %s", session.EnvID, session.Container, session.UserEmail,
+			time.Unix(session.StartTime, 0).UTC().Format(time.RFC3339)),
+	).WriteString(w, ReplayHTML)
+}
+
+// Recording returns asciicast of session, ticket can be used once
+func Recording(w http.ResponseWriter, r *http.Request) {
+	t, ok := ticketGet(replayTickets, r.FormValue("ticket"), true)
+	if !ok {
+		http.Error(w, "replay link expired", http.StatusUnauthorized)
+		return
+	}
+
+	session := db.TermSessionGet(t.SessionID)
+	if session == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(session.RecordingPath())
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Cache-control", "no-store")
+	http.ServeContent(w, r, session.ID+".cast", time.Unix(session.StartTime, 0), f)
+}
@@ -2,15 +2,21 @@ package term
 
 import (
 	"context"
+	"core/db"
 	"core/kube"
 	"encoding/json"
 	"errors"
 	"io"
 	log "lib/tlog"
+	"lib/utils/net"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -24,15 +30,68 @@ var upgrader = websocket.Upgrader{
 }
 
 func Socket(w http.ResponseWriter, r *http.Request) {
-	vars := r.URL.Query()
+	t, ok := ticketGet(tickets, r.URL.Query().Get("ticket"), true)
+	if !ok {
+		http.Error(w, "terminal link expired, open terminal again", http.StatusUnauthorized)
+		return
+	}
+
+	// permissions could change after ticket was created
+	user := db.GetUserByID(t.UserID)
+	env := db.EnvironmentMap.Get(t.EnvID)
+	if err := Allowed(user, env, t.ElementName); err != nil {
+		http.Error(w, err.Message, http.StatusForbidden)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error("Unable to upgrade connection")
 		return
 	}
 
+	session := &db.TermSessionS{
+		ID:          strings.ReplaceAll(uuid.New().String(), "-", ""),
+		UserID:      user.ID,
+		UserEmail:   user.Email,
+		UserIP:      net.RequestIP(r),
+		EnvID:       t.EnvID,
+		ElementName: t.ElementName,
+		Pod:         t.Pod,
+		Container:   t.Container,
+		StartTime:   time.Now().Unix(),
+	}
+	recorder, err := newRecorder(session.RecordingPath(), t.EnvID+":"+t.Container+" "+user.Email)
+	if err != nil {
+		log.Error(err)
+		conn.WriteMessage(websocket.BinaryMessage, []byte("unable to record session, terminal is not available"))
+		conn.Close()
+		return
+	}
+	log.Error(session.Save())
+
+	log.Info("terminal session opened", log.Vars{
+		"env":        t.EnvID,
+		"element":    t.ElementName,
+		"pod":        t.Pod,
+		"container":  t.Container,
+		"session-id": session.ID,
+		"user-ip":    session.UserIP,
+		"user":       user.Email,
+		"event":      true,
+	})
+
 	ctx, cancel := context.WithCancel(context.Background())
 
+	var bytesIn, bytesOut int64
+	lastInput := time.Now().UnixNano()
+	endReason := ""
+	var endOnce sync.Once
+	end := func(reason string) {
+		endOnce.Do(func() { endReason = reason })
+		cancel()
+	}
+
 	// IO
 	// Use os.Pipe(), not io.Pipe() as it's closing properly
 	stdinReader, stdinWriter, _ := os.Pipe()
@@ -56,13 +115,61 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 		stdinReader.Close()
 		stdoutReader.Close()
 		conn.Close()
+
+		endOnce.Do(func() { endReason = "closed" })
+		log.Error(recorder.Close())
+		session.EndTime = time.Now().Unix()
+		session.EndReason = endReason
+		session.BytesIn = atomic.LoadInt64(&bytesIn)
+		session.BytesOut = atomic.LoadInt64(&bytesOut)
+		log.Error(session.Save())
+
+		log.Info("terminal session closed", log.Vars{
+			"env":        session.EnvID,
+			"element":    session.ElementName,
+			"pod":        session.Pod,
+			"session-id": session.ID,
+			"reason":     session.EndReason,
+			"duration":   (time.Duration(session.EndTime-session.StartTime) * time.Second).String(),
+			"bytes-in":   session.BytesIn,
+			"bytes-out":  session.BytesOut,
+			"user":       session.UserEmail,
+			"event":      true,
+		})
+	}()
+
+	// Idle timeout and environment policy
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			log.Error(recorder.Flush())
+
+			env := db.EnvironmentMap.Get(session.EnvID)
+			if err := Allowed(db.GetUserByID(session.UserID), env, session.ElementName); err != nil {
+				conn.WriteMessage(websocket.BinaryMessage, []byte("\r\n"+err.Message+"\r\n"))
+				end("policy")
+				return
+			}
+			timeout := env.Terminal.IdleTimeout()
+			if time.Since(time.Unix(0, atomic.LoadInt64(&lastInput))) > timeout {
+				conn.WriteMessage(websocket.BinaryMessage, []byte("\r\nSession closed after "+timeout.String()+" of inactivity\r\n"))
+				end("idle-timeout")
+				return
+			}
+		}
 	}()
 
 	// Shell
 	go func() {
 		defer cancel()
 		err := startShell(
-			vars.Get("namespace"), vars.Get("pod"), vars.Get("container"),
+			env.KubeClient(), t.EnvID, t.Pod, t.Container,
 			&termIO{
 				Stdin:   stdinReader,
 				Stdout:  stdoutWriter,
@@ -72,6 +179,7 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 		)
 		if err != nil {
 			conn.WriteMessage(websocket.BinaryMessage, []byte(err.Error()))
+			end("error: " + err.Error())
 		}
 	}()
 
@@ -87,6 +195,8 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 				}
 				return
 			}
+			recorder.Output(buf[:read])
+			atomic.AddInt64(&bytesOut, int64(read))
 			conn.WriteMessage(websocket.BinaryMessage, buf[:read])
 		}
 	}()
@@ -115,10 +225,12 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 
 			switch dataTypeBuf[0] {
 			case 0:
-				_, err := io.Copy(stdinWriter, reader)
+				n, err := io.Copy(stdinWriter, reader)
 				if err != nil {
 					log.Error(err)
 				}
+				atomic.AddInt64(&bytesIn, n)
+				atomic.StoreInt64(&lastInput, time.Now().UnixNano())
 			case 1:
 				decoder := json.NewDecoder(reader)
 				err = decoder.Decode(size)
@@ -126,6 +238,7 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 					conn.WriteMessage(websocket.TextMessage, []byte("Resize failed: "+err.Error()))
 					continue
 				}
+				recorder.Resize(size.Cols, size.Rows)
 				resizer.Push(size)
 			default:
 				log.Error("Unknown data type")
@@ -134,8 +247,10 @@ func Socket(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
-func startShell(ns, pod, cnt string, io *termIO, ctx context.Context) error {
-	kClient := kube.GetKube()
+func startShell(kClient *kube.ClientS, ns, pod, cnt string, io *termIO, ctx context.Context) error {
+	if kClient == nil {
+		return errors.New("cluster of environment is not reachable")
+	}
 	req := kClient.API.CoreV1().RESTClient().
 		Post().
 		Resource("pods").
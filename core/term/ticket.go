@@ -0,0 +1,142 @@
+package term
+
+import (
+	"core/db"
+	perms "core/db/permissions"
+	"core/kube"
+	"crypto/rand"
+	"encoding/base64"
+	"lib/tlog"
+	"lib/utils/maps"
+	"time"
+)
+
+// tickets are one-time links created by authenticated API, websocket can't
+// send Session header and session ID never appears in URL
+const ticketTimeout = time.Minute
+
+type ticketS struct {
+	UserID      string
+	EnvID       string
+	ElementName string
+	Pod         string
+	Container   string
+	SessionID   string // replay of db.TermSessionS
+	Created     time.Time
+}
+
+var (
+	tickets       = maps.NewSafe[string, ticketS](nil) // key=ticket, shell
+	replayTickets = maps.NewSafe[string, ticketS](nil) // key=ticket, recording
+)
+
+func ticketNew(m *maps.SafeMap[string, ticketS], t ticketS) (string, *tlog.RecordS) {
+	for _, k := range m.Keys() {
+		if old, ok := m.GetFull(k); ok && time.Since(old.Created) > ticketTimeout {
+			m.Delete(k)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", tlog.Error(err)
+	}
+	key := base64.RawURLEncoding.EncodeToString(buf)
+	t.Created = time.Now()
+	m.Set(key, t)
+	return key, nil
+}
+
+// ticketGet returns ticket, take=true removes it so it can be used only once
+func ticketGet(m *maps.SafeMap[string, ticketS], key string, take bool) (ticketS, bool) {
+	var t ticketS
+	var ok bool
+	m.Commit(func(data map[string]ticketS) {
+		t, ok = data[key]
+		if ok && take {
+			delete(data, key)
+		}
+	})
+	return t, ok && time.Since(t.Created) <= ticketTimeout
+}
+
+// Allowed checks if user can open terminal of element
+func Allowed(user *db.UserS, env *db.EnvironmentS, elementName string) *tlog.RecordS {
+	if user == nil || env == nil {
+		return tlog.Error("permission denied")
+	}
+	if user.Token != nil {
+		return tlog.Error("terminal requires login session, API tokens are not allowed")
+	}
+	if user.ServiceAccount || user.Teams.Exists(db.BlacklistedTeamName) {
+		return tlog.Error("permission denied")
+	}
+	if !user.HasElementPerm(env.ID, elementName, perms.Env_ElementTerminal) {
+		return tlog.Error("permission denied")
+	}
+	if env.Terminal.Disabled {
+		return tlog.Error("terminal is disabled in this environment")
+	}
+	return nil
+}
+
+// TicketCreate selects pod of element and returns ticket for /cli page
+func TicketCreate(user *db.UserS, env *db.EnvironmentS, elementName, podName string, debug bool) (string, *tlog.RecordS) {
+
+	if err := Allowed(user, env, elementName); err != nil {
+		return "", err
+	}
+
+	element := env.GetElement(elementName)
+	if element == nil {
+		return "", tlog.Error("element `" + elementName + "` not found")
+	}
+
+	pods := element.GetStatus().PodsGet()
+	if len(pods) == 0 {
+		return "", tlog.Error("element `" + elementName + "` does not have pods")
+	}
+
+	if podName == "" {
+		for k, pod := range pods {
+			if debug && !pod.Debug {
+				continue
+			}
+			if pod.Status == kube.PodStatusReady || pod.Status == kube.PodStatusRunning {
+				podName = k
+				break
+			}
+		}
+		if podName == "" {
+			return "", tlog.Error("element `" + elementName + "` does not have any ready pods")
+		}
+	} else if _, ok := pods[podName]; !ok {
+		return "", tlog.Error("element `" + elementName + "` does not have pod " + podName)
+	}
+
+	containerName := elementName
+	if debug {
+		containerName += "-debug"
+	}
+
+	return ticketNew(tickets, ticketS{
+		UserID:      user.ID,
+		EnvID:       env.ID,
+		ElementName: elementName,
+		Pod:         podName,
+		Container:   containerName,
+	})
+}
+
+// ReplayTicketCreate returns ticket for /cli-replay page, permissions to
+// session must be checked by caller
+func ReplayTicketCreate(user *db.UserS, session *db.TermSessionS) (string, *tlog.RecordS) {
+	return ticketNew(replayTickets, ticketS{
+		UserID:      user.ID,
+		EnvID:       session.EnvID,
+		ElementName: session.ElementName,
+		Pod:         session.Pod,
+		Container:   session.Container,
+		SessionID:   session.ID,
+	})
+}
@@ -0,0 +1,34 @@
+import { api } from "@/zodios/api";
+
+// Terminal links are one-time and valid for a minute. The window is opened
+// before the request, otherwise browsers block it as a popup.
+export function openLink(request: Promise<{ URL: string } | undefined>) {
+  const win = window.open("", "_blank");
+  request
+    .then((res) => {
+      if (res?.URL && win) {
+        win.location.href = res.URL;
+      } else {
+        win?.close();
+      }
+    })
+    .catch(() => {
+      win?.close();
+    });
+}
+
+export function openTerminal(env: string, element: string, pod = "") {
+  openLink(
+    api.get("/env-element-terminal", {
+      queries: { env, element, pod },
+    })
+  );
+}
+
+export function openTerminalReplay(id: string) {
+  openLink(
+    api.get("/env-terminal-session-replay", {
+      queries: { id },
+    })
+  );
+}
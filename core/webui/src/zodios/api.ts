@@ -106,6 +106,7 @@ const cloneEnv = defineGet("/env-clone", {
   queries: {
     env: z.string(),
     targetName: z.string(),
+    withData: z.string().optional(),
   },
   response: z.any(),
 });
@@ -589,6 +590,426 @@ const userLogin = defineGet("/user-login", {
     token: z.string().optional(),
   },
 });
+const ssoProviders = defineGet("/sso-providers", {
+  response: z.any(),
+});
+const ssoSession = defineGet("/sso-session", {
+  response: z.any(),
+  queries: {
+    code: z.string(),
+  },
+});
+const envElementTerminal = defineGet("/env-element-terminal", {
+  response: z.object({ URL: z.string() }),
+  queries: {
+    env: z.string(),
+    element: z.string(),
+    pod: z.string().optional(),
+    debug: z.string().optional(),
+  },
+});
+const envTerminalSessionList = defineGet("/env-terminal-session-list", {
+  response: z.array(
+    z.object({
+      ID: z.string(),
+      UserEmail: z.string(),
+      ElementName: z.string(),
+      Pod: z.string(),
+      Container: z.string(),
+      StartTime: z.number(),
+      EndTime: z.number(),
+      EndReason: z.string(),
+      BytesIn: z.number(),
+      BytesOut: z.number(),
+    })
+  ),
+  queries: {
+    env: z.string(),
+  },
+});
+const envTerminalSessionReplay = defineGet("/env-terminal-session-replay", {
+  response: z.object({ URL: z.string() }),
+  queries: {
+    id: z.string(),
+  },
+});
+const envElementSnapshotSchema = z.object({
+  ID: z.string(),
+  EnvID: z.string(),
+  ElementName: z.string(),
+  Label: z.string(),
+  Scheduled: z.boolean(),
+  Export: z.boolean(),
+  State: z.string(),
+  Error: z.string(),
+  SizeBytes: z.number(),
+  Volumes: z.array(z.any()),
+  CreatedTime: z.number(),
+  CreatedByEmail: z.string(),
+});
+const envElementSnapshotList = defineGet("/env-element-snapshot-list", {
+  response: z.array(envElementSnapshotSchema),
+  queries: {
+    env: z.string(),
+    element: z.string().optional(),
+  },
+});
+const envElementSnapshotCreate = defineGet("/env-element-snapshot-create", {
+  response: z.any(),
+  queries: {
+    env: z.string(),
+    element: z.string(),
+    label: z.string().optional(),
+    export: z.string().optional(),
+  },
+});
+const envElementSnapshotDelete = defineGet("/env-element-snapshot-delete", {
+  response: z.string(),
+  queries: {
+    env: z.string(),
+    id: z.string(),
+  },
+});
+const envElementSnapshotRestore = defineGet("/env-element-snapshot-restore", {
+  response: z.string(),
+  queries: {
+    env: z.string(),
+    id: z.string(),
+    targetEnv: z.string().optional(),
+  },
+});
+const envElementBackupSchema = z.object({
+  ID: z.string(),
+  EnvID: z.string(),
+  ElementName: z.string(),
+  Target: z.string(),
+  Name: z.string(),
+  Label: z.string(),
+  Scheduled: z.boolean(),
+  State: z.string(),
+  Error: z.string(),
+  SizeBytes: z.number(),
+  StartTime: z.number(),
+  EndTime: z.number(),
+  CreatedByEmail: z.string(),
+  RestoreState: z.string(),
+  RestoreError: z.string(),
+  RestoreTime: z.number(),
+  RestoredByEmail: z.string(),
+});
+const envElementBackupList = defineGet("/env-element-backup-list", {
+  response: z.array(envElementBackupSchema),
+  queries: {
+    env: z.string(),
+    element: z.string().optional(),
+  },
+});
+const envElementBackupCreate = defineGet("/env-element-backup-create", {
+  response: z.any(),
+  queries: {
+    env: z.string(),
+    element: z.string(),
+    target: z.string(),
+    label: z.string().optional(),
+  },
+});
+const envElementBackupDelete = defineGet("/env-element-backup-delete", {
+  response: z.string(),
+  queries: {
+    env: z.string(),
+    id: z.string(),
+  },
+});
+const envElementBackupRestore = defineGet("/env-element-backup-restore", {
+  response: z.string(),
+  queries: {
+    env: z.string(),
+    id: z.string(),
+  },
+});
+const envElementProfileSchema = z.object({
+  ID: z.string(),
+  EnvID: z.string(),
+  ElementName: z.string(),
+  Pod: z.string(),
+  Version: z.string(),
+  Type: z.string(),
+  SizeBytes: z.number(),
+  CreatedTime: z.number(),
+});
+const envElementProfileList = defineGet("/env-element-profile-list", {
+  response: z.array(envElementProfileSchema),
+  queries: {
+    env: z.string(),
+    element: z.string(),
+    type: z.string().optional(),
+  },
+});
+const envElementProfileVersionSchema = z.object({
+  Version: z.string(),
+  Profiles: z.number(),
+  Total: z.number(),
+});
+const envElementProfileCompare = defineGet("/env-element-profile-compare", {
+  response: z.object({
+    Type: z.string(),
+    SampleType: z.string(),
+    Unit: z.string(),
+    Base: envElementProfileVersionSchema,
+    Target: envElementProfileVersionSchema,
+    Functions: z
+      .array(
+        z.object({
+          Name: z.string(),
+          Base: z.number(),
+          Target: z.number(),
+          Delta: z.number(),
+          DeltaPC: z.number(),
+        })
+      )
+      .nullable(),
+  }),
+  queries: {
+    env: z.string(),
+    element: z.string(),
+    type: z.string(),
+    base: z.string(),
+    target: z.string(),
+    top: z.string().optional(),
+  },
+});
+const envDriftList = defineGet("/env-drift-list", {
+  response: z.array(
+    z.object({
+      Cluster: z.string(),
+      Kind: z.string(),
+      Namespace: z.string(),
+      Name: z.string(),
+      Desired: z.string(),
+      Live: z.string(),
+      Time: z.number(),
+      EnvID: z.string(),
+      ElementName: z.string(),
+    })
+  ),
+  queries: {
+    env: z.string(),
+  },
+});
+const envQuotaSchema = z.object({
+  Key: z.string(),
+  CPUCores: z.number(),
+  RAMMB: z.number(),
+  StorageMB: z.number(),
+  Pods: z.number(),
+  Domains: z.number(),
+  BudgetMonthly: z.number(),
+  AlertEmails: z.array(z.string()).nullable(),
+});
+const envQuotaUsageSchema = z.object({
+  CPUCores: z.number(),
+  RAMMB: z.number(),
+  StorageMB: z.number(),
+  Pods: z.number(),
+  Domains: z.number(),
+});
+const quotaPricesSchema = z.object({
+  Currency: z.string(),
+  CPUCoreHour: z.number(),
+  RAMGBHour: z.number(),
+  StorageGBMonth: z.number(),
+});
+const envQuota = defineGet("/env-quota", {
+  response: z.object({
+    Quota: envQuotaSchema.nullable(),
+    Usage: envQuotaUsageSchema,
+    Cost: z.object({
+      Month: z.string(),
+      Cost: z.number(),
+      HourlyRate: z.number(),
+      Projected: z.number(),
+      Budget: z.number(),
+      BudgetAlert: z.boolean(),
+    }),
+    Currency: z.string(),
+  }),
+  queries: {
+    env: z.string(),
+  },
+});
+const systemQuotaList = defineGet("/system-quota-list", {
+  response: z.object({
+    Quotas: z.array(envQuotaSchema),
+    Prices: quotaPricesSchema,
+  }),
+});
+const systemQuotaSave = definePost("/system-quota-save", {
+  response: z.any(),
+  request: envQuotaSchema,
+});
+const systemQuotaDelete = defineGet("/system-quota-delete", {
+  response: z.any(),
+  queries: {
+    key: z.string(),
+  },
+});
+const systemQuotaPricesSave = definePost("/system-quota-prices-save", {
+  response: z.any(),
+  request: quotaPricesSchema,
+});
+const alertRuleSchema = z.object({
+  Expr: z.string(),
+  For: z.string(),
+  Severity: z.string(),
+  Labels: z.record(z.string()).nullable(),
+  Summary: z.string(),
+  Disabled: z.boolean(),
+});
+const alertRouteSchema = z.object({
+  Match: z.record(z.string()).nullable(),
+  MatchRe: z.record(z.string()).nullable(),
+  Emails: z.array(z.string()),
+  Provider: z.string(),
+  GroupBy: z.array(z.string()).nullable(),
+  GroupWait: z.string(),
+  RepeatInterval: z.string(),
+  Continue: z.boolean(),
+});
+const alertSilenceSchema = z.object({
+  ID: z.string(),
+  EnvID: z.string(),
+  Match: z.record(z.string()),
+  Comment: z.string(),
+  StartTime: z.number(),
+  EndTime: z.number(),
+  UserEmail: z.string(),
+});
+const envAlerts = defineGet("/env-alerts", {
+  response: z.object({
+    Config: z.object({
+      Rules: z.record(alertRuleSchema).nullable(),
+      Routes: z.array(alertRouteSchema).nullable(),
+    }),
+    ManagedByGit: z.boolean(),
+    Alerts: z.array(
+      z.object({
+        Rule: z.string(),
+        Labels: z.record(z.string()),
+        Value: z.number(),
+        Summary: z.string(),
+        State: z.string(),
+        ActiveTime: z.number(),
+        FiredTime: z.number(),
+        Silenced: z.boolean(),
+      })
+    ),
+    RuleErrors: z.record(z.string()),
+    Silences: z.array(alertSilenceSchema),
+  }),
+  queries: {
+    env: z.string(),
+  },
+});
+const envAlertsSet = definePost("/env-alerts-set", {
+  response: z.string(),
+  request: z.object({
+    EnvID: z.string(),
+    Rules: z.record(alertRuleSchema.partial()),
+    Routes: z.array(alertRouteSchema.partial()),
+  }),
+});
+const envAlertTest = defineGet("/env-alert-test", {
+  response: z.array(
+    z.object({
+      Labels: z.record(z.string()),
+      Value: z.number(),
+    })
+  ),
+  queries: {
+    env: z.string(),
+    expr: z.string(),
+  },
+});
+const envAlertSilenceCreate = definePost("/env-alert-silence-create", {
+  response: alertSilenceSchema,
+  request: z.object({
+    EnvID: z.string(),
+    Match: z.record(z.string()),
+    DurationMin: z.number(),
+    Comment: z.string(),
+  }),
+});
+const envAlertSilenceDelete = defineGet("/env-alert-silence-delete", {
+  response: z.string(),
+  queries: {
+    env: z.string(),
+    id: z.string(),
+  },
+});
+const envScheduleRulesSet = definePost("/env-schedule-rules-set", {
+  response: z.string(),
+  request: z.object({
+    EnvID: z.string(),
+    ExpireTime: z.number(),
+    IdleSleepMin: z.number(),
+    Calendars: z.array(z.string()),
+  }),
+});
+const elementScheduleSchema = z.object({
+  OnCrons: z.array(z.string()).nullable(),
+  OffCrons: z.array(z.string()).nullable(),
+  NoIdleSleep: z.boolean(),
+  IgnoreCalendars: z.boolean(),
+});
+const envElementScheduleSet = definePost("/env-element-schedule-set", {
+  response: z.string(),
+  request: z.object({
+    EnvID: z.string(),
+    Element: z.string(),
+    Schedule: elementScheduleSchema.nullable(),
+  }),
+});
+const scheduleCalendarSchema = z.object({
+  Name: z.string(),
+  URL: z.string(),
+  Timezone: z.string(),
+  Events: z
+    .array(
+      z.object({
+        Summary: z.string(),
+        Begin: z.number(),
+        End: z.number(),
+        Yearly: z.boolean(),
+      })
+    )
+    .nullable(),
+  ImportTime: z.number(),
+  UserEmail: z.string(),
+});
+const systemScheduleCalendarList = defineGet("/system-schedule-calendar-list", {
+  response: z.array(scheduleCalendarSchema),
+});
+const systemScheduleCalendarImport = definePost(
+  "/system-schedule-calendar-import",
+  {
+    response: z.any(),
+    request: z.object({
+      Name: z.string(),
+      URL: z.string(),
+      Timezone: z.string(),
+      ICal: z.string(),
+    }),
+  }
+);
+const systemScheduleCalendarDelete = defineGet(
+  "/system-schedule-calendar-delete",
+  {
+    response: z.any(),
+    queries: {
+      name: z.string(),
+    },
+  }
+);
 const permissionList = defineGet("/perms-list", {
   response: z.any(),
 });
@@ -743,6 +1164,37 @@ const endpoints = defineEndpoints(
   userPermission,
   permissionList,
   userLogin,
+  ssoProviders,
+  ssoSession,
+  envElementTerminal,
+  envTerminalSessionList,
+  envTerminalSessionReplay,
+  envElementSnapshotList,
+  envElementSnapshotCreate,
+  envElementSnapshotDelete,
+  envElementSnapshotRestore,
+  envElementBackupList,
+  envElementBackupCreate,
+  envElementBackupDelete,
+  envElementBackupRestore,
+  envElementProfileList,
+  envElementProfileCompare,
+  envDriftList,
+  envQuota,
+  systemQuotaList,
+  systemQuotaSave,
+  systemQuotaDelete,
+  systemQuotaPricesSave,
+  envAlerts,
+  envAlertsSet,
+  envAlertTest,
+  envAlertSilenceCreate,
+  envAlertSilenceDelete,
+  envScheduleRulesSet,
+  envElementScheduleSet,
+  systemScheduleCalendarList,
+  systemScheduleCalendarImport,
+  systemScheduleCalendarDelete,
   updateDefaultBranch,
   repoUpdateAccess,
   managementSet,
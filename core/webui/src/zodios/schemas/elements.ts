@@ -74,6 +74,14 @@ const ElementBase = z.object({
   UserEmail: z.string(),
   UserInitials: z.string(),
   Unschedulable: z.boolean(),
+  ScheduleOverride: z
+    .object({
+      OnCrons: z.array(z.string()).nullable(),
+      OffCrons: z.array(z.string()).nullable(),
+      NoIdleSleep: z.boolean(),
+      IgnoreCalendars: z.boolean(),
+    })
+    .nullish(),
   Stopped: z.boolean(),
   SaveTimestamp: z.number().int(),
 });
@@ -363,9 +371,23 @@ export const ElementMapStatus = z.object({
   PodCount: z.number().int(),
 });
 
+export const ElementPodMetrics = z.object({
+  CPUThrottledPC: z.number(),
+  WorkingSetMB: z.number(),
+  MemLimitMB: z.number(),
+  DiskReadKBs: z.number(),
+  DiskWriteKBs: z.number(),
+  NetRxKBs: z.number(),
+  NetTxKBs: z.number(),
+  OOMKills: z.number(),
+  Restarts: z.number(),
+  UpdateTime: z.number(),
+});
+
 export const ElementMapRespExtended = z.object({
   Info: ElementMapResp,
   Status: ElementMapStatus,
+  Metrics: ElementPodMetrics.nullish(),
 });
 
 export const GitEnvS = z.object({
@@ -311,6 +311,27 @@ export const ContainersInfo = z
 //   z.string(),
 // ]);
 
+const SLOObjective = z.object({
+  Target: z.number(),
+  SLI: z.number(),
+  BudgetRemaining: z.number(),
+  BurnRate1h: z.number(),
+  BurnRate6h: z.number(),
+});
+
+export const SLOStatus = z.object({
+  WindowDays: z.number(),
+  Requests: z.number(),
+  Availability: SLOObjective.nullable(),
+  Latency: SLOObjective.nullable(),
+  LatencyMs: z.number(),
+  PercentileMs: z.number(),
+  Exhausted: z.boolean(),
+  BlockAutoUpdate: z.boolean(),
+  Error: z.string(),
+  UpdateTime: z.number(),
+});
+
 export const EnvInfo = z.object({
   Env: z.object({
     ID: z.string(),
@@ -322,6 +343,10 @@ export const EnvInfo = z.object({
       Timezone: z.object({}).nullish(),
       OnCrons: z.array(z.string()).nullish(),
       OffCrons: z.array(z.string()).nullish(),
+      ExpireTime: z.number().optional(),
+      IdleSleepMin: z.number().optional(),
+      Calendars: z.array(z.string()).nullish(),
+      Sleeping: z.array(z.string()).nullish(),
     }),
     GitOps: z.object({
       Enabled: z.boolean(),
@@ -379,6 +404,23 @@ export const EnvInfo = z.object({
   Teams: z.record(z.boolean()),
   Members: z.record(z.record(z.boolean())),
   URLs: z.record(z.string()),
+  Dependencies: z
+    .object({
+      Nodes: z.array(
+        z.object({
+          Name: z.string(),
+          DependsOn: z.array(z.string()),
+          Waiting: z.array(z.string()),
+        })
+      ),
+      Levels: z.array(z.array(z.string())),
+    })
+    .optional(),
+  ScheduleBlackout: z.string().optional(),
+  SLO: z.record(SLOStatus).nullable().optional(),
+  AutoUpdateBlockedBy: z.string().optional(),
+  Dashboard: z.string().optional(),
+  ElementDashboards: z.record(z.string()).nullable().optional(),
 });
 
 export const EnvPod = z.object({
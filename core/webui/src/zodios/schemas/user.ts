@@ -5,6 +5,7 @@ export const permissions = z.object({
   Glob_CreateAndDeleteEnvs: z.object({ Index: z.number(), IsSet: z.boolean() }),
   Glob_CreateAndDeleteGitRepos: z.object({ Index: z.number(), IsSet: z.boolean() }),
   Glob_ManageGlobalMemebers: z.object({ Index: z.number(), IsSet: z.boolean() }),
+  Glob_ManageSystem: z.object({ Index: z.number(), IsSet: z.boolean() }),
 });
 export const User = z.object({
   ID: z.string(),
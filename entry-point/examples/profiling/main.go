@@ -0,0 +1,35 @@
+// Sample Go service for `[profiling]` of pod element, it serves
+// net/http/pprof on :6060 and burns some CPU and memory. Run it under
+// entry-point with start-dev-profiling.sh to collect profiles locally.
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"time"
+)
+
+func main() {
+	go func() {
+		fmt.Println(http.ListenAndServe("127.0.0.1:6060", nil))
+	}()
+
+	keep := [][]byte{}
+	for i := 0; ; i++ {
+		buf := make([]byte, 64*1024)
+		for j := 0; j < 200; j++ {
+			sum := sha256.Sum256(buf)
+			copy(buf, sum[:])
+		}
+		keep = append(keep, buf)
+		if len(keep) > 500 {
+			keep = keep[1:]
+		}
+		if i%1000 == 0 {
+			fmt.Println("iteration", i)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
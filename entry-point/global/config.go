@@ -12,7 +12,14 @@ import (
 var (
 	GitTag string // build version
 
-	ProcessCommand = os.Args[1:]
+	// EP_EXTRA_ARGS are appended to command of image, separated by `;`,
+	// eg. core adds entrypoints of tcp and udp domains to CMD of traefik
+	ProcessCommand = func() []string {
+		if len(os.Args) < 2 {
+			return nil
+		}
+		return append(os.Args[1:], env.Get("EP_EXTRA_ARGS", []string{})...)
+	}()
 
 	JournalProxyURL = func() string {
 		tmp := os.Getenv("TIMONI_JOURNAL_PROXY")
@@ -57,6 +64,17 @@ var (
 
 	TimoniURL = env.Get("TIMONI_URL", "")
 
+	// `[profiling]` of pod element, profiles are pulled from pprof HTTP
+	// endpoint of process, EP_PROFILING_DIR keeps them locally instead of
+	// uploading to Timoni
+	ProfilingPort       = env.Get("EP_PROFILING_PORT", 0)
+	ProfilingPath       = env.Get("EP_PROFILING_PATH", "/debug/pprof")
+	ProfilingInterval   = env.Get("EP_PROFILING_INTERVAL", 600) // seconds
+	ProfilingTypes      = env.Get("EP_PROFILING_TYPES", []string{"cpu", "heap"})
+	ProfilingCPUSeconds = env.Get("EP_PROFILING_CPU_SECONDS", 10)
+	ProfilingToken      = env.Get("EP_PROFILING_TOKEN", "")
+	ProfilingDir        = env.Get("EP_PROFILING_DIR", "")
+
 	InitialEnvs = GetEnvMap()
 
 	LogWriter = utils.Must(NewLogWriter(ConfigS{
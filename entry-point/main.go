@@ -32,6 +32,7 @@ func main() {
 	modes.ApplyVariablesOnFiles()
 	go modes.TailDir()
 	go server.ServeStaticFiles()
+	go modes.Profiling()
 
 	modes.Setup()
 	modes.Mode.Start()
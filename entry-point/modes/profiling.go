@@ -0,0 +1,59 @@
+package modes
+
+import (
+	"entry-point/global"
+	"entry-point/profiling"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Profiling pulls profiles from pprof HTTP endpoint of process every
+// interval and uploads them to Timoni, tagged with env, element, pod and
+// version of element. Process has to serve net/http/pprof on localhost.
+func Profiling() {
+	if global.ProfilingPort <= 0 {
+		return
+	}
+
+	cfg := &profiling.ConfigS{
+		Port:        global.ProfilingPort,
+		Path:        global.ProfilingPath,
+		CPUSeconds:  global.ProfilingCPUSeconds,
+		Dir:         global.ProfilingDir,
+		TimoniURL:   global.TimoniURL,
+		Token:       global.ProfilingToken,
+		EnvID:       global.EnvironmentID,
+		ElementName: global.ElementName,
+		PodName:     global.PodName,
+		Version:     global.ElementVersion,
+	}
+
+	interval := time.Duration(global.ProfilingInterval) * time.Second
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+
+	// let process start its HTTP server
+	time.Sleep(10 * time.Second)
+
+	for {
+		for _, profileType := range global.ProfilingTypes {
+			profileType = strings.TrimSpace(profileType)
+			if profileType == "" {
+				continue
+			}
+
+			buf, err := cfg.Pull(profileType)
+			if err != nil {
+				fmt.Fprintf(global.STDERR, "Error pulling %s profile: %s\n", profileType, err.Error())
+				continue
+			}
+
+			if err := cfg.Store(profileType, buf); err != nil {
+				fmt.Fprintf(global.STDERR, "Error storing %s profile: %s\n", profileType, err.Error())
+			}
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,111 @@
+package profiling
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConfigS is `[profiling]` of pod element with identity of pod, profiles
+// are kept in Dir when set, otherwise uploaded to TimoniURL
+type ConfigS struct {
+	Port       int    // pprof HTTP endpoint of process on localhost
+	Path       string // eg. /debug/pprof
+	CPUSeconds int
+	Dir        string
+	TimoniURL  string
+	Token      string
+
+	EnvID       string
+	ElementName string
+	PodName     string
+	Version     string
+}
+
+// Pull returns gzipped protobuf profile of process
+func (c *ConfigS) Pull(profileType string) ([]byte, error) {
+	base := fmt.Sprintf("http://127.0.0.1:%d/%s/", c.Port, strings.Trim(c.Path, "/"))
+
+	timeout := 30 * time.Second
+	u := base + profileType
+	if profileType == "cpu" {
+		u = fmt.Sprintf("%sprofile?seconds=%d", base, c.CPUSeconds)
+		timeout += time.Duration(c.CPUSeconds) * time.Second
+	}
+
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Store keeps profile in Dir or uploads it to Timoni
+func (c *ConfigS) Store(profileType string, buf []byte) error {
+
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0755); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%s-%d.pb.gz", profileType, c.Version, time.Now().Unix())
+		return os.WriteFile(filepath.Join(c.Dir, name), buf, 0644)
+	}
+
+	if c.TimoniURL == "" {
+		return fmt.Errorf("TIMONI_URL is not set")
+	}
+
+	timoniURL := c.TimoniURL
+	if !strings.HasPrefix(timoniURL, "http://") && !strings.HasPrefix(timoniURL, "https://") {
+		timoniURL = "https://" + timoniURL
+	}
+
+	query := url.Values{}
+	query.Set("envID", c.EnvID)
+	query.Set("elementName", c.ElementName)
+	query.Set("pod", c.PodName)
+	query.Set("version", c.Version)
+	query.Set("type", profileType)
+	query.Set("token", c.Token)
+
+	client := &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	response, err := client.Post(
+		strings.TrimSuffix(timoniURL, "/")+"/api/entry-point-profile-upload?"+query.Encode(),
+		"application/octet-stream",
+		bytes.NewReader(buf),
+	)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package profiling
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pprofServer serves net/http/pprof on random localhost port like profiled
+// process does, returns the port
+func pprofServer(t *testing.T) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func isGzip(buf []byte) bool {
+	return len(buf) > 2 && buf[0] == 0x1f && buf[1] == 0x8b
+}
+
+func TestPull(t *testing.T) {
+	cfg := &ConfigS{Port: pprofServer(t), Path: "/debug/pprof/", CPUSeconds: 1}
+
+	for _, profileType := range []string{"heap", "cpu", "goroutine"} {
+		t.Run(profileType, func(t *testing.T) {
+			buf, err := cfg.Pull(profileType)
+			if err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			if !isGzip(buf) {
+				t.Errorf("Pull() returned %d bytes which are not gzipped profile", len(buf))
+			}
+		})
+	}
+
+	if _, err := cfg.Pull("unknown"); err == nil {
+		t.Error("Pull() of unknown profile expected error")
+	}
+}
+
+func TestStoreUpload(t *testing.T) {
+	cfg := &ConfigS{
+		Port:        pprofServer(t),
+		Path:        "/debug/pprof",
+		Token:       "profiling-token",
+		EnvID:       "env-a",
+		ElementName: "api",
+		PodName:     "api-0",
+		Version:     "abc123",
+	}
+	buf, err := cfg.Pull("heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded []byte
+	timoni := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/entry-point-profile-upload" {
+			http.NotFound(w, r)
+			return
+		}
+		want := map[string]string{
+			"envID":       "env-a",
+			"elementName": "api",
+			"pod":         "api-0",
+			"version":     "abc123",
+			"type":        "heap",
+		}
+		for k, v := range want {
+			if got := r.URL.Query().Get(k); got != v {
+				t.Errorf("upload %s = %q, want %q", k, got, v)
+			}
+		}
+		uploaded, _ = io.ReadAll(r.Body)
+		if r.URL.Query().Get("token") != "profiling-token" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer timoni.Close()
+
+	cfg.TimoniURL = timoni.URL + "/"
+	if err := cfg.Store("heap", buf); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if !bytes.Equal(uploaded, buf) {
+		t.Errorf("Store() uploaded %d bytes, want %d", len(uploaded), len(buf))
+	}
+
+	cfg.Token = "wrong"
+	err = cfg.Store("heap", buf)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Store() with wrong token error = %v, want 403", err)
+	}
+
+	cfg.TimoniURL = ""
+	if err := cfg.Store("heap", buf); err == nil {
+		t.Error("Store() without TimoniURL expected error")
+	}
+}
+
+func TestStoreDir(t *testing.T) {
+	cfg := &ConfigS{Dir: filepath.Join(t.TempDir(), "profiles"), Version: "abc123"}
+
+	if err := cfg.Store("cpu", []byte{0x1f, 0x8b, 0}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "cpu-abc123-*.pb.gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Store() files = %v, %v", files, err)
+	}
+	if buf, _ := os.ReadFile(files[0]); !isGzip(buf) {
+		t.Errorf("Store() wrote %v", buf)
+	}
+}
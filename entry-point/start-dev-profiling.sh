@@ -0,0 +1,21 @@
+#!/bin/bash
+
+set -ex
+
+export POD_NAME="dev"
+export NAMESPACE="dev"
+export ELEMENT_NAME="dev"
+export ELEMENT_VERSION="1"
+
+export LOG_MODE="mjson"
+
+# profiles are written to EP_PROFILING_DIR, compare them with
+# go tool pprof -diff_base=<older>.pb.gz <newer>.pb.gz
+export EP_PROFILING_PORT="6060"
+export EP_PROFILING_INTERVAL="60"
+export EP_PROFILING_TYPES="cpu,heap,goroutine"
+export EP_PROFILING_CPU_SECONDS="5"
+export EP_PROFILING_DIR="/tmp/entry-point-profiles"
+
+go build -o /tmp/profiling-sample ./examples/profiling
+go run . /tmp/profiling-sample
@@ -1,6 +1,7 @@
 package action
 
 import (
+	"journal-proxy/metrics"
 	"journal-proxy/wsb"
 	"lib/tlog"
 	"net/http"
@@ -26,6 +27,7 @@ func DeleteEnvHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	conn.DropTables(envID)
+	metrics.EntriesDeleteEnv(envID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
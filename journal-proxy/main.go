@@ -88,6 +88,7 @@ func main() {
 
 	// HTTP
 	http.Handle("/metrics", um.HandlerPretty(&metrics.Vars))
+	http.HandleFunc("/metrics-prom", metrics.EntriesHandler)
 	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("ok"))
 	})
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"fmt"
+	"journal-proxy/global"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Log entries per env, element and level in Prometheus text format, scraped
+// by VictoriaMetrics for dashboards of envs (timoni_journal_entries_total)
+
+type entriesKey struct {
+	EnvID   string
+	Element string
+	Level   string
+}
+
+var (
+	entries     = map[entriesKey]uint64{}
+	entriesLock sync.Mutex
+)
+
+// EntriesCount counts inserted entries
+func EntriesCount(list []*global.Entry) {
+	entriesLock.Lock()
+	defer entriesLock.Unlock()
+
+	for _, e := range list {
+		if e.EnvID == "" {
+			continue
+		}
+		entries[entriesKey{e.EnvID, e.Element, e.Level}]++
+	}
+}
+
+// EntriesDeleteEnv drops series of deleted env
+func EntriesDeleteEnv(envID string) {
+	entriesLock.Lock()
+	defer entriesLock.Unlock()
+
+	for k := range entries {
+		if k.EnvID == envID {
+			delete(entries, k)
+		}
+	}
+}
+
+func EntriesHandler(w http.ResponseWriter, r *http.Request) {
+	entriesLock.Lock()
+	lines := make([]string, 0, len(entries))
+	for k, v := range entries {
+		lines = append(lines, fmt.Sprintf("timoni_journal_entries_total{env_id=%q,element=%q,level=%q} %d", k.EnvID, k.Element, k.Level, v))
+	}
+	entriesLock.Unlock()
+	sort.Strings(lines)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte("# TYPE timoni_journal_entries_total counter\n"))
+	w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
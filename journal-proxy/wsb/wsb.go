@@ -106,6 +106,7 @@ func insert(entries []*global.Entry, conn journal.ConnectionI) {
 		}
 
 		wg.Wait()
+		metrics.EntriesCount(entries)
 		metrics.Vars.Inserts.Add(1)
 		metrics.Vars.InsertedTotal.Add(size)
 		metrics.Vars.ActiveInsertsToDB.Add(-1)
@@ -0,0 +1,470 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type of value described by Field
+type Type string
+
+const (
+	TypeString   Type = "string"
+	TypeInt      Type = "int"
+	TypeFloat    Type = "float"
+	TypeBool     Type = "bool"
+	TypeEnum     Type = "enum"
+	TypeURL      Type = "url"
+	TypeEmail    Type = "email"
+	TypeDuration Type = "duration"
+	TypeCIDR     Type = "cidr"
+	TypeJSON     Type = "json"
+	TypeRegex    Type = "regex"
+)
+
+var Types = []Type{
+	TypeString, TypeInt, TypeFloat, TypeBool, TypeEnum, TypeURL,
+	TypeEmail, TypeDuration, TypeCIDR, TypeJSON, TypeRegex,
+}
+
+// Field describes single named string value, eg. element variable or env var.
+//
+//	type = "int"
+//	min = 1
+//	max = 10
+//	default = "3"
+type Field struct {
+	Type       Type     `toml:"type" json:",omitempty"`
+	Required   bool     `toml:"required" json:",omitempty"`
+	Default    string   `toml:"default" json:",omitempty"`
+	Deprecated string   `toml:"deprecated" json:",omitempty"` // message shown when value is set
+	Min        *float64 `toml:"min" json:",omitempty"`        // value for int/float/duration(seconds), length for others
+	Max        *float64 `toml:"max" json:",omitempty"`
+	Values     []string `toml:"values" json:",omitempty"`  // allowed values of enum
+	Pattern    string   `toml:"pattern" json:",omitempty"` // regex value has to match
+}
+
+// IsEmpty returns true when field has no schema
+func (f Field) IsEmpty() bool {
+	return f.Type == "" && !f.Required && f.Default == "" && f.Deprecated == "" &&
+		f.Min == nil && f.Max == nil && len(f.Values) == 0 && f.Pattern == ""
+}
+
+// Check returns error when schema itself is invalid.
+func (f Field) Check() error {
+	if f.Type != "" {
+		known := false
+		for _, t := range Types {
+			if t == f.Type {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown type `%s`, expected one of: %s", f.Type, typeNames())
+		}
+	}
+
+	if f.Type == TypeEnum && len(f.Values) == 0 {
+		return fmt.Errorf("type `enum` requires list of `values`")
+	}
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		return fmt.Errorf("`min` (%v) is greater than `max` (%v)", *f.Min, *f.Max)
+	}
+	if f.Pattern != "" {
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("`pattern` is not a valid regular expression: %s", err.Error())
+		}
+	}
+	if f.Default != "" {
+		if err := f.validate(f.Default); err != nil {
+			return fmt.Errorf("`default` is invalid: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// Validate checks value against schema, returned error is human readable
+// and does not contain the value, so it is safe to use with secrets.
+func (f Field) Validate(value string) error {
+	if value == "" {
+		if f.Required {
+			return fmt.Errorf("value is required")
+		}
+		return nil
+	}
+	return f.validate(value)
+}
+
+func (f Field) validate(value string) error {
+	if err := CheckType(f.Type, value, f.Values); err != nil {
+		return err
+	}
+
+	switch f.Type {
+	case TypeInt, TypeFloat:
+		num, _ := strconv.ParseFloat(value, 64)
+		if err := f.checkRange(num, "value"); err != nil {
+			return err
+		}
+
+	case TypeDuration:
+		d, _ := time.ParseDuration(value)
+		if err := f.checkRange(d.Seconds(), "duration in seconds"); err != nil {
+			return err
+		}
+
+	case TypeBool, TypeEnum:
+
+	default:
+		if err := f.checkRange(float64(len(value)), "length"); err != nil {
+			return err
+		}
+	}
+
+	if f.Pattern != "" {
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return fmt.Errorf("`pattern` is not a valid regular expression")
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("value does not match pattern `%s`", f.Pattern)
+		}
+	}
+	return nil
+}
+
+func (f Field) checkRange(num float64, what string) error {
+	if f.Min != nil && num < *f.Min {
+		return fmt.Errorf("%s must be at least %v", what, *f.Min)
+	}
+	if f.Max != nil && num > *f.Max {
+		return fmt.Errorf("%s must be at most %v", what, *f.Max)
+	}
+	return nil
+}
+
+// CheckType returns error when value is not valid value of type t.
+// values are allowed values of enum type.
+func CheckType(t Type, value string, values []string) error {
+	switch t {
+	case "", TypeString:
+
+	case TypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("value is not an integer")
+		}
+
+	case TypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("value is not a number")
+		}
+
+	case TypeBool:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true", "1", "yes", "on", "y", "t":
+		case "false", "0", "no", "off", "n", "f":
+		default:
+			return fmt.Errorf("value is not a boolean, use true or false")
+		}
+
+	case TypeEnum:
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("value must be one of: %s", strings.Join(values, ", "))
+
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("value is not a valid URL, expected eg. https://example.com/path")
+		}
+
+	case TypeEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return fmt.Errorf("value is not a valid email address")
+		}
+
+	case TypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("value is not a valid duration, expected eg. 30s, 5m or 1h30m")
+		}
+
+	case TypeCIDR:
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("value is not a valid CIDR, expected eg. 10.0.0.0/8")
+		}
+
+	case TypeJSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("value is not a valid JSON")
+		}
+
+	case TypeRegex:
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("value is not a valid regular expression: %s", err.Error())
+		}
+
+	default:
+		return fmt.Errorf("unknown type `%s`", t)
+	}
+	return nil
+}
+
+func typeNames() string {
+	names := make([]string, len(Types))
+	for i, t := range Types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ---
+
+// FieldError is validation error of single field
+type FieldError struct {
+	Field   string
+	Message string
+	Warning bool `json:",omitempty"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+type FieldErrors []FieldError
+
+func (errs FieldErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns nil when there are no errors, warnings are ignored
+func (errs FieldErrors) Err() error {
+	for _, e := range errs {
+		if !e.Warning {
+			return errs
+		}
+	}
+	return nil
+}
+
+// ---
+
+// Schema describes set of named values and constraints between them.
+type Schema struct {
+	Fields      map[string]Field
+	Constraints []Constraint
+}
+
+// Check returns errors of invalid field schemas and constraints
+func (s Schema) Check() FieldErrors {
+	errs := FieldErrors{}
+	for _, name := range s.fieldNames() {
+		if err := s.Fields[name].Check(); err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	for _, c := range s.Constraints {
+		if _, err := c.parse(); err != nil {
+			errs = append(errs, FieldError{Field: c.Rule, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Validate validates values (defaults should be applied already),
+// deprecated fields with value are reported as warnings.
+func (s Schema) Validate(values map[string]string) FieldErrors {
+	errs := FieldErrors{}
+	for _, name := range s.fieldNames() {
+		f := s.Fields[name]
+		value := values[name]
+
+		if err := f.Validate(value); err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+		}
+		if f.Deprecated != "" && value != "" && value != f.Default {
+			errs = append(errs, FieldError{Field: name, Message: "deprecated: " + f.Deprecated, Warning: true})
+		}
+	}
+
+	for _, c := range s.Constraints {
+		if err := c.Validate(values); err != nil {
+			errs = append(errs, FieldError{Field: c.Rule, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func (s Schema) fieldNames() []string {
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ---
+
+// Constraint between values, rule is one of:
+//
+//	MIN_REPLICAS <= MAX_REPLICAS    (<, <=, >, >=, ==, !=; operand can be a name, number, duration or "string")
+//	TLS_CERT requires TLS_KEY       (when first is set, second has to be set)
+//	PASSWORD conflicts PASSWORD_FILE (only one of them can be set)
+type Constraint struct {
+	Rule    string `toml:"rule"`
+	Message string `toml:"message"` // optional, used instead of generated message
+}
+
+var reConstraint = regexp.MustCompile(`^\s*(\S+)\s+(<=|>=|==|!=|<|>|requires|conflicts)\s+(\S+)\s*$`)
+
+type constraintS struct {
+	left, op, right string
+}
+
+func (c Constraint) parse() (constraintS, error) {
+	m := reConstraint.FindStringSubmatch(c.Rule)
+	if m == nil {
+		return constraintS{}, fmt.Errorf("invalid constraint, expected eg. `A <= B`, `A requires B` or `A conflicts B`")
+	}
+	return constraintS{left: m[1], op: m[2], right: m[3]}, nil
+}
+
+// Names returns names of values used by constraint
+func (c Constraint) Names() []string {
+	p, err := c.parse()
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, x := range []string{p.left, p.right} {
+		if _, literal := literalValue(x); !literal {
+			names = append(names, x)
+		}
+	}
+	return names
+}
+
+func (c Constraint) Validate(values map[string]string) error {
+	p, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	fail := func(format string, args ...any) error {
+		if c.Message != "" {
+			return fmt.Errorf("%s", c.Message)
+		}
+		return fmt.Errorf(format, args...)
+	}
+
+	operand := func(x string) string {
+		if v, literal := literalValue(x); literal {
+			return v
+		}
+		return values[x]
+	}
+	left, right := operand(p.left), operand(p.right)
+
+	switch p.op {
+	case "requires":
+		if left != "" && right == "" {
+			return fail("%s requires %s to be set", p.left, p.right)
+		}
+		return nil
+
+	case "conflicts":
+		if left != "" && right != "" {
+			return fail("%s and %s cannot be set together", p.left, p.right)
+		}
+		return nil
+	}
+
+	if left == "" || right == "" {
+		// nothing to compare, use `required` to force values
+		return nil
+	}
+
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		if p.op != "==" && p.op != "!=" {
+			return fail("%s and %s cannot be compared with %s, values are not numbers or durations", p.left, p.right, p.op)
+		}
+		cmp = strings.Compare(left, right)
+	}
+
+	var valid bool
+	switch p.op {
+	case "<":
+		valid = cmp < 0
+	case "<=":
+		valid = cmp <= 0
+	case ">":
+		valid = cmp > 0
+	case ">=":
+		valid = cmp >= 0
+	case "==":
+		valid = cmp == 0
+	case "!=":
+		valid = cmp != 0
+	}
+	if !valid {
+		return fail("%s must be %s %s", p.left, p.op, p.right)
+	}
+	return nil
+}
+
+// literalValue returns value of number, duration or quoted string operand
+func literalValue(x string) (string, bool) {
+	if len(x) >= 2 && x[0] == '"' && x[len(x)-1] == '"' {
+		return x[1 : len(x)-1], true
+	}
+	if _, err := strconv.ParseFloat(x, 64); err == nil {
+		return x, true
+	}
+	if _, err := time.ParseDuration(x); err == nil {
+		return x, true
+	}
+	return "", false
+}
+
+// compareValues compares numbers or durations
+func compareValues(a, b string) (int, bool) {
+	var x, y float64
+	var errA, errB error
+
+	x, errA = strconv.ParseFloat(a, 64)
+	y, errB = strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		d1, err1 := time.ParseDuration(a)
+		d2, err2 := time.ParseDuration(b)
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		x, y = float64(d1), float64(d2)
+	}
+
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
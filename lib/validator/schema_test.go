@@ -0,0 +1,153 @@
+package validator
+
+import (
+	"lib/utils/conv"
+	"testing"
+)
+
+func TestFieldTypes(t *testing.T) {
+	valid := map[Type][]string{
+		TypeInt:      {"0", "-12", "42"},
+		TypeFloat:    {"1.5", "3", "-0.1"},
+		TypeBool:     {"true", "no", "1"},
+		TypeURL:      {"https://timoni.io", "postgres://db:5432/app"},
+		TypeEmail:    {"admin@timoni.io"},
+		TypeDuration: {"30s", "1h30m"},
+		TypeCIDR:     {"10.0.0.0/8", "fd00::/64"},
+		TypeJSON:     {`{"a": 1}`, `[1, 2]`, `"x"`},
+		TypeRegex:    {`^[a-z]+$`},
+	}
+	invalid := map[Type][]string{
+		TypeInt:      {"1.5", "abc"},
+		TypeFloat:    {"abc"},
+		TypeBool:     {"maybe"},
+		TypeURL:      {"timoni.io", "://x"},
+		TypeEmail:    {"admin", "Admin <admin@timoni.io>"},
+		TypeDuration: {"5 minutes"},
+		TypeCIDR:     {"10.0.0.1"},
+		TypeJSON:     {`{a: 1}`},
+		TypeRegex:    {`[a-z`},
+	}
+
+	for typ, values := range valid {
+		for _, v := range values {
+			if err := (Field{Type: typ}).Validate(v); err != nil {
+				t.Errorf("%s %q: %s", typ, v, err)
+			}
+		}
+	}
+	for typ, values := range invalid {
+		for _, v := range values {
+			if err := (Field{Type: typ}).Validate(v); err == nil {
+				t.Errorf("%s %q: expected error", typ, v)
+			}
+		}
+	}
+}
+
+func TestFieldRules(t *testing.T) {
+	f := Field{Type: TypeInt, Min: conv.Ptr(1.0), Max: conv.Ptr(10.0)}
+	if err := f.Validate("5"); err != nil {
+		t.Error(err)
+	}
+	if err := f.Validate("11"); err == nil {
+		t.Error("max")
+	}
+	if err := f.Validate(""); err != nil {
+		t.Error("not required", err)
+	}
+	f.Required = true
+	if err := f.Validate(""); err == nil {
+		t.Error("required")
+	}
+
+	enum := Field{Type: TypeEnum, Values: []string{"dev", "prod"}}
+	if err := enum.Validate("prod"); err != nil {
+		t.Error(err)
+	}
+	if err := enum.Validate("test"); err == nil {
+		t.Error("enum")
+	}
+
+	str := Field{Max: conv.Ptr(3.0), Pattern: `^[a-z]+$`}
+	if err := str.Validate("abcd"); err == nil {
+		t.Error("length")
+	}
+	if err := str.Validate("aB"); err == nil {
+		t.Error("pattern")
+	}
+
+	if err := (Field{Type: "number"}).Check(); err == nil {
+		t.Error("unknown type")
+	}
+	if err := (Field{Type: TypeEnum}).Check(); err == nil {
+		t.Error("enum without values")
+	}
+	if err := (Field{Type: TypeInt, Default: "x"}).Check(); err == nil {
+		t.Error("invalid default")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema{
+		Fields: map[string]Field{
+			"MIN":     {Type: TypeInt},
+			"MAX":     {Type: TypeInt},
+			"TIMEOUT": {Type: TypeDuration},
+			"OLD":     {Deprecated: "use NEW"},
+		},
+		Constraints: []Constraint{
+			{Rule: "MIN <= MAX"},
+			{Rule: "TIMEOUT < 1m", Message: "timeout is too long"},
+			{Rule: "CERT requires KEY"},
+			{Rule: "PASSWORD conflicts PASSWORD_FILE"},
+		},
+	}
+	if errs := s.Check(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	values := map[string]string{"MIN": "1", "MAX": "3", "TIMEOUT": "30s"}
+	if errs := s.Validate(values); len(errs) > 0 {
+		t.Error(errs)
+	}
+
+	values = map[string]string{
+		"MIN": "5", "MAX": "3", "TIMEOUT": "2m", "OLD": "x",
+		"CERT": "c", "PASSWORD": "p", "PASSWORD_FILE": "/f",
+	}
+	errs := s.Validate(values)
+	if len(errs) != 5 {
+		t.Fatal(errs)
+	}
+	for _, e := range errs {
+		if e.Field == "OLD" && !e.Warning {
+			t.Error("deprecated should be a warning")
+		}
+		if e.Field == "TIMEOUT < 1m" && e.Message != "timeout is too long" {
+			t.Error(e.Message)
+		}
+	}
+
+	if errs := (Schema{Constraints: []Constraint{{Rule: "A ~ B"}}}).Check(); len(errs) != 1 {
+		t.Error("invalid rule")
+	}
+	if names := (Constraint{Rule: "A <= 10"}).Names(); len(names) != 1 || names[0] != "A" {
+		t.Error(names)
+	}
+}
+
+func TestTypeTag(t *testing.T) {
+	type test struct {
+		Email string `type:"email"`
+		Stage string `type:"enum:dev|prod"`
+	}
+	x := &test{Email: "admin@timoni.io", Stage: "dev"}
+	if err := Validate(x); err != nil {
+		t.Error(err)
+	}
+	x.Stage = "test"
+	if err := Validate(x); err == nil {
+		t.Error("enum")
+	}
+}
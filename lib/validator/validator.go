@@ -20,6 +20,7 @@ var validators = maps.NewWeighted(map[string]maps.Weighted[validatorI]{
 	"min":   {Value: min{}, Weight: 10},
 	"max":   {Value: max{}, Weight: 10},
 	"regex": {Value: regex{}, Weight: 10},
+	"type":  {Value: typeV{}, Weight: 10},
 })
 
 type validator struct {
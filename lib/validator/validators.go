@@ -145,6 +145,31 @@ func (regex) validate(tagValue string, v reflect.Value) error {
 	return nil
 }
 
+type typeV struct{}
+
+// typeV validates string fields with types of Field schema,
+// eg. `type:"email"` or `type:"enum:dev|prod"`
+func (typeV) validate(tagValue string, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("invalid type for type validator")
+	}
+	if v.String() == "" {
+		return nil
+	}
+
+	t, values, _ := strings.Cut(tagValue, ":")
+	return CheckType(Type(t), v.String(), strings.Split(values, "|"))
+}
+
 type flags struct{}
 
 func (flags) validate(tagValue string, v reflect.Value) error {
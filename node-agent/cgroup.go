@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"lib/tlog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Per-pod metrics read from cgroup v2 files of pods, it is cheaper than
+// scanning processes and covers what processes don't show: disk I/O,
+// throttling, working set vs limit and OOM kills. CPU and memory of pods and
+// their containers come from cpu.stat and memory.current, processes are
+// scanned only on cgroup v1. Network is read from /proc/<pid>/net/dev of any
+// process of pod, all containers share netns.
+
+type cgroupStatsS struct {
+	CPUUsage     uint64 // usec
+	CPUThrottled uint64 // usec
+	MemCurrent   uint64 // bytes
+	MemInactive  uint64 // bytes, inactive_file
+	MemMax       uint64 // bytes, 0 = no limit
+	OOMKills     uint64
+	IORead       uint64 // bytes
+	IOWrite      uint64 // bytes
+	NetRx        uint64 // bytes
+	NetTx        uint64 // bytes
+}
+
+type cgroupSampleS struct {
+	stats cgroupStatsS
+	time  time.Time
+}
+
+// podCgroupMetricS is computed from two samples of pod cgroup
+type podCgroupMetricS struct {
+	CPU          float64 // % of one core
+	Memory       float64 // KiB, memory.current
+	CPUThrottled float64 // % of time
+	WorkingSet   float64 // KiB
+	MemLimit     float64 // KiB, 0 = no limit
+	OOMKills     float64 // since start of pod
+	DiskRead     float64 // KiB/s
+	DiskWrite    float64 // KiB/s
+	NetRx        float64 // KiB/s
+	NetTx        float64 // KiB/s
+	Containers   []containerCgroupMetricS
+}
+
+// add sums metrics of pods of element, throttling is the worst of pods,
+// pods without memory limit are not counted in the limit
+func (m *podCgroupMetricS) add(o podCgroupMetricS) {
+	m.CPU += o.CPU
+	m.Memory += o.Memory
+	m.CPUThrottled = math.Max(m.CPUThrottled, o.CPUThrottled)
+	m.WorkingSet += o.WorkingSet
+	m.MemLimit += o.MemLimit
+	m.OOMKills += o.OOMKills
+	m.DiskRead += o.DiskRead
+	m.DiskWrite += o.DiskWrite
+	m.NetRx += o.NetRx
+	m.NetTx += o.NetTx
+}
+
+// containerCgroupMetricS is CPU and memory of container of pod
+type containerCgroupMetricS struct {
+	Name   string  // command of first process of container
+	CPU    float64 // % of one core
+	Memory float64 // KiB, memory.current
+}
+
+var (
+	cgroupSamples    = map[string]cgroupSampleS{} // podID -> last sample
+	containerSamples = map[string]cgroupSampleS{} // cgroup dir of container -> last sample
+	cgroupV1Once     bool
+)
+
+// cgroupRoot returns cgroup v2 mount of host, empty for cgroup v1
+func cgroupRoot() string {
+	dirs := []string{"/proc/1/root/sys/fs/cgroup", "/sys/fs/cgroup"}
+	if dir := os.Getenv("CGROUP_ROOT"); dir != "" {
+		dirs = []string{dir}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// cgroupPodID returns ID of pod from name of its cgroup, eg.
+// kubepods-burstable-pod<uid>.slice (systemd) or pod<uid> (cgroupfs)
+func cgroupPodID(name string) string {
+	if _, after, found := strings.Cut(name, "-pod"); found && strings.HasSuffix(after, ".slice") {
+		return strings.ReplaceAll(strings.TrimSuffix(after, ".slice"), "-", "_")
+	}
+	if strings.HasPrefix(name, "pod") && len(name) > 3 {
+		return strings.ReplaceAll(name[3:], "-", "_")
+	}
+	return ""
+}
+
+// cgroupPods returns cgroup dirs of pods on node, key=podID
+func cgroupPods(root string) map[string]string {
+	res := map[string]string{}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		depth := strings.Count(rel, string(filepath.Separator))
+		if depth == 0 && !strings.HasPrefix(d.Name(), "kubepods") {
+			return filepath.SkipDir
+		}
+		if depth > 2 {
+			return filepath.SkipDir
+		}
+		if podID := cgroupPodID(d.Name()); podID != "" {
+			res[podID] = path
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return res
+}
+
+// readKeyValues reads flat keyed file, eg. cpu.stat or memory.events
+func readKeyValues(path string) map[string]uint64 {
+	res := map[string]uint64{}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return res
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, _ := strconv.ParseUint(fields[1], 10, 64)
+		res[fields[0]] = v
+	}
+	return res
+}
+
+func readUint(path string) uint64 {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64) // "max" = 0
+	return v
+}
+
+func readPodCgroup(dir string) cgroupStatsS {
+	s := cgroupStatsS{}
+
+	cpu := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	s.CPUUsage = cpu["usage_usec"]
+	s.CPUThrottled = cpu["throttled_usec"]
+
+	s.MemCurrent = readUint(filepath.Join(dir, "memory.current"))
+	s.MemInactive = readKeyValues(filepath.Join(dir, "memory.stat"))["inactive_file"]
+	s.MemMax = readUint(filepath.Join(dir, "memory.max"))
+	s.OOMKills = readKeyValues(filepath.Join(dir, "memory.events"))["oom_kill"]
+
+	// io.stat: `8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0`
+	if buf, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		for _, field := range strings.Fields(string(buf)) {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseUint(v, 10, 64)
+			switch k {
+			case "rbytes":
+				s.IORead += n
+			case "wbytes":
+				s.IOWrite += n
+			}
+		}
+	}
+
+	if pid := cgroupPid(dir); pid != "" {
+		s.NetRx, s.NetTx = readNetDev(filepath.Join("/proc", pid, "net", "dev"))
+	}
+	return s
+}
+
+// cgroupPid returns any process of pod, processes are in cgroups of containers
+func cgroupPid(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if pid := cgroupFirstPid(filepath.Join(dir, e.Name())); pid != "" {
+			return pid
+		}
+	}
+	return ""
+}
+
+// cgroupFirstPid returns first process of cgroup, empty without processes
+func cgroupFirstPid(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text())
+	}
+	return ""
+}
+
+// readContainers returns CPU and memory of containers of pod which have
+// previous sample, pause container is skipped
+func readContainers(dir string, now time.Time, seen map[string]bool) []containerCgroupMetricS {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	res := []containerCgroupMetricS{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		cDir := filepath.Join(dir, e.Name())
+		pid := cgroupFirstPid(cDir)
+		if pid == "" {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		name := strings.TrimSpace(string(comm))
+		if err != nil || name == "pause" {
+			continue
+		}
+
+		cur := cgroupStatsS{
+			CPUUsage:   readKeyValues(filepath.Join(cDir, "cpu.stat"))["usage_usec"],
+			MemCurrent: readUint(filepath.Join(cDir, "memory.current")),
+		}
+		prev, ok := containerSamples[cDir]
+		containerSamples[cDir] = cgroupSampleS{stats: cur, time: now}
+		seen[cDir] = true
+		if !ok {
+			continue
+		}
+
+		res = append(res, containerCgroupMetricS{
+			Name:   name,
+			CPU:    math.Round(1000*counterRate(cur.CPUUsage, prev.stats.CPUUsage, now.Sub(prev.time).Seconds())/1e6) / 10,
+			Memory: float64(cur.MemCurrent / 1024),
+		})
+	}
+	return res
+}
+
+// readNetDev sums bytes of interfaces except loopback
+func readNetDev(path string) (rx, tx uint64) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		iface, data, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(data)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
+
+// counterRate returns change of counter per second, reset of counter is 0
+func counterRate(cur, prev uint64, sec float64) float64 {
+	if cur < prev || sec <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / sec
+}
+
+// cgroupMetrics reads cgroups of pods on node and returns metrics of pods
+// which have previous sample, key=podID, root is cgroup v2 mount
+func cgroupMetrics(root string) map[string]podCgroupMetricS {
+	if root == "" {
+		if !cgroupV1Once {
+			cgroupV1Once = true
+			tlog.Warning("cgroup v2 not found, CPU and memory are read from processes, per-pod I/O, network and OOM metrics are disabled")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	res := map[string]podCgroupMetricS{}
+	pods := cgroupPods(root)
+	seen := map[string]bool{}
+	for podID, dir := range pods {
+		containers := readContainers(dir, now, seen)
+		cur := readPodCgroup(dir)
+		prev, ok := cgroupSamples[podID]
+		cgroupSamples[podID] = cgroupSampleS{stats: cur, time: now}
+		if !ok {
+			continue
+		}
+
+		sec := now.Sub(prev.time).Seconds()
+		ws := cur.MemCurrent
+		if cur.MemInactive < ws {
+			ws -= cur.MemInactive
+		}
+		res[podID] = podCgroupMetricS{
+			CPU:          math.Round(1000*counterRate(cur.CPUUsage, prev.stats.CPUUsage, sec)/1e6) / 10,
+			Memory:       float64(cur.MemCurrent / 1024),
+			Containers:   containers,
+			CPUThrottled: 100 * counterRate(cur.CPUThrottled, prev.stats.CPUThrottled, sec) / 1e6,
+			WorkingSet:   float64(ws / 1024),
+			MemLimit:     float64(cur.MemMax / 1024),
+			OOMKills:     float64(cur.OOMKills),
+			DiskRead:     counterRate(cur.IORead, prev.stats.IORead, sec) / 1024,
+			DiskWrite:    counterRate(cur.IOWrite, prev.stats.IOWrite, sec) / 1024,
+			NetRx:        counterRate(cur.NetRx, prev.stats.NetRx, sec) / 1024,
+			NetTx:        counterRate(cur.NetTx, prev.stats.NetTx, sec) / 1024,
+		}
+	}
+
+	for podID := range cgroupSamples {
+		if _, ok := pods[podID]; !ok {
+			delete(cgroupSamples, podID)
+		}
+	}
+	for dir := range containerSamples {
+		if !seen[dir] {
+			delete(containerSamples, dir)
+		}
+	}
+	return res
+}
+
+// --- cgroup v1, processes are scanned
+
+// parsePidsCgroups parses output of `ps -eo pid,cgroup`, key=pid, processes
+// without cgroup are skipped
+func parsePidsCgroups(out string) map[int32]string {
+	res := map[int32]string{}
+	lines := strings.Split(out, "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] == "-" {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if tlog.Error(err) != nil {
+			continue
+		}
+		res[int32(pid)] = fields[1]
+	}
+	return res
+}
+
+// processPodID returns ID of pod from cgroup of process, eg.
+// `0::/kubepods.slice/.../kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope`
+// or `12:memory:/kubepods/burstable/pod<uid>/<id>`, emptyPodID when process
+// is not in pod
+func processPodID(cgroup string) string {
+	podID := emptyPodID
+
+	// systemd driver
+	for _, str := range strings.Split(cgroup, "/") {
+		if strings.Contains(str, "kubepods") {
+			_, after, found := strings.Cut(str, "-pod")
+			if found && strings.HasSuffix(after, ".slice") {
+				podID = strings.TrimSuffix(after, ".slice")
+			}
+		}
+	}
+
+	if podID == emptyPodID {
+		// cgroupfs driver
+		for _, str := range strings.Split(cgroup, "/") {
+			if strings.HasPrefix(str, "pod") && len(str) > 3 {
+				podID = str[3:]
+			}
+		}
+	}
+
+	if podID == emptyPodID {
+		return podID
+	}
+	return strings.ReplaceAll(podID, "-", "_")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testPod1 = "testdata/cgroup-v2/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1111_aaaa.slice"
+	testPod2 = "testdata/cgroup-v2/kubepods.slice/kubepods-pod2222_bbbb.slice"
+)
+
+func TestCgroupPodID(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"kubepods-burstable-pod1111_aaaa.slice", "1111_aaaa"},
+		{"kubepods-pod2222_bbbb.slice", "2222_bbbb"},
+		{"pod3333-cccc", "3333_cccc"},
+		{"kubepods-burstable.slice", ""},
+		{"cri-containerd-abc.scope", ""},
+		{"pod", ""},
+	}
+	for _, tt := range tests {
+		if got := cgroupPodID(tt.name); got != tt.want {
+			t.Errorf("cgroupPodID(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCgroupPods(t *testing.T) {
+	tests := []struct {
+		root string
+		want map[string]string
+	}{
+		{"testdata/cgroup-v2", map[string]string{
+			"1111_aaaa": testPod1,
+			"2222_bbbb": testPod2,
+		}},
+		{"testdata/cgroup-v2-cgroupfs", map[string]string{
+			"3333_cccc": "testdata/cgroup-v2-cgroupfs/kubepods/burstable/pod3333-cccc",
+		}},
+		{"testdata/missing", map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := cgroupPods(tt.root); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("cgroupPods(%q) = %v, want %v", tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestReadPodCgroup(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want cgroupStatsS
+	}{
+		{testPod1, cgroupStatsS{
+			CPUUsage:     5000000,
+			CPUThrottled: 250000,
+			MemCurrent:   104857600,
+			MemInactive:  20971520,
+			MemMax:       268435456,
+			OOMKills:     2,
+			IORead:       5120,
+			IOWrite:      8192,
+		}},
+		// memory.max is `max`, no io.stat
+		{testPod2, cgroupStatsS{
+			CPUUsage:   100,
+			MemCurrent: 2048,
+		}},
+		{"testdata/missing", cgroupStatsS{}},
+	}
+	for _, tt := range tests {
+		if got := readPodCgroup(tt.dir); got != tt.want {
+			t.Errorf("readPodCgroup(%q) = %+v, want %+v", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestReadNetDev(t *testing.T) {
+	rx, tx := readNetDev("testdata/net-dev")
+	if rx != 2049000 || tx != 1024500 {
+		t.Errorf("readNetDev() = %d, %d, want 2049000, 1024500 without loopback", rx, tx)
+	}
+	if rx, tx := readNetDev("testdata/missing"); rx != 0 || tx != 0 {
+		t.Errorf("readNetDev() of missing file = %d, %d", rx, tx)
+	}
+}
+
+func TestCgroupMetrics(t *testing.T) {
+	cgroupSamples = map[string]cgroupSampleS{}
+
+	if got := cgroupMetrics(""); got != nil {
+		t.Errorf("cgroupMetrics() on cgroup v1 = %v, want nil", got)
+	}
+
+	// first sample has nothing to compare with
+	if got := cgroupMetrics("testdata/cgroup-v2"); len(got) != 0 {
+		t.Fatalf("cgroupMetrics() first sample = %v", got)
+	}
+
+	got := cgroupMetrics("testdata/cgroup-v2")
+	if len(got) != 2 {
+		t.Fatalf("cgroupMetrics() = %v, want 2 pods", got)
+	}
+	want := podCgroupMetricS{
+		Memory:     102400,
+		WorkingSet: 81920, // memory.current - inactive_file
+		MemLimit:   262144,
+		OOMKills:   2,
+		Containers: []containerCgroupMetricS{},
+	}
+	if m := got["1111_aaaa"]; !reflect.DeepEqual(m, want) {
+		t.Errorf("cgroupMetrics() pod = %+v, want %+v", m, want)
+	}
+	if m := got["2222_bbbb"]; m.MemLimit != 0 || m.Memory != 2 {
+		t.Errorf("cgroupMetrics() pod without limit = %+v", m)
+	}
+}
+
+func TestPodCgroupMetricAdd(t *testing.T) {
+	sum := podCgroupMetricS{}
+	sum.add(podCgroupMetricS{CPU: 10, CPUThrottled: 5, WorkingSet: 100, MemLimit: 200, OOMKills: 1, NetRx: 3})
+	sum.add(podCgroupMetricS{CPU: 20, CPUThrottled: 2, WorkingSet: 50, NetRx: 1})
+
+	want := podCgroupMetricS{CPU: 30, CPUThrottled: 5, WorkingSet: 150, MemLimit: 200, OOMKills: 1, NetRx: 4}
+	if !reflect.DeepEqual(sum, want) {
+		t.Errorf("add() = %+v, want %+v", sum, want)
+	}
+}
+
+func TestParsePidsCgroups(t *testing.T) {
+	out, err := os.ReadFile(filepath.Join("testdata", "cgroup-v1", "ps.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parsePidsCgroups(string(out))
+
+	tests := []struct {
+		pid    int32
+		podID  string
+		exists bool
+	}{
+		{1, "", false}, // no cgroup
+		{812, emptyPodID, true},
+		{1001, "1111_aaaa", true},
+		{1002, "2222_bbbb", true},
+		{1003, "3333_cccc", true},
+	}
+	for _, tt := range tests {
+		cgroup, ok := got[tt.pid]
+		if ok != tt.exists {
+			t.Errorf("parsePidsCgroups() pid %d exists = %v, want %v", tt.pid, ok, tt.exists)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if podID := processPodID(cgroup); podID != tt.podID {
+			t.Errorf("processPodID(%q) = %q, want %q", cgroup, podID, tt.podID)
+		}
+	}
+}
+
+func TestProcessPodID(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{"0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1111_aaaa.slice/cri-containerd-abc.scope", "1111_aaaa"},
+		{"0::/kubepods.slice/kubepods-pod2222_bbbb.slice/cri-containerd-abc.scope", "2222_bbbb"},
+		{"12:memory:/kubepods/burstable/pod3333-cccc/0f1e2d", "3333_cccc"},
+		{"0::/kubepods.slice/kubepods-burstable.slice", emptyPodID},
+		{"0::/system.slice/containerd.service", emptyPodID},
+	}
+	for _, tt := range tests {
+		if got := processPodID(tt.cgroup); got != tt.want {
+			t.Errorf("processPodID(%q) = %q, want %q", tt.cgroup, got, tt.want)
+		}
+	}
+}
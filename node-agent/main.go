@@ -14,7 +14,6 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"time"
 
@@ -35,20 +34,34 @@ type metricDataS struct {
 }
 
 type podCacheData struct {
-	EnvID       string `json:"EnvID"`
-	ElementName string `json:"ElementName"`
+	EnvID        string `json:"EnvID"`
+	ElementName  string `json:"ElementName"`
+	RestartCount int    `json:"RestartCount"`
 }
 
 type podMetric struct {
 	CPU         MagicSlice
 	RSS         MagicSlice
 	ElementName string
+
+	// from cgroup v2, see cgroup.go
+	CPUThrottled MagicSlice // % of time
+	WorkingSet   MagicSlice // KiB
+	DiskRead     MagicSlice // KiB/s
+	DiskWrite    MagicSlice // KiB/s
+	NetRx        MagicSlice // KiB/s
+	NetTx        MagicSlice // KiB/s
+	MemLimit     float64    // KiB, 0 = no limit
+	OOMKills     float64    // since start of pod
+	Restarts     float64
 }
 
 type tmpMetric struct {
 	CPU         float64
 	RSS         float64
 	ElementName string
+	Cgroup      *podCgroupMetricS
+	Restarts    int
 }
 
 type MagicSlice struct {
@@ -85,131 +98,121 @@ func main() {
 	exec.Command("/sbin/sysctl", "-w", "vm.max_map_count=262144").Run()
 
 	for {
-		processData := initProcesses()
-		var md []metricDataS
 		tmp := maps.NewSafe[string, *maps.SafeMap[string, *tmpMetric]](nil)
-		for _, pd := range processData {
+		root := cgroupRoot()
 
-			// ---
+		var md []metricDataS
+		if root == "" {
+			// cgroup v1, CPU and memory of pods are summed from processes
+			md = processMetrics(nodeIP, tmp)
+		}
+		md = append(md, podCgroupMetrics(nodeIP, root, tmp)...)
 
-			processName, err := pd.P.Name()
-			if err != nil {
-				continue
-			}
+		go updatePodMetricMap(tmp.Iter())
+		go send(md)
 
-			if !strings.Contains(pd.Cgroup, "kubepods") {
-				continue
-			}
+		time.Sleep(1 * time.Second)
+	}
+}
 
-			podID := emptyPodID
-
-			// cgroup v2
-			for _, str := range strings.Split(pd.Cgroup, "/") {
-				if strings.Contains(str, "kubepods") {
-					// tlog.PrintJSON(pd)
-					_, after, found := strings.Cut(str, "-pod")
-					if found {
-						if len(after) > 0 {
-							podID = after[:len(after)-6]
-						}
-					}
-				}
-			}
+// processMetrics returns CPU and memory of processes of pods and sums them
+// to metrics of elements in tmp, used on cgroup v1 only
+func processMetrics(nodeIP string, tmp *maps.SafeMap[string, *maps.SafeMap[string, *tmpMetric]]) []metricDataS {
+	processData := initProcesses()
+	var md []metricDataS
+	for _, pd := range processData {
 
-			if podID == emptyPodID {
-				// cgroup v1
-				for _, str := range strings.Split(pd.Cgroup, "/") {
-					if strings.HasPrefix(str, "pod") {
-						podID = str[3:]
-					}
-				}
-			}
+		// ---
 
-			if podID == emptyPodID {
-				tlog.Warning("podID is empty", tlog.Vars{
-					"pd.Cgroup": pd.Cgroup,
-					"podID":     podID,
-				})
+		processName, err := pd.P.Name()
+		if err != nil {
+			continue
+		}
 
-			} else {
-				podID = strings.ReplaceAll(podID, "-", "_")
-			}
+		if !strings.Contains(pd.Cgroup, "kubepods") {
+			continue
+		}
 
-			if processName == "pause" && podID != "" {
-				// skip pause process
-				continue
-			}
+		podID := processPodID(pd.Cgroup)
 
-			// ---
+		if podID == emptyPodID {
+			tlog.Warning("podID is empty", tlog.Vars{
+				"pd.Cgroup": pd.Cgroup,
+				"podID":     podID,
+			})
+		}
 
-			cpuCurrent, err := pd.CPUCurrentUtilization()
-			if err != nil {
-				continue
-			}
-			cpuCurrent = float64(math.Round(cpuCurrent*10) / 10)
+		if processName == "pause" && podID != "" {
+			// skip pause process
+			continue
+		}
 
-			memInfo, err := pd.P.MemoryInfo()
-			if tlog.Error(err) != nil {
-				continue
-			}
+		// ---
 
-			// ---------------------------------
-			podData := podCacheMap.Get(podID)
+		cpuCurrent, err := pd.CPUCurrentUtilization()
+		if err != nil {
+			continue
+		}
+		cpuCurrent = float64(math.Round(cpuCurrent*10) / 10)
 
-			if podData.EnvID == "" {
-				tlog.Warning("podData.EnvID is empty", tlog.Vars{
-					"podID": podID,
-				})
-				tlog.PrintJSON(podCacheMap)
-			}
+		memInfo, err := pd.P.MemoryInfo()
+		if tlog.Error(err) != nil {
+			continue
+		}
 
-			tags := map[string]string{
-				"name": processName,
-				// "pod_id":  podID,
-				"node_ip": nodeIP,
-				"env_id":  podData.EnvID,
-				"element": podData.ElementName,
-			}
-			for k, v := range tags {
-				if v == "" {
-					tags[k] = "-"
-				}
-			}
+		// ---------------------------------
+		podData := podCacheMap.Get(podID)
 
-			if podData.EnvID != "" && podData.ElementName != "" {
-				envMap := tmp.Get(podData.EnvID)
-				if envMap == nil {
-					envMap = maps.NewSafe[string, *tmpMetric](nil)
-					tmp.Set(podData.EnvID, envMap)
-				}
+		if podData.EnvID == "" {
+			tlog.Warning("podData.EnvID is empty", tlog.Vars{
+				"podID": podID,
+			})
+			tlog.PrintJSON(podCacheMap)
+		}
 
-				podMap := envMap.Get(podID)
-				if podMap == nil {
-					podMap = &tmpMetric{ElementName: podData.ElementName}
-					envMap.Set(podID, podMap)
-				}
-				podMap.CPU += cpuCurrent
-				podMap.RSS += float64(memInfo.RSS / 1024) // KiB
+		tags := map[string]string{
+			"name": processName,
+			// "pod_id":  podID,
+			"node_ip": nodeIP,
+			"env_id":  podData.EnvID,
+			"element": podData.ElementName,
+		}
+		for k, v := range tags {
+			if v == "" {
+				tags[k] = "-"
+			}
+		}
+
+		if podData.EnvID != "" && podData.ElementName != "" {
+			envMap := tmp.Get(podData.EnvID)
+			if envMap == nil {
+				envMap = maps.NewSafe[string, *tmpMetric](nil)
+				tmp.Set(podData.EnvID, envMap)
 			}
 
-			md = append(md,
-				metricDataS{
-					Metric: "timoni_process_cpu_utilization",
-					Value:  cpuCurrent,
-					Tags:   tags,
-				},
-				metricDataS{
-					Metric: "timoni_process_rss_utilization",
-					Value:  float64(memInfo.RSS / 1024), // KiB
-					Tags:   tags,
-				},
-			)
+			podMap := envMap.Get(podID)
+			if podMap == nil {
+				podMap = &tmpMetric{ElementName: podData.ElementName}
+				envMap.Set(podID, podMap)
+			}
+			podMap.CPU += cpuCurrent
+			podMap.RSS += float64(memInfo.RSS / 1024) // KiB
 		}
-		go updatePodMetricMap(tmp.Iter())
-		go send(md)
 
-		time.Sleep(1 * time.Second)
+		md = append(md,
+			metricDataS{
+				Metric: "timoni_process_cpu_utilization",
+				Value:  cpuCurrent,
+				Tags:   tags,
+			},
+			metricDataS{
+				Metric: "timoni_process_rss_utilization",
+				Value:  float64(memInfo.RSS / 1024), // KiB
+				Tags:   tags,
+			},
+		)
 	}
+	return md
 }
 
 func updatePodMetricMap(iter types.Iterator[string, *maps.SafeMap[string, *tmpMetric]]) {
@@ -223,20 +226,135 @@ func updatePodMetricMap(iter types.Iterator[string, *maps.SafeMap[string, *tmpMe
 			podMetr := podMap.Get(vv.Key)
 			if podMetr == nil {
 				podMetr = &podMetric{
-					CPU:         MagicSlice{slice.NewRigid[int32](timeRange).Safe()},
-					RSS:         MagicSlice{slice.NewRigid[int32](timeRange).Safe()},
-					ElementName: vv.Value.ElementName,
+					CPU:          newMagicSlice(),
+					RSS:          newMagicSlice(),
+					ElementName:  vv.Value.ElementName,
+					CPUThrottled: newMagicSlice(),
+					WorkingSet:   newMagicSlice(),
+					DiskRead:     newMagicSlice(),
+					DiskWrite:    newMagicSlice(),
+					NetRx:        newMagicSlice(),
+					NetTx:        newMagicSlice(),
 				}
 				podMap.Set(vv.Key, podMetr)
 			}
 			podMetr.CPU.Add(int32(math.Floor(vv.Value.CPU)))
 			podMetr.RSS.Add(int32(vv.Value.RSS))
+			if c := vv.Value.Cgroup; c != nil {
+				podMetr.CPUThrottled.Add(int32(math.Round(c.CPUThrottled)))
+				podMetr.WorkingSet.Add(int32(c.WorkingSet))
+				podMetr.DiskRead.Add(int32(c.DiskRead))
+				podMetr.DiskWrite.Add(int32(c.DiskWrite))
+				podMetr.NetRx.Add(int32(c.NetRx))
+				podMetr.NetTx.Add(int32(c.NetTx))
+				podMetr.MemLimit = c.MemLimit
+				podMetr.OOMKills = c.OOMKills
+			}
+			podMetr.Restarts = float64(vv.Value.Restarts)
 
 		}
 	}
 	updatePodInfo()
 }
 
+// podCgroupMetrics returns metrics of pods read from cgroups and adds them to
+// metrics of elements in tmp. Series are summed per element, like process
+// metrics without pod_id, so restarts of pods don't create new ones. CPU and
+// memory of containers are sent as process metrics.
+func podCgroupMetrics(nodeIP, root string, tmp *maps.SafeMap[string, *maps.SafeMap[string, *tmpMetric]]) []metricDataS {
+	elements := map[elementKeyS]*podCgroupMetricS{}
+	restarts := map[elementKeyS]float64{}
+	containers := map[elementKeyS]*containerCgroupMetricS{}
+
+	for podID, m := range cgroupMetrics(root) {
+		podData := podCacheMap.Get(podID)
+
+		if podData.EnvID != "" && podData.ElementName != "" {
+			envMap := tmp.Get(podData.EnvID)
+			if envMap == nil {
+				envMap = maps.NewSafe[string, *tmpMetric](nil)
+				tmp.Set(podData.EnvID, envMap)
+			}
+			podMap := envMap.Get(podID)
+			if podMap == nil {
+				podMap = &tmpMetric{ElementName: podData.ElementName}
+				envMap.Set(podID, podMap)
+			}
+			m := m
+			podMap.Cgroup = &m
+			podMap.Restarts = podData.RestartCount
+			podMap.CPU = m.CPU
+			podMap.RSS = m.Memory
+		}
+
+		key := elementKeyS{EnvID: podData.EnvID, Element: podData.ElementName}
+		if elements[key] == nil {
+			elements[key] = &podCgroupMetricS{}
+		}
+		elements[key].add(m)
+		restarts[key] += float64(podData.RestartCount)
+
+		for _, c := range m.Containers {
+			cKey := key
+			cKey.Name = c.Name
+			if containers[cKey] == nil {
+				containers[cKey] = &containerCgroupMetricS{Name: c.Name}
+			}
+			containers[cKey].CPU += c.CPU
+			containers[cKey].Memory += c.Memory
+		}
+	}
+
+	var md []metricDataS
+	for key, c := range containers {
+		tags := key.tags(nodeIP)
+		md = append(md,
+			metricDataS{Metric: "timoni_process_cpu_utilization", Value: c.CPU, Tags: tags},
+			metricDataS{Metric: "timoni_process_rss_utilization", Value: c.Memory, Tags: tags},
+		)
+	}
+	for key, m := range elements {
+		tags := key.tags(nodeIP)
+		md = append(md,
+			metricDataS{Metric: "timoni_pod_cpu_throttled", Value: m.CPUThrottled, Tags: tags},
+			metricDataS{Metric: "timoni_pod_memory_working_set", Value: m.WorkingSet, Tags: tags},
+			metricDataS{Metric: "timoni_pod_memory_limit", Value: m.MemLimit, Tags: tags},
+			metricDataS{Metric: "timoni_pod_oom_kills", Value: m.OOMKills, Tags: tags},
+			metricDataS{Metric: "timoni_pod_restarts", Value: restarts[key], Tags: tags},
+			metricDataS{Metric: "timoni_pod_disk_read", Value: m.DiskRead, Tags: tags},
+			metricDataS{Metric: "timoni_pod_disk_write", Value: m.DiskWrite, Tags: tags},
+			metricDataS{Metric: "timoni_pod_network_rx", Value: m.NetRx, Tags: tags},
+			metricDataS{Metric: "timoni_pod_network_tx", Value: m.NetTx, Tags: tags},
+		)
+	}
+	return md
+}
+
+// elementKeyS identifies series of element on node, Name is set for
+// containers only
+type elementKeyS struct {
+	EnvID   string
+	Element string
+	Name    string
+}
+
+func (k elementKeyS) tags(nodeIP string) map[string]string {
+	tags := map[string]string{
+		"node_ip": nodeIP,
+		"env_id":  k.EnvID,
+		"element": k.Element,
+	}
+	if k.Name != "" {
+		tags["name"] = k.Name
+	}
+	for key, v := range tags {
+		if v == "" {
+			tags[key] = "-"
+		}
+	}
+	return tags
+}
+
 func initProcesses() []ProcessData {
 	processes, errP := process.Processes()
 	tlog.Fatal(errP)
@@ -306,20 +424,7 @@ func getPidsCgroupsMap() map[int32]string {
 		})
 		return nil
 	}
-	pidsCgroups := strings.Split(string(out), "\n")[1:]
-	pidsCgroups = pidsCgroups[:len(pidsCgroups)-1]
-	pidsCgroupsMap := make(map[int32]string)
-
-	for _, pc := range pidsCgroups {
-		pcs := strings.Split(strings.TrimSpace(pc), " ")
-		if pcs[1] != "-" {
-			pid, errA := strconv.Atoi(pcs[0])
-			tlog.Fatal(errA)
-			pidsCgroupsMap[int32(pid)] = pcs[1]
-		}
-	}
-
-	return pidsCgroupsMap
+	return parsePidsCgroups(string(out))
 }
 
 func updatePodInfo() {
@@ -369,10 +474,18 @@ func deleteOldMetrics() {
 	}
 }
 
+func newMagicSlice() MagicSlice {
+	return MagicSlice{slice.NewRigid[int32](timeRange).Safe()}
+}
+
 func (m *MagicSlice) MarshalJSON() ([]byte, error) {
 	// we calculate the average value of the metric
 	// for the last 15 minutes
 
+	if m.Len() == 0 {
+		// metrics of cgroups are missing on cgroup v1
+		return json.Marshal(0)
+	}
 	var avg float64 = 0
 	for _, c := range m.GetAll() {
 		avg += float64(c)